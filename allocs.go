@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/google/pprof/profile"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+func init() {
+	lineMagics["allocs"] = allocsMagic
+}
+
+// cellAllocation is the memory allocated while a cell ran.
+type cellAllocation struct {
+	cell          string
+	code          string
+	bytes, allocs uint64
+
+	// top is the function that allocated the most bytes in the cell, empty unless the heap profile is sampled.
+	top string
+}
+
+// allocTracker records the memory allocated by each cell of the session.
+type allocTracker struct {
+	// sample is set by `%allocs sample on`: the heap profile is then read around each cell, to attribute its
+	// allocations to functions.
+	sample bool
+
+	cells []cellAllocation
+
+	// funcs maps the functions that allocated memory in sampled cells to the bytes they allocated.
+	funcs map[string]int64
+}
+
+// allocSnapshot is the state of the heap when a cell starts.
+type allocSnapshot struct {
+	stats runtime.MemStats
+
+	// funcs maps the functions of the heap profile to the bytes they allocated so far, nil unless sampled.
+	funcs map[string]*profileFunc
+}
+
+// cellAllocs tracks the allocations of the cells run by the kernel.
+var cellAllocs = &allocTracker{funcs: make(map[string]int64)}
+
+// start returns the state of the heap before a cell runs.
+func (t *allocTracker) start() *allocSnapshot {
+	s := &allocSnapshot{}
+	if t.sample {
+		s.funcs = heapProfileFuncs()
+	}
+	runtime.ReadMemStats(&s.stats)
+	return s
+}
+
+// record records the memory allocated by the cell with the given label and code since it started. The counts
+// include the allocations of the goroutines running meanwhile, like those the cell started.
+func (t *allocTracker) record(cell, code string, start *allocSnapshot) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	c := cellAllocation{
+		cell:   cell,
+		code:   code,
+		bytes:  stats.TotalAlloc - start.stats.TotalAlloc,
+		allocs: stats.Mallocs - start.stats.Mallocs,
+	}
+	if start.funcs != nil {
+		var topBytes int64
+		for name, f := range heapProfileFuncs() {
+			allocated := f.self
+			if before := start.funcs[name]; before != nil {
+				allocated -= before.self
+			}
+			if allocated <= 0 {
+				continue
+			}
+			t.funcs[name] += allocated
+			if allocated > topBytes || allocated == topBytes && name < c.top {
+				c.top, topBytes = name, allocated
+			}
+		}
+	}
+	t.cells = append(t.cells, c)
+}
+
+// heapProfileFuncs returns the bytes allocated so far by the functions of the heap profile, or nil if it cannot
+// be read. The profile is as of the last garbage collection, so it runs one first.
+func heapProfileFuncs() map[string]*profileFunc {
+	runtime.GC()
+	var buf bytes.Buffer
+	if err := pprof.Lookup("allocs").WriteTo(&buf, 0); err != nil {
+		return nil
+	}
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		return nil
+	}
+	funcs, _ := profileFuncs(p, "alloc_space")
+	return funcs
+}
+
+// allocsMagic implements `%allocs [-top n]`, which shows the n cells of the session that allocated the most
+// memory, and the n functions that did when the heap profile is sampled, `%allocs sample on|off`, which turns
+// the sampling on or off, and `%allocs reset`, which forgets the allocations recorded so far.
+func allocsMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "sample":
+			on, err := parseSwitch(args[1:])
+			cellAllocs.sample = on && err == nil
+			return err
+		case "reset":
+			cellAllocs.cells, cellAllocs.funcs = nil, make(map[string]int64)
+			return nil
+		}
+	}
+
+	flags := flag.NewFlagSet("allocs", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	top := flags.Int("top", 10, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *top < 1 {
+		return fmt.Errorf("expected [-top n], sample on|off or reset, got %q", strings.Join(args, " "))
+	}
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	if err := receipt.PublishDisplayData(bundledMIMEData(cellAllocs.cellsTable(*top)), nil, ""); err != nil {
+		return err
+	}
+	if len(cellAllocs.funcs) == 0 {
+		return nil
+	}
+	return receipt.PublishDisplayData(bundledMIMEData(cellAllocs.funcsTable(*top)), nil, "")
+}
+
+// cellsTable returns the n cells that allocated the most bytes, in a table.
+func (t *allocTracker) cellsTable(n int) display.Data {
+	cells := append([]cellAllocation(nil), t.cells...)
+	sort.SliceStable(cells, func(i, j int) bool { return cells[i].bytes > cells[j].bytes })
+	if len(cells) > n {
+		cells = cells[:n]
+	}
+	rows := make([][]string, len(cells))
+	for i, c := range cells {
+		rows[i] = []string{c.cell, formatBytes(uintptr(c.bytes)), fmt.Sprint(c.allocs), c.top, firstLine(c.code, 40)}
+	}
+	return display.Table([]string{"cell", "allocated", "allocations", "top function", "code"}, rows)
+}
+
+// funcsTable returns the n functions that allocated the most bytes in the sampled cells, in a table.
+func (t *allocTracker) funcsTable(n int) display.Data {
+	var total int64
+	names := make([]string, 0, len(t.funcs))
+	for name, allocated := range t.funcs {
+		names = append(names, name)
+		total += allocated
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := t.funcs[names[i]], t.funcs[names[j]]
+		return a > b || a == b && names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	rows := make([][]string, len(names))
+	for i, name := range names {
+		allocated := t.funcs[name]
+		rows[i] = []string{formatBytes(uintptr(allocated)), fmt.Sprintf("%.2f%%", 100*float64(allocated)/float64(total)), name}
+	}
+	return display.Table([]string{"allocated", "share", "function"}, rows)
+}
+
+// firstLine returns the first non-blank line of code, shortened to n runes with an ellipsis.
+func firstLine(code string, n int) string {
+	var line string
+	for _, line = range strings.Split(code, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			break
+		}
+	}
+	if runes := []rune(line); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return line
+}
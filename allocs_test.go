@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestAllocTracker tests recording the allocations of cells and reporting those allocating the most.
+func TestAllocTracker(t *testing.T) {
+	tracker := &allocTracker{sample: true, funcs: make(map[string]int64)}
+	var sink [][]byte
+
+	start := tracker.start()
+	for i := 0; i < 256; i++ {
+		sink = append(sink, make([]byte, 64<<10))
+	}
+	tracker.record("In [1]", "\n  sink := make([]byte, 4<<20) // a long comment after the code\n", start)
+	start = tracker.start()
+	tracker.record("In [2]", "x := 1", start)
+	_ = sink
+
+	if len(tracker.cells) != 2 || tracker.cells[0].bytes < 16<<20 || tracker.cells[0].allocs < 256 {
+		t.Fatalf("\t%s Expected the first cell to allocate 16 MiB in 256 allocations, got %+v", failure, tracker.cells)
+	}
+	if tracker.cells[0].top == "" || len(tracker.funcs) == 0 {
+		t.Errorf("\t%s Expected the sampled heap profile to name the function allocating, got %+v", failure, tracker.cells[0])
+	}
+
+	lines := strings.Split(tableLines(tracker.cellsTable(1).Text()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "In [1] 16.") ||
+		!strings.HasSuffix(lines[1], "sink := make([]byte, 4<<20) // a long c…") {
+		t.Errorf("\t%s Expected the cells table to show the first cell, got\n%s", failure, strings.Join(lines, "\n"))
+	}
+	if text := tracker.funcsTable(10).Text(); !strings.Contains(text, "share") || !strings.Contains(text, tracker.cells[0].top) {
+		t.Errorf("\t%s Expected the functions table to show %s, got\n%s", failure, tracker.cells[0].top, text)
+	}
+}
+
+// TestAllocsMagic tests the arguments of `%allocs`.
+func TestAllocsMagic(t *testing.T) {
+	defer func(sample bool) { cellAllocs.sample = sample }(cellAllocs.sample)
+	ir := newInterp()
+	cases := []struct {
+		code string
+		ok   bool
+	}{
+		{"%allocs sample on", true},
+		{"%allocs sample maybe", false},
+		{"%allocs reset", true},
+		{"%allocs -top 0", false},
+		{"%allocs extra", false},
+	}
+	for _, c := range cases {
+		if _, err := evalCell(ir, nil, c.code); (err == nil) != c.ok {
+			t.Errorf("\t%s Expected %q to succeed: %v, got %v", failure, c.code, c.ok, err)
+		}
+	}
+	if cellAllocs.sample {
+		t.Errorf("\t%s Expected an invalid %%allocs sample to turn the sampling off", failure)
+	}
+}
@@ -0,0 +1,141 @@
+// Package assert provides assertions for testing code in gophernotes notebooks. A failed assertion panics with a
+// *Failure, which fails the cell and is shown as a side-by-side diff of the expected and actual values.
+package assert
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// Failure is the value failed assertions panic with.
+type Failure struct {
+	// Message describes the failed assertion, followed by the message given to it, if any.
+	Message string
+
+	// Expected and Actual are the formatted values compared by the assertion, empty when it compares none.
+	Expected, Actual string
+}
+
+// Error returns the message of the failure, followed by a line diff of the values it compares.
+func (f *Failure) Error() string {
+	if f.Expected == "" && f.Actual == "" {
+		return f.Message
+	}
+	var b strings.Builder
+	b.WriteString(f.Message)
+	b.WriteString("\n--- expected\n+++ actual\n")
+	for _, line := range diffLines(f.Expected, f.Actual) {
+		b.WriteString(line.String())
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Data returns the failure as HTML, with the expected and actual values side by side and their differing lines
+// highlighted, and as the text of Error.
+func (f *Failure) Data() display.Data {
+	var htm bytes.Buffer
+	fmt.Fprintf(&htm, "<div><strong>%s</strong>", html.EscapeString(f.Message))
+	if f.Expected != "" || f.Actual != "" {
+		htm.WriteString(`<table style="font-family: monospace"><thead><tr><th>expected</th><th>actual</th></tr></thead><tbody>`)
+		for _, row := range sideBySide(diffLines(f.Expected, f.Actual)) {
+			htm.WriteString("<tr>")
+			for i, cell := range row {
+				style := ""
+				switch {
+				case cell.changed && i == 0:
+					style = ` style="background-color: #fdd"`
+				case cell.changed:
+					style = ` style="background-color: #dfd"`
+				}
+				fmt.Fprintf(&htm, `<td%s><pre style="margin: 0">%s</pre></td>`, style, html.EscapeString(cell.text))
+			}
+			htm.WriteString("</tr>")
+		}
+		htm.WriteString("</tbody></table>")
+	}
+	htm.WriteString("</div>")
+
+	return display.Data{
+		display.MIMETypeText: f.Error(),
+		display.MIMETypeHTML: htm.String(),
+	}
+}
+
+// fail panics with a failure described by format and args, followed by msgAndArgs, the message given to the
+// assertion and its arguments.
+func fail(expected, actual string, msgAndArgs []interface{}, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if len(msgAndArgs) > 0 {
+		if format, ok := msgAndArgs[0].(string); ok {
+			msg += ": " + fmt.Sprintf(format, msgAndArgs[1:]...)
+		} else {
+			msg += ": " + fmt.Sprint(msgAndArgs...)
+		}
+	}
+	panic(&Failure{Message: msg, Expected: expected, Actual: actual})
+}
+
+// Equal asserts that actual is deeply equal to expected, as reflect.DeepEqual reports. It may be followed by a
+// message and its arguments, formatted like fmt.Sprintf, describing the assertion.
+func Equal(expected, actual interface{}, msgAndArgs ...interface{}) {
+	if reflect.DeepEqual(expected, actual) {
+		return
+	}
+	want, got := Format(expected), Format(actual)
+	if want == got {
+		// The values only differ by their types, e.g. the int and int64 3.
+		want = fmt.Sprintf("%s (%T)", want, expected)
+		got = fmt.Sprintf("%s (%T)", got, actual)
+	}
+	fail(want, got, msgAndArgs, "values are not equal")
+}
+
+// NotEqual asserts that actual is not deeply equal to expected.
+func NotEqual(expected, actual interface{}, msgAndArgs ...interface{}) {
+	if reflect.DeepEqual(expected, actual) {
+		fail("", "", msgAndArgs, "values are equal: %s", Format(actual))
+	}
+}
+
+// True asserts that value is true.
+func True(value bool, msgAndArgs ...interface{}) {
+	if !value {
+		fail("", "", msgAndArgs, "value is false")
+	}
+}
+
+// NoError asserts that err is nil.
+func NoError(err error, msgAndArgs ...interface{}) {
+	if err != nil {
+		fail("", "", msgAndArgs, "unexpected error: %v", err)
+	}
+}
+
+// Error asserts that err is not nil.
+func Error(err error, msgAndArgs ...interface{}) {
+	if err == nil {
+		fail("", "", msgAndArgs, "expected an error, got nil")
+	}
+}
+
+// Panics asserts that fn panics, and returns the value it panics with.
+func Panics(fn func(), msgAndArgs ...interface{}) (value interface{}) {
+	panicked := true
+	func() {
+		defer func() {
+			value = recover()
+		}()
+		fn()
+		panicked = false
+	}()
+	if !panicked {
+		fail("", "", msgAndArgs, "function did not panic")
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+package assert
+
+import (
+	"strings"
+	"testing"
+)
+
+// failure returns the failure fn panics with, or nil.
+func failure(fn func()) (f *Failure) {
+	defer func() {
+		f, _ = recover().(*Failure)
+	}()
+	fn()
+	return nil
+}
+
+type point struct {
+	X, Y int
+	Name string
+}
+
+func TestEqual(t *testing.T) {
+	if f := failure(func() { Equal([]int{1, 2}, []int{1, 2}) }); f != nil {
+		t.Errorf("Equal() of equal values failed: %v", f)
+	}
+
+	f := failure(func() { Equal(3, int64(3), "answer of %s", "x") })
+	if f == nil || f.Message != "values are not equal: answer of x" || f.Expected != "3 (int)" || f.Actual != "3 (int64)" {
+		t.Errorf("Equal() of values of different types = %+v", f)
+	}
+
+	want := []point{{1, 2, "a"}, {3, 4, "b"}, {5, 6, "c"}}
+	got := []point{{1, 2, "a"}, {3, 5, "b"}, {5, 6, "c"}}
+	f = failure(func() { Equal(want, got) })
+	if f == nil {
+		t.Fatal("Equal() of different values did not fail")
+	}
+	text := f.Error()
+	if !strings.Contains(text, "- \tassert.point{X: 3, Y: 4, Name: \"b\"},\n+ \tassert.point{X: 3, Y: 5, Name: \"b\"},") ||
+		!strings.Contains(text, "  \tassert.point{X: 1, Y: 2, Name: \"a\"},") {
+		t.Errorf("Equal() failure does not diff the differing element:\n%s", text)
+	}
+	htm := f.Data()["text/html"].(string)
+	if strings.Count(htm, "#fdd") != 1 || strings.Count(htm, "#dfd") != 1 {
+		t.Errorf("Equal() failure does not highlight the differing lines side by side:\n%s", htm)
+	}
+}
+
+func TestFormatCycle(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	if got, want := Format(n), "&assert.node{Next: (*assert.node)(cycle)}"; got != want {
+		t.Errorf("Format() of a cycle = %q, want %q", got, want)
+	}
+}
+
+func TestPanics(t *testing.T) {
+	if got := Panics(func() { panic("boom") }); got != "boom" {
+		t.Errorf("Panics() = %v, want boom", got)
+	}
+	if f := failure(func() { Panics(func() {}) }); f == nil || f.Message != "function did not panic" {
+		t.Errorf("Panics() of a function returning = %+v", f)
+	}
+	if f := failure(func() { NoError(nil); Error(nil) }); f == nil || f.Message != "expected an error, got nil" {
+		t.Errorf("Error(nil) = %+v", f)
+	}
+}
@@ -0,0 +1,194 @@
+package assert
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxInline is the length beyond which the composite values are formatted one element per line, so that their
+// diffs show which elements differ.
+const maxInline = 60
+
+// maxDepth is the depth of nested values beyond which Format elides them.
+const maxDepth = 10
+
+// Format returns v in Go syntax, like the %#v verb of fmt, with the elements of the long arrays, slices, maps
+// and structs on lines of their own.
+func Format(v interface{}) string {
+	return format(reflect.ValueOf(v), 0, make(map[uintptr]bool))
+}
+
+func format(v reflect.Value, depth int, visiting map[uintptr]bool) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	if depth > maxDepth {
+		return "..."
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return fmt.Sprintf("(%v)(nil)", v.Type())
+		}
+		if visiting[v.Pointer()] {
+			return fmt.Sprintf("(%v)(cycle)", v.Type())
+		}
+		visiting[v.Pointer()] = true
+		defer delete(visiting, v.Pointer())
+		return "&" + format(v.Elem(), depth+1, visiting)
+	case reflect.Interface:
+		return format(v.Elem(), depth, visiting)
+	case reflect.Array, reflect.Slice:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return fmt.Sprintf("%v(nil)", v.Type())
+		}
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = format(v.Index(i), depth+1, visiting)
+		}
+		return composite(v.Type().String(), elems)
+	case reflect.Map:
+		if v.IsNil() {
+			return fmt.Sprintf("%v(nil)", v.Type())
+		}
+		elems := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			elems = append(elems, format(key, depth+1, visiting)+": "+format(v.MapIndex(key), depth+1, visiting))
+		}
+		sort.Strings(elems)
+		return composite(v.Type().String(), elems)
+	case reflect.Struct:
+		elems := make([]string, v.NumField())
+		for i := range elems {
+			elems[i] = v.Type().Field(i).Name + ": " + format(v.Field(i), depth+1, visiting)
+		}
+		return composite(v.Type().String(), elems)
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	}
+	if v.CanInterface() {
+		return fmt.Sprintf("%#v", v.Interface())
+	}
+	return fmt.Sprint(v)
+}
+
+// composite returns the composite literal of type typ with elements elems, on a single line if it is short and
+// elems are, else with an indented element per line.
+func composite(typ string, elems []string) string {
+	inline := typ + "{" + strings.Join(elems, ", ") + "}"
+	if len(inline) <= maxInline && !strings.Contains(inline, "\n") {
+		return inline
+	}
+	var b strings.Builder
+	b.WriteString(typ + "{\n")
+	for _, elem := range elems {
+		b.WriteString("\t" + strings.Replace(elem, "\n", "\n\t", -1) + ",\n")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// diffLine is a line of a line diff: kept, deleted from the expected value or inserted by the actual one.
+type diffLine struct {
+	op   byte // ' ', '-' or '+'
+	text string
+}
+
+func (l diffLine) String() string {
+	return string(l.op) + " " + l.text
+}
+
+// maxDiffLines is the number of lines of the values beyond which they are shown as deleted and inserted as a
+// whole rather than diffed.
+const maxDiffLines = 1000
+
+// diffLines returns the line diff turning expected into actual, with the longest common subsequence of their
+// lines kept.
+func diffLines(expected, actual string) []diffLine {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		var lines []diffLine
+		for _, line := range a {
+			lines = append(lines, diffLine{'-', line})
+		}
+		for _, line := range b {
+			lines = append(lines, diffLine{'+', line})
+		}
+		return lines
+	}
+
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
+
+// diffCell is a cell of a side-by-side diff: a line of one of the values, changed if the diff deletes or
+// inserts it.
+type diffCell struct {
+	text    string
+	changed bool
+}
+
+// sideBySide returns the rows of the side-by-side view of lines: the kept lines face each other, and so do the
+// runs of deleted and inserted lines between them.
+func sideBySide(lines []diffLine) [][2]diffCell {
+	var rows [][2]diffCell
+	for k := 0; k < len(lines); {
+		if lines[k].op == ' ' {
+			rows = append(rows, [2]diffCell{{lines[k].text, false}, {lines[k].text, false}})
+			k++
+			continue
+		}
+		var deleted, inserted []string
+		for ; k < len(lines) && lines[k].op != ' '; k++ {
+			if lines[k].op == '-' {
+				deleted = append(deleted, lines[k].text)
+			} else {
+				inserted = append(inserted, lines[k].text)
+			}
+		}
+		for n := 0; n < len(deleted) || n < len(inserted); n++ {
+			var row [2]diffCell
+			if n < len(deleted) {
+				row[0] = diffCell{deleted[n], true}
+			}
+			if n < len(inserted) {
+				row[1] = diffCell{inserted[n], true}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
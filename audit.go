@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditRecord is the record of an executed cell appended to the audit log, as a line of JSON.
+type auditRecord struct {
+	Time           time.Time `json:"time"`
+	User           string    `json:"user"`
+	Session        string    `json:"session"`
+	CellID         string    `json:"cell_id,omitempty"`
+	ExecutionCount int       `json:"execution_count"`
+	SHA256         string    `json:"sha256"`
+	Status         string    `json:"status"`
+	Ename          string    `json:"ename,omitempty"`
+}
+
+// auditLog appends the records of the executed cells to a file, or posts them to an HTTP endpoint.
+type auditLog struct {
+	mu     sync.Mutex
+	target string
+	client *http.Client
+}
+
+// audit is the audit log of the kernel, set by GOPHERNOTES_AUDIT to the path of a file or to an http(s) URL.
+// It is nil, and cells are not audited, when the variable is not set.
+var audit = newAuditLog(os.Getenv("GOPHERNOTES_AUDIT"))
+
+// newAuditLog returns the audit log writing to target, or nil if target is empty.
+func newAuditLog(target string) *auditLog {
+	if target == "" {
+		return nil
+	}
+	return &auditLog{target: target, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// record appends the record of the cell with the given code, executed on behalf of receipt, whose execute_reply
+// has the given content. The failures to write it are logged, they do not fail the cell.
+func (a *auditLog) record(receipt *msgReceipt, count int, code string, content map[string]interface{}) {
+	if a == nil {
+		return
+	}
+	sum := sha256.Sum256([]byte(code))
+	rec := auditRecord{
+		Time:           time.Now().UTC(),
+		User:           receipt.Msg.Header.Username,
+		Session:        receipt.Msg.Header.Session,
+		ExecutionCount: count,
+		SHA256:         hex.EncodeToString(sum[:]),
+	}
+	rec.CellID, _ = receipt.Msg.Metadata["cellId"].(string)
+	rec.Status, _ = content["status"].(string)
+	rec.Ename, _ = content["ename"].(string)
+	if err := a.write(rec); err != nil {
+		log.Printf("Error writing the audit log: %v\n", err)
+	}
+}
+
+// write appends rec to the audit log, in the order of the executions.
+func (a *auditLog) write(rec auditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if strings.HasPrefix(a.target, "http://") || strings.HasPrefix(a.target, "https://") {
+		resp, err := a.client.Post(a.target, "application/json", bytes.NewReader(line))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%s: %s", a.target, resp.Status)
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(a.target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
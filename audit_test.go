@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAuditLog tests appending the records of executed cells to a file and posting them to an endpoint.
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	receipt := &msgReceipt{Msg: ComposedMsg{
+		Header:   MsgHeader{Username: "ada", Session: "s1"},
+		Metadata: map[string]interface{}{"cellId": "c1"},
+	}}
+	path := filepath.Join(dir, "audit.jsonl")
+	a := newAuditLog(path)
+	a.record(receipt, 1, "x := 1", map[string]interface{}{"status": "ok"})
+	a.record(receipt, 2, "x +", map[string]interface{}{"status": "error", "ename": enameCompileError})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []auditRecord
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("\t%s Expected a JSON record per line: %v", failure, err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 2 || recs[0].User != "ada" || recs[0].CellID != "c1" || recs[0].Status != "ok" ||
+		recs[0].SHA256 != "27bdb0baa67b88ff4aeebdb78a76e3d8dd39e5c2d30960f630d88a3feab841e8" ||
+		recs[1].ExecutionCount != 2 || recs[1].Ename != enameCompileError {
+		t.Errorf("\t%s Unexpected audit records %+v", failure, recs)
+	}
+
+	posted := make(chan auditRecord, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec auditRecord
+		json.NewDecoder(r.Body).Decode(&rec)
+		posted <- rec
+	}))
+	defer server.Close()
+	newAuditLog(server.URL).record(receipt, 3, "x", map[string]interface{}{"status": "ok"})
+	select {
+	case rec := <-posted:
+		if rec.ExecutionCount != 3 || rec.User != "ada" {
+			t.Errorf("\t%s Unexpected posted record %+v", failure, rec)
+		}
+	default:
+		t.Errorf("\t%s Expected the record to be posted", failure)
+	}
+
+	var none *auditLog
+	none.record(receipt, 4, "x", nil)
+}
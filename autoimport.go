@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	r "reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// autoImport is set by `%autoimport on|suggest|off`. When a statement fails because it uses a package that
+// is not imported, like goimports, "on" imports the package and runs the statement again, "suggest" adds the
+// missing import to the error, and "off" leaves the error alone.
+var autoImport = "on"
+
+func init() {
+	lineMagics["autoimport"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) != 1 || args[0] != "on" && args[0] != "suggest" && args[0] != "off" {
+			return errors.New("expected on, suggest or off")
+		}
+		autoImport = args[0]
+		return nil
+	}
+}
+
+var undefinedIdentifier = regexp.MustCompile(`undefined identifier: ([\pL_][\pL\pN_]*)$`)
+
+// evalNodeImporting evaluates node like ir.EvalNode. If this fails because node uses a package that is not
+// imported, it imports the package and evaluates node again, according to autoImport.
+func evalNodeImporting(ir *classic.Interp, node ast.Node) (r.Value, []r.Value) {
+	imported := make(map[string]bool)
+	for {
+		result, results, failure := tryEvalNode(ir, node)
+		if failure == nil {
+			return result, results
+		}
+
+		path := missingImport(node, failure)
+		if path == "" || imported[path] || autoImport == "off" {
+			panic(failure)
+		}
+		if autoImport == "suggest" {
+			panic(executionError{enameCompileError, fmt.Errorf("%v (missing import %q?)", failure, path)})
+		}
+
+		imported[path] = true
+		ir.EvalNode(&ast.GenDecl{Tok: token.IMPORT, Specs: []ast.Spec{
+			&ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}},
+		}})
+		fmt.Fprintf(os.Stderr, "added import %q\n", path)
+	}
+}
+
+// tryEvalNode evaluates node, returning the value it panics with, if any.
+func tryEvalNode(ir *classic.Interp, node ast.Node) (result r.Value, results []r.Value, failure interface{}) {
+	defer func() {
+		failure = recover()
+	}()
+	result, results = ir.EvalNode(node)
+	return
+}
+
+// missingImport returns the import path of the package that node uses without importing it, according to
+// failure, or "" if failure is about something else. The package must be known to the interpreter, and a
+// standard package is preferred to others with the same name.
+func missingImport(node ast.Node, failure interface{}) string {
+	err, ok := failure.(error)
+	if !ok {
+		return ""
+	}
+	m := undefinedIdentifier.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+	name := m[1]
+
+	// The identifier must be used as a package, i.e. as the left hand side of a selector.
+	used := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == name {
+				used = true
+			}
+		}
+		return !used
+	})
+	if !used {
+		return ""
+	}
+
+	var candidates []string
+	for path := range imports.Packages {
+		if path[strings.LastIndexByte(path, '/')+1:] != name {
+			continue
+		}
+		if strings.Contains(path, "internal") || strings.Contains(path, "vendor/") {
+			continue
+		}
+		candidates = append(candidates, path)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		// Standard packages have no dot in their first path element.
+		stdi := !strings.Contains(strings.SplitN(candidates[i], "/", 2)[0], ".")
+		stdj := !strings.Contains(strings.SplitN(candidates[j], "/", 2)[0], ".")
+		if stdi != stdj {
+			return stdi
+		}
+		if len(candidates[i]) != len(candidates[j]) {
+			return len(candidates[i]) < len(candidates[j])
+		}
+		return candidates[i] < candidates[j]
+	})
+	return candidates[0]
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+func init() {
+	cellMagics["bench"] = benchMagic
+	lineMagics["benchcmp"] = benchcmpMagic
+}
+
+// benchResult holds the samples measured by a `%%bench` cell, one per run of -count.
+type benchResult struct {
+	name   string
+	nsOp   []float64
+	bytes  []float64
+	allocs []float64
+}
+
+// benchResults maps the names of the benchmarks run by the session to their last results.
+var benchResults = make(map[string]*benchResult)
+
+// benchMagic implements `%%bench [-count n] [-benchtime d] name`: it runs the body of the cell as a benchmark,
+// like go test -bench does, count times for about d each, and records its time and allocations per run under
+// name for %benchcmp. The body is compiled once, as the body of a function called in a loop.
+func benchMagic(ir *classic.Interp, receipt *msgReceipt, args []string, body string) ([]interface{}, error) {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	count := flags.Int("count", 10, "")
+	benchtime := flags.Duration("benchtime", 100*time.Millisecond, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || *count < 1 || *benchtime <= 0 {
+		return nil, errors.New("expected [-count n] [-benchtime duration] name")
+	}
+	name := flags.Arg(0)
+
+	vals, err := doEval(ir, "(func() {"+body+"\n})")
+	if err != nil {
+		return nil, err
+	}
+	var fn func()
+	if len(vals) == 1 {
+		fn, _ = vals[0].(func())
+	}
+	if fn == nil {
+		return nil, errors.New("the body of the cell cannot be run as a function")
+	}
+
+	result, err := runBenchmark(name, fn, *count, *benchtime)
+	if err != nil {
+		return nil, err
+	}
+	benchResults[name] = result
+	fmt.Fprintln(os.Stdout, result)
+	return nil, nil
+}
+
+// runBenchmark measures fn count times, each time calling it in a loop for about benchtime. A panic of fn fails
+// the benchmark.
+func runBenchmark(name string, fn func(), count int, benchtime time.Duration) (result *benchResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: panic: %v", name, r)
+		}
+	}()
+
+	// Find the number of iterations lasting about benchtime, growing it like the testing package does.
+	n := 1
+	for {
+		elapsed, _, _ := measure(fn, n)
+		if elapsed >= benchtime || n >= 1e9 {
+			break
+		}
+		next := n * 100
+		if elapsed > 0 {
+			next = int(float64(n) * 1.2 * float64(benchtime) / float64(elapsed))
+		}
+		if next > 100*n {
+			next = 100 * n
+		}
+		if next <= n {
+			next = n + 1
+		}
+		n = next
+	}
+
+	result = &benchResult{name: name}
+	for i := 0; i < count; i++ {
+		elapsed, bytes, allocs := measure(fn, n)
+		result.nsOp = append(result.nsOp, float64(elapsed.Nanoseconds())/float64(n))
+		result.bytes = append(result.bytes, float64(bytes)/float64(n))
+		result.allocs = append(result.allocs, float64(allocs)/float64(n))
+	}
+	return result, nil
+}
+
+// measure calls fn n times, and returns the time it took and the memory it allocated.
+func measure(fn func(), n int) (elapsed time.Duration, bytes, allocs uint64) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		fn()
+	}
+	elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	return elapsed, after.TotalAlloc - before.TotalAlloc, after.Mallocs - before.Mallocs
+}
+
+// String formats the result like go test -bench does, with the mean of the samples and their spread.
+func (b *benchResult) String() string {
+	return fmt.Sprintf("Benchmark%s\t%d runs\t%s\t%s\t%s", b.name, len(b.nsOp),
+		formatSamples(b.nsOp, "ns/op"), formatSamples(b.bytes, "B/op"), formatSamples(b.allocs, "allocs/op"))
+}
+
+// benchcmpMagic implements `%benchcmp old new`, which compares the results of the benchmarks old and new run by
+// `%%bench`, like benchstat does: the mean of each measure, its spread, the change from old to new, and whether
+// the change is significant according to a Mann-Whitney U test.
+func benchcmpMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("expected the names of two benchmarks run by %%%%bench, got %q", strings.Join(args, " "))
+	}
+	var results [2]*benchResult
+	for i, name := range args {
+		if results[i] = benchResults[name]; results[i] == nil {
+			return fmt.Errorf("no benchmark named %q, run it with %%%%bench %s", name, name)
+		}
+	}
+	return receipt.PublishDisplayData(bundledMIMEData(benchcmpTable(results[0], results[1])), nil, "")
+}
+
+// benchcmpTable returns the comparison of the benchmarks before and after as a table.
+func benchcmpTable(before, after *benchResult) display.Data {
+	rows := [][]string{
+		benchcmpRow("time/op", "ns", before.nsOp, after.nsOp),
+		benchcmpRow("alloc/op", "B", before.bytes, after.bytes),
+		benchcmpRow("allocs/op", "allocs", before.allocs, after.allocs),
+	}
+	return display.Table([]string{"measure", before.name, after.name, "delta", ""}, rows)
+}
+
+// benchcmpRow returns the row of the table comparing the samples before and after of a measure. The delta is ~
+// when the change is not significant, at the 5% level.
+func benchcmpRow(measure, unit string, before, after []float64) []string {
+	p := mannWhitneyP(before, after)
+	delta := "~"
+	if p < 0.05 {
+		delta = fmt.Sprintf("%+.2f%%", 100*(mean(after)-mean(before))/mean(before))
+	}
+	return []string{measure, formatSamples(before, unit), formatSamples(after, unit), delta,
+		fmt.Sprintf("(p=%.3f n=%d+%d)", p, len(before), len(after))}
+}
+
+// formatSamples formats the mean of samples in unit followed by their spread, the standard deviation relative to
+// the mean, as in "123.4 ns ± 2%". The mean has 4 significant digits, or none after the point from 10000 on.
+func formatSamples(samples []float64, unit string) string {
+	m := mean(samples)
+	text := fmt.Sprintf("%.4g %s", m, unit)
+	if m >= 1e4 {
+		text = fmt.Sprintf("%.0f %s", m, unit)
+	}
+	if m == 0 || len(samples) < 2 {
+		return text
+	}
+	return fmt.Sprintf("%s ± %.0f%%", text, 100*stddev(samples)/m)
+}
+
+func mean(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range samples {
+		sum += x
+	}
+	return sum / float64(len(samples))
+}
+
+func stddev(samples []float64) float64 {
+	m, sum := mean(samples), 0.0
+	for _, x := range samples {
+		sum += (x - m) * (x - m)
+	}
+	return math.Sqrt(sum / float64(len(samples)-1))
+}
+
+// mannWhitneyP returns the two-sided p-value of the Mann-Whitney U test that the samples a and b come from the
+// same distribution, with the normal approximation corrected for ties and continuity.
+func mannWhitneyP(a, b []float64) float64 {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type sample struct {
+		x     float64
+		fromA bool
+	}
+	all := make([]sample, 0, len(a)+len(b))
+	for _, x := range a {
+		all = append(all, sample{x, true})
+	}
+	for _, x := range b {
+		all = append(all, sample{x, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].x < all[j].x })
+
+	// Rank the samples, giving tied samples the mean of their ranks.
+	rankA, ties := 0.0, 0.0
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].x == all[i].x {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankA += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n := n1 + n2
+	u := rankA - n1*(n1+1)/2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-n1*n2/2) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMannWhitneyP tests the significance of the differences between benchmark samples.
+func TestMannWhitneyP(t *testing.T) {
+	cases := []struct {
+		a, b     []float64
+		min, max float64
+	}{
+		{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1, 1},
+		{[]float64{1, 2, 3, 4, 5}, []float64{1, 2, 3, 4, 5}, 0.9, 1},
+		{[]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 0.012, 0.013},
+		{[]float64{1, 3, 5, 7, 9}, []float64{2, 4, 6, 8, 10}, 0.5, 1},
+		{nil, []float64{1}, 1, 1},
+	}
+	for _, c := range cases {
+		if p := mannWhitneyP(c.a, c.b); p < c.min || p > c.max {
+			t.Errorf("\t%s mannWhitneyP(%v, %v) = %g, expected between %g and %g", failure, c.a, c.b, p, c.min, c.max)
+		}
+	}
+}
+
+// TestBenchcmp tests running benchmarks and comparing them.
+func TestBenchcmp(t *testing.T) {
+	var sink []byte
+	result, err := runBenchmark("alloc", func() { sink = make([]byte, 64) }, 3, time.Millisecond)
+	if err != nil || len(result.nsOp) != 3 || mean(result.allocs) < 0.9 || mean(result.bytes) < 64 {
+		t.Fatalf("\t%s runBenchmark() = %+v, %v, expected 3 runs of 1 allocation of 64 bytes", failure, result, err)
+	}
+	_ = sink
+
+	ir := newInterp()
+	if _, err := evalCell(ir, nil, "%%bench -count 2 -benchtime 1ms sum\ns := 0\nfor i := 0; i < 10; i++ {\n\ts += i\n}"); err != nil {
+		t.Fatalf("\t%s Expected %%%%bench to run the cell, got %v", failure, err)
+	}
+	if r := benchResults["sum"]; r == nil || len(r.nsOp) != 2 {
+		t.Errorf("\t%s Expected %%%%bench to record 2 runs of sum, got %+v", failure, r)
+	}
+	if !strings.HasPrefix(result.String(), "Benchmarkalloc\t3 runs\t") {
+		t.Errorf("\t%s String() = %q", failure, result)
+	}
+	if _, err := runBenchmark("panic", func() { panic("boom") }, 1, time.Millisecond); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("\t%s Expected a panicking benchmark to fail, got %v", failure, err)
+	}
+
+	before := &benchResult{"old", []float64{10, 11, 10, 11, 10}, []float64{64, 64, 64, 64, 64}, []float64{1, 1, 1, 1, 1}}
+	after := &benchResult{"new", []float64{5, 6, 5, 6, 5}, []float64{64, 64, 64, 64, 64}, []float64{1, 1, 1, 1, 1}}
+	text := benchcmpTable(before, after).Text()
+	for _, want := range []string{"old", "new", "10.4 ns ± 5%", "-48.08%", "64 B", "~", "(p=1.000 n=5+5)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("\t%s Expected the comparison to contain %q, got\n%s", failure, want, text)
+		}
+	}
+	samples := []struct {
+		samples []float64
+		want    string
+	}{
+		{[]float64{2}, "2 ns"},
+		{[]float64{11700, 12300}, "12000 ns ± 4%"},
+		{[]float64{1.5, 1.5}, "1.5 ns ± 0%"},
+	}
+	for _, c := range samples {
+		if got := formatSamples(c.samples, "ns"); got != c.want {
+			t.Errorf("\t%s formatSamples(%v) = %q, expected %q", failure, c.samples, got, c.want)
+		}
+	}
+}
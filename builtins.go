@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// defineBuiltins defines the builtins added to Go after those of the interpreter, min, max and clear, in the
+// environment of the builtins of ir, so that the cells can declare functions of the same names.
+func defineBuiltins(ir *classic.Interp) {
+	top := ir.Env.TopEnv()
+	for name, exec := range map[string]func(*classic.Env, []r.Value) (r.Value, []r.Value){
+		"min":   builtinMin,
+		"max":   builtinMax,
+		"clear": builtinClear,
+	} {
+		fn := builtinFunc(exec)
+		top.DefineVar(name, fn.Type(), fn)
+	}
+}
+
+// builtinMin implements min.
+func builtinMin(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	return extremum(env, "min", args, func(x, y r.Value) bool { return less(y, x) }), nil
+}
+
+// builtinMax implements max.
+func builtinMax(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	return extremum(env, "max", args, less), nil
+}
+
+// extremum returns the argument of the builtin name that replaces the others when better reports it does, after
+// converting args to a common type. A NaN argument is the result, like in compiled Go. The errors are reported
+// at the position of the call in env.
+func extremum(env *classic.Env, name string, args []r.Value, better func(x, y r.Value) bool) r.Value {
+	if len(args) == 0 {
+		env.Errorf("not enough arguments for %s() (expected 1, found 0)", name)
+	}
+	typ := extremumType(env, name, args)
+	result := args[0].Convert(typ)
+	for _, arg := range args[1:] {
+		arg = arg.Convert(typ)
+		if isNaN(result) {
+			break
+		}
+		if isNaN(arg) || better(result, arg) {
+			result = arg
+		}
+	}
+	return result
+}
+
+// extremumType returns the type min and max convert args to: that of the arguments if they all have the same,
+// else the first floating-point type among them, as the constants of the interpreter are typed int or float64
+// where Go keeps them untyped.
+func extremumType(env *classic.Env, name string, args []r.Value) r.Type {
+	typ := args[0].Type()
+	for _, arg := range args {
+		t := arg.Type()
+		switch {
+		case t == typ:
+		case !isOrdered(t) || !isOrdered(typ) || (t.Kind() == r.String) != (typ.Kind() == r.String):
+			env.Errorf("invalid argument: mismatched types %v and %v for %s()", typ, t, name)
+		case isFloat(t) && !isFloat(typ):
+			typ = t
+		}
+	}
+	if !isOrdered(typ) {
+		env.Errorf("invalid argument: %v cannot be ordered in %s()", typ, name)
+	}
+	return typ
+}
+
+// isOrdered reports whether the values of t are ordered.
+func isOrdered(t r.Type) bool {
+	switch t.Kind() {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64, r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr,
+		r.Float32, r.Float64, r.String:
+		return true
+	}
+	return false
+}
+
+// isFloat reports whether t is a floating-point type.
+func isFloat(t r.Type) bool {
+	return t.Kind() == r.Float32 || t.Kind() == r.Float64
+}
+
+// isNaN reports whether v is a floating-point NaN.
+func isNaN(v r.Value) bool {
+	return isFloat(v.Type()) && math.IsNaN(v.Float())
+}
+
+// less reports whether x < y, for values of the same ordered type. A negative zero is less than a positive one,
+// as min and max require.
+func less(x, y r.Value) bool {
+	switch x.Kind() {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		return x.Int() < y.Int()
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		return x.Uint() < y.Uint()
+	case r.Float32, r.Float64:
+		if x.Float() == 0 && y.Float() == 0 {
+			return math.Signbit(x.Float()) && !math.Signbit(y.Float())
+		}
+		return x.Float() < y.Float()
+	}
+	return x.String() < y.String()
+}
+
+// builtinClear implements clear: it deletes the entries of a map, and zeroes the elements of a slice.
+func builtinClear(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	if len(args) != 1 {
+		env.Errorf("wrong number of arguments for clear() (expected 1, found %d)", len(args))
+	}
+	v := args[0]
+	if !v.IsValid() {
+		env.Errorf("invalid argument: clear(nil)")
+	}
+	switch v.Kind() {
+	case r.Map:
+		for _, key := range v.MapKeys() {
+			v.SetMapIndex(key, r.Value{})
+		}
+	case r.Slice:
+		zero := r.Zero(v.Type().Elem())
+		for i := 0; i < v.Len(); i++ {
+			v.Index(i).Set(zero)
+		}
+	default:
+		env.Errorf("invalid argument: %v (type %v) cannot be cleared", v, v.Type())
+	}
+	return base.None, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestBuiltins tests the builtins min, max and clear.
+func TestBuiltins(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{"min(3, 1, 2)", 1},
+		{"max(3, 1, 2)", 3},
+		{"min(2, 1.5)", 1.5},
+		{"var b byte = 7\nmax(b, 9)", byte(9)},
+		{`min("b", "a", "c")`, "a"},
+		{"import \"math\"\nmath.IsNaN(max(1, math.NaN(), 3))", true},
+		{"import \"math\"\nmath.Signbit(min(0.0, math.Copysign(0, -1)))", true},
+		{"m := map[string]int{\"a\": 1, \"b\": 2}\nclear(m)\nlen(m)", 0},
+		{"s := []int{1, 2, 3}\nclear(s)\nlen(s) + s[0] + s[1] + s[2]", 3},
+		// The functions of the cells take precedence.
+		{"func min(a, b int) int { return 42 }\nmin(1, 2)", 42},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+
+	// The errors have the position of the call, like those of the interpreter.
+	errCases := []struct {
+		code string
+		want string
+	}{
+		{"clear(3)", "repl.go:1:7: invalid argument: 3 (type int) cannot be cleared"},
+		{"x := 1\ny := min(x, \"a\")", "repl.go:2:13: invalid argument: mismatched types int and string for min()"},
+		{"for i, j := range 3 {\n}", "repl.go:1:19: range over 3 permits only one iteration variable"},
+	}
+	for _, c := range errCases {
+		if _, err := doEval(newInterp(), c.code); err == nil || err.Error() != c.want {
+			t.Errorf("\t%s Expected %q but got %v for\n%s", failure, c.want, err, c.code)
+		}
+	}
+}
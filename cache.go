@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// importCacheEntry describes a plugin of the import cache, stored as entry.json next to the plugin.
+type importCacheEntry struct {
+	Path      string
+	Module    string `json:",omitempty"`
+	Version   string
+	GoVersion string
+	Created   time.Time
+}
+
+// cachedImport is an entry of the import cache along with the directory holding it.
+type cachedImport struct {
+	importCacheEntry
+	Dir  string
+	Size int64
+}
+
+// importCacheDir returns the directory of the import cache, $GOPHERNOTES_CACHE or ~/.gophernotes/cache.
+func importCacheDir() string {
+	if dir := os.Getenv("GOPHERNOTES_CACHE"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".gophernotes", "cache")
+}
+
+// moduleVersion returns the module path and version of a package directory in the module cache, i.e. below
+// $GOPATH/pkg/mod/<module>@<version>. ok is false for the other directories.
+func moduleVersion(gopath, dir string) (module, version string, ok bool) {
+	rel, err := filepath.Rel(filepath.Join(gopath, "pkg", "mod"), dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", false
+	}
+	rel = filepath.ToSlash(rel)
+	at := strings.IndexByte(rel, '@')
+	if at <= 0 {
+		return "", "", false
+	}
+	module, version = rel[:at], rel[at+1:]
+	if slash := strings.IndexByte(version, '/'); slash >= 0 {
+		version = version[:slash]
+	}
+
+	return unescapeModulePath(module), unescapeModulePath(version), version != ""
+}
+
+// readImportCache returns the entries of the import cache in dir, sorted by import path.
+func readImportCache(dir string) ([]cachedImport, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []cachedImport
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		entry := cachedImport{Dir: filepath.Join(dir, info.Name())}
+		data, err := ioutil.ReadFile(filepath.Join(entry.Dir, "entry.json"))
+		if err != nil {
+			// An entry being written, or left over by a crash.
+			continue
+		}
+		if err := json.Unmarshal(data, &entry.importCacheEntry); err != nil {
+			continue
+		}
+		if plugin, err := os.Stat(filepath.Join(entry.Dir, "plugin.so")); err == nil {
+			entry.Size = plugin.Size()
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries, nil
+}
+
+// cacheCommand implements `gophernotes cache list` and `gophernotes cache clean [path...]`, which show and
+// remove the bindings of the imported packages cached by earlier sessions.
+func cacheCommand(args []string) error {
+	flags := flag.NewFlagSet("cache", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gophernotes cache list")
+		fmt.Fprintln(flags.Output(), "       gophernotes cache clean [import path]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	switch flags.Arg(0) {
+	case "list":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("cache list: unexpected arguments")
+		}
+		return listImportCache(importCacheDir(), os.Stdout)
+	case "clean":
+		return cleanImportCache(importCacheDir(), flags.Args()[1:], os.Stdout)
+	default:
+		flags.Usage()
+		return errors.New("cache: need list or clean")
+	}
+}
+
+// listImportCache writes a table of the entries of the import cache in dir to out.
+func listImportCache(dir string, out io.Writer) error {
+	entries, err := readImportCache(dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tVERSION\tGO\tSIZE\tCREATED")
+	for _, e := range entries {
+		version := e.Version
+		if e.Module != "" && e.Module != e.Path {
+			version = e.Module + "@" + e.Version
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1fMB\t%s\n", e.Path, version, e.GoVersion,
+			float64(e.Size)/(1<<20), e.Created.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// cleanImportCache removes the entries of the import cache in dir for the given import paths, or all of them.
+func cleanImportCache(dir string, paths []string, out io.Writer) error {
+	if len(paths) == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "removed %s\n", dir)
+		return nil
+	}
+
+	entries, err := readImportCache(dir)
+	if err != nil {
+		return err
+	}
+	removed := make(map[string]bool)
+	for _, e := range entries {
+		for _, path := range paths {
+			if e.Path != path {
+				continue
+			}
+			if err := os.RemoveAll(e.Dir); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "removed %s %s\n", e.Path, e.Version)
+			removed[path] = true
+		}
+	}
+	for _, path := range paths {
+		if !removed[path] {
+			fmt.Fprintf(out, "%s is not cached\n", path)
+		}
+	}
+	return nil
+}
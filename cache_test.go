@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestModuleVersion tests that the packages of the module cache are versioned by their module.
+func TestModuleVersion(t *testing.T) {
+	gopath := filepath.FromSlash("/home/gopher/go")
+	cases := []struct {
+		dir, module, version string
+		ok                   bool
+	}{
+		{"pkg/mod/github.com/!azure/azure-sdk-for-go@v1.2.3/storage", "github.com/Azure/azure-sdk-for-go", "v1.2.3", true},
+		{"pkg/mod/golang.org/x/text@v0.3.0", "golang.org/x/text", "v0.3.0", true},
+		{"src/github.com/gonum/plot", "", "", false},
+		{"pkg/mod/cache/download", "", "", false},
+	}
+	for _, c := range cases {
+		module, version, ok := moduleVersion(gopath, filepath.Join(gopath, filepath.FromSlash(c.dir)))
+		if module != c.module || version != c.version || ok != c.ok {
+			t.Errorf("\t%s moduleVersion(%q) = %q, %q, %v, want %q, %q, %v", failure, c.dir,
+				module, version, ok, c.module, c.version, c.ok)
+		}
+	}
+}
+
+// TestImportCacheCommand tests listing and cleaning the import cache.
+func TestImportCacheCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, path := range []string{"golang.org/x/text/language", "github.com/gonum/plot"} {
+		entry := importCacheEntry{Path: path, Version: "v1.0.0", GoVersion: "go1.10", Created: time.Unix(0, 0)}
+		data, _ := json.Marshal(entry)
+		sub := filepath.Join(dir, string('a'+rune(i)))
+		os.Mkdir(sub, 0700)
+		ioutil.WriteFile(filepath.Join(sub, "entry.json"), data, 0600)
+		ioutil.WriteFile(filepath.Join(sub, "plugin.so"), make([]byte, 1<<20), 0600)
+	}
+
+	var out bytes.Buffer
+	if err := listImportCache(dir, &out); err != nil {
+		t.Fatalf("\t%s listImportCache: %s", failure, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "github.com/gonum/plot ") || !strings.Contains(lines[1], "1.0MB") {
+		t.Errorf("\t%s listImportCache wrote\n%s", failure, out.String())
+	}
+
+	out.Reset()
+	if err := cleanImportCache(dir, []string{"github.com/gonum/plot", "fmt"}, &out); err != nil {
+		t.Fatalf("\t%s cleanImportCache: %s", failure, err)
+	}
+	if got, want := out.String(), "removed github.com/gonum/plot v1.0.0\nfmt is not cached\n"; got != want {
+		t.Errorf("\t%s cleanImportCache wrote %q, want %q", failure, got, want)
+	}
+	if entries, _ := readImportCache(dir); len(entries) != 1 || entries[0].Path != "golang.org/x/text/language" {
+		t.Errorf("\t%s cleanImportCache left %v", failure, entries)
+	}
+}
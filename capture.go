@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	r "reflect"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+)
+
+func init() {
+	cellMagics["capture"] = captureMagic
+}
+
+// outputCapture collects the output published on behalf of a cell run with `%%capture name`.
+type outputCapture struct {
+	mu         sync.Mutex
+	output     notebook.CapturedOutput
+	displayIDs []string
+
+	// done stores the captured output once all of it was collected.
+	done func(notebook.CapturedOutput)
+}
+
+// captureMagic runs the body of the cell, collecting its output into a new notebook.CapturedOutput variable
+// named by the single argument. The variable is defined once the output streams of the cell are flushed.
+func captureMagic(ir *classic.Interp, receipt *msgReceipt, args []string, body string) ([]interface{}, error) {
+	if len(args) != 1 || !token.IsIdentifier(args[0]) {
+		return nil, fmt.Errorf("expected the name of the variable receiving the output, got %q", strings.Join(args, " "))
+	}
+	name := args[0]
+
+	if receipt == nil {
+		return nil, errors.New("needs a front-end")
+	}
+
+	receipt.capture = &outputCapture{
+		done: func(output notebook.CapturedOutput) {
+			ir.Env.DefineVar(name, r.TypeOf(output), r.ValueOf(output))
+		},
+	}
+
+	vals, err := evalCell(ir, receipt, body)
+	if vals != nil {
+		receipt.capture.display(renderValues(vals), "")
+	}
+	return nil, err
+}
+
+// write appends data written to the stream named stream.
+func (c *outputCapture) write(stream, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch stream {
+	case StreamStdout:
+		c.output.Stdout += data
+	case StreamStderr:
+		c.output.Stderr += data
+	}
+}
+
+// display appends a rich output. The output is later replaced by updates with the same non-empty displayID.
+func (c *outputCapture) display(data bundledMIMEData, displayID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.output.Outputs = append(c.output.Outputs, display.Data(data))
+	c.displayIDs = append(c.displayIDs, displayID)
+}
+
+// update replaces the rich outputs previously displayed with displayID.
+func (c *outputCapture) update(data bundledMIMEData, displayID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, id := range c.displayIDs {
+		if id != "" && id == displayID {
+			c.output.Outputs[i] = display.Data(data)
+		}
+	}
+}
+
+// finish hands the captured output over to the done callback.
+func (c *outputCapture) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.done(c.output)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cellFlags control the execution of a cell. They are read from the "tags" list in the metadata of the
+// execute_request, as sent by headless runners and front-ends forwarding the cell's tags.
+type cellFlags struct {
+	// skip is set by the "skip" tag. The cell is not run.
+	skip bool
+
+	// timeout is set by a "timeout=<duration>" tag, e.g. "timeout=30s". A cell still running after the
+	// duration fails with a timeout error, the notebook.Context of the cell is cancelled and its loops stop at
+	// their next iteration. Calls of compiled code not watching the context run until they return.
+	timeout time.Duration
+
+	// raisesException is set by the "raises-exception" tag. An error raised by the cell is still shown, but
+	// the execution is reported as successful so that runners carry on with the next cells.
+	raisesException bool
+}
+
+// parseCellFlags reads the flags of a cell from the metadata of its execute_request. Tags that are not
+// execution flags are ignored.
+func parseCellFlags(metadata map[string]interface{}) (cellFlags, error) {
+	var flags cellFlags
+
+	tags, _ := metadata["tags"].([]interface{})
+	for _, tag := range tags {
+		tag, ok := tag.(string)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case tag == "skip":
+			flags.skip = true
+		case tag == "raises-exception":
+			flags.raisesException = true
+		case strings.HasPrefix(tag, "timeout="):
+			timeout, err := time.ParseDuration(strings.TrimPrefix(tag, "timeout="))
+			if err != nil || timeout <= 0 {
+				return flags, fmt.Errorf("invalid cell tag %q: expected a positive duration such as timeout=30s", tag)
+			}
+			flags.timeout = timeout
+		}
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	r "reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// chanWaitFuncName is the name of the function called before the channel operations of the interpreted code,
+	// and chanDoneFuncName the one called after them.
+	chanWaitFuncName = "__gophernotesChanWait"
+	chanDoneFuncName = "__gophernotesChanDone"
+
+	// chanRewaitFuncName is the name of the function called before each receive of a range over a channel
+	// but the first.
+	chanRewaitFuncName = "__gophernotesChanRewait"
+
+	// chanWaitsVarName prefixes the names of the variables holding the operations recorded.
+	chanWaitsVarName = "__gophernotesChanWaits"
+
+	// chanMadeFuncName is the name of the function naming the channels made by the interpreted code.
+	chanMadeFuncName = "__gophernotesChanMade"
+)
+
+// chanWait is a channel operation that a goroutine started and did not finish yet.
+type chanWait struct {
+	// op is "send", "receive" or "range", prefixed by "select " for the cases of select statements. ch is
+	// the zero Value for a select without cases.
+	op string
+	ch r.Value
+}
+
+// chanWaits are the channel operations of a statement of a goroutine, the cases of a select or a single send,
+// receive or range. The instrumented code holds them from the start of the statement to its end.
+type chanWaits struct {
+	goroutine int64
+	seq       int64
+	ops       []chanWait
+}
+
+// chanTracker records the channel operations of the goroutines of the interpreted code, so that `%chans` can
+// show which ones are blocked.
+type chanTracker struct {
+	mu sync.Mutex
+
+	// waits holds the pending operations of the goroutines, and seq numbers them in the order they started.
+	waits map[*chanWaits]bool
+	seq   int64
+
+	// names holds the names of the variables the channels made by the interpreted code were assigned to.
+	names map[uintptr]string
+}
+
+var chans = &chanTracker{
+	waits: make(map[*chanWaits]bool),
+	names: make(map[uintptr]string),
+}
+
+// chansOn is set by `%chans on`: the channel operations of the cells are then recorded. They are not by
+// default, as recording them costs each operation a lookup of the id of its goroutine.
+var chansOn bool
+
+// maxChanNames bounds the number of names of channels remembered, as their channels may be collected.
+const maxChanNames = 1000
+
+func init() {
+	lineMagics["chans"] = chansMagic
+}
+
+// chansMagic implements `%chans`, which displays the channels of the session and those that goroutines are
+// blocked on, with the number of buffered values of each, as a Mermaid flowchart, and `%chans on|off`, which
+// turns the recording of the channel operations of the cells that follow on or off. `%chans step` records them
+// too, and steps the goroutines started from then on.
+func chansMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if len(args) == 1 && args[0] == "step" {
+		chansOn = true
+		steps.start()
+		return nil
+	}
+	if len(args) > 0 {
+		on, err := parseSwitch(args)
+		if err != nil {
+			return err
+		}
+		chansOn = on
+		steps.stop()
+		if !on {
+			chans.mu.Lock()
+			chans.waits = make(map[*chanWaits]bool)
+			chans.mu.Unlock()
+		}
+		return nil
+	}
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	if !chansOn {
+		return errors.New("the channel operations are not recorded, turn it on with %chans on and run the cells again")
+	}
+	snap := chans.snapshot(ir)
+	return receipt.PublishDisplayData(bundledMIMEData{
+		"text/markdown": "```mermaid\n" + snap.mermaid() + "```\n",
+		"text/plain":    snap.String(),
+	}, nil, "")
+}
+
+// goroutineID returns the id of the calling goroutine, as printed in its stack trace.
+func goroutineID() int64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	var id int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + int64(c-'0')
+	}
+	return id
+}
+
+// liveGoroutines returns the ids of the goroutines of the kernel.
+func liveGoroutines() map[int64]bool {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	ids := make(map[int64]bool)
+	for _, line := range strings.Split(string(buf), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "goroutine" {
+			if id, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+// wait records that the calling goroutine starts the operations given by ops, pairs of an op and a channel,
+// and returns them for done. The channels that are not, e.g. when ranging over a slice, are ignored, and nil is
+// returned if none is left.
+func (t *chanTracker) wait(ops ...interface{}) *chanWaits {
+	w := &chanWaits{}
+	for i := 0; i+1 < len(ops); i += 2 {
+		op, _ := ops[i].(string)
+		v := r.ValueOf(ops[i+1])
+		if ops[i+1] != nil && v.Kind() != r.Chan {
+			continue
+		}
+		w.ops = append(w.ops, chanWait{op, v})
+	}
+	if len(w.ops) == 0 {
+		return nil
+	}
+	w.goroutine = goroutineID()
+	t.rewait(w)
+	return w
+}
+
+// rewait records that the goroutine of w starts the operations of w again, like the next receive of a range.
+func (t *chanTracker) rewait(w *chanWaits) {
+	if w == nil {
+		return
+	}
+	t.mu.Lock()
+	t.seq++
+	w.seq = t.seq
+	t.waits[w] = true
+	t.mu.Unlock()
+}
+
+// done records that the goroutine of w finished the operations of w, or one of them for a select.
+func (t *chanTracker) done(w *chanWaits) {
+	if w == nil {
+		return
+	}
+	t.mu.Lock()
+	delete(t.waits, w)
+	t.mu.Unlock()
+}
+
+// end forgets the operations of the calling goroutine, which a panic left pending.
+func (t *chanTracker) end() {
+	id := goroutineID()
+	t.mu.Lock()
+	for w := range t.waits {
+		if w.goroutine == id {
+			delete(t.waits, w)
+		}
+	}
+	t.mu.Unlock()
+}
+
+// made names ch after the variable it was assigned to.
+func (t *chanTracker) made(name string, ch interface{}) {
+	v := r.ValueOf(ch)
+	if v.Kind() != r.Chan || v.IsNil() {
+		return
+	}
+	t.mu.Lock()
+	if len(t.names) >= maxChanNames {
+		t.names = make(map[uintptr]string)
+	}
+	t.names[v.Pointer()] = name
+	t.mu.Unlock()
+}
+
+// chanInfo is a channel shown by `%chans`.
+type chanInfo struct {
+	name     string
+	typ      r.Type
+	len, cap int
+	nil      bool
+}
+
+func (c chanInfo) String() string {
+	if c.nil {
+		return "nil channel"
+	}
+	return fmt.Sprintf("%s (%s) %d/%d", c.name, c.typ, c.len, c.cap)
+}
+
+// chanEdge is the pending operation of a goroutine on a channel, or on no channel for `select {}`.
+type chanEdge struct {
+	goroutine int64
+	op        string
+	ch        int
+}
+
+// chanSnapshot is the state of the channels and of the goroutines blocked on them at a given time.
+type chanSnapshot struct {
+	chans []chanInfo
+	edges []chanEdge
+}
+
+// snapshot returns the channels held by the variables of the session, and the pending operations of the live
+// goroutines. The operations of the goroutines that exited are forgotten.
+func (t *chanTracker) snapshot(ir *classic.Interp) *chanSnapshot {
+	snap := &chanSnapshot{}
+	index := make(map[uintptr]int)
+	add := func(name string, v r.Value) int {
+		ptr := v.Pointer()
+		if i, ok := index[ptr]; ok {
+			return i
+		}
+		index[ptr] = len(snap.chans)
+		if v.IsNil() {
+			snap.chans = append(snap.chans, chanInfo{name: "nil", nil: true})
+		} else {
+			snap.chans = append(snap.chans, chanInfo{name: name, typ: v.Type(), len: v.Len(), cap: v.Cap()})
+		}
+		return index[ptr]
+	}
+
+	binds := ir.Env.Binds.AsMap()
+	var names []string
+	for name, v := range binds {
+		if v.IsValid() && v.Kind() == r.Chan && !v.IsNil() && !strings.HasPrefix(name, "__gophernotes") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, binds[name])
+	}
+
+	live := liveGoroutines()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var waits []*chanWaits
+	for w := range t.waits {
+		if !live[w.goroutine] {
+			delete(t.waits, w)
+			continue
+		}
+		waits = append(waits, w)
+	}
+	sort.Slice(waits, func(i, j int) bool {
+		if waits[i].goroutine != waits[j].goroutine {
+			return waits[i].goroutine < waits[j].goroutine
+		}
+		return waits[i].seq < waits[j].seq
+	})
+	for _, w := range waits {
+		for _, op := range w.ops {
+			ch := -1
+			if op.ch.IsValid() {
+				name, ok := t.names[op.ch.Pointer()]
+				if !ok {
+					name = fmt.Sprintf("chan#%d", len(snap.chans))
+				}
+				ch = add(name, op.ch)
+			}
+			snap.edges = append(snap.edges, chanEdge{w.goroutine, op.op, ch})
+		}
+	}
+	return snap
+}
+
+// mermaidQuoter escapes the quotes of the labels of Mermaid nodes.
+var mermaidQuoter = strings.NewReplacer(`"`, "#quot;")
+
+// mermaid renders the snapshot as a Mermaid flowchart, with arrows from the goroutines to the channels they
+// send to and from the channels to the goroutines receiving from them. The cases of select are dotted.
+func (s *chanSnapshot) mermaid() string {
+	var buf bytes.Buffer
+	buf.WriteString("graph LR\n")
+	for i, c := range s.chans {
+		fmt.Fprintf(&buf, "  ch%d[[\"%s\"]]\n", i, mermaidQuoter.Replace(c.String()))
+	}
+	seen := make(map[int64]bool)
+	for _, e := range s.edges {
+		if !seen[e.goroutine] {
+			seen[e.goroutine] = true
+			fmt.Fprintf(&buf, "  g%d((\"goroutine %d\"))\n", e.goroutine, e.goroutine)
+		}
+		if e.ch < 0 {
+			fmt.Fprintf(&buf, "  style g%d stroke:#d62728\n", e.goroutine)
+			continue
+		}
+		arrow := "-->"
+		if strings.HasPrefix(e.op, "select ") {
+			arrow = "-.->"
+		}
+		if strings.HasSuffix(e.op, "send") {
+			fmt.Fprintf(&buf, "  g%d %s|%s| ch%d\n", e.goroutine, arrow, e.op, e.ch)
+		} else {
+			fmt.Fprintf(&buf, "  ch%d %s|%s| g%d\n", e.ch, arrow, e.op, e.goroutine)
+		}
+	}
+	return buf.String()
+}
+
+// String lists the channels of the snapshot, then the pending operations of each goroutine.
+func (s *chanSnapshot) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("Channels:\n")
+	if len(s.chans) == 0 {
+		buf.WriteString("  none\n")
+	}
+	for _, c := range s.chans {
+		fmt.Fprintf(&buf, "  %s\n", c)
+	}
+	buf.WriteString("Goroutines:\n")
+	if len(s.edges) == 0 {
+		buf.WriteString("  none\n")
+	}
+	for _, e := range s.edges {
+		if e.ch < 0 {
+			fmt.Fprintf(&buf, "  goroutine %d: select {}\n", e.goroutine)
+		} else {
+			fmt.Fprintf(&buf, "  goroutine %d: %s %s\n", e.goroutine, e.op, s.chans[e.ch].name)
+		}
+	}
+	return buf.String()
+}
+
+// instrumentChanOps inserts calls recording the channel operations of nodes when `%chans on` is set: the
+// sends, receives, ranges and selects, as well as naming the channels made. The channel operands must be plain
+// names or fields, as they are evaluated twice. The top-level nodes are instrumented too, except for the last
+// one if it is an expression, as it gives the result of the cell.
+func instrumentChanOps(ir *classic.Interp, nodes []ast.Node) []ast.Node {
+	if !chansOn {
+		return nodes
+	}
+	ir.Env.DefineVar(chanWaitFuncName, r.TypeOf(steps.wait), r.ValueOf(steps.wait))
+	ir.Env.DefineVar(chanRewaitFuncName, r.TypeOf(steps.rewait), r.ValueOf(steps.rewait))
+	ir.Env.DefineVar(chanDoneFuncName, r.TypeOf(steps.done), r.ValueOf(steps.done))
+	ir.Env.DefineVar(chanMadeFuncName, r.TypeOf(chans.made), r.ValueOf(chans.made))
+
+	c := &chanInstrumenter{}
+	instrumentBlocks(nodes, c.stmts)
+
+	var instrumented []ast.Node
+	for i, node := range nodes {
+		var stmt ast.Stmt
+		switch node := node.(type) {
+		case ast.Stmt:
+			stmt = node
+		case ast.Expr:
+			if i < len(nodes)-1 {
+				stmt = &ast.ExprStmt{X: node}
+			}
+		}
+		if stmt == nil {
+			instrumented = append(instrumented, node)
+			continue
+		}
+		stmts := c.stmts([]ast.Stmt{stmt})
+		if len(stmts) == 1 {
+			instrumented = append(instrumented, node)
+			continue
+		}
+		for _, stmt := range stmts {
+			instrumented = append(instrumented, stmt)
+		}
+	}
+	return instrumented
+}
+
+// chanInstrumenter inserts the calls recording the channel operations of a cell. Each operation keeps what
+// chanTracker.wait returns in a variable of its own, numbered by the cell.
+type chanInstrumenter struct {
+	vars int
+}
+
+func chanCall(name string, args ...ast.Expr) ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent(name), Args: args}}
+}
+
+// stmts returns stmts with calls recording their channel operations. The statements inserted by the
+// instrumentations, which have no position, are left alone.
+func (c *chanInstrumenter) stmts(stmts []ast.Stmt) []ast.Stmt {
+	instrumented := make([]ast.Stmt, 0, len(stmts))
+	for _, stmt := range stmts {
+		if !stmt.Pos().IsValid() {
+			instrumented = append(instrumented, stmt)
+			continue
+		}
+		inner := stmt
+		if labeled, ok := stmt.(*ast.LabeledStmt); ok {
+			inner = labeled.Stmt
+		}
+
+		var ops []ast.Expr
+		switch s := inner.(type) {
+		case *ast.SendStmt:
+			if plainExpr(s.Chan) {
+				ops = chanOp(ops, "send", s.Chan)
+			}
+		case *ast.ExprStmt, *ast.AssignStmt:
+			if ch := receivedChan(s); ch != nil {
+				ops = chanOp(ops, "receive", ch)
+			}
+			if name, ok := madeChan(s); ok {
+				instrumented = append(instrumented, stmt, chanCall(chanMadeFuncName,
+					&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(name)}, ast.NewIdent(name)))
+				continue
+			}
+		case *ast.RangeStmt:
+			if plainExpr(s.X) {
+				ops = chanOp(ops, "range", s.X)
+			}
+		case *ast.SelectStmt:
+			ops = selectOps(s)
+			if len(s.Body.List) == 0 {
+				ops = chanOp(ops, "select", ast.NewIdent("nil"))
+			}
+		}
+		if len(ops) == 0 {
+			instrumented = append(instrumented, stmt)
+			continue
+		}
+
+		c.vars++
+		waits := ast.NewIdent(chanWaitsVarName + strconv.Itoa(c.vars))
+		done := chanCall(chanDoneFuncName, waits)
+		instrumented = append(instrumented, &ast.AssignStmt{
+			Lhs: []ast.Expr{waits},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{Fun: ast.NewIdent(chanWaitFuncName), Args: ops}},
+		}, stmt, done)
+		switch s := inner.(type) {
+		case *ast.SelectStmt:
+			// The case run ends the select, if it does not leave the block.
+			for _, clause := range s.Body.List {
+				clause := clause.(*ast.CommClause)
+				clause.Body = append([]ast.Stmt{done}, clause.Body...)
+			}
+		case *ast.RangeStmt:
+			// The range waits for the next value of the channel after each iteration, not while its body runs.
+			rewait := chanCall(chanRewaitFuncName, waits)
+			s.Body.List = append([]ast.Stmt{done}, rewaitContinues(s.Body.List, rewait)...)
+			s.Body.List = append(s.Body.List, rewait)
+		}
+	}
+	return instrumented
+}
+
+// rewaitContinues returns stmts where rewait precedes the continue statements of the loop they are the body
+// of, leaving those of the inner loops and functions alone.
+func rewaitContinues(stmts []ast.Stmt, rewait ast.Stmt) []ast.Stmt {
+	lists := [][]ast.Stmt{stmts}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt, *ast.FuncLit:
+				return false
+			case *ast.BlockStmt:
+				lists = append(lists, n.List)
+			case *ast.CaseClause:
+				lists = append(lists, n.Body)
+			case *ast.CommClause:
+				lists = append(lists, n.Body)
+			}
+			return true
+		})
+	}
+	for _, list := range lists {
+		for i, stmt := range list {
+			if b, ok := stmt.(*ast.BranchStmt); ok && b.Tok == token.CONTINUE && b.Label == nil {
+				list[i] = &ast.BlockStmt{List: []ast.Stmt{rewait, stmt}}
+			}
+		}
+	}
+	return stmts
+}
+
+// chanOp appends the arguments of chanTracker.wait recording the operation op on ch to ops.
+func chanOp(ops []ast.Expr, op string, ch ast.Expr) []ast.Expr {
+	return append(ops, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(op)}, ch)
+}
+
+// selectOps returns the arguments of chanTracker.wait recording the cases of s, or none if one of their
+// channels is not plain.
+func selectOps(s *ast.SelectStmt) []ast.Expr {
+	var ops []ast.Expr
+	for _, clause := range s.Body.List {
+		clause := clause.(*ast.CommClause)
+		switch comm := clause.Comm.(type) {
+		case nil:
+		case *ast.SendStmt:
+			if !plainExpr(comm.Chan) {
+				return nil
+			}
+			ops = chanOp(ops, "select send", comm.Chan)
+		default:
+			ch := receivedChan(comm)
+			if ch == nil {
+				return nil
+			}
+			ops = chanOp(ops, "select receive", ch)
+		}
+	}
+	return ops
+}
+
+// receivedChan returns the channel that stmt receives from, as in `<-ch` or `v, ok := <-ch`, if it is plain.
+func receivedChan(stmt ast.Stmt) ast.Expr {
+	var expr ast.Expr
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		expr = stmt.X
+	case *ast.AssignStmt:
+		if len(stmt.Rhs) == 1 {
+			expr = stmt.Rhs[0]
+		}
+	}
+	if paren, ok := expr.(*ast.ParenExpr); ok {
+		expr = paren.X
+	}
+	if recv, ok := expr.(*ast.UnaryExpr); ok && recv.Op == token.ARROW && plainExpr(recv.X) {
+		return recv.X
+	}
+	return nil
+}
+
+// madeChan returns the name of the variable that stmt assigns a new channel to, as in `ch := make(chan int)`.
+func madeChan(stmt ast.Stmt) (string, bool) {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 || assign.Tok != token.DEFINE && assign.Tok != token.ASSIGN {
+		return "", false
+	}
+	ident, ok := assign.Lhs[0].(*ast.Ident)
+	call, isCall := assign.Rhs[0].(*ast.CallExpr)
+	if !ok || ident.Name == "_" || !isCall || len(call.Args) == 0 {
+		return "", false
+	}
+	if fun, ok := call.Fun.(*ast.Ident); !ok || fun.Name != "make" {
+		return "", false
+	}
+	if _, ok := call.Args[0].(*ast.ChanType); !ok {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+// plainExpr reports whether expr is a name or a field of a name, which can be evaluated again without side
+// effects.
+func plainExpr(expr ast.Expr) bool {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		return expr.Name != "_"
+	case *ast.SelectorExpr:
+		return plainExpr(expr.X)
+	case *ast.ParenExpr:
+		return plainExpr(expr.X)
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChans tests listing the channels of the session and the goroutines blocked on them.
+func TestChans(t *testing.T) {
+	ir := newInterp()
+	if err := chansMagic(ir, nil, []string{"on"}); err != nil {
+		t.Fatal(err)
+	}
+	defer chansMagic(ir, nil, []string{"off"})
+	_, err := doEval(ir, `jobs := make(chan int, 3)
+jobs <- 1
+jobs <- 2
+results := make(chan string)
+go func() {
+	results <- "done"
+}()
+go func() {
+	quit := make(chan bool)
+	var never chan int
+	select {
+	case <-quit:
+	case v := <-never:
+		_ = v
+	}
+}()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snap *chanSnapshot
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if snap = chans.snapshot(ir); len(snap.edges) == 3 {
+			break
+		}
+	}
+	text := snap.String()
+	for _, want := range []string{
+		"jobs (chan int) 2/3",
+		"results (chan string) 0/0",
+		": send results",
+		": select receive quit",
+		": select receive nil",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("\t%s Expected %q in\n%s", failure, want, text)
+		}
+	}
+	if diagram := snap.mermaid(); !strings.Contains(diagram, "-.->|select receive|") || !strings.Contains(diagram, "-->|send|") {
+		t.Errorf("\t%s Expected sends and select cases in\n%s", failure, diagram)
+	}
+
+	// Receiving unblocks the sender.
+	if vals, err := doEval(ir, "msg := <-results\nmsg"); err != nil || len(vals) != 1 || vals[0] != "done" {
+		t.Fatalf("\t%s Expected to receive done but got %v, %v", failure, vals, err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if snap = chans.snapshot(ir); len(snap.edges) == 2 {
+			break
+		}
+	}
+	if text := snap.String(); strings.Contains(text, "send results") {
+		t.Errorf("\t%s Expected the sender to be done in\n%s", failure, text)
+	}
+}
+
+// TestChansRange tests that a range over a channel is blocked only while it waits for the next value, and that
+// the channel operations are not recorded unless %chans on is set.
+func TestChansRange(t *testing.T) {
+	ir := newInterp()
+	if _, err := doEval(ir, "off := make(chan int)\ngo func() { off <- 1 }()"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if snap := chans.snapshot(ir); len(snap.edges) != 0 {
+		t.Errorf("\t%s Expected no operations recorded by default but got\n%s", failure, snap)
+	}
+
+	if err := chansMagic(ir, nil, []string{"on"}); err != nil {
+		t.Fatal(err)
+	}
+	defer chansMagic(ir, nil, []string{"off"})
+	_, err := doEval(ir, `values := make(chan int)
+step := make(chan bool)
+go func() {
+	for v := range values {
+		if v == 0 {
+			continue
+		}
+		<-step
+	}
+}()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(want string) {
+		t.Helper()
+		var text string
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if text = chans.snapshot(ir).String(); strings.Contains(text, want) && strings.Count(text, ": ") == 1 {
+				return
+			}
+		}
+		t.Errorf("\t%s Expected only %q in\n%s", failure, want, text)
+	}
+	expect(": range values")
+	if _, err := doEval(ir, "values <- 1"); err != nil {
+		t.Fatal(err)
+	}
+	expect(": receive step")
+	if _, err := doEval(ir, "step <- true\nvalues <- 0"); err != nil {
+		t.Fatal(err)
+	}
+	expect(": range values")
+}
+
+// TestChansStep tests that the goroutines stepped by %chans step take turns at their channel operations, in the
+// order they started, the same way on every run.
+func TestChansStep(t *testing.T) {
+	ir := newInterp()
+	if err := chansMagic(ir, nil, []string{"step"}); err != nil {
+		t.Fatal(err)
+	}
+	defer chansMagic(ir, nil, []string{"off"})
+	if _, err := doEval(ir, `import (
+	"fmt"
+	"strings"
+)
+
+func worker(name string, out chan string, done chan bool) {
+	for i := 0; i < 3; i++ {
+		out <- fmt.Sprint(name, i)
+	}
+	done <- true
+}`); err != nil {
+		t.Fatal(err)
+	}
+
+	const cell = `out := make(chan string, 100)
+done := make(chan bool)
+go worker("a", out, done)
+go worker("b", out, done)
+go worker("c", out, done)
+<-done
+<-done
+<-done
+close(out)
+var got []string
+for s := range out {
+	got = append(got, s)
+}
+strings.Join(got, " ")`
+	for run := 0; run < 5; run++ {
+		vals, err := doEval(ir, cell)
+		if want := "a0 b0 c0 a1 b1 c1 a2 b2 c2"; err != nil || len(vals) != 1 || vals[0] != want {
+			t.Fatalf("\t%s Expected %q on run %d but got %v, %v", failure, want, run, vals, err)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+	"github.com/nu7hatch/gouuid"
+)
+
+const (
+	// widgetTargetName is the comm target used by the Jupyter widgets front-end.
+	widgetTargetName = "jupyter.widget"
+
+	// widgetProtocolVersion is the version of the Jupyter widgets message protocol spoken by the kernel.
+	widgetProtocolVersion = "2.0.0"
+
+	// widgetControlsVersion is the version of the @jupyter-widgets/controls models the kernel creates.
+	widgetControlsVersion = "1.5.0"
+
+	// widgetViewMIMEType is the MIME type used to display a widget model on the front-end.
+	widgetViewMIMEType = "application/vnd.jupyter.widget-view+json"
+)
+
+// interaction ties the controls displayed by notebook.Interact to the function they drive.
+type interaction struct {
+	fn        reflect.Value
+	args      []reflect.Value
+	controls  []notebook.Control
+	displayID string
+}
+
+// widgetComm is an open comm backing the control of one parameter of an interaction, or a button.
+type widgetComm struct {
+	interaction *interaction
+	arg         int
+
+	// click is called when the button backed by the comm is clicked.
+	click func()
+}
+
+// Interact implements notebook.Kernel.Interact by opening a widget comm per control and displaying
+// the controls followed by the result of the first call to fn.
+func (h *kernelHooks) Interact(fn reflect.Value, controls []notebook.Control) error {
+	receipt, err := h.currentReceipt()
+	if err != nil {
+		return err
+	}
+
+	displayID, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	in := &interaction{
+		fn:        fn,
+		args:      make([]reflect.Value, len(controls)),
+		controls:  controls,
+		displayID: displayID,
+	}
+
+	for i, control := range controls {
+		in.args[i] = control.Value
+
+		commID, err := newUUID()
+		if err != nil {
+			return err
+		}
+
+		state := widgetState(control)
+		data := map[string]interface{}{
+			"state":        state,
+			"buffer_paths": []string{},
+		}
+		metadata := map[string]interface{}{
+			"version": widgetProtocolVersion,
+		}
+		if err := receipt.PublishCommOpen(commID, widgetTargetName, data, metadata); err != nil {
+			return err
+		}
+
+		h.mu.Lock()
+		h.comms[commID] = widgetComm{interaction: in, arg: i}
+		h.mu.Unlock()
+
+		view := bundledMIMEData{
+			"text/plain": fmt.Sprintf("%s: %v", control.Label, control.Value.Interface()),
+			widgetViewMIMEType: map[string]interface{}{
+				"model_id":      commID,
+				"version_major": 2,
+				"version_minor": 0,
+			},
+		}
+		if err := receipt.PublishDisplayData(view, nil, ""); err != nil {
+			return err
+		}
+	}
+
+	return receipt.PublishDisplayData(in.call(), nil, in.displayID)
+}
+
+// Live implements notebook.Kernel.Live by displaying data with a display id, followed by a button opened as a
+// widget comm. The returned function publishes updates on behalf of the current cell, even once it completes.
+func (h *kernelHooks) Live(data display.Data, label string, stop func()) (func(display.Data) error, error) {
+	receipt, err := h.currentReceipt()
+	if err != nil {
+		return nil, err
+	}
+
+	displayID, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	if err := receipt.PublishDisplayData(bundledMIMEData(data), nil, displayID); err != nil {
+		return nil, err
+	}
+
+	commID, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]interface{}{
+		"_model_module":         "@jupyter-widgets/controls",
+		"_model_module_version": widgetControlsVersion,
+		"_model_name":           "ButtonModel",
+		"_view_module":          "@jupyter-widgets/controls",
+		"_view_module_version":  widgetControlsVersion,
+		"_view_name":            "ButtonView",
+		"description":           label,
+		"icon":                  "stop",
+	}
+	if err := receipt.PublishCommOpen(commID, widgetTargetName, map[string]interface{}{
+		"state":        state,
+		"buffer_paths": []string{},
+	}, map[string]interface{}{
+		"version": widgetProtocolVersion,
+	}); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	h.comms[commID] = widgetComm{click: stop}
+	h.mu.Unlock()
+
+	view := bundledMIMEData{
+		"text/plain": label,
+		widgetViewMIMEType: map[string]interface{}{
+			"model_id":      commID,
+			"version_major": 2,
+			"version_minor": 0,
+		},
+	}
+	if err := receipt.PublishDisplayData(view, nil, ""); err != nil {
+		return nil, err
+	}
+
+	return func(data display.Data) error {
+		return receipt.PublishUpdateDisplayData(bundledMIMEData(data), nil, displayID)
+	}, nil
+}
+
+// call runs the interactive function with the current control values and returns its rendered result.
+func (in *interaction) call() (data bundledMIMEData) {
+	defer func() {
+		if r := recover(); r != nil {
+			data = newTextBundledMIMEData(fmt.Sprint("panic: ", r))
+		}
+	}()
+
+	results := in.fn.Call(in.args)
+
+	vals := make([]interface{}, len(results))
+	for i, result := range results {
+		vals[i] = result.Interface()
+	}
+	return renderValues(vals)
+}
+
+// widgetState returns the initial state of the widget model representing control.
+func widgetState(control notebook.Control) map[string]interface{} {
+	state := map[string]interface{}{
+		"_model_module":         "@jupyter-widgets/controls",
+		"_model_module_version": widgetControlsVersion,
+		"_view_module":          "@jupyter-widgets/controls",
+		"_view_module_version":  widgetControlsVersion,
+		"description":           control.Label,
+		"continuous_update":     false,
+	}
+
+	var model string
+	switch control.Type.Kind() {
+	case reflect.Float32, reflect.Float64:
+		model = "FloatSlider"
+		state["min"], state["max"], state["step"] = control.Min, control.Max, control.Step
+		state["value"] = control.Value.Float()
+	case reflect.Bool:
+		model = "Checkbox"
+		state["value"] = control.Value.Bool()
+	case reflect.String:
+		if len(control.Options) > 0 {
+			model = "Dropdown"
+			state["_options_labels"] = control.Options
+			state["index"] = optionIndex(control.Options, control.Value.String())
+		} else {
+			model = "Text"
+			state["value"] = control.Value.String()
+		}
+	default:
+		model = "IntSlider"
+		state["min"], state["max"], state["step"] = int64(control.Min), int64(control.Max), int64(control.Step)
+		state["value"] = control.Value.Interface()
+	}
+
+	state["_model_name"] = model + "Model"
+	state["_view_name"] = model + "View"
+	return state
+}
+
+// handleCommOpen responds to a comm_open request from the front-end. The kernel does not register any
+// comm targets, so the comm is closed right away.
+func handleCommOpen(receipt msgReceipt) {
+	content := receipt.Msg.Content.(map[string]interface{})
+	commID, _ := content["comm_id"].(string)
+
+	if err := receipt.Publish("comm_close",
+		struct {
+			CommID string                 `json:"comm_id"`
+			Data   map[string]interface{} `json:"data"`
+		}{
+			CommID: commID,
+			Data:   make(map[string]interface{}),
+		},
+	); err != nil {
+		log.Printf("Error publishing comm_close: %v\n", err)
+	}
+}
+
+// handleCommMsg responds to a comm_msg sent by the front-end, updating the interaction the comm belongs to. The
+// interactive function runs like a cell: its output is forwarded to the front-end, it can display data and it
+// stops early when the kernel is interrupted.
+func handleCommMsg(ir *classic.Interp, receipt msgReceipt) {
+	content := receipt.Msg.Content.(map[string]interface{})
+	commID, _ := content["comm_id"].(string)
+	data, _ := content["data"].(map[string]interface{})
+
+	hooks.mu.Lock()
+	comm, ok := hooks.comms[commID]
+	hooks.mu.Unlock()
+
+	if !ok || data == nil {
+		return
+	}
+
+	if comm.click != nil {
+		// Buttons send {"method": "custom", "content": {"event": "click"}}.
+		content, _ := data["content"].(map[string]interface{})
+		if data["method"] == "custom" && content["event"] == "click" {
+			comm.click()
+		}
+		return
+	}
+
+	in := comm.interaction
+	control := in.controls[comm.arg]
+
+	switch data["method"] {
+	case "request_state":
+		current := control
+		current.Value = in.args[comm.arg]
+		if err := receipt.PublishCommMsg(commID, map[string]interface{}{
+			"method":       "update",
+			"state":        widgetState(current),
+			"buffer_paths": []string{},
+		}); err != nil {
+			log.Printf("Error publishing comm_msg: %v\n", err)
+		}
+		return
+	case "update":
+	default:
+		return
+	}
+
+	state, _ := data["state"].(map[string]interface{})
+
+	var value interface{}
+	if index, ok := state["index"].(float64); ok && len(control.Options) > 0 {
+		if int(index) < 0 || int(index) >= len(control.Options) {
+			return
+		}
+		value = control.Options[int(index)]
+	} else if value, ok = state["value"]; !ok {
+		return
+	}
+
+	if err := notebook.SetControlValue(in.args[comm.arg], value); err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := receipt.PublishKernelStatus(kernelBusy); err != nil {
+		log.Printf("Error publishing kernel status 'busy': %v\n", err)
+	}
+	defer func() {
+		if err := receipt.PublishKernelStatus(kernelIdle); err != nil {
+			log.Printf("Error publishing kernel status 'idle': %v\n", err)
+		}
+	}()
+
+	execution := hooks.startCell(&receipt, 0)
+	defer hooks.endCell()
+	defineStopCheck(ir, execution)
+
+	restoreStreams, err := redirectStreams(&receipt)
+	if err != nil {
+		log.Printf("Error redirecting the output of the interactive function: %v\n", err)
+		return
+	}
+	result := in.call()
+	restoreStreams()
+	if execution.stopReason() == stopInterrupted {
+		result = newTextBundledMIMEData("Interrupted")
+	}
+
+	if err := receipt.PublishUpdateDisplayData(result, nil, in.displayID); err != nil {
+		log.Printf("Error publishing display update: %v\n", err)
+	}
+}
+
+// handleCommClose forgets a comm closed by the front-end.
+func handleCommClose(receipt msgReceipt) {
+	content := receipt.Msg.Content.(map[string]interface{})
+	commID, _ := content["comm_id"].(string)
+
+	hooks.mu.Lock()
+	delete(hooks.comms, commID)
+	hooks.mu.Unlock()
+}
+
+// handleCommInfoRequest replies to a comm_info_request with the comms currently open.
+func handleCommInfoRequest(receipt msgReceipt) error {
+	comms := make(map[string]interface{})
+
+	hooks.mu.Lock()
+	for commID := range hooks.comms {
+		comms[commID] = map[string]string{"target_name": widgetTargetName}
+	}
+	hooks.mu.Unlock()
+
+	return receipt.Reply("comm_info_reply", map[string]interface{}{
+		"status": "ok",
+		"comms":  comms,
+	})
+}
+
+// optionIndex returns the index of option in options, or 0 if it is not present.
+func optionIndex(options []string, option string) int {
+	for i, o := range options {
+		if o == option {
+			return i
+		}
+	}
+	return 0
+}
+
+// newUUID returns a new random UUID as a string, for use as a comm or display id.
+func newUUID() (string, error) {
+	u, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
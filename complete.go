@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	"path/filepath"
+	r "reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// completionMatching is set by `%completion fuzzy|prefix`: how completions match the identifier before the
+// cursor, see completionRank.
+var completionMatching = "fuzzy"
+
+func init() {
+	lineMagics["completion"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) != 1 || args[0] != "fuzzy" && args[0] != "prefix" {
+			return errors.New("expected fuzzy or prefix")
+		}
+		completionMatching = args[0]
+		return nil
+	}
+}
+
+// completion is a candidate completion of the code before the cursor, along with the metadata shown by
+// front-ends supporting the experimental completion types, like JupyterLab. The typed identifier is matched
+// against trigger if set, as for snippets, otherwise against text.
+type completion struct {
+	text, kind, signature, doc string
+	trigger                    string
+}
+
+// handleCompleteRequest replies to a complete_request with the completions of the identifier before the cursor.
+func handleCompleteRequest(ir *classic.Interp, receipt msgReceipt) error {
+	content := receipt.Msg.Content.(map[string]interface{})
+	code, _ := content["code"].(string)
+	cursor, _ := content["cursor_pos"].(float64)
+	return receipt.Reply("complete_reply", completeReply(ir, code, int(cursor)))
+}
+
+// completeReply returns the content of the complete_reply to code with the cursor at the given position,
+// counted in unicode code points.
+func completeReply(ir *classic.Interp, code string, cursor int) map[string]interface{} {
+	completions, start, end := complete(ir, code, cursor)
+
+	matches := make([]string, len(completions))
+	types := make([]map[string]interface{}, len(completions))
+	for i, c := range completions {
+		matches[i] = c.text
+		types[i] = map[string]interface{}{
+			"start":     start,
+			"end":       end,
+			"text":      c.text,
+			"type":      c.kind,
+			"signature": c.signature,
+			"docstring": c.doc,
+		}
+	}
+
+	return map[string]interface{}{
+		"status":       "ok",
+		"matches":      matches,
+		"cursor_start": start,
+		"cursor_end":   end,
+		"metadata": map[string]interface{}{
+			"_jupyter_types_experimental": types,
+		},
+	}
+}
+
+// complete returns the completions of the identifier before the cursor in code, replacing the code points
+// from start to end. The identifier may be selected from a package or a value, as in `strings.Spl`, or be a
+// keyword, the trigger of a snippet or the key of a struct literal. In
+// import declarations, the import paths are completed instead, and in string literals and magic arguments
+// holding file paths, the files.
+func complete(ir *classic.Interp, code string, cursor int) (completions []completion, start, end int) {
+	runes := []rune(code)
+	if cursor < 0 || cursor > len(runes) {
+		cursor = len(runes)
+	}
+	start = identStart(runes, cursor)
+	prefix := string(runes[start:cursor])
+
+	var candidates []indexedCompletion
+	if path, ok := typedImportPath(runes, cursor); ok {
+		prefix = path
+		start = cursor - len([]rune(path))
+		candidates = indexCompletions(importPathCompletions(path))
+	} else if path, ok := typedPath(runes, cursor); ok {
+		// Complete the last element of the path.
+		_, prefix = filepath.Split(path)
+		start = cursor - len([]rune(prefix))
+		candidates = indexCompletions(pathCompletions(path))
+	} else if start > 0 && runes[start-1] == '.' {
+		recvStart := identStart(runes, start-1)
+		recv := string(runes[recvStart : start-1])
+		if recv == "" {
+			return nil, start, cursor
+		}
+		candidates = memberCompletions(ir, recv)
+	} else {
+		candidates = symbols.scopeCompletions(ir)
+		if fields, ok := literalFieldCompletions(ir, runes, start); ok {
+			candidates = append(indexCompletions(fields), candidates...)
+		}
+	}
+
+	// Sort the matches by rank, then by name, moving their positions rather than the completions.
+	type match struct {
+		i, rank int
+	}
+	matches := make([]match, 0, len(candidates))
+	lower := strings.ToLower(prefix)
+	for i := range candidates {
+		if rank, ok := candidates[i].key.rank(prefix, lower); ok {
+			matches = append(matches, match{i, rank})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return candidates[matches[i].i].text < candidates[matches[j].i].text
+	})
+	if len(matches) > 0 {
+		completions = make([]completion, len(matches))
+		for i, m := range matches {
+			completions[i] = candidates[m.i].completion
+		}
+	}
+	return completions, start, cursor
+}
+
+// completionRank returns how well name matches the identifier typed so far, the lower the better, and whether
+// it matches at all. In "prefix" mode, name must start with the typed identifier. In "fuzzy" mode, matches by
+// prefix come first, then ignoring case, then by the initials of the words of name (camel humps or snake
+// case), then names containing the typed identifier, then those containing its letters in order.
+func completionRank(typed, name string) (int, bool) {
+	return newMatchKey(name).rank(typed, strings.ToLower(typed))
+}
+
+// rank implements completionRank, given the typed identifier in lower case too.
+func (k matchKey) rank(typed, lowerTyped string) (int, bool) {
+	if strings.HasPrefix(k.name, typed) {
+		return 0, true
+	}
+	if completionMatching == "prefix" {
+		return 0, false
+	}
+
+	switch {
+	case strings.HasPrefix(k.lower, lowerTyped):
+		return 1, true
+	case strings.HasPrefix(k.initials, lowerTyped):
+		return 2, true
+	case strings.Contains(k.lower, lowerTyped):
+		return 3, true
+	}
+	rest := []rune(lowerTyped)
+	for _, c := range k.lower {
+		if len(rest) > 0 && rest[0] == c {
+			rest = rest[1:]
+		}
+	}
+	return 4, len(rest) == 0
+}
+
+// wordInitials returns the lower case initials of the words of a camel case or snake case name, e.g. "hw" for
+// handleWriter or handle_writer.
+func wordInitials(name string) string {
+	var initials []rune
+	prev := '_'
+	for _, c := range name {
+		if c != '_' && (prev == '_' || unicode.IsUpper(c) && !unicode.IsUpper(prev) || unicode.IsDigit(c) && !unicode.IsDigit(prev)) {
+			initials = append(initials, unicode.ToLower(c))
+		}
+		prev = c
+	}
+	return string(initials)
+}
+
+// identStart returns the position of the first code point of the identifier ending at end.
+func identStart(runes []rune, end int) int {
+	start := end
+	for start > 0 && (unicode.IsLetter(runes[start-1]) || unicode.IsDigit(runes[start-1]) || runes[start-1] == '_') {
+		start--
+	}
+	return start
+}
+
+// memberCompletions returns the exported symbols of the package imported as recv, or the fields and methods
+// of the value recv.
+func memberCompletions(ir *classic.Interp, recv string) []indexedCompletion {
+	v := ir.ValueOf(recv)
+	if !v.IsValid() {
+		return nil
+	}
+	if ref := packageRef(v); ref != nil {
+		return symbols.packageCompletions(ref)
+	}
+
+	var completions []completion
+	seen := make(map[string]bool)
+	add := func(c completion) {
+		if !seen[c.text] {
+			seen[c.text] = true
+			completions = append(completions, c)
+		}
+	}
+
+	t := v.Type()
+	if t.Kind() == r.Interface && !v.IsNil() {
+		t = v.Elem().Type()
+	}
+	for _, typ := range []r.Type{t, r.PtrTo(t)} {
+		for i := 0; i < typ.NumMethod(); i++ {
+			m := typ.Method(i)
+			if m.PkgPath != "" {
+				continue
+			}
+			// The methods of interface types have no receiver.
+			sig := m.Type.String()
+			if typ.Kind() != r.Interface {
+				sig = methodSignature(m)
+			}
+			add(completion{text: m.Name, kind: "func", signature: sig})
+		}
+		for name := range ir.AllMethods[typ] {
+			add(completion{text: name, kind: "func"})
+		}
+	}
+	if t.Kind() == r.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == r.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			add(completion{text: f.Name, kind: "var", signature: f.Type.String()})
+		}
+	}
+	return indexCompletions(completions)
+}
+
+// packageCompletions returns the exported symbols of the package with the given import path.
+func packageCompletions(path string, pkg imports.Package) []completion {
+	docs := cachedPackageDocs(path)
+
+	var completions []completion
+	for name, v := range pkg.Binds {
+		if !ast.IsExported(name) {
+			continue
+		}
+		c := valueCompletion(name, v)
+		if d, ok := docs[name]; ok {
+			if d.signature != "" {
+				c.signature = d.signature
+			}
+			c.doc = d.doc
+		}
+		completions = append(completions, c)
+	}
+	for name, t := range pkg.Types {
+		if ast.IsExported(name) {
+			c := typeCompletion(name, t)
+			c.doc = docs[name].doc
+			completions = append(completions, c)
+		}
+	}
+	return completions
+}
+
+// valueCompletion returns the completion of a variable, constant, function or package named name.
+func valueCompletion(name string, v r.Value) completion {
+	c := completion{text: name, kind: "const"}
+	if !v.IsValid() {
+		return c
+	}
+	c.signature = v.Type().String()
+	switch {
+	case v.Type() == r.TypeOf((*base.PackageRef)(nil)):
+		c.kind, c.signature = "package", ""
+		if ref, ok := v.Interface().(*base.PackageRef); ok {
+			c.signature = ref.Path
+		}
+	case v.CanAddr():
+		c.kind = "var"
+	case v.Kind() == r.Func:
+		c.kind = "func"
+	}
+	return c
+}
+
+// typeCompletion returns the completion of a type named name.
+func typeCompletion(name string, t r.Type) completion {
+	return completion{text: name, kind: "type", signature: t.Kind().String()}
+}
+
+// methodSignature returns the signature of a method without its receiver.
+func methodSignature(m r.Method) string {
+	var in, out []r.Type
+	for i := 1; i < m.Type.NumIn(); i++ {
+		in = append(in, m.Type.In(i))
+	}
+	for i := 0; i < m.Type.NumOut(); i++ {
+		out = append(out, m.Type.Out(i))
+	}
+	return r.FuncOf(in, out, m.Type.IsVariadic()).String()
+}
+
+// packageDocsCache holds the documentation of the packages completed so far, by import path.
+var packageDocsCache = make(map[string]map[string]pkgSymbol)
+
+// cachedPackageDocs returns packageDocs(path), parsing the source of the package once.
+func cachedPackageDocs(path string) map[string]pkgSymbol {
+	docs, ok := packageDocsCache[path]
+	if !ok {
+		docs = packageDocs(path)
+		packageDocsCache[path] = docs
+	}
+	return docs
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestComplete tests completing the symbols of the session, of packages and of values.
+func TestComplete(t *testing.T) {
+	ir := newInterp()
+	if _, err := doEval(ir, `import ("strings"; "net/url")
+type point struct{ X, Y int }
+func (p point) Norm() int { return p.X*p.X + p.Y*p.Y }
+completeMe := point{1, 2}
+const completeConst = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { completionMatching = "fuzzy" }()
+	completionMatching = "prefix"
+
+	cases := []struct {
+		code       string
+		cursor     int
+		start, end int
+		want       []string
+	}{
+		{"x := completeM", -1, 5, 14, []string{"completeMe"}},
+		{"strings.SplitA", -1, 8, 14, []string{"SplitAfter", "SplitAfterN"}},
+		{"completeMe.\nfoo", 11, 11, 11, []string{"Norm", "X", "Y"}},
+		{"é := strings.Tr(", 15, 13, 15, []string{"Trim", "TrimFunc", "TrimLeft", "TrimLeftFunc", "TrimPrefix", "TrimRight", "TrimRightFunc", "TrimSpace", "TrimSuffix"}},
+		{"missing.X", -1, 8, 9, nil},
+		{"p := point{X: 1,\n\tY", -1, 18, 19, []string{"Y: "}},
+		{"u := url.URL{Sch", -1, 13, 16, []string{"Scheme: "}},
+		{"fmt.Println(point{1, 2}, Y", -1, 25, 26, nil},
+		{"if true {\n\tgot", -1, 11, 14, []string{"goto"}},
+		{"iferr", -1, 0, 5, []string{"if err != nil {\n\tpanic(err)\n}"}},
+	}
+	for _, c := range cases {
+		completions, start, end := complete(ir, c.code, c.cursor)
+		var got []string
+		for _, comp := range completions {
+			got = append(got, comp.text)
+		}
+		if start != c.start || end != c.end || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("\t%s complete(%q) = %v, %d, %d, want %v, %d, %d", failure, c.code, got, start, end, c.want, c.start, c.end)
+		}
+	}
+
+	reply := completeReply(ir, "strings.SplitAfterN", -1)
+	types := reply["metadata"].(map[string]interface{})["_jupyter_types_experimental"].([]map[string]interface{})
+	if len(types) != 1 || types[0]["type"] != "func" || types[0]["signature"] != "func SplitAfterN(s, sep string, n int) []string" || types[0]["docstring"] == "" {
+		t.Errorf("\t%s Expected the metadata of strings.SplitAfterN but got %v", failure, types)
+	}
+}
+
+// TestCompletionRank tests ranking fuzzy completions.
+func TestCompletionRank(t *testing.T) {
+	names := []string{"handleWriter", "HandleWrite", "handler", "withHandler", "hdw", "shadow", "Hollow"}
+	var got []string
+	for _, name := range names {
+		if rank, ok := completionRank("hw", name); ok {
+			got = append(got, fmt.Sprintf("%s:%d", name, rank))
+		}
+	}
+	want := []string{"handleWriter:2", "HandleWrite:2", "hdw:4", "shadow:4", "Hollow:4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\t%s Expected the ranks %v but got %v", failure, want, got)
+	}
+
+	if rank, ok := completionRank("hand", "Handler"); !ok || rank != 1 {
+		t.Errorf("\t%s Expected a case insensitive prefix match but got %d, %v", failure, rank, ok)
+	}
+	if rank, ok := completionRank("dle", "handler"); !ok || rank != 3 {
+		t.Errorf("\t%s Expected a substring match but got %d, %v", failure, rank, ok)
+	}
+	if initials := wordInitials("parse_HTTPHeader2"); initials != "ph2" {
+		t.Errorf("\t%s wordInitials = %q, want ph2", failure, initials)
+	}
+}
+
+// TestCompletePath tests completing file paths in string literals and magic arguments.
+func TestCompletePath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"data.csv", "data.json", ".hidden"} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0600)
+	}
+	os.Mkdir(filepath.Join(dir, "datasets"), 0700)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	ir := newInterp()
+	cases := []struct {
+		code       string
+		start, end int
+		want       []string
+	}{
+		{`f, err := os.Open("dat`, 19, 22, []string{"data.csv", "data.json", "datasets/"}},
+		{`ioutil.ReadFile(` + "`./datasets/", 28, 28, nil},
+		{`x := "./data.j`, 8, 14, []string{"data.json"}},
+		{`x := "data.j`, 11, 12, nil},
+		{`s := "os.Open(\"dat" + data`, 23, 27, nil},
+		{"%rpc ./.h", 7, 9, []string{".hidden"}},
+	}
+	for _, c := range cases {
+		completions, start, end := complete(ir, c.code, -1)
+		var got []string
+		for _, comp := range completions {
+			if comp.kind == "path" {
+				got = append(got, comp.text)
+			}
+		}
+		if start != c.start || end != c.end || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("\t%s complete(%q) = %v, %d, %d, want %v, %d, %d", failure, c.code, got, start, end, c.want, c.start, c.end)
+		}
+	}
+}
+
+// TestCompleteImportPath tests completing import paths from the standard library, the GOPATH and go.mod.
+func TestCompleteImportPath(t *testing.T) {
+	defer setTestGOPATH(t, map[string]map[string]string{
+		"example.com/greet":       {"greet.go": "package greet\n"},
+		"example.com/greet/fancy": {"fancy.go": "package fancy\n"},
+	})()
+
+	dir, err := ioutil.TempDir("", "complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gomod := "module example.org/notebook\n\nrequire (\n\tgithub.com/pkg/errors v0.9.1\n)\n"
+	ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0600)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	defer func() { completionMatching = "fuzzy" }()
+	completionMatching = "prefix"
+
+	ir := newInterp()
+	cases := []struct {
+		code       string
+		start, end int
+		want       []string
+	}{
+		{`import "net/http/httpt`, 8, 22, []string{"net/http/httptest", "net/http/httptrace"}},
+		{"import (\n\t\"fmt\"\n\ts \"strc", 20, 24, []string{"strconv"}},
+		{`import "example.com/greet/`, 8, 26, []string{"example.com/greet/fancy"}},
+		{`import _ "github.com/pkg/`, 10, 25, []string{"github.com/pkg/errors"}},
+		{"import \"fmt\"\nx := \"strc", 19, 23, nil},
+	}
+	for _, c := range cases {
+		completions, start, end := complete(ir, c.code, -1)
+		var got []string
+		for _, comp := range completions {
+			got = append(got, comp.text)
+		}
+		if start != c.start || end != c.end || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("\t%s complete(%q) = %v, %d, %d, want %v, %d, %d", failure, c.code, got, start, end, c.want, c.start, c.end)
+		}
+	}
+}
+
+// TestCompletionIndex tests updating the completion index after redefining a symbol.
+func TestCompletionIndex(t *testing.T) {
+	ir := newInterp()
+	for _, code := range []string{"indexed := 1", "indexed := \"one\""} {
+		if _, err := doEval(ir, code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	completions, _, _ := complete(ir, "indexe", -1)
+	if len(completions) == 0 || completions[0].text != "indexed" || completions[0].signature != "string" {
+		t.Errorf("\t%s Expected the completion of indexed as a string but got %v", failure, completions)
+	}
+}
+
+// BenchmarkComplete measures the latency of completing in a session with many symbols, which should stay
+// well below 10ms.
+func BenchmarkComplete(b *testing.B) {
+	ir := newInterp()
+	var code strings.Builder
+	code.WriteString("import (\"strings\"; \"net/http\"; \"os\")\n")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&code, "var value%d = %d\n", i, i)
+	}
+	if _, err := doEval(ir, code.String()); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, typed := range []string{"val", "vl1", "strings.Spl", "http.StatusN"} {
+		b.Run(typed, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				complete(ir, typed, -1)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// typedImportPath returns the import path typed before the cursor, if the cursor is in the path of an import
+// declaration, as in `import "net/ht` or in an `import (...)` block.
+func typedImportPath(runes []rune, cursor int) (string, bool) {
+	quote, ok := stringLiteralStart(runes, cursor)
+	if !ok {
+		return "", false
+	}
+	lineStart := quote
+	for lineStart > 0 && runes[lineStart-1] != '\n' {
+		lineStart--
+	}
+
+	// Skip the name of the package, if any.
+	fields := strings.Fields(string(runes[lineStart:quote]))
+	if n := len(fields); n > 0 && fields[n-1] != "import" && fields[n-1] != "(" {
+		name := []rune(fields[n-1])
+		if string(name) == "." || identStart(name, len(name)) == 0 {
+			fields = fields[:n-1]
+		}
+	}
+
+	inSpec := false
+	switch strings.Join(fields, " ") {
+	case "import", "import (":
+		inSpec = true
+	case "":
+		// In an import block, the preceding lines are other import specs.
+		before := string(runes[:lineStart])
+		if i := strings.LastIndex(before, "import"); i >= 0 {
+			rest := strings.TrimSpace(before[i+len("import"):])
+			inSpec = strings.HasPrefix(rest, "(") && !strings.Contains(rest, ")")
+		}
+	}
+	return string(runes[quote+1 : cursor]), inSpec
+}
+
+// importPathCompletions returns the import paths completing path: the packages known to the interpreter,
+// including the standard library, the modules required by the go.mod file of the working directory, and the
+// directories of the GOPATH and of the module cache below the last slash of path.
+func importPathCompletions(path string) []completion {
+	seen := make(map[string]bool)
+	var completions []completion
+	add := func(p, kind string) {
+		if !seen[p] && !strings.Contains("/"+p+"/", "/internal/") && !strings.Contains("/"+p+"/", "/vendor/") && p != "main" {
+			seen[p] = true
+			completions = append(completions, completion{text: p, kind: kind})
+		}
+	}
+
+	for p := range imports.Packages {
+		add(p, "package")
+	}
+	for _, p := range goModRequires("go.mod") {
+		add(p, "module")
+	}
+
+	dir := path[:strings.LastIndexByte(path, '/')+1]
+	gopath := build.Default.GOPATH
+	for _, root := range filepath.SplitList(gopath) {
+		for _, name := range subdirs(filepath.Join(root, "src", filepath.FromSlash(dir))) {
+			add(dir+name, "package")
+		}
+		for _, name := range subdirs(filepath.Join(root, "pkg", "mod", filepath.FromSlash(escapeModulePath(dir)))) {
+			if name == "cache" && dir == "" {
+				continue
+			}
+			if at := strings.IndexByte(name, '@'); at >= 0 {
+				name = name[:at]
+			}
+			add(dir+unescapeModulePath(name), "module")
+		}
+	}
+	return completions
+}
+
+// subdirs returns the names of the visible subdirectories of dir.
+func subdirs(dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() && !strings.HasPrefix(info.Name(), ".") && !strings.HasPrefix(info.Name(), "_") {
+			names = append(names, info.Name())
+		}
+	}
+	return names
+}
+
+// goModRequires returns the module paths of the module and of the requirements of a go.mod file.
+func goModRequires(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var paths []string
+	inRequire := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "//"):
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire:
+			paths = append(paths, fields[0])
+		case fields[0] == "module" && len(fields) > 1:
+			paths = append(paths, strings.Trim(fields[1], `"`))
+		case fields[0] == "require" && len(fields) > 1 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) > 1:
+			paths = append(paths, fields[1])
+		}
+	}
+	return paths
+}
+
+// escapeModulePath escapes the upper case letters of a path as the module cache does, e.g. "!azure" for "Azure".
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, c := range path {
+		if unicode.IsUpper(c) {
+			b.WriteByte('!')
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// unescapeModulePath reverses escapeModulePath: the module cache escapes upper case letters as '!' followed by
+// the lower case letter.
+func unescapeModulePath(path string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range path {
+		switch {
+		case c == '!':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(c))
+			upper = false
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	r "reflect"
+	"strings"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// matchKey holds the forms of a name compared with the typed identifier, computed once per name.
+type matchKey struct {
+	name, lower, initials string
+}
+
+func newMatchKey(name string) matchKey {
+	return matchKey{name: name, lower: strings.ToLower(name), initials: wordInitials(name)}
+}
+
+// indexedCompletion is a completion along with its match key and, for symbols of the session, the type it was
+// computed from.
+type indexedCompletion struct {
+	completion
+	key matchKey
+	typ r.Type
+}
+
+func newIndexedCompletion(c completion) indexedCompletion {
+	name := c.text
+	if c.trigger != "" {
+		name = c.trigger
+	}
+	return indexedCompletion{completion: c, key: newMatchKey(name)}
+}
+
+// completionIndex holds the completions of the symbols in scope and of the imported packages, so that completing
+// does not scan the whole session on every keystroke. It is updated after each execution, recomputing only the
+// completions of the symbols the execution defined or redefined.
+type completionIndex struct {
+	ir  *classic.Interp
+	env *classic.Env
+
+	// The builtins, keywords and snippets, which never change, and the symbols of the session by name.
+	static  []indexedCompletion
+	session map[string]indexedCompletion
+	scope   []indexedCompletion
+
+	// The exported symbols of the packages completed so far, by import path.
+	packages map[string][]indexedCompletion
+}
+
+// symbols is the completion index of the interpreter of the kernel.
+var symbols = completionIndex{packages: make(map[string][]indexedCompletion)}
+
+// update brings the index up to date with the symbols of ir.
+func (x *completionIndex) update(ir *classic.Interp) {
+	if x.ir != ir {
+		x.ir = ir
+		x.static = append(indexCompletions(envCompletions(ir.Env.TopEnv())), indexCompletions(syntaxCompletions())...)
+	}
+	if x.env != ir.Env {
+		x.env = ir.Env
+		x.session = make(map[string]indexedCompletion)
+	}
+
+	// The innermost symbols shadow the outer ones.
+	seen := make(map[string]bool)
+	for env := ir.Env; env != nil && env.Outer != nil; env = env.Outer {
+		for name, v := range env.Binds.AsMap() {
+			if seen[name] || strings.HasPrefix(name, "__gophernotes") {
+				continue
+			}
+			seen[name] = true
+			// Package references all have the same type, and may be rebound to another package.
+			if old, ok := x.session[name]; ok && v.IsValid() && old.typ == v.Type() && old.kind != "package" {
+				continue
+			}
+			c := newIndexedCompletion(valueCompletion(name, v))
+			if v.IsValid() {
+				c.typ = v.Type()
+			}
+			x.session[name] = c
+		}
+		for name, t := range env.Types.AsMap() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if old, ok := x.session[name]; ok && old.kind == "type" && old.typ == t {
+				continue
+			}
+			c := newIndexedCompletion(typeCompletion(name, t))
+			c.typ = t
+			x.session[name] = c
+		}
+	}
+	for name := range x.session {
+		if !seen[name] {
+			delete(x.session, name)
+		}
+	}
+
+	x.scope = x.scope[:0]
+	for _, c := range x.session {
+		x.scope = append(x.scope, c)
+	}
+	for _, c := range x.static {
+		if !seen[c.text] {
+			x.scope = append(x.scope, c)
+		}
+	}
+}
+
+// scopeCompletions returns the symbols of the session, the builtins, the keywords and the snippets.
+func (x *completionIndex) scopeCompletions(ir *classic.Interp) []indexedCompletion {
+	if x.ir != ir || x.env != ir.Env {
+		x.update(ir)
+	}
+	return x.scope
+}
+
+// packageCompletions returns the exported symbols of the package with the given import path.
+func (x *completionIndex) packageCompletions(ref *base.PackageRef) []indexedCompletion {
+	completions, ok := x.packages[ref.Path]
+	if !ok {
+		completions = indexCompletions(packageCompletions(ref.Path, ref.Package))
+		x.packages[ref.Path] = completions
+	}
+	return completions
+}
+
+// envCompletions returns the symbols bound in env.
+func envCompletions(env *classic.Env) []completion {
+	var completions []completion
+	for name, v := range env.Binds.AsMap() {
+		completions = append(completions, valueCompletion(name, v))
+	}
+	for name, t := range env.Types.AsMap() {
+		completions = append(completions, typeCompletion(name, t))
+	}
+	return completions
+}
+
+// indexCompletions computes the match keys of completions.
+func indexCompletions(completions []completion) []indexedCompletion {
+	indexed := make([]indexedCompletion, len(completions))
+	for i, c := range completions {
+		indexed[i] = newIndexedCompletion(c)
+	}
+	return indexed
+}
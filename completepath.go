@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// pathFuncs are the functions whose first argument is a file path, completed when typed as a string literal.
+var pathFuncs = map[string]bool{
+	"os.Open": true, "os.OpenFile": true, "os.Create": true, "os.ReadFile": true, "os.WriteFile": true,
+	"os.Stat": true, "os.Lstat": true, "os.ReadDir": true, "os.Remove": true, "os.RemoveAll": true,
+	"os.Mkdir": true, "os.MkdirAll": true, "os.Chdir": true,
+	"ioutil.ReadFile": true, "ioutil.WriteFile": true, "ioutil.ReadDir": true,
+	"filepath.Glob": true, "filepath.Abs": true,
+}
+
+// typedPath returns the file path typed before the cursor, if it is the first argument of one of pathFuncs,
+// another string literal looking like a path, or an argument of a line magic looking like a path.
+func typedPath(runes []rune, cursor int) (string, bool) {
+	lineStart := cursor
+	for lineStart > 0 && runes[lineStart-1] != '\n' {
+		lineStart--
+	}
+	line := string(runes[lineStart:cursor])
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "%") {
+		word := line[strings.LastIndexAny(line, " \t")+1:]
+		return word, word != trimmed && isPathLike(word)
+	}
+
+	quote, ok := stringLiteralStart(runes, cursor)
+	if !ok {
+		return "", false
+	}
+	path := string(runes[quote+1 : cursor])
+
+	// Find the function called with the literal as first argument.
+	end := quote
+	for end > 0 && unicode.IsSpace(runes[end-1]) {
+		end--
+	}
+	if end > 0 && runes[end-1] == '(' {
+		start := end - 1
+		for start > 0 && (runes[start-1] == '.' || runes[start-1] == '_' || unicode.IsLetter(runes[start-1]) || unicode.IsDigit(runes[start-1])) {
+			start--
+		}
+		if pathFuncs[string(runes[start:end-1])] {
+			return path, true
+		}
+	}
+	return path, isPathLike(path)
+}
+
+// isPathLike reports whether s looks like the beginning of a file path.
+func isPathLike(s string) bool {
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, "./") || strings.HasPrefix(s, "../") ||
+		strings.HasPrefix(s, "~/") || s == "." || s == ".." || s == "~"
+}
+
+// stringLiteralStart returns the position of the quote opening the string literal the cursor is in, if any.
+func stringLiteralStart(runes []rune, cursor int) (int, bool) {
+	const (
+		code = iota
+		interpreted
+		raw
+		char
+		lineComment
+		blockComment
+	)
+	state, start := code, 0
+	for i := 0; i < cursor; i++ {
+		c := runes[i]
+		switch state {
+		case code:
+			switch {
+			case c == '"':
+				state, start = interpreted, i
+			case c == '`':
+				state, start = raw, i
+			case c == '\'':
+				state = char
+			case c == '/' && i+1 < cursor && runes[i+1] == '/':
+				state = lineComment
+			case c == '/' && i+1 < cursor && runes[i+1] == '*':
+				state, i = blockComment, i+1
+			}
+		case interpreted, char:
+			if c == '\\' {
+				i++
+			} else if c == '"' && state == interpreted || c == '\'' && state == char || c == '\n' {
+				state = code
+			}
+		case raw:
+			if c == '`' {
+				state = code
+			}
+		case lineComment:
+			if c == '\n' {
+				state = code
+			}
+		case blockComment:
+			if c == '*' && i+1 < cursor && runes[i+1] == '/' {
+				state, i = code, i+1
+			}
+		}
+	}
+	return start, state == interpreted || state == raw
+}
+
+// pathCompletions returns the files and directories completing the last element of path, relative to the
+// working directory. Directories end with a slash. Hidden files are only completed after a dot.
+func pathCompletions(path string) []completion {
+	dir, base := filepath.Split(path)
+	if strings.HasPrefix(dir, "~/") {
+		dir = filepath.Join(os.Getenv("HOME"), dir[2:])
+	} else if path == "~" {
+		return []completion{{text: "~/", kind: "path"}}
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var completions []completion
+	for _, info := range infos {
+		name := info.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		c := completion{text: name, kind: "path", signature: info.Mode().String()}
+		if info.IsDir() {
+			c.text += "/"
+		}
+		completions = append(completions, c)
+	}
+	return completions
+}
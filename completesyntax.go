@@ -0,0 +1,131 @@
+package main
+
+import (
+	"go/ast"
+	r "reflect"
+	"strings"
+	"unicode"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// goKeywords are the keywords of Go, completed along with the symbols of the session.
+var goKeywords = []string{
+	"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func",
+	"go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct",
+	"switch", "type", "var",
+}
+
+// snippets are the common statements completed by their trigger, inserting the whole statement.
+var snippets = []completion{
+	{trigger: "forr", text: "for i, v := range x {\n\t\n}", signature: "for range loop"},
+	{trigger: "fori", text: "for i := 0; i < n; i++ {\n\t\n}", signature: "for loop"},
+	{trigger: "iferr", text: "if err != nil {\n\tpanic(err)\n}", signature: "check error"},
+	{trigger: "func", text: "func name() {\n\t\n}", signature: "function declaration"},
+	{trigger: "switch", text: "switch x {\ncase :\ndefault:\n}", signature: "switch statement"},
+	{trigger: "select", text: "select {\ncase v := <-ch:\ndefault:\n}", signature: "select statement"},
+}
+
+// syntaxCompletions returns the keywords of Go and the snippets.
+func syntaxCompletions() []completion {
+	completions := make([]completion, 0, len(goKeywords)+len(snippets))
+	for _, k := range goKeywords {
+		completions = append(completions, completion{text: k, kind: "keyword"})
+	}
+	for _, s := range snippets {
+		s.kind = "snippet"
+		completions = append(completions, s)
+	}
+	return completions
+}
+
+// literalFieldCompletions returns the fields of the struct type of the composite literal the identifier
+// starting at start is a key of, as in `point{X: 1, Y`, followed by a colon. ok is false outside of the keys
+// of a struct literal.
+func literalFieldCompletions(ir *classic.Interp, runes []rune, start int) (completions []completion, ok bool) {
+	typ := compositeLiteralType(runes, start)
+	if typ == "" {
+		return nil, false
+	}
+	t, exported := literalType(ir, typ)
+	if t == nil {
+		return nil, false
+	}
+	if t.Kind() == r.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != r.Struct {
+		return nil, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if exported && !ast.IsExported(f.Name) {
+			continue
+		}
+		completions = append(completions, completion{trigger: f.Name, text: f.Name + ": ", kind: "var", signature: f.Type.String()})
+	}
+	return completions, true
+}
+
+// compositeLiteralType returns the type, as typed, of the composite literal enclosing the position start, if
+// start is where a key of the literal begins: right after its opening brace or after a comma.
+func compositeLiteralType(runes []rune, start int) string {
+	i := start
+	for i > 0 && unicode.IsSpace(runes[i-1]) {
+		i--
+	}
+	if i == 0 || runes[i-1] != '{' && runes[i-1] != ',' {
+		return ""
+	}
+
+	// Find the unclosed brace.
+	depth := 0
+	brace := -1
+	for j := i - 1; j >= 0 && brace < 0; j-- {
+		switch runes[j] {
+		case '}', ')', ']':
+			depth++
+		case '(', '[':
+			if depth == 0 {
+				// A call or an index, not a literal.
+				return ""
+			}
+			depth--
+		case '{':
+			if depth == 0 {
+				brace = j
+			}
+			depth--
+		}
+	}
+	if brace < 0 {
+		return ""
+	}
+	typeStart := brace
+	for typeStart > 0 && (runes[typeStart-1] == '.' || runes[typeStart-1] == '_' ||
+		unicode.IsLetter(runes[typeStart-1]) || unicode.IsDigit(runes[typeStart-1])) {
+		typeStart--
+	}
+	return string(runes[typeStart:brace])
+}
+
+// literalType returns the type named typ, either declared in the session or qualified by an imported package,
+// and whether only its exported fields are accessible. It returns nil for unknown types.
+func literalType(ir *classic.Interp, typ string) (r.Type, bool) {
+	if dot := strings.IndexByte(typ, '.'); dot >= 0 {
+		v := ir.ValueOf(typ[:dot])
+		if !v.IsValid() {
+			return nil, false
+		}
+		if ref := packageRef(v); ref != nil {
+			return ref.Types[typ[dot+1:]], true
+		}
+		return nil, false
+	}
+	for env := ir.Env; env != nil; env = env.Outer {
+		if t, ok := env.Types.Get(typ); ok {
+			return t, false
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	r "reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// newBuilderFuncName is the name of the function creating the builders accumulating the strings
+	// concatenated by loops.
+	newBuilderFuncName = "__gophernotesNewBuilder"
+
+	// builderVarPrefix prefixes the names of the variables holding the builders.
+	builderVarPrefix = "__gophernotesBuilder"
+)
+
+var stringType = r.TypeOf("")
+
+// newBuilder returns a builder starting with s.
+func newBuilder(s string) *strings.Builder {
+	b := new(strings.Builder)
+	b.WriteString(s)
+	return b
+}
+
+// concatRewriter rewrites the loops of a cell that build strings with +=.
+type concatRewriter struct {
+	ir *classic.Interp
+
+	// decls counts the declarations of each name in the cell, and strings holds the names declared once as
+	// strings.
+	decls   map[string]int
+	strings map[string]bool
+
+	// builders counts the builders declared so far, to name them.
+	builders int
+}
+
+// rewriteConcatLoops rewrites the loops of nodes that append to a string with `s += x`, which copies s each
+// time and takes a time quadratic in the length of the result, so that they write to a strings.Builder
+// instead and assign its content to s once the loop ends. Only the loops that do not read s otherwise, nor
+// leave early with return, goto or labeled branches, nor create closures or goroutines or call functions that
+// could see s, are rewritten. Should the loop panic, s holds what was appended to it until then.
+func rewriteConcatLoops(ir *classic.Interp, nodes []ast.Node) {
+	cr := &concatRewriter{ir: ir, decls: make(map[string]int), strings: make(map[string]bool)}
+	cr.collectDecls(nodes)
+
+	rewritten := false
+	for i, node := range nodes {
+		if stmt, ok := node.(ast.Stmt); ok {
+			if block := cr.rewriteLoop(stmt); block != nil {
+				nodes[i] = block
+				rewritten = true
+			}
+		}
+	}
+	instrumentBlocks(nodes, func(stmts []ast.Stmt) []ast.Stmt {
+		for i, stmt := range stmts {
+			if block := cr.rewriteLoop(stmt); block != nil {
+				stmts[i] = block
+				rewritten = true
+			}
+		}
+		return stmts
+	})
+	if rewritten {
+		ir.Env.DefineVar(newBuilderFuncName, r.TypeOf(newBuilder), r.ValueOf(newBuilder))
+	}
+}
+
+// collectDecls counts the declarations of nodes, and notes those of strings.
+func (cr *concatRewriter) collectDecls(nodes []ast.Node) {
+	declare := func(ident ast.Expr, isString bool) {
+		if ident, ok := ident.(*ast.Ident); ok {
+			cr.decls[ident.Name]++
+			cr.strings[ident.Name] = isString
+		}
+	}
+	isStringType := func(expr ast.Expr) bool {
+		ident, ok := expr.(*ast.Ident)
+		return ok && ident.Name == "string"
+	}
+	isStringLit := func(exprs []ast.Expr, i int) bool {
+		if len(exprs) == 0 || i >= len(exprs) {
+			return false
+		}
+		lit, ok := exprs[i].(*ast.BasicLit)
+		return ok && lit.Kind == token.STRING
+	}
+
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				declare(n.Name, false)
+			case *ast.Field:
+				for _, name := range n.Names {
+					declare(name, isStringType(n.Type))
+				}
+			case *ast.ValueSpec:
+				for i, name := range n.Names {
+					declare(name, isStringType(n.Type) || n.Type == nil && len(n.Values) == len(n.Names) && isStringLit(n.Values, i))
+				}
+			case *ast.TypeSpec:
+				declare(n.Name, false)
+			case *ast.AssignStmt:
+				if n.Tok == token.DEFINE {
+					for i, lhs := range n.Lhs {
+						declare(lhs, len(n.Lhs) == len(n.Rhs) && isStringLit(n.Rhs, i))
+					}
+				}
+			case *ast.RangeStmt:
+				if n.Tok == token.DEFINE {
+					declare(n.Key, false)
+					declare(n.Value, false)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// isString reports whether name is a variable of type string: declared once in the cell as a string, or not
+// declared in the cell and holding a string in the session.
+func (cr *concatRewriter) isString(name string) bool {
+	switch cr.decls[name] {
+	case 0:
+		v := cr.ir.Env.ValueOf(name)
+		return v.IsValid() && v.Type() == stringType
+	case 1:
+		return cr.strings[name]
+	}
+	return false
+}
+
+// rewriteLoop returns the block replacing stmt if it is a loop concatenating strings that can be rewritten, or
+// nil.
+func (cr *concatRewriter) rewriteLoop(stmt ast.Stmt) ast.Stmt {
+	switch stmt.(type) {
+	case *ast.ForStmt, *ast.RangeStmt:
+	default:
+		return nil
+	}
+
+	// Find the variables appended to by statements of the blocks of the loop, and the uses of all the names.
+	// A call to a function could read the variables, so only calls to builtins and conversions are allowed.
+	escapes := false
+	uses := make(map[string]int)
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ReturnStmt, *ast.FuncLit, *ast.DeferStmt, *ast.GoStmt:
+			escapes = true
+		case *ast.BranchStmt:
+			escapes = escapes || n.Tok == token.GOTO || n.Label != nil
+		case *ast.CallExpr:
+			escapes = !cr.isPureCall(n)
+		case *ast.Ident:
+			uses[n.Name]++
+		}
+		return !escapes
+	})
+	if escapes {
+		return nil
+	}
+	var order []string
+	appended := make(map[string]int)
+	forEachStmt(stmt, func(stmts []ast.Stmt, i int) {
+		if assign := concatAssign(stmts[i]); assign != nil {
+			name := assign.Lhs[0].(*ast.Ident).Name
+			if appended[name] == 0 {
+				order = append(order, name)
+			}
+			appended[name]++
+		}
+	})
+
+	// Rewrite the variables that are only appended to.
+	builders := make(map[string]string)
+	var names []string
+	for _, name := range order {
+		if appended[name] != uses[name] || !cr.isString(name) {
+			continue
+		}
+		builders[name] = builderVarPrefix + strconv.Itoa(cr.builders)
+		cr.builders++
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	forEachStmt(stmt, func(stmts []ast.Stmt, i int) {
+		assign := concatAssign(stmts[i])
+		if assign == nil {
+			return
+		}
+		if builder := builders[assign.Lhs[0].(*ast.Ident).Name]; builder != "" {
+			stmts[i] = &ast.ExprStmt{X: &ast.CallExpr{
+				Fun:    &ast.SelectorExpr{X: ast.NewIdent(builder), Sel: ast.NewIdent("WriteString")},
+				Lparen: assign.Pos(),
+				Args:   assign.Rhs,
+			}}
+		}
+	})
+
+	// The statements before and after the loop have no position, so that trace and coverage skip them. The
+	// strings are assigned by a deferred function, so that they hold what was appended even if the loop panics.
+	block := &ast.BlockStmt{}
+	for _, name := range names {
+		block.List = append(block.List, &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(builders[name])},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{Fun: ast.NewIdent(newBuilderFuncName), Args: []ast.Expr{ast.NewIdent(name)}}},
+		})
+	}
+	assign := &ast.BlockStmt{}
+	for _, name := range names {
+		assign.List = append(assign.List, &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(name)},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{&ast.CallExpr{Fun: &ast.SelectorExpr{X: ast.NewIdent(builders[name]), Sel: ast.NewIdent("String")}}},
+		})
+	}
+	loop := &ast.FuncLit{Type: &ast.FuncType{Params: &ast.FieldList{}}, Body: &ast.BlockStmt{List: []ast.Stmt{
+		&ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.FuncLit{Type: &ast.FuncType{Params: &ast.FieldList{}}, Body: assign}}},
+		stmt,
+	}}}
+	block.List = append(block.List, &ast.ExprStmt{X: &ast.CallExpr{Fun: loop}})
+	return block
+}
+
+// pureBuiltins are the builtin functions that cannot read a variable unless it is passed to them.
+var pureBuiltins = map[string]bool{
+	"append": true, "cap": true, "complex": true, "copy": true, "imag": true, "len": true, "make": true, "new": true,
+	"real": true,
+}
+
+// isPureCall reports whether call is a conversion, or a call to a builtin function that cannot read the
+// variables it is not passed, neither redefined by the cell nor by the session.
+func (cr *concatRewriter) isPureCall(call *ast.CallExpr) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.ArrayType:
+		return true
+	case *ast.ParenExpr:
+		_, ok := fun.X.(*ast.ArrayType)
+		return ok
+	case *ast.Ident:
+		if cr.decls[fun.Name] > 0 {
+			return false
+		}
+		// The builtins are defined in the outermost environment of the interpreter.
+		for env := cr.ir.Env; env != nil; env = env.Outer {
+			if _, ok := env.Binds.Get(fun.Name); ok {
+				return env.Outer == nil && pureBuiltins[fun.Name]
+			}
+			if _, ok := env.Types.Get(fun.Name); ok {
+				return env.Outer == nil
+			}
+		}
+	}
+	return false
+}
+
+// concatAssign returns stmt if it appends to a variable, as in `s += x`, or nil.
+func concatAssign(stmt ast.Stmt) *ast.AssignStmt {
+	assign, ok := stmt.(*ast.AssignStmt)
+	if !ok || assign.Tok != token.ADD_ASSIGN || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil
+	}
+	if _, ok := assign.Lhs[0].(*ast.Ident); !ok {
+		return nil
+	}
+	return assign
+}
+
+// forEachStmt calls f with each statement of the blocks and clauses nested in node, along with the list holding
+// it so that f can replace it.
+func forEachStmt(node ast.Node, f func(stmts []ast.Stmt, i int)) {
+	instrumentBlocks([]ast.Node{node}, func(stmts []ast.Stmt) []ast.Stmt {
+		for i := range stmts {
+			f(stmts, i)
+		}
+		return stmts
+	})
+}
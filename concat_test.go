@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestRewriteConcatLoops tests building strings with += in loops.
+func TestRewriteConcatLoops(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{`s := "<"
+for i := 0; i < 3; i++ {
+	s += "ab"
+	if i == 1 {
+		s += "|"
+	}
+}
+s + ">"`, "<abab|ab>"},
+		// Reading s in the loop keeps the concatenation.
+		{`t := ""
+for i := 0; i < 3; i++ {
+	t += string('a' + rune(len(t)))
+}
+t`, "abc"},
+		{`func join(words []string) string {
+	var out string
+	for _, w := range words {
+		if out != "" {
+			out += ","
+		}
+		out += w
+	}
+	return out
+}
+join([]string{"x", "y", "z"})`, "x,y,z"},
+		{`n := 0
+for i := 0; i < 4; i++ {
+	n += i
+}
+n`, 6},
+		// A variable of the session, appended to by a loop that breaks early.
+		{`for _, c := range "hello" {
+	if c == 'l' {
+		break
+	}
+	s += string(c)
+}
+s`, "<abab|abhe"},
+		// A function called by the loop reads the string as it grows.
+		{`var seen []string
+u := ""
+func see() {
+	seen = append(seen, u)
+}
+for i := 0; i < 3; i++ {
+	u += "x"
+	see()
+}
+seen[2]`, "xxx"},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+
+	// A loop that panics leaves the string with what was appended until then.
+	if _, err := doEval(ir, `p := ""`); err != nil {
+		t.Fatalf("\t%s Expected p to be declared but got %v", failure, err)
+	}
+	if _, err := doEval(ir, `letters := []int{1, 2}
+for i := 0; i < 5; i++ {
+	p += string(rune('a' + letters[i]))
+}`); err == nil {
+		t.Errorf("\t%s Expected the loop to panic", failure)
+	}
+	if vals, err := doEval(ir, "p"); err != nil || len(vals) != 1 || vals[0] != "bc" {
+		t.Errorf("\t%s Expected the partial string \"bc\" but got %v, %v", failure, vals, err)
+	}
+
+	// Long strings are built in linear time.
+	vals, err := doEval(ir, `long := ""
+for i := 0; i < 200000; i++ {
+	long += "0123456789"
+}
+len(long)`)
+	if err != nil || len(vals) != 1 || vals[0] != 2000000 {
+		t.Errorf("\t%s Expected a string of 2000000 bytes but got %v, %v", failure, vals, err)
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// conformanceCase is a cell along with the value its last expression has when compiled by gc.
+type conformanceCase struct {
+	code string
+	want string
+}
+
+// testConformance runs each case in a new interpreter and compares the printed value of the result with the
+// one of compiled Go.
+func testConformance(t *testing.T, cases []conformanceCase) {
+	for _, c := range cases {
+		ir := newInterp()
+		vals, err := doEval(ir, "import \"fmt\"\n"+c.code)
+		if err != nil || len(vals) != 1 || fmt.Sprint(vals[0]) != c.want {
+			t.Errorf("\t%s Expected %s like gc but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+}
+
+// TestSelectConformance tests that select statements follow the specification: cases on nil channels never
+// proceed, closed channels are always ready, and the ready cases are chosen at random.
+func TestSelectConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`var nilChan chan int
+ready := make(chan int, 1)
+ready <- 7
+got := -1
+select {
+case got = <-nilChan:
+case got = <-ready:
+}
+got`, "7"},
+		{`var nilChan chan int
+got := ""
+select {
+case nilChan <- 1:
+	got = "sent"
+default:
+	got = "default"
+}
+got`, "default"},
+		{`closed := make(chan int)
+close(closed)
+got := ""
+select {
+case v, ok := <-closed:
+	got = fmt.Sprint(v, ok)
+default:
+	got = "default"
+}
+got`, "0 false"},
+		{`empty := make(chan int)
+got := ""
+select {
+case <-empty:
+	got = "received"
+default:
+	got = "default"
+}
+got`, "default"},
+		// With both cases always ready, each should be chosen about half of the time.
+		{`a, b := make(chan bool), make(chan bool)
+close(a)
+close(b)
+na := 0
+for i := 0; i < 1000; i++ {
+	select {
+	case <-a:
+		na++
+	case <-b:
+	}
+}
+na > 350 && na < 650`, "true"},
+	})
+}
+
+// TestTypeSwitchConformance tests the type of the variable of type switches: the type of the case in the
+// clauses listing one type, and the type of the guard in the others.
+func TestTypeSwitchConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`var x interface{} = 3
+got := ""
+switch v := x.(type) {
+case int:
+	got = fmt.Sprintf("%T", &v)
+}
+got`, "*int"},
+		{`var x interface{} = 3
+got := ""
+switch v := x.(type) {
+case int, string:
+	got = fmt.Sprintf("%T", &v)
+}
+got`, "*interface {}"},
+		{`var err error = fmt.Errorf("code %d", 7)
+got := ""
+switch v := err.(type) {
+case fmt.Stringer:
+	got = "stringer"
+default:
+	got = fmt.Sprintf("%T %v", &v, v)
+}
+got`, "*error code 7"},
+		{`var err error
+got := ""
+switch v := err.(type) {
+case nil:
+	got = fmt.Sprintf("%T", &v)
+}
+got`, "*error"},
+		{`values := []interface{}{1, "a", 2.5, true}
+got := ""
+for _, x := range values {
+	switch v := x.(type) {
+	case int, float64:
+		got += fmt.Sprintf("%T ", &v)
+	case string:
+		got += v + " "
+	default:
+		got += "default "
+	}
+}
+got`, "*interface {} a *interface {} default "},
+		{`func describe(x interface{}) string {
+	switch n := 1; v := x.(type) {
+	case bool, int:
+		return fmt.Sprint(n, v)
+	}
+	return ""
+}
+describe(true)`, "1 true"},
+	})
+}
+
+// TestConstConformance tests that the specifications of const groups without values repeat the type and values
+// of the previous one, with iota counting the specifications of each group.
+func TestConstConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`const (
+	A = iota * 10
+	B
+	C
+)
+[]int{A, B, C}`, "[0 10 20]"},
+		{`const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+	GB
+)
+[]int{KB, MB, GB}`, "[1024 1048576 1073741824]"},
+		{`const (
+	A uint8 = 1 << iota
+	B
+	C
+)
+fmt.Sprintf("%T %v", C, C)`, "uint8 4"},
+		{`const (
+	_ = iota
+	KB float64 = 1 << (10 * iota)
+	MB
+)
+fmt.Sprintf("%T %v", MB, MB)`, "float64 1.048576e+06"},
+		{`type Color int
+const (
+	Red Color = iota + 1
+	_
+	Blue
+)
+Blue`, "3"},
+		{`const (
+	X0, Y0 = iota, -iota
+	X1, Y1
+)
+[]int{X0, Y0, X1, Y1}`, "[0 0 1 -1]"},
+		{`const (
+	FlagA = 1 << iota
+	FlagB
+	FlagC
+	Mask = FlagA | FlagC
+)
+Mask`, "5"},
+		{`const (
+	P = "p"
+	Q
+	R = iota
+)
+fmt.Sprint(P, Q, R)`, "pp2"},
+		{`const (
+	A = iota
+	B
+)
+const (
+	C = iota
+	D
+)
+[]int{A, B, C, D}`, "[0 1 0 1]"},
+		{`func f() int {
+	const (
+		A = iota * 2
+		B
+	)
+	return B
+}
+f()`, "2"},
+	})
+}
+
+// TestUntypedConstConformance tests that untyped constants keep their exact values until they are converted,
+// however large the intermediate values.
+func TestUntypedConstConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`const big = 1 << 100
+const small = big >> 98
+small`, "4"},
+		{`const (
+	huge = 1e300 * 1e300
+	norm = huge / 1e300
+)
+norm`, "1e+300"},
+		{`const third = 1.0 / 3
+third * 3 == 1`, "true"},
+		{`const big = 1 << 100
+float64(big)`, "1.2676506002282294e+30"},
+		{`const (
+	Big = 1 << (100 + iota)
+	Bigger
+)
+const ratio = Bigger / Big
+ratio`, "2"},
+		{`const mask = ^uint64(0)
+mask`, "18446744073709551615"},
+		{`const word = "go" + "pher"
+len(word)`, "6"},
+		{`const Big = 1 << 100
+type T struct{ Big int }
+v := T{Big: Big >> 99}
+v.Big`, "2"},
+	})
+}
+
+// TestCompiledFuncConformance tests that interpreted functions can be passed to compiled code wherever a function
+// of the same signature is expected, converted to named function types included.
+func TestCompiledFuncConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`import "sort"
+s := []int{3, 1, 2}
+sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+s`, "[1 2 3]"},
+		{`import ("net/http"; "net/http/httptest")
+func handle(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }
+mux := http.NewServeMux()
+mux.Handle("/tea", http.HandlerFunc(handle))
+mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) })
+codes := []int{}
+for _, path := range []string{"/tea", "/"} {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	codes = append(codes, rec.Code)
+}
+codes`, "[418 202]"},
+		{`import ("os"; "path/filepath")
+dirs := 0
+var walk filepath.WalkFunc = func(path string, info os.FileInfo, err error) error {
+	if err == nil && info.IsDir() {
+		dirs++
+	}
+	return nil
+}
+filepath.Walk(".", walk)
+dirs > 0`, "true"},
+		{`import ("bufio"; "strings")
+sc := bufio.NewScanner(strings.NewReader("a bc d"))
+sc.Split(func(data []byte, atEOF bool) (int, []byte, error) { return bufio.ScanWords(data, atEOF) })
+n := 0
+for sc.Scan() {
+	n++
+}
+n`, "3"},
+		{`import ("bytes"; "text/template")
+funcs := template.FuncMap{"twice": func(s string) string { return s + s }}
+tmpl := template.Must(template.New("t").Funcs(funcs).Parse("{{twice .}}"))
+var b bytes.Buffer
+tmpl.Execute(&b, "go")
+b.String()`, "gogo"},
+	})
+}
+
+// TestMethodConformance tests method values, bound to a copy of their receiver when it is evaluated, and method
+// expressions, taking the receiver as first argument, of compiled and interpreted types.
+func TestMethodConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`import "bytes"
+var buf bytes.Buffer
+write := buf.WriteString
+write("a")
+(*bytes.Buffer).WriteString(&buf, "b")
+buf.String()`, "ab"},
+		{`import "time"
+d := time.Second
+str := d.String
+d = time.Minute
+str() + " " + time.Duration.String(d)`, "1s 1m0s"},
+		{`type Counter struct{ N int }
+func (c Counter) Get() int { return c.N }
+func (c *Counter) Inc() { c.N++ }
+c := Counter{1}
+get, inc := c.Get, c.Inc
+inc()
+[]int{get(), c.N, Counter.Get(c)}`, "[1 2 2]"},
+		{`type Counter struct{ N int }
+func (c Counter) Get() int { return c.N }
+func (c *Counter) Inc() { c.N++ }
+p := &Counter{1}
+get := p.Get
+inc := (*Counter).Inc
+inc(p)
+p = &Counter{5}
+[]int{get(), (*Counter).Get(p)}`, "[2 5]"},
+		{`import "errors"
+var err error = errors.New("first")
+msg := err.Error
+err = errors.New("second")
+msg() + " " + error.Error(err)`, "first second"},
+		{`import ("fmt"; "time")
+str := fmt.Stringer.String
+str(time.Minute)`, "1m0s"},
+	})
+}
+
+// TestVariadicConformance tests variadic calls: append with `...`, nil and untyped constants as variadic arguments,
+// the nil slice of calls without variadic arguments, and variadic methods of interpreted types.
+func TestVariadicConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`type Ints []int
+a := Ints{1}
+var none Ints
+a = append(a, Ints{2, 3}...)
+a = append(a, none...)
+a`, "[1 2 3]"},
+		{`b := append([]byte("ab"), "cd"...)
+string(b)`, "abcd"},
+		{`func isNil(xs ...int) bool { return xs == nil }
+var none []int
+[]bool{isNil(), isNil(none...), isNil(1)}`, "[true true false]"},
+		{`func sum(xs ...float64) float64 {
+	total := 0.0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+sum(1, 2.5)`, "3.5"},
+		{`func count(xs ...interface{}) int { return len(xs) }
+fmt.Sprint(count(nil), count(nil, 1), fmt.Sprint(nil))`, "1 2<nil>"},
+		{`vs := []interface{}{}
+vs = append(vs, 1, "a")
+fmt.Sprint(vs...)`, "1a"},
+		{`type Acc struct{ N int }
+func (a *Acc) Add(xs ...int) {
+	for _, x := range xs {
+		a.N += x
+	}
+}
+var acc Acc
+acc.Add(1, 2)
+acc.Add([]int{3}...)
+add := acc.Add
+add(4)
+acc.N`, "10"},
+	})
+}
+
+// TestDeferConformance tests that the function and the arguments of deferred calls are evaluated when the defer
+// statement runs, in loops included, and that the deferred calls can recover the panics of their function.
+func TestDeferConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`var got []int
+func collect() {
+	for i := 0; i < 3; i++ {
+		defer func(i int) { got = append(got, i) }(i)
+	}
+}
+collect()
+got`, "[2 1 0]"},
+		{`import "bytes"
+var b bytes.Buffer
+func write() {
+	s := "before"
+	defer b.WriteString(s)
+	s = "after"
+}
+write()
+b.String()`, "before"},
+		{`type Point struct{ X int }
+var got Point
+func keep(p Point) { got = p }
+func move() {
+	p := Point{1}
+	defer keep(p)
+	p.X = 2
+}
+move()
+got.X`, "1"},
+		{`var got string
+func safe() {
+	defer func() { got = fmt.Sprint("recovered ", recover()) }()
+	panic("boom")
+}
+safe()
+got`, "recovered boom"},
+		{`var got []bool
+func check(xs ...int) { got = append(got, xs == nil) }
+func run() {
+	defer check()
+	defer check(1)
+}
+run()
+got`, "[false true]"},
+		{`import "bytes"
+var buf bytes.Buffer
+func write() {
+	defer buf.Reset()
+	buf.WriteString("x")
+}
+write()
+buf.Len()`, "0"},
+	})
+}
+
+// TestSwitchConformance tests the scope of the variables of the init statements of switches, and fallthrough
+// into the next clause, the default clause included wherever it is.
+func TestSwitchConformance(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`func two() int { return 2 }
+x := 5
+got := 0
+switch x := two(); x {
+case 2:
+	x++
+	got = x
+}
+[]int{got, x}`, "[3 5]"},
+		{`got := ""
+switch y := 3; {
+case y > 2:
+	got = fmt.Sprint("big ", y)
+}
+got`, "big 3"},
+		{`got := ""
+switch 1 {
+case 1:
+	got += "a"
+	fallthrough
+case 2:
+	got += "b"
+	fallthrough
+default:
+	got += "c"
+}
+got`, "abc"},
+		{`got := ""
+switch 3 {
+default:
+	got += "d"
+	fallthrough
+case 1:
+	got += "1"
+case 3:
+	got += "3"
+}
+got`, "3"},
+		{`got := ""
+switch 4 {
+default:
+	got += "d"
+	fallthrough
+case 1:
+	got += "1"
+case 3:
+	got += "3"
+}
+got`, "d1"},
+	})
+}
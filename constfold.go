@@ -0,0 +1,699 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"math"
+	r "reflect"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// basicTypes maps the names of the predeclared types of fixed size to their type, for unsafe.Sizeof.
+var basicTypes = map[string]r.Type{
+	"bool":       r.TypeOf(false),
+	"int":        r.TypeOf(int(0)),
+	"int8":       r.TypeOf(int8(0)),
+	"int16":      r.TypeOf(int16(0)),
+	"int32":      r.TypeOf(int32(0)),
+	"rune":       r.TypeOf(rune(0)),
+	"int64":      r.TypeOf(int64(0)),
+	"uint":       r.TypeOf(uint(0)),
+	"uint8":      r.TypeOf(uint8(0)),
+	"byte":       r.TypeOf(byte(0)),
+	"uint16":     r.TypeOf(uint16(0)),
+	"uint32":     r.TypeOf(uint32(0)),
+	"uint64":     r.TypeOf(uint64(0)),
+	"uintptr":    r.TypeOf(uintptr(0)),
+	"float32":    r.TypeOf(float32(0)),
+	"float64":    r.TypeOf(float64(0)),
+	"complex64":  r.TypeOf(complex64(0)),
+	"complex128": r.TypeOf(complex128(0)),
+	"string":     r.TypeOf(""),
+}
+
+// builtinLen is the len builtin of the interpreter, to tell whether the code of a session redefined len.
+var builtinLen = classic.NewEnv(nil, "builtin").ValueOf("len")
+
+// constantFolder replaces the constant expressions of a cell with their value.
+type constantFolder struct {
+	// foldLen and foldSizeof are set when len and unsafe.Sizeof refer to the builtin and to the package unsafe.
+	foldLen, foldSizeof bool
+
+	// consts holds the exact values of the untyped constants of the session, and shadowed the names the cell
+	// declares otherwise than as top-level constants. iota is set while folding the specifications of a
+	// const declaration.
+	consts   *sessionConsts
+	shadowed map[string]bool
+	iota     constant.Value
+
+	// cellConsts holds the constants declared by the cell, which the interpreter does not define before it
+	// runs the cell.
+	cellConsts map[string]bool
+}
+
+// sessionConsts holds the exact values of the untyped constants declared at the top level of the cells, which
+// the interpreter evaluates with the precision of int and float64 only.
+type sessionConsts struct {
+	ir     *classic.Interp
+	values map[string]constant.Value
+}
+
+var untypedConsts = &sessionConsts{}
+
+// foldConstants replaces the constant expressions of nodes with literals of their value, so that the
+// interpreter does not compute them each time it runs them: the arithmetic on untyped integer, floating-point
+// and string literals and constants, len of constant strings and arrays, and unsafe.Sizeof of the predeclared
+// types. The untyped constants are computed with arbitrary precision like gc does, and only converted when
+// used, so that `const big = 1 << 100` then `big >> 98` gives 4. Like gc, it returns an error when a constant
+// is converted to a numeric type that cannot represent it, which the interpreter would truncate.
+func foldConstants(ir *classic.Interp, nodes []ast.Node) error {
+	declared := declaredNames(nodes)
+	f := constantFolder{
+		foldLen:    !declared["len"] && !declared["int"] && sameFunc(ir.Env.ValueOf("len"), builtinLen),
+		consts:     untypedConsts,
+		shadowed:   shadowedConsts(nodes),
+		cellConsts: make(map[string]bool),
+	}
+	if ref := packageRef(ir.Env.ValueOf("unsafe")); ref != nil {
+		f.foldSizeof = ref.Path == "unsafe"
+	}
+	f.foldSizeof = (f.foldSizeof || importsUnsafe(nodes)) && !declared["unsafe"] && !declared["uintptr"]
+	if f.consts.ir != ir {
+		f.consts.ir = ir
+		f.consts.values = make(map[string]constant.Value)
+	}
+
+	for i, node := range nodes {
+		if err := f.checkOverflows(node); err != nil {
+			return err
+		}
+		if decl, ok := node.(*ast.GenDecl); ok && decl.Tok == token.CONST {
+			f.foldConstDecl(decl)
+			continue
+		}
+		// The names declared otherwise are no longer constants.
+		for name := range declaredNames([]ast.Node{node}) {
+			delete(f.consts.values, name)
+		}
+		if expr, ok := node.(ast.Expr); ok {
+			if lit := f.literal(expr); lit != nil {
+				nodes[i] = lit
+				continue
+			}
+		}
+		f.walk(node)
+	}
+	return nil
+}
+
+// checkOverflows returns an error if node converts an untyped constant to a numeric type that cannot represent
+// it: in the declarations of typed constants and of variables, in assignments to the variables of the session
+// and in conversions, with the default type int or float64 of the constant when no type is given. A top-level
+// expression, which gives the result of the cell, has the default type of its constant too.
+func (f *constantFolder) checkOverflows(node ast.Node) error {
+	var err error
+	check := func(expr ast.Expr, typ string) {
+		if err == nil {
+			err = f.checkOverflow(expr, typ)
+		}
+	}
+	if expr, ok := node.(ast.Expr); ok {
+		check(expr, "")
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GenDecl:
+			for _, spec := range n.Specs {
+				spec, ok := spec.(*ast.ValueSpec)
+				if !ok || n.Tok == token.CONST && spec.Type == nil {
+					continue
+				}
+				typ, ok := f.basicTypeName(spec.Type)
+				for _, value := range spec.Values {
+					if ok {
+						check(value, typ)
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				break
+			}
+			for i, rhs := range n.Rhs {
+				switch n.Tok {
+				case token.DEFINE:
+					check(rhs, "")
+				case token.ASSIGN:
+					if typ, ok := f.varTypeName(n.Lhs[i]); ok {
+						check(rhs, typ)
+					}
+				}
+			}
+		case *ast.CallExpr:
+			if typ, ok := f.basicTypeName(n.Fun); ok && typ != "" && len(n.Args) == 1 && !n.Ellipsis.IsValid() {
+				check(n.Args[0], typ)
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkOverflow returns an error if expr is an untyped numeric constant that the predeclared type typ, or its
+// default type if typ is empty, cannot represent.
+func (f *constantFolder) checkOverflow(expr ast.Expr, typ string) error {
+	val, valTyp := f.value(expr)
+	if val == nil || valTyp != "" {
+		return nil
+	}
+	if typ == "" {
+		switch val.Kind() {
+		case constant.Int:
+			typ = "int"
+		case constant.Float:
+			typ = "float64"
+		default:
+			return nil
+		}
+	}
+	if !overflows(val, basicTypes[typ]) {
+		return nil
+	}
+	s := val.String()
+	if val.Kind() == constant.Int {
+		s = val.ExactString()
+	}
+	return fmt.Errorf("%s: constant %s overflows %s", f.consts.ir.Env.Fileset.Position(expr.Pos()), s, typ)
+}
+
+// basicTypeName returns the name of the predeclared type expr names, or "" if expr is nil, as long as the cell
+// does not declare it otherwise.
+func (f *constantFolder) basicTypeName(expr ast.Expr) (string, bool) {
+	if expr == nil {
+		return "", true
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok || basicTypes[ident.Name] == nil || f.shadowed[ident.Name] {
+		return "", false
+	}
+	return ident.Name, true
+}
+
+// varTypeName returns the name of the predeclared type of the variable of the session that expr names, unless
+// the cell declares the name otherwise.
+func (f *constantFolder) varTypeName(expr ast.Expr) (string, bool) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok || f.shadowed[ident.Name] {
+		return "", false
+	}
+	v := f.consts.ir.Env.ValueOf(ident.Name)
+	if !v.IsValid() || !v.CanSet() || basicTypes[v.Type().String()] != v.Type() {
+		return "", false
+	}
+	return v.Type().String(), true
+}
+
+// overflows reports whether the numeric constant val is out of the range of t, a predeclared numeric type.
+// Conversions to integer types of floating-point values that are not integers are left to the interpreter.
+func overflows(val constant.Value, t r.Type) bool {
+	switch t.Kind() {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		if val = constant.ToInt(val); val.Kind() != constant.Int {
+			return false
+		}
+		max := constant.Shift(constant.MakeInt64(1), token.SHL, uint(t.Bits()-1))
+		return constant.Compare(val, token.GEQ, max) || constant.Compare(val, token.LSS, constant.UnaryOp(token.SUB, max, 0))
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		if val = constant.ToInt(val); val.Kind() != constant.Int {
+			return false
+		}
+		max := constant.Shift(constant.MakeInt64(1), token.SHL, uint(t.Bits()))
+		return constant.Compare(val, token.GEQ, max) || constant.Sign(val) < 0
+	case r.Float32:
+		x, _ := constant.Float32Val(constant.ToFloat(val))
+		return math.IsInf(float64(x), 0)
+	case r.Float64:
+		x, _ := constant.Float64Val(constant.ToFloat(val))
+		return math.IsInf(x, 0)
+	}
+	return false
+}
+
+// shadowedConsts returns the names that nodes declare otherwise than as top-level constants.
+func shadowedConsts(nodes []ast.Node) map[string]bool {
+	var others []ast.Node
+	for _, node := range nodes {
+		if decl, ok := node.(*ast.GenDecl); ok && decl.Tok == token.CONST {
+			for _, spec := range decl.Specs {
+				for _, value := range spec.(*ast.ValueSpec).Values {
+					others = append(others, value)
+				}
+			}
+			continue
+		}
+		others = append(others, node)
+	}
+	return declaredNames(others)
+}
+
+// foldConstDecl records the exact values of the untyped constants declared by decl, then replaces their values
+// with literals. The values using iota are left alone, as the specifications without values repeat them. The
+// integers too large for the interpreter are replaced with floating-point approximations, which are exact
+// enough for conversions to float64.
+func (f *constantFolder) foldConstDecl(decl *ast.GenDecl) {
+	defer func() { f.iota = nil }()
+
+	var typ ast.Expr
+	var values []ast.Expr
+	for i, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if spec.Type != nil || len(spec.Values) > 0 {
+			typ, values = spec.Type, spec.Values
+		}
+		f.iota = constant.MakeInt64(int64(i))
+		for j, name := range spec.Names {
+			var val constant.Value
+			if typ == nil && j < len(values) {
+				var valTyp string
+				if val, valTyp = f.value(values[j]); valTyp != "" {
+					val = nil
+				}
+			}
+			if val != nil && name.Name != "_" {
+				f.consts.values[name.Name] = val
+				f.cellConsts[name.Name] = true
+			} else {
+				delete(f.consts.values, name.Name)
+			}
+		}
+
+		for j, value := range spec.Values {
+			if usesIota(value) {
+				continue
+			}
+			if lit := f.literal(value); lit != nil {
+				spec.Values[j] = lit
+			} else if val, valTyp := f.value(value); val != nil && valTyp == "" && val.Kind() == constant.Int {
+				if lit := literalOf(constant.ToFloat(val), "", value.Pos()); lit != nil {
+					spec.Values[j] = lit
+				}
+			} else {
+				f.replace(r.ValueOf(spec.Values).Index(j))
+			}
+		}
+	}
+}
+
+// usesIota reports whether expr refers to iota.
+func usesIota(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == "iota" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// sameFunc reports whether the values a and b are the same function.
+func sameFunc(a, b r.Value) bool {
+	return a.IsValid() && b.IsValid() && a.Kind() == r.Func && b.Kind() == r.Func && a.Pointer() == b.Pointer()
+}
+
+// importsUnsafe reports whether nodes import the package unsafe under its own name.
+func importsUnsafe(nodes []ast.Node) bool {
+	for _, node := range nodes {
+		if decl, ok := node.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			for _, spec := range decl.Specs {
+				if spec := spec.(*ast.ImportSpec); spec.Name == nil && spec.Path.Value == `"unsafe"` {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// declaredNames returns the names declared anywhere in nodes.
+func declaredNames(nodes []ast.Node) map[string]bool {
+	names := make(map[string]bool)
+	declare := func(exprs ...ast.Expr) {
+		for _, expr := range exprs {
+			if ident, ok := expr.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+		}
+	}
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.StructType:
+			// The names of fields are not in scope.
+			for _, field := range n.Fields.List {
+				ast.Inspect(field.Type, visit)
+			}
+			return false
+		case *ast.FuncDecl:
+			declare(n.Name)
+		case *ast.Field:
+			for _, name := range n.Names {
+				declare(name)
+			}
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				declare(name)
+			}
+		case *ast.TypeSpec:
+			declare(n.Name)
+		case *ast.ImportSpec:
+			if n.Name != nil {
+				declare(n.Name)
+			}
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				declare(n.Lhs...)
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				declare(n.Key, n.Value)
+			}
+		}
+		return true
+	}
+	for _, node := range nodes {
+		ast.Inspect(node, visit)
+	}
+	return names
+}
+
+var (
+	exprType  = r.TypeOf((*ast.Expr)(nil)).Elem()
+	nodeType  = r.TypeOf((*ast.Node)(nil)).Elem()
+	exprsType = r.TypeOf([]ast.Expr(nil))
+)
+
+// walk replaces the largest constant expressions below node.
+func (f constantFolder) walk(node ast.Node) {
+	switch node := node.(type) {
+	case nil, *ast.Ident, *ast.BasicLit:
+		return
+	case *ast.KeyValueExpr:
+		// The keys of struct literals name fields, which may have the names of constants.
+		if _, ok := node.Key.(*ast.Ident); ok {
+			f.replace(r.ValueOf(node).Elem().FieldByName("Value"))
+			return
+		}
+	case *ast.UnaryExpr:
+		// Skip the quotes and unquotes of macros, which the interpreter parses as unary operators.
+		switch node.Op {
+		case token.ADD, token.SUB, token.XOR, token.NOT, token.AND, token.ARROW, token.MUL:
+		default:
+			return
+		}
+	}
+
+	v := r.ValueOf(node)
+	if v.Kind() != r.Ptr || v.IsNil() || v.Elem().Kind() != r.Struct {
+		return
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Type() == exprType:
+			f.replace(field)
+		case field.Type() == exprsType:
+			for j := 0; j < field.Len(); j++ {
+				f.replace(field.Index(j))
+			}
+		case field.Type().Implements(nodeType):
+			if !field.IsNil() {
+				f.walk(field.Interface().(ast.Node))
+			}
+		case field.Kind() == r.Slice && field.Type().Elem().Implements(nodeType):
+			for j := 0; j < field.Len(); j++ {
+				if elem := field.Index(j); !elem.IsNil() {
+					f.walk(elem.Interface().(ast.Node))
+				}
+			}
+		}
+	}
+}
+
+// replace sets v, holding an expression, to the literal of its value if it is constant, or else walks it.
+func (f constantFolder) replace(v r.Value) {
+	if v.IsNil() {
+		return
+	}
+	expr := v.Interface().(ast.Expr)
+	if lit := f.literal(expr); lit != nil {
+		v.Set(r.ValueOf(lit))
+		return
+	}
+	f.walk(expr)
+}
+
+// literal returns the literal of the value of expr, converted to its type unless it is untyped, or nil if expr
+// is not constant, already a literal, or has a value that the literals of Go cannot hold.
+func (f constantFolder) literal(expr ast.Expr) ast.Expr {
+	// Literals, and negated literals, would be replaced with themselves.
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return nil
+	case *ast.UnaryExpr:
+		if _, ok := expr.X.(*ast.BasicLit); ok {
+			return nil
+		}
+	}
+	val, typ := f.value(expr)
+	if val == nil {
+		return nil
+	}
+	return literalOf(val, typ, expr.Pos())
+}
+
+// literalOf returns the literal of val at pos, converted to typ unless it is empty, or nil if the literals of
+// Go cannot hold val.
+func literalOf(val constant.Value, typ string, pos token.Pos) ast.Expr {
+	negative := val.Kind() != constant.String && constant.Sign(val) < 0
+	if negative {
+		val = constant.UnaryOp(token.SUB, val, 0)
+	}
+	var lit ast.Expr
+	switch val.Kind() {
+	case constant.Int:
+		u, exact := constant.Uint64Val(val)
+		if !exact || negative && u > 1<<63 {
+			return nil
+		}
+		lit = &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.FormatUint(u, 10)}
+	case constant.Float:
+		x, _ := constant.Float64Val(val)
+		if math.IsInf(x, 0) {
+			return nil
+		}
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			// Keep the value floating-point.
+			s += ".0"
+		}
+		lit = &ast.BasicLit{ValuePos: pos, Kind: token.FLOAT, Value: s}
+	case constant.String:
+		lit = &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: strconv.Quote(constant.StringVal(val))}
+	default:
+		return nil
+	}
+	if negative {
+		lit = &ast.UnaryExpr{OpPos: pos, Op: token.SUB, X: lit}
+	}
+	if typ != "" {
+		lit = &ast.CallExpr{Fun: &ast.Ident{NamePos: pos, Name: typ}, Lparen: pos, Args: []ast.Expr{lit}}
+	}
+	return lit
+}
+
+// value returns the value of expr if it is constant, or nil, along with the name of its type if it is typed.
+// Only len and unsafe.Sizeof give typed constants, of type int and uintptr. Characters are left alone, as
+// their literals have a type of their own.
+func (f constantFolder) value(expr ast.Expr) (constant.Value, string) {
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		switch expr.Kind {
+		case token.INT, token.FLOAT, token.STRING:
+			if val := constant.MakeFromLiteral(expr.Value, expr.Kind, 0); val.Kind() != constant.Unknown {
+				return val, ""
+			}
+		}
+	case *ast.Ident:
+		if expr.Name == "iota" && f.iota != nil && !f.shadowed["iota"] {
+			return f.iota, ""
+		}
+		// The constants deleted with %delete are no longer defined.
+		val, ok := f.consts.values[expr.Name]
+		if ok && !f.shadowed[expr.Name] && (f.cellConsts[expr.Name] || f.consts.ir.Env.ValueOf(expr.Name).IsValid()) {
+			return val, ""
+		}
+	case *ast.ParenExpr:
+		return f.value(expr.X)
+	case *ast.UnaryExpr:
+		x, typ := f.value(expr.X)
+		if x == nil || x.Kind() == constant.String {
+			return nil, ""
+		}
+		switch expr.Op {
+		case token.ADD:
+			return x, typ
+		case token.SUB:
+			if typ != "uintptr" || constant.Sign(x) == 0 {
+				return constant.UnaryOp(expr.Op, x, 0), typ
+			}
+		case token.XOR:
+			// The complement of a typed unsigned value depends on its size.
+			if x.Kind() == constant.Int && typ != "uintptr" {
+				return constant.UnaryOp(expr.Op, x, 0), typ
+			}
+		}
+	case *ast.BinaryExpr:
+		return f.binaryValue(expr)
+	case *ast.CallExpr:
+		if len(expr.Args) != 1 || expr.Ellipsis.IsValid() {
+			return nil, ""
+		}
+		if ident, ok := expr.Fun.(*ast.Ident); ok && ident.Name == "len" && f.foldLen {
+			return f.lenValue(expr.Args[0]), "int"
+		}
+		if sel, ok := expr.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Sizeof" && f.foldSizeof {
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "unsafe" {
+				return sizeofValue(expr.Args[0]), "uintptr"
+			}
+		}
+	}
+	return nil, ""
+}
+
+// binaryValue returns the value of the binary operation expr and its type if its operands are constant, except
+// for comparisons, divisions by zero and mismatched types, which are left for the interpreter to report.
+func (f constantFolder) binaryValue(expr *ast.BinaryExpr) (constant.Value, string) {
+	x, xtyp := f.value(expr.X)
+	y, ytyp := f.value(expr.Y)
+	if x == nil || y == nil || xtyp != "" && ytyp != "" && xtyp != ytyp && expr.Op != token.SHL && expr.Op != token.SHR {
+		return nil, ""
+	}
+	typ := xtyp
+	if typ == "" && expr.Op != token.SHL && expr.Op != token.SHR {
+		typ = ytyp
+	}
+	val := binaryOp(x, expr.Op, y)
+	if val == nil || typ != "" && (val.Kind() != constant.Int || typ == "uintptr" && constant.Sign(val) < 0) {
+		return nil, ""
+	}
+	return val, typ
+}
+
+// binaryOp returns the value of x op y, or nil.
+func binaryOp(x constant.Value, op token.Token, y constant.Value) constant.Value {
+	if x.Kind() == constant.String || y.Kind() == constant.String {
+		if op == token.ADD && x.Kind() == y.Kind() {
+			return constant.BinaryOp(x, token.ADD, y)
+		}
+		return nil
+	}
+
+	ints := x.Kind() == constant.Int && y.Kind() == constant.Int
+	switch op {
+	case token.ADD, token.SUB, token.MUL:
+		return constant.BinaryOp(x, op, y)
+	case token.QUO:
+		if constant.Sign(y) == 0 {
+			return nil
+		}
+		if ints {
+			// Dividing integers truncates.
+			return constant.BinaryOp(x, token.QUO_ASSIGN, y)
+		}
+		return constant.BinaryOp(x, token.QUO, y)
+	case token.REM:
+		if ints && constant.Sign(y) != 0 {
+			return constant.BinaryOp(x, token.REM, y)
+		}
+	case token.AND, token.OR, token.XOR, token.AND_NOT:
+		if ints {
+			return constant.BinaryOp(x, op, y)
+		}
+	case token.SHL, token.SHR:
+		// Keep the shifts of huge values for the interpreter.
+		if s, exact := constant.Uint64Val(y); ints && exact && s <= 1024 {
+			return constant.Shift(x, op, uint(s))
+		}
+	}
+	return nil
+}
+
+// lenValue returns the length of arg if it is a constant string or a literal of an array of constant length.
+// The elements of the array are not evaluated, so they must not call functions or receive from channels.
+func (f constantFolder) lenValue(arg ast.Expr) constant.Value {
+	if val, _ := f.value(arg); val != nil {
+		if val.Kind() == constant.String {
+			return constant.MakeInt64(int64(len(constant.StringVal(val))))
+		}
+		return nil
+	}
+
+	lit, ok := arg.(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	array, ok := lit.Type.(*ast.ArrayType)
+	if !ok || array.Len == nil {
+		return nil
+	}
+	length, _ := f.value(array.Len)
+	if length == nil || length.Kind() != constant.Int {
+		return nil
+	}
+	pure := true
+	ast.Inspect(lit, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			pure = false
+		case *ast.UnaryExpr:
+			pure = pure && n.Op != token.ARROW
+		}
+		return pure
+	})
+	if !pure {
+		return nil
+	}
+	return length
+}
+
+// sizeofValue returns the size of arg if it is a conversion to a predeclared type, or an untyped constant of
+// the default type int, float64 or string.
+func sizeofValue(arg ast.Expr) constant.Value {
+	var t r.Type
+	switch arg := arg.(type) {
+	case *ast.CallExpr:
+		if ident, ok := arg.Fun.(*ast.Ident); ok && len(arg.Args) == 1 {
+			t = basicTypes[ident.Name]
+		}
+	case *ast.BasicLit:
+		switch arg.Kind {
+		case token.INT:
+			t = basicTypes["int"]
+		case token.FLOAT:
+			t = basicTypes["float64"]
+		case token.STRING:
+			t = basicTypes["string"]
+		}
+	}
+	if t == nil {
+		return nil
+	}
+	return constant.MakeUint64(uint64(t.Size()))
+}
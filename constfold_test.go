@@ -0,0 +1,110 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// TestFoldConstants tests replacing the constant expressions of cells with their value.
+func TestFoldConstants(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{"7 / 2", 3},
+		{"7 / 2.0", 3.5},
+		{"2.0 * 3", 6.0},
+		{"-(1 << 10) + 24", -1000},
+		{"(1 << 70) >> 68", 4},
+		{"^0 & 0xff", 255},
+		{`"go" + "pher" + "notes"`, "gophernotes"},
+		{`len("héllo") * 2`, 12},
+		{"len([2 + 3]int{}) % 3", 2},
+		{"import \"unsafe\"\nunsafe.Sizeof(int32(0)) + unsafe.Sizeof(1.5)", uintptr(12)},
+		{"'a' + 1", 'b'},
+		{"func area(r float64) float64 { return 3.0 / 2 * r * r }\narea(2)", 6.0},
+		{"len := func(s string) int { return 42 }\nlen(\"abc\")", 42},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+
+	// The exact values of constants are kept from cell to cell, until the names are declared otherwise.
+	for _, c := range []struct {
+		code string
+		want interface{}
+	}{
+		{"const exa = 1 << 60 * 1024", nil},
+		{"exa >> 70", 1},
+		{"exa := 3\nexa", 3},
+		{"exa >> 1", 1},
+	} {
+		vals, err := doEval(ir, c.code)
+		if err != nil || c.want != nil && (len(vals) != 1 || vals[0] != c.want) {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+
+	// Divisions by zero are left for the interpreter to report.
+	if _, err := doEval(ir, "x := 1 / 0"); err == nil {
+		t.Errorf("\t%s Expected a division by zero to fail", failure)
+	}
+
+	// Like gc, the constants are not truncated to the type they are converted to.
+	if _, err := doEval(ir, "var b byte"); err != nil {
+		t.Fatalf("\t%s Expected no error but got %v", failure, err)
+	}
+	for _, code := range []string{
+		"var i int = 1 << 70",
+		"const c = 1 << 70\nvar j int = c",
+		"var i8 int8 = 200",
+		"var u uint = -1",
+		"k := 1 << 64",
+		"var f float32 = 1e39",
+		"int16(1 << 15)",
+		"b = 256",
+		"1 << 63",
+	} {
+		if _, err := doEval(ir, code); err == nil || !strings.Contains(err.Error(), "overflows") {
+			t.Errorf("\t%s Expected an overflow error but got %v for\n%s", failure, err, code)
+		}
+	}
+	for _, c := range []struct {
+		code string
+		want interface{}
+	}{
+		{"var b2 byte = 255\nb2", byte(255)},
+		{"var i8 int8 = -128\ni8", int8(-128)},
+		{"(1 << 70) >> 68", 4},
+		{"uint64(1<<64 - 1)", uint64(1<<64 - 1)},
+		{"type int8 int\nvar big int8 = 1000\nint(big)", 1000},
+	} {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+
+	nodes := []ast.Node{&ast.BinaryExpr{
+		X:  &ast.BasicLit{Kind: token.INT, Value: "6"},
+		Op: token.MUL,
+		Y: &ast.CallExpr{Fun: ast.NewIdent("f"), Args: []ast.Expr{&ast.BinaryExpr{
+			X:  &ast.BasicLit{Kind: token.INT, Value: "2"},
+			Op: token.SUB,
+			Y:  &ast.BasicLit{Kind: token.INT, Value: "5"},
+		}}},
+	}}
+	if err := foldConstants(ir, nodes); err != nil {
+		t.Errorf("\t%s Expected the constants to fold but got %v", failure, err)
+	}
+	arg := nodes[0].(*ast.BinaryExpr).Y.(*ast.CallExpr).Args[0]
+	if neg, ok := arg.(*ast.UnaryExpr); !ok || neg.Op != token.SUB || neg.X.(*ast.BasicLit).Value != "3" {
+		t.Errorf("\t%s Expected the argument to be folded to -3 but got %#v", failure, arg)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"html"
+	"log"
+	r "reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// coverFuncName is the name of the function called by the statements inserted into cells run with `%coverage`.
+const coverFuncName = "__gophernotesCover"
+
+// coverCell is set by `%coverage` to record the coverage of the cell it appears in.
+var coverCell bool
+
+func init() {
+	lineMagics["coverage"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) > 0 {
+			return errors.New("expected no arguments")
+		}
+		coverCell = true
+		return nil
+	}
+}
+
+// cellCoverage records which statements of a cell were executed.
+type cellCoverage struct {
+	code string
+
+	mu sync.Mutex
+
+	// stmts and executed hold the lines where statements start, and those of these statements that ran.
+	stmts, executed map[int]bool
+}
+
+var (
+	// activeCoverageMu guards activeCoverage, since goroutines started by a cell may run covered statements.
+	activeCoverageMu sync.Mutex
+
+	// activeCoverage is the coverage of the cell being executed, nil when coverage is not recorded.
+	activeCoverage *cellCoverage
+)
+
+// startCoverage instruments nodes so that each statement records its execution, and starts the coverage of
+// the cell with the given source.
+func startCoverage(ir *classic.Interp, nodes []ast.Node, code string) *cellCoverage {
+	ir.Env.DefineVar(coverFuncName, r.TypeOf(coverStmt), r.ValueOf(coverStmt))
+
+	cov := &cellCoverage{
+		code:     code,
+		stmts:    make(map[int]bool),
+		executed: make(map[int]bool),
+	}
+	line := func(pos token.Pos) int {
+		return ir.Env.Fileset.Position(pos).Line
+	}
+
+	for _, node := range nodes {
+		cov.stmts[line(node.Pos())] = true
+	}
+	instrumentBlocks(nodes, func(stmts []ast.Stmt) []ast.Stmt {
+		instrumented := make([]ast.Stmt, 0, 2*len(stmts))
+		for _, stmt := range stmts {
+			if stmt.Pos().IsValid() {
+				n := line(stmt.Pos())
+				cov.stmts[n] = true
+				instrumented = append(instrumented, &ast.ExprStmt{X: &ast.CallExpr{
+					Fun:  ast.NewIdent(coverFuncName),
+					Args: []ast.Expr{&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(n)}},
+				}})
+			}
+			instrumented = append(instrumented, stmt)
+		}
+		return instrumented
+	})
+
+	activeCoverageMu.Lock()
+	activeCoverage = cov
+	activeCoverageMu.Unlock()
+	return cov
+}
+
+// coverStmt is the function called by instrumented statements before they run.
+func coverStmt(line int) {
+	activeCoverageMu.Lock()
+	cov := activeCoverage
+	activeCoverageMu.Unlock()
+
+	if cov != nil {
+		cov.mark(line)
+	}
+}
+
+// mark records that the statement starting at line ran.
+func (cov *cellCoverage) mark(line int) {
+	cov.mu.Lock()
+	defer cov.mu.Unlock()
+	cov.executed[line] = true
+}
+
+// coverNode records that a top-level node of the cell is about to run.
+func (cov *cellCoverage) coverNode(ir *classic.Interp, node ast.Node) {
+	cov.mark(ir.Env.Fileset.Position(node.Pos()).Line)
+}
+
+// finish stops recording the coverage and displays the source of the cell with the lines of the statements
+// that ran in green and the others in red. The text version marks them with "+" and "-".
+func (cov *cellCoverage) finish() {
+	activeCoverageMu.Lock()
+	activeCoverage = nil
+	activeCoverageMu.Unlock()
+
+	receipt, err := hooks.currentReceipt()
+	if err != nil {
+		return
+	}
+
+	cov.mu.Lock()
+	defer cov.mu.Unlock()
+
+	var text, htm bytes.Buffer
+	htm.WriteString("<pre>")
+	for i, line := range strings.Split(strings.TrimRight(cov.code, "\n"), "\n") {
+		marker, style := " ", ""
+		switch {
+		case cov.executed[i+1]:
+			marker, style = "+", ` style="background-color: #dfd"`
+		case cov.stmts[i+1]:
+			marker, style = "-", ` style="background-color: #fdd"`
+		}
+		fmt.Fprintf(&text, "%s %s\n", marker, line)
+		fmt.Fprintf(&htm, "<div%s>%s </div>", style, html.EscapeString(line))
+	}
+	htm.WriteString("</pre>")
+
+	err = receipt.PublishDisplayData(bundledMIMEData{
+		"text/plain": text.String(),
+		"text/html":  htm.String(),
+	}, nil, "")
+	if err != nil {
+		log.Printf("Error publishing coverage: %v\n", err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCrashCells is the number of the last cells executed kept for the crash reports.
+	maxCrashCells = 20
+
+	// maxCrashMessages is the number of the last messages received kept for the crash reports.
+	maxCrashMessages = 200
+)
+
+// crashCell is a cell executed by the kernel, as shown by the crash reports.
+type crashCell struct {
+	count int
+	start time.Time
+	code  string
+}
+
+// crashRecorder keeps the last cells executed and messages received, which the crash reports show.
+type crashRecorder struct {
+	mu       sync.Mutex
+	cells    []crashCell
+	messages []string
+}
+
+// crashes records the activity of the kernel for the crash reports.
+var crashes = &crashRecorder{}
+
+// recordMessage records a message received by the kernel.
+func (c *crashRecorder) recordMessage(msg ComposedMsg) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, fmt.Sprintf("%s %s id=%s session=%s parent=%s",
+		time.Now().Format(time.RFC3339Nano), msg.Header.MsgType, msg.Header.MsgID, msg.Header.Session,
+		msg.ParentHeader.MsgID))
+	if len(c.messages) > maxCrashMessages {
+		c.messages = c.messages[len(c.messages)-maxCrashMessages:]
+	}
+}
+
+// recordCell records a cell starting to execute.
+func (c *crashRecorder) recordCell(count int, code string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cells = append(c.cells, crashCell{count, time.Now(), code})
+	if len(c.cells) > maxCrashCells {
+		c.cells = c.cells[len(c.cells)-maxCrashCells:]
+	}
+}
+
+// report returns the crash report of the kernel failing for reason: the versions, the options of the kernel,
+// the last cells executed, the last messages received and the stacks of all the goroutines.
+func (c *crashRecorder) report(reason string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "gophernotes %s crash report\n", Version)
+	fmt.Fprintf(&b, "time: %s\ngo: %s %s/%s\n", time.Now().Format(time.RFC3339), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	fmt.Fprintf(&b, "\n== reason ==\n%s\n", strings.TrimSpace(reason))
+
+	b.WriteString("\n== options ==\n")
+	names := make([]string, 0, len(kernelOptions))
+	for name := range kernelOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\n", name, kernelOptions[name].value())
+	}
+	fmt.Fprintf(&b, "autoimport: %s\ncgo: %s\ncompletion: %s\nrecursionlimit: %d\n",
+		autoImport, cgoImports, completionMatching, recursionLimit)
+
+	c.mu.Lock()
+	b.WriteString("\n== last cells ==\n")
+	for _, cell := range c.cells {
+		fmt.Fprintf(&b, "-- In [%d] at %s\n%s\n", cell.count, cell.start.Format(time.RFC3339), strings.TrimRight(cell.code, "\n"))
+	}
+	b.WriteString("\n== last messages ==\n")
+	for _, msg := range c.messages {
+		b.WriteString(msg + "\n")
+	}
+	c.mu.Unlock()
+
+	b.WriteString("\n== goroutines ==\n")
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			b.Write(buf[:n])
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	return b.Bytes()
+}
+
+// crashDir returns the directory of the crash reports, $GOPHERNOTES_CRASH_DIR or ~/.gophernotes/crashes.
+func crashDir() string {
+	if dir := os.Getenv("GOPHERNOTES_CRASH_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".gophernotes", "crashes")
+}
+
+// writeCrashReport writes the crash report of the kernel failing for reason to a new file of dir, falling back
+// to the temporary directory, and returns its path.
+func writeCrashReport(dir, reason string) (string, error) {
+	report := crashes.report(reason)
+	name := fmt.Sprintf("gophernotes-crash-%s-%d.txt", time.Now().Format("20060102-150405"), os.Getpid())
+	for _, dir := range []string{dir, os.TempDir()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, report, 0600); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("cannot write the crash report to %s nor to %s", dir, os.TempDir())
+}
+
+// kernelFatal stops the kernel failing for reason, after writing a crash report to attach to bug reports.
+func kernelFatal(reason interface{}) {
+	log.Println(reason)
+	path, err := writeCrashReport(crashDir(), fmt.Sprint(reason))
+	if err != nil {
+		log.Println(err)
+	} else {
+		log.Printf("The kernel stopped. Please attach the crash report %s to your bug report at "+
+			"https://github.com/gopherdata/gophernotes/issues, after checking that it holds no secrets.\n", path)
+	}
+	os.Exit(1)
+}
+
+// crashOnPanic stops the kernel with a crash report when the function deferring it panics.
+func crashOnPanic() {
+	if r := recover(); r != nil {
+		kernelFatal(fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack()))
+	}
+}
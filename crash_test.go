@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCrashReport tests writing the crash report of the kernel with its last cells and messages.
+func TestCrashReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes-crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := crashes
+	defer func() { crashes = old }()
+	crashes = &crashRecorder{}
+	for i := 1; i <= maxCrashCells+5; i++ {
+		crashes.recordCell(i, fmt.Sprintf("x%d := %d\n", i, i))
+	}
+	for i := 0; i < maxCrashMessages+1; i++ {
+		crashes.recordMessage(ComposedMsg{Header: MsgHeader{MsgType: "execute_request", MsgID: fmt.Sprintf("m%d", i)}})
+	}
+
+	path, err := writeCrashReport(filepath.Join(dir, "crashes"), "boom")
+	if err != nil {
+		t.Fatalf("\t%s writeCrashReport: %v", failure, err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, want := range []string{
+		"== reason ==\nboom\n", "== options ==\n", "\nwarnings: ", "recursionlimit: ",
+		"-- In [25] at ", "x25 := 25\n", "execute_request id=m200 ", "== goroutines ==\ngoroutine ",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("\t%s Expected the crash report to contain %q:\n%s", failure, want, report)
+		}
+	}
+	if strings.Contains(report, "In [5] ") || strings.Contains(report, "id=m0 ") {
+		t.Errorf("\t%s Expected the crash report to only keep the last cells and messages", failure)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// deferFuncName is the name of the function returning the deferred calls of the functions of the cells.
+	deferFuncName = "__gophernotesDefer"
+
+	// callStackFrames is the number of frames allocated at once for the call stacks of the interpreter, so that
+	// they rarely need to grow.
+	callStackFrames = 64
+)
+
+// fixDefers rewrites the defer statements of the functions of node, as in `defer f(x)`, into deferred calls of
+// the function returned by deferFuncName, as in `defer __gophernotesDefer(f, false, x)()`. It copies the
+// function and the arguments when the statement runs, as the specification requires, where the interpreter
+// keeps the variables instead, so that the deferred calls would see the values they have when the function
+// returns, e.g. the last value of the variable of a loop. The defer statements the interpreter already gets right
+// are left to it, as it runs them faster: see deferredByInterp. It returns the replacement of node.
+func fixDefers(ir *classic.Interp, node ast.Node) ast.Node {
+	if !ir.Env.ValueOf(deferFuncName).IsValid() {
+		fn := builtinFunc(deferCall)
+		ir.Env.DefineVar(deferFuncName, fn.Type(), fn)
+	}
+	declared := declaredNames([]ast.Node{node})
+
+	fix := func(stmt ast.Stmt) ast.Stmt {
+		d, ok := stmt.(*ast.DeferStmt)
+		if !ok || !callsLater(ir, d.Call, declared) || deferredByInterp(ir, d.Call, declared) {
+			return stmt
+		}
+		ellipsis := "false"
+		if d.Call.Ellipsis.IsValid() {
+			ellipsis = "true"
+		}
+		args := []ast.Expr{d.Call.Fun, &ast.Ident{NamePos: d.Call.Lparen, Name: ellipsis}}
+		call := &ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: d.Call.Pos(), Name: deferFuncName},
+			Args:   append(args, d.Call.Args...),
+			Rparen: d.Call.Rparen,
+		}
+		return &ast.DeferStmt{Defer: d.Defer, Call: &ast.CallExpr{Fun: call, Lparen: d.Call.Rparen, Rparen: d.Call.Rparen}}
+	}
+
+	// The defer statements outside of functions are left to the interpreter.
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				rewriteStmts(n.Body, fix)
+			}
+			return false
+		case *ast.FuncLit:
+			rewriteStmts(n.Body, fix)
+			return false
+		}
+		return true
+	})
+	return node
+}
+
+// deferredByInterp reports whether the interpreter evaluates the deferred call like Go, as in `defer mu.Unlock()`:
+// it passes constant literals, if anything, to a function of a package, or to a method with a pointer receiver
+// of a variable of the session, which the variable cannot change. The call has no results, which the interpreter
+// would warn about. Only the variables and methods known before the cell are considered, as the interpreter keeps
+// the functions held by variables and the receivers of other methods instead of copying them.
+func deferredByInterp(ir *classic.Interp, call *ast.CallExpr, declared map[string]bool) bool {
+	if call.Ellipsis.IsValid() {
+		return false
+	}
+	for _, arg := range call.Args {
+		if _, ok := unparen(arg).(*ast.BasicLit); !ok {
+			return false
+		}
+	}
+	sel, ok := unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok || declared[x.Name] {
+		return false
+	}
+	v := ir.Env.ValueOf(x.Name)
+	var fn r.Type
+	if ref := packageRef(v); ref != nil {
+		if f, ok := ref.Binds[sel.Sel.Name]; ok && f.Kind() == r.Func && !f.CanAddr() {
+			fn = f.Type()
+		}
+	} else if v.IsValid() && v.CanAddr() && v.Kind() != r.Ptr && v.Kind() != r.Interface {
+		m, ok := r.PtrTo(v.Type()).MethodByName(sel.Sel.Name)
+		if _, byValue := v.Type().MethodByName(sel.Sel.Name); ok && !byValue {
+			fn = m.Type
+		}
+	}
+	return fn != nil && fn.NumOut() == 0
+}
+
+// deferCall implements deferFuncName: args are the function called by the defer statement, whether its call
+// has an ellipsis, and its arguments, evaluated by env. It returns the deferred call.
+func deferCall(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	if frame := env.CurrentFrame(); frame == nil || frame.FuncEnv == nil {
+		panic(errors.New("defer outside function"))
+	}
+	fn := args[0]
+	if fn.Kind() != r.Func {
+		env.Errorf("defer of non-function %v", fn)
+	}
+	fn = copyValue(fn, fn.Type())
+	in, err := callArgs("defer", fn.Type(), args[2:], args[1].Bool())
+	if err != nil {
+		env.Errorf("%v", err)
+	}
+
+	stack := env.CallStack
+	return r.ValueOf(func() {
+		// The interpreter keeps pointers to the frames of the functions running their deferred calls, e.g. to
+		// re-panic unless recover cleared the panic of the frame. The frames of the call may move the frames of
+		// the stack to grow it: move them back, with what the call changed, recover included.
+		frames := stack.Frames
+		defer func() {
+			if len(stack.Frames) >= len(frames) && len(frames) > 0 && &stack.Frames[0] != &frames[0] {
+				copy(frames, stack.Frames)
+				stack.Frames = frames
+			}
+		}()
+		callValues(fn, in)
+	}), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"testing"
+)
+
+// TestDeferRecoverDepth tests that deferred calls recover the panics of their function at any depth of the call
+// stack, including those where their frames make it grow.
+func TestDeferRecoverDepth(t *testing.T) {
+	ir := newInterp()
+	_, err := doEval(ir, `var got interface{}
+func deep(n int) {
+	if n > 0 {
+		deep(n - 1)
+		return
+	}
+	defer func() { got = recover() }()
+	panic("boom")
+}`)
+	if err != nil {
+		t.Fatalf("\t%s Declaring deep: %v", failure, err)
+	}
+	for n := 0; n < 600; n++ {
+		vals, err := doEval(ir, fmt.Sprintf("got = nil\ndeep(%d)\ngot", n))
+		if err != nil || len(vals) != 1 || vals[0] != "boom" {
+			t.Errorf("\t%s Expected deep(%d) to recover boom but got %v, %v", failure, n, vals, err)
+		}
+	}
+}
+
+// TestDeferredByInterp tests that the deferred calls the interpreter evaluates like Go are left to it, and only
+// those.
+func TestDeferredByInterp(t *testing.T) {
+	ir := newInterp()
+	_, err := doEval(ir, `import ("bytes"; "fmt"; "sort"; "sync"; "time")
+var mu sync.Mutex
+var pmu = &mu
+var buf bytes.Buffer
+var ints sort.IntSlice
+var f = func() {}`)
+	if err != nil {
+		t.Fatalf("\t%s Declaring the variables: %v", failure, err)
+	}
+	cases := []struct {
+		call string
+		want bool
+	}{
+		{"mu.Unlock()", true},
+		{"buf.Reset()", true},
+		{"time.Sleep(1)", true},
+		{"buf.WriteString(\"x\")", false},
+		{"fmt.Println(\"x\")", false},
+		{"pmu.Unlock()", false},
+		{"ints.Sort()", false},
+		{"time.Sleep(d)", false},
+		{"f()", false},
+		{"local.Unlock()", false},
+	}
+	declared := map[string]bool{"local": true}
+	for _, c := range cases {
+		expr, err := parser.ParseExpr(c.call)
+		if err != nil {
+			t.Fatalf("\t%s Parsing %s: %v", failure, c.call, err)
+		}
+		if got := deferredByInterp(ir, expr.(*ast.CallExpr), declared); got != c.want {
+			t.Errorf("\t%s Expected deferredByInterp to be %v but got %v for %s", failure, c.want, got, c.call)
+		}
+	}
+}
+
+// benchmarkCalls measures the calls of the interpreted function run declared by code.
+func benchmarkCalls(b *testing.B, code string) {
+	ir := newInterp()
+	vals, err := doEval(ir, "import \"sync\"\nvar mu sync.Mutex\n"+code+"\nrun")
+	if err != nil || len(vals) != 1 {
+		b.Fatalf("\t%s Declaring run: %v", failure, err)
+	}
+	run := vals[0].(func())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		run()
+	}
+}
+
+// BenchmarkDeferUnlock measures a function unlocking a mutex with a deferred call, to compare with
+// BenchmarkExplicitUnlock.
+func BenchmarkDeferUnlock(b *testing.B) {
+	benchmarkCalls(b, "func run() {\n\tmu.Lock()\n\tdefer mu.Unlock()\n}")
+}
+
+// BenchmarkExplicitUnlock measures a function unlocking a mutex without defer.
+func BenchmarkExplicitUnlock(b *testing.B) {
+	benchmarkCalls(b, "func run() {\n\tmu.Lock()\n\tmu.Unlock()\n}")
+}
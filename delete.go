@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+func init() {
+	lineMagics["delete"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) == 0 {
+			return errors.New("expected the names of the symbols to delete")
+		}
+		return deleteSymbols(ir, args)
+	}
+}
+
+// Delete implements notebook.Kernel.Delete.
+func (h *kernelHooks) Delete(names ...string) error {
+	if h.ir == nil {
+		return errors.New("notebook: Delete: no interpreter")
+	}
+	return deleteSymbols(h.ir, names)
+}
+
+// deleteSymbols removes the top-level variables, constants, functions and types with the given names from
+// the interpreter, then returns the memory they referenced to the operating system. The interpreter keeps its
+// symbols in maps, so nothing else refers to them once deleted. Values such as open files are released
+// when the garbage collector finalizes them.
+func deleteSymbols(ir *classic.Interp, names []string) error {
+	for _, name := range names {
+		if _, ok := ir.Env.Binds.Get(name); ok {
+			ir.Env.Binds.Del(name)
+		} else if _, ok := ir.Env.Types.Get(name); ok {
+			ir.Env.Types.Del(name)
+		} else {
+			return fmt.Errorf("%s is not defined", name)
+		}
+
+		// Cells reading the symbol no longer depend on the cell that defined it.
+		delete(deps.definers, name)
+	}
+
+	debug.FreeOSMemory()
+	return nil
+}
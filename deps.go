@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/cosmos72/gomacro/ast2"
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// depCell records the top-level symbols that the last successful execution of a cell defined and read.
+type depCell struct {
+	id    string
+	label string
+	code  string
+
+	// order is the position of the cell in the order of execution.
+	order int
+
+	defines []string
+
+	// reads maps the ids of the cells that defined the symbols read by this cell to these symbols.
+	reads map[string][]string
+}
+
+// depGraph tracks the dependencies between the cells of the session through the symbols they define and read.
+// Cells are identified by the "cellId" sent in the metadata of their execute_request, or by their execution
+// count for front-ends that do not send it, in which case re-executions cannot be detected.
+type depGraph struct {
+	cells map[string]*depCell
+
+	// definers maps each top-level symbol to the id of the cell that last defined or assigned it.
+	definers map[string]string
+
+	// stale holds the ids of the cells that read symbols redefined since they last ran.
+	stale map[string]bool
+
+	// autorun is toggled by `%deps autorun on|off`. When set, stale cells are re-run automatically.
+	autorun bool
+
+	// rerunning is set while stale cells are re-run, to stop a stale cell running `%deps stale` from re-running
+	// itself forever.
+	rerunning bool
+
+	order int
+}
+
+// deps is the dependency graph of the session.
+var deps = &depGraph{
+	cells:    make(map[string]*depCell),
+	definers: make(map[string]string),
+	stale:    make(map[string]bool),
+}
+
+func init() {
+	lineMagics["deps"] = depsMagic
+}
+
+// depsMagic implements `%deps [mermaid|dot|stale|autorun on|off]`.
+func depsMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if len(args) == 0 {
+		args = []string{"mermaid"}
+	}
+
+	switch args[0] {
+	case "mermaid":
+		return publishDeps(receipt, display.Mermaid(deps.mermaid()))
+	case "dot":
+		return publishDeps(receipt, display.Graphviz(deps.dot()))
+	case "stale":
+		return deps.rerunStale(ir, receipt)
+	case "autorun":
+		var err error
+		deps.autorun, err = parseSwitch(args[1:])
+		return err
+	}
+	return fmt.Errorf("unknown subcommand %q, expected mermaid, dot, stale or autorun", args[0])
+}
+
+// publishDeps displays a rendering of the dependency graph, along with a text listing of the dependencies.
+func publishDeps(receipt *msgReceipt, data display.Data) error {
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	data[display.MIMETypeText] = deps.String()
+	return receipt.PublishDisplayData(bundledMIMEData(data), nil, "")
+}
+
+// cellID returns the id identifying the cell of an execute_request in the dependency graph.
+func cellID(receipt *msgReceipt, execCount int) string {
+	if id, ok := receipt.Msg.Metadata["cellId"].(string); ok && id != "" {
+		return id
+	}
+	return fmt.Sprintf("exec-%d", execCount)
+}
+
+// record updates the graph after the successful execution of the cell id and returns the symbols the cell
+// defines. Cells that read these symbols become stale, unless they are the cell itself. Cells handled by a
+// cell magic are not tracked.
+func (g *depGraph) record(ir *classic.Interp, id, label, code string) []string {
+	if strings.HasPrefix(code, "%%") {
+		return nil
+	}
+
+	nodes, ok := parseCellNodes(ir, code)
+	if !ok || len(nodes) == 0 {
+		return nil
+	}
+
+	defines, reads := g.symbols(nodes)
+
+	cell := &depCell{
+		id:      id,
+		label:   label,
+		code:    code,
+		order:   g.order,
+		defines: defines,
+		reads:   make(map[string][]string),
+	}
+	g.order++
+
+	for _, name := range reads {
+		if definer, ok := g.definers[name]; ok && definer != id {
+			cell.reads[definer] = append(cell.reads[definer], name)
+		}
+	}
+
+	_, rerun := g.cells[id]
+	g.cells[id] = cell
+	delete(g.stale, id)
+
+	for _, name := range defines {
+		g.definers[name] = id
+	}
+
+	if rerun {
+		for _, other := range g.cells {
+			if _, ok := other.reads[id]; ok && other.id != id {
+				g.stale[other.id] = true
+			}
+		}
+	}
+	return defines
+}
+
+// rerunStale runs the stale cells again, in their original order, until none is left. Re-running a cell
+// makes the cells depending on it stale in turn.
+func (g *depGraph) rerunStale(ir *classic.Interp, receipt *msgReceipt) error {
+	if g.rerunning {
+		return errors.New("stale cells are already being re-run")
+	}
+	g.rerunning = true
+	defer func() { g.rerunning = false }()
+
+	for runs := 0; len(g.stale) > 0; runs++ {
+		if runs > len(g.cells) {
+			return errors.New("cyclic dependencies between stale cells")
+		}
+
+		var cells []*depCell
+		for id := range g.stale {
+			cells = append(cells, g.cells[id])
+		}
+		sort.Slice(cells, func(i, j int) bool { return cells[i].order < cells[j].order })
+
+		cell := cells[0]
+		fmt.Printf("Re-running stale cell %s\n", cell.label)
+
+		vals, err := evalCell(ir, receipt, cell.code)
+		if err != nil {
+			return fmt.Errorf("re-running %s: %v", cell.label, err)
+		}
+		if vals != nil && receipt != nil {
+			if err := receipt.PublishDisplayData(renderValues(vals), nil, ""); err != nil {
+				log.Printf("Error publishing result of stale cell: %v\n", err)
+			}
+		}
+		g.record(ir, cell.id, cell.label, cell.code)
+	}
+	return nil
+}
+
+// parseCellNodes parses the Go code of a cell, ignoring its line magics.
+func parseCellNodes(ir *classic.Interp, code string) (nodes []ast.Node, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+
+	switch src := ir.ParseOnly(blankMagics(code)).(type) {
+	case ast2.AstWithNode:
+		return []ast.Node{src.Node()}, true
+	case ast2.NodeSlice:
+		return src.X, true
+	}
+	return nil, true
+}
+
+// blankMagics replaces the line magics of the code of a cell by empty lines, keeping the other lines in place.
+func blankMagics(code string) string {
+	lines := strings.SplitAfter(code, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "%") {
+			lines[i] = "\n"
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// symbols returns the top-level symbols defined by nodes, including the session symbols they assign, and the
+// session symbols they read.
+func (g *depGraph) symbols(nodes []ast.Node) (defines, reads []string) {
+	defined := make(map[string]bool)
+	define := func(ident *ast.Ident) {
+		if ident != nil && ident.Name != "_" && !defined[ident.Name] {
+			defined[ident.Name] = true
+			defines = append(defines, ident.Name)
+		}
+	}
+
+	for _, node := range nodes {
+		if stmt, ok := node.(*ast.DeclStmt); ok {
+			node = stmt.Decl
+		}
+
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			if node.Recv == nil {
+				define(node.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range node.Specs {
+				switch spec := spec.(type) {
+				case *ast.ImportSpec:
+					if spec.Name != nil {
+						define(spec.Name)
+					} else {
+						path := strings.Trim(spec.Path.Value, "\"`")
+						define(ast.NewIdent(path[strings.LastIndexByte(path, '/')+1:]))
+					}
+				case *ast.TypeSpec:
+					define(spec.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						define(name)
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			if node.Tok == token.DEFINE {
+				for _, lhs := range node.Lhs {
+					ident, _ := lhs.(*ast.Ident)
+					define(ident)
+				}
+			}
+		}
+	}
+
+	read := make(map[string]bool)
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				// Only the package or value being selected from can be a session symbol.
+				ast.Inspect(n.X, func(n ast.Node) bool {
+					if ident, ok := n.(*ast.Ident); ok && !read[ident.Name] {
+						read[ident.Name] = true
+						reads = append(reads, ident.Name)
+					}
+					return true
+				})
+				return false
+			case *ast.AssignStmt:
+				// Assigning a session symbol anywhere in the cell redefines it.
+				if n.Tok != token.DEFINE {
+					for _, lhs := range n.Lhs {
+						if ident, ok := lhs.(*ast.Ident); ok {
+							if _, known := g.definers[ident.Name]; known {
+								define(ident)
+							}
+						}
+					}
+				}
+			case *ast.IncDecStmt:
+				if ident, ok := n.X.(*ast.Ident); ok {
+					if _, known := g.definers[ident.Name]; known {
+						define(ident)
+					}
+				}
+			case *ast.Ident:
+				if !read[n.Name] {
+					read[n.Name] = true
+					reads = append(reads, n.Name)
+				}
+			}
+			return true
+		})
+	}
+
+	return defines, reads
+}
+
+// sortedCells returns the cells of the graph in their order of execution.
+func (g *depGraph) sortedCells() []*depCell {
+	cells := make([]*depCell, 0, len(g.cells))
+	for _, cell := range g.cells {
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].order < cells[j].order })
+	return cells
+}
+
+// edges calls fn for each dependency of a cell on another cell, in order of execution.
+func (g *depGraph) edges(fn func(from, to *depCell, symbols []string)) {
+	for _, cell := range g.sortedCells() {
+		var definers []*depCell
+		for id := range cell.reads {
+			if definer, ok := g.cells[id]; ok {
+				definers = append(definers, definer)
+			}
+		}
+		sort.Slice(definers, func(i, j int) bool { return definers[i].order < definers[j].order })
+
+		for _, definer := range definers {
+			fn(definer, cell, cell.reads[definer.id])
+		}
+	}
+}
+
+// mermaid renders the graph as a Mermaid flowchart. Stale cells are highlighted.
+func (g *depGraph) mermaid() string {
+	var buf bytes.Buffer
+	buf.WriteString("graph TD\n")
+	for _, cell := range g.sortedCells() {
+		fmt.Fprintf(&buf, "  c%d[\"%s: %s\"]\n", cell.order, cell.label, strings.Join(cell.defines, ", "))
+		if g.stale[cell.id] {
+			fmt.Fprintf(&buf, "  style c%d stroke:#d62728,stroke-dasharray:4\n", cell.order)
+		}
+	}
+	g.edges(func(from, to *depCell, symbols []string) {
+		fmt.Fprintf(&buf, "  c%d -->|%s| c%d\n", from.order, strings.Join(symbols, ", "), to.order)
+	})
+	return buf.String()
+}
+
+// dot renders the graph in the Graphviz DOT language. Stale cells are dashed.
+func (g *depGraph) dot() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph deps {\n")
+	for _, cell := range g.sortedCells() {
+		style := ""
+		if g.stale[cell.id] {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&buf, "  c%d [label=%q%s];\n", cell.order, cell.label+": "+strings.Join(cell.defines, ", "), style)
+	}
+	g.edges(func(from, to *depCell, symbols []string) {
+		fmt.Fprintf(&buf, "  c%d -> c%d [label=%q];\n", from.order, to.order, strings.Join(symbols, ", "))
+	})
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// String lists the dependencies of each cell as text.
+func (g *depGraph) String() string {
+	var buf bytes.Buffer
+	g.edges(func(from, to *depCell, symbols []string) {
+		fmt.Fprintf(&buf, "%s -> %s (%s)\n", from.label, to.label, strings.Join(symbols, ", "))
+	})
+	for _, cell := range g.sortedCells() {
+		if g.stale[cell.id] {
+			fmt.Fprintf(&buf, "%s is stale\n", cell.label)
+		}
+	}
+	return buf.String()
+}
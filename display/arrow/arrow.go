@@ -0,0 +1,190 @@
+// Package arrow encodes slices of structs as tables in the Apache Arrow IPC file format, and makes the results of
+// cells holding them display as such tables. It is a module of its own, so that the users of the display package
+// do not depend on the Arrow libraries.
+package arrow
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// init renders the slices and arrays of structs as Arrow tables, of type display.MIMETypeArrow.
+func init() {
+	for _, kind := range []reflect.Kind{reflect.Slice, reflect.Array} {
+		display.RegisterKind(kind, 0, func(v interface{}) (display.Data, bool) {
+			table, err := File(v)
+			if err != nil {
+				return nil, false
+			}
+			return display.Data{display.MIMETypeArrow: table}, true
+		})
+	}
+}
+
+// File encodes rows, a slice or array of structs or of pointers to structs, as a table in the Arrow IPC
+// file format. Each field of the structs becomes a column. Fields must be booleans, numbers or strings.
+// The result can be written to a .arrow or .feather file and read by pyarrow, pandas or polars.
+func File(rows interface{}) ([]byte, error) {
+	columns, err := tableColumns(reflect.ValueOf(rows))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]arrow.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = arrow.Field{Name: column.name, Type: dataType(column.kind)}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	for i, column := range columns {
+		appendColumn(builder.Field(i), column)
+	}
+	record := builder.NewRecordBatch()
+	defer record.Release()
+
+	var file bytes.Buffer
+	w, err := ipc.NewFileWriter(&file, ipc.WithSchema(schema))
+	if err != nil {
+		return nil, fmt.Errorf("arrow: %v", err)
+	}
+	if err := w.Write(record); err != nil {
+		return nil, fmt.Errorf("arrow: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("arrow: %v", err)
+	}
+	return file.Bytes(), nil
+}
+
+// WriteFile writes rows as an Arrow IPC file to path, so that other programs, e.g. Python cells of another
+// kernel, can load them. See File.
+func WriteFile(path string, rows interface{}) error {
+	data, err := File(rows)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// column is a column of a table: the values of a struct field across rows.
+type column struct {
+	name   string
+	kind   reflect.Kind
+	values []reflect.Value
+}
+
+// tableColumns splits rows into columns, one per field of the structs.
+func tableColumns(rows reflect.Value) ([]column, error) {
+	if rows.Kind() != reflect.Slice && rows.Kind() != reflect.Array {
+		return nil, fmt.Errorf("arrow: expected a slice of structs, got %s", rows.Kind())
+	}
+
+	rowType := rows.Type().Elem()
+	pointers := rowType.Kind() == reflect.Ptr
+	if pointers {
+		rowType = rowType.Elem()
+	}
+	if rowType.Kind() != reflect.Struct || rowType.NumField() == 0 {
+		return nil, fmt.Errorf("arrow: expected a slice of structs, got %v", rows.Type())
+	}
+
+	columns := make([]column, rowType.NumField())
+	for i := range columns {
+		field := rowType.Field(i)
+		switch field.Type.Kind() {
+		case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("arrow: unsupported column %s of type %v", field.Name, field.Type)
+		}
+		columns[i] = column{name: field.Name, kind: field.Type.Kind()}
+	}
+
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i)
+		if pointers {
+			if row.IsNil() {
+				return nil, errors.New("arrow: nil row")
+			}
+			row = row.Elem()
+		}
+		for j := range columns {
+			columns[j].values = append(columns[j].values, row.Field(j))
+		}
+	}
+	return columns, nil
+}
+
+// dataType returns the Arrow type of a column of the given kind. int and uint are stored with 64 bits.
+func dataType(kind reflect.Kind) arrow.DataType {
+	switch kind {
+	case reflect.Bool:
+		return arrow.FixedWidthTypes.Boolean
+	case reflect.String:
+		return arrow.BinaryTypes.String
+	case reflect.Float32:
+		return arrow.PrimitiveTypes.Float32
+	case reflect.Float64:
+		return arrow.PrimitiveTypes.Float64
+	case reflect.Int8:
+		return arrow.PrimitiveTypes.Int8
+	case reflect.Int16:
+		return arrow.PrimitiveTypes.Int16
+	case reflect.Int32:
+		return arrow.PrimitiveTypes.Int32
+	case reflect.Int, reflect.Int64:
+		return arrow.PrimitiveTypes.Int64
+	case reflect.Uint8:
+		return arrow.PrimitiveTypes.Uint8
+	case reflect.Uint16:
+		return arrow.PrimitiveTypes.Uint16
+	case reflect.Uint32:
+		return arrow.PrimitiveTypes.Uint32
+	}
+	return arrow.PrimitiveTypes.Uint64
+}
+
+// appendColumn appends the values of column to b, the builder of the array of its Arrow type.
+func appendColumn(b array.Builder, column column) {
+	b.Reserve(len(column.values))
+	for _, v := range column.values {
+		switch b := b.(type) {
+		case *array.BooleanBuilder:
+			b.Append(v.Bool())
+		case *array.StringBuilder:
+			b.Append(v.String())
+		case *array.Float32Builder:
+			b.Append(float32(v.Float()))
+		case *array.Float64Builder:
+			b.Append(v.Float())
+		case *array.Int8Builder:
+			b.Append(int8(v.Int()))
+		case *array.Int16Builder:
+			b.Append(int16(v.Int()))
+		case *array.Int32Builder:
+			b.Append(int32(v.Int()))
+		case *array.Int64Builder:
+			b.Append(v.Int())
+		case *array.Uint8Builder:
+			b.Append(uint8(v.Uint()))
+		case *array.Uint16Builder:
+			b.Append(uint16(v.Uint()))
+		case *array.Uint32Builder:
+			b.Append(uint32(v.Uint()))
+		case *array.Uint64Builder:
+			b.Append(v.Uint())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package arrow
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+func TestFile(t *testing.T) {
+	type row struct {
+		Name  string
+		Count int
+		Ratio float64
+		OK    bool
+		Small uint8
+	}
+
+	data, err := File([]*row{{"a", 1, 0.5, true, 7}, {"bc", 2, 1.5, false, 255}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ipc.NewFileReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, want := r.Schema().String(), "schema:\n  fields: 5\n"+
+		"    - Name: type=utf8\n    - Count: type=int64\n    - Ratio: type=float64\n"+
+		"    - OK: type=bool\n    - Small: type=uint8"; got != want {
+		t.Errorf("File() schema = %q, want %q", got, want)
+	}
+	if r.NumRecords() != 1 {
+		t.Fatalf("File() has %d record batches, want 1", r.NumRecords())
+	}
+	record, err := r.RecordBatch(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := record.Column(0).(*array.String).Value(1), "bc"; got != want {
+		t.Errorf("File() Name[1] = %q, want %q", got, want)
+	}
+	if got, want := record.Column(1).(*array.Int64).Value(1), int64(2); got != want {
+		t.Errorf("File() Count[1] = %d, want %d", got, want)
+	}
+	if got, want := record.Column(2).(*array.Float64).Value(0), 0.5; got != want {
+		t.Errorf("File() Ratio[0] = %v, want %v", got, want)
+	}
+	if got := record.Column(3).(*array.Boolean).Value(0); !got {
+		t.Errorf("File() OK[0] = %v, want true", got)
+	}
+	if got, want := record.Column(4).(*array.Uint8).Value(1), uint8(255); got != want {
+		t.Errorf("File() Small[1] = %d, want %d", got, want)
+	}
+
+	if _, err := File([]int{1, 2}); err == nil {
+		t.Errorf("File() of a slice of ints did not fail")
+	}
+	if _, err := File([]struct{ M map[string]int }{{}}); err == nil {
+		t.Errorf("File() of a struct with a map did not fail")
+	}
+	if _, err := File([]*row{nil}); err == nil {
+		t.Errorf("File() of a nil row did not fail")
+	}
+}
+
+func TestRender(t *testing.T) {
+	type row struct{ N int }
+	if data, ok := display.Render([]row{{1}}); !ok || data[display.MIMETypeArrow] == nil {
+		t.Errorf("Render() of a slice of structs = %v, %v, want an Arrow table", data, ok)
+	}
+	if _, ok := display.Render([]int{1}); ok {
+		t.Errorf("Render() of a slice of ints rendered it")
+	}
+}
@@ -0,0 +1,316 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+const (
+	// diagramBoxHeight and diagramMinBoxWidth are the size in pixels of the boxes of a diagram, which are wider
+	// when their label needs it.
+	diagramBoxHeight   = 30
+	diagramMinBoxWidth = 60
+
+	// diagramCharWidth is the approximate width in pixels of a character of the labels.
+	diagramCharWidth = 7
+
+	// diagramGapX and diagramGapY are the space in pixels between the boxes of a layer, and between the layers.
+	diagramGapX = 30
+	diagramGapY = 50
+
+	// diagramMargin is the space in pixels left around the boxes, where the arrows going up are drawn.
+	diagramMargin = 40
+)
+
+// Diagram is a drawing of labeled boxes joined by arrows, for architecture sketches and algorithm
+// visualizations. The boxes are laid out in layers from top to bottom, each box below the boxes it has an
+// arrow from, unless the arrow closes a cycle. Box and Arrow return the diagram, so that calls can be chained:
+//
+//	display.NewDiagram().Arrow("client", "server", "HTTP").Arrow("server", "db", "SQL").Data()
+type Diagram struct {
+	boxes  []diagramBox
+	arrows []diagramArrow
+	index  map[string]int
+}
+
+type diagramBox struct {
+	id, label string
+}
+
+type diagramArrow struct {
+	from, to int
+	label    string
+}
+
+// NewDiagram returns an empty diagram.
+func NewDiagram() *Diagram {
+	return &Diagram{index: make(map[string]int)}
+}
+
+// Box adds the box id with the given label, or sets the label of the box id if it exists.
+func (d *Diagram) Box(id, label string) *Diagram {
+	d.box(id)
+	d.boxes[d.index[id]].label = label
+	return d
+}
+
+// Arrow adds an arrow from the box from to the box to, with an optional label. The boxes which do not exist are
+// added, labeled with their id.
+func (d *Diagram) Arrow(from, to, label string) *Diagram {
+	d.arrows = append(d.arrows, diagramArrow{d.box(from), d.box(to), label})
+	return d
+}
+
+// box returns the index of the box id, adding it if needed.
+func (d *Diagram) box(id string) int {
+	if i, ok := d.index[id]; ok {
+		return i
+	}
+	d.index[id] = len(d.boxes)
+	d.boxes = append(d.boxes, diagramBox{id, id})
+	return len(d.boxes) - 1
+}
+
+// Graph returns the diagram of the directed graph whose arrows go from each key of edges to each of its values,
+// the keys being added in sorted order.
+func Graph(edges map[string][]string) *Diagram {
+	keys := make([]string, 0, len(edges))
+	for k := range edges {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	d := NewDiagram()
+	for _, k := range keys {
+		d.box(k)
+		for _, v := range edges[k] {
+			d.Arrow(k, v, "")
+		}
+	}
+	return d
+}
+
+// Data returns the SVG image of the diagram, along with a text listing of its arrows.
+func (d *Diagram) Data() Data {
+	return Data{
+		MIMETypeSVG:  d.SVG(),
+		MIMETypeText: d.String(),
+	}
+}
+
+// String lists the boxes of the diagram and its arrows.
+func (d *Diagram) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "diagram of %d boxes and %d arrows", len(d.boxes), len(d.arrows))
+	for _, a := range d.arrows {
+		fmt.Fprintf(&buf, "\n  %s -> %s", d.boxes[a.from].label, d.boxes[a.to].label)
+		if a.label != "" {
+			fmt.Fprintf(&buf, ": %s", a.label)
+		}
+	}
+	for i, b := range d.boxes {
+		if !d.connected(i) {
+			fmt.Fprintf(&buf, "\n  %s", b.label)
+		}
+	}
+	return buf.String()
+}
+
+// connected reports whether an arrow starts or ends at box i.
+func (d *Diagram) connected(i int) bool {
+	for _, a := range d.arrows {
+		if a.from == i || a.to == i {
+			return true
+		}
+	}
+	return false
+}
+
+// layers returns the layer of each box: 0 for the boxes no arrow goes to, and one more than the deepest box
+// with an arrow to it otherwise, ignoring the arrows closing cycles.
+func (d *Diagram) layers() []int {
+	out := make([][]int, len(d.boxes))
+	for _, a := range d.arrows {
+		out[a.from] = append(out[a.from], a.to)
+	}
+
+	// Visit the boxes depth first to order them topologically, skipping the arrows back to a box being visited.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(d.boxes))
+	order := make([]int, 0, len(d.boxes))
+	var visit func(int)
+	visit = func(i int) {
+		state[i] = visiting
+		for _, j := range out[i] {
+			if state[j] == unvisited {
+				visit(j)
+			}
+		}
+		state[i] = visited
+		order = append(order, i)
+	}
+	for i := range d.boxes {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	rank := make([]int, len(d.boxes))
+	for k, i := range order {
+		rank[i] = len(order) - k
+	}
+	layer := make([]int, len(d.boxes))
+	for k := len(order) - 1; k >= 0; k-- {
+		i := order[k]
+		for _, j := range out[i] {
+			if rank[j] > rank[i] && layer[j] < layer[i]+1 {
+				layer[j] = layer[i] + 1
+			}
+		}
+	}
+	return layer
+}
+
+// diagramRect is the position of a box in the SVG image.
+type diagramRect struct {
+	x, y, w, h float64
+}
+
+func (r diagramRect) centerX() float64 { return r.x + r.w/2 }
+func (r diagramRect) centerY() float64 { return r.y + r.h/2 }
+
+// layout returns the position of each box and the size of the image.
+func (d *Diagram) layout() (rects []diagramRect, width, height float64) {
+	layer := d.layers()
+	var rows [][]int
+	for i, l := range layer {
+		for len(rows) <= l {
+			rows = append(rows, nil)
+		}
+		rows[l] = append(rows[l], i)
+	}
+
+	rects = make([]diagramRect, len(d.boxes))
+	for i, b := range d.boxes {
+		w := float64(len([]rune(b.label))*diagramCharWidth + 20)
+		if w < diagramMinBoxWidth {
+			w = diagramMinBoxWidth
+		}
+		rects[i] = diagramRect{w: w, h: diagramBoxHeight}
+	}
+
+	// Order the boxes of each layer by the mean position of the boxes above with an arrow to them, reducing
+	// the crossings of the arrows.
+	in := make([][]int, len(d.boxes))
+	for _, a := range d.arrows {
+		if layer[a.from] < layer[a.to] {
+			in[a.to] = append(in[a.to], a.from)
+		}
+	}
+	position := make([]float64, len(d.boxes))
+	for _, row := range rows {
+		mean := make(map[int]float64, len(row))
+		for k, i := range row {
+			mean[i] = float64(k)
+			if len(in[i]) > 0 {
+				sum := 0.0
+				for _, j := range in[i] {
+					sum += position[j]
+				}
+				mean[i] = sum / float64(len(in[i]))
+			}
+		}
+		sort.SliceStable(row, func(a, b int) bool { return mean[row[a]] < mean[row[b]] })
+		for k, i := range row {
+			position[i] = float64(k)
+		}
+	}
+
+	rowWidths := make([]float64, len(rows))
+	for l, row := range rows {
+		for k, i := range row {
+			if k > 0 {
+				rowWidths[l] += diagramGapX
+			}
+			rowWidths[l] += rects[i].w
+		}
+		if rowWidths[l] > width {
+			width = rowWidths[l]
+		}
+	}
+	for l, row := range rows {
+		x := diagramMargin + (width-rowWidths[l])/2
+		for _, i := range row {
+			rects[i].x = x
+			rects[i].y = float64(diagramMargin + l*(diagramBoxHeight+diagramGapY))
+			x += rects[i].w + diagramGapX
+		}
+	}
+	width += 2 * diagramMargin
+	height = float64(2*diagramMargin + len(rows)*diagramBoxHeight + (len(rows)-1)*diagramGapY)
+	if len(rows) == 0 {
+		height = 2 * diagramMargin
+	}
+	return rects, width, height
+}
+
+// SVG returns the diagram drawn as an SVG image.
+func (d *Diagram) SVG() string {
+	rects, width, height := d.layout()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`,
+		width, height, width, height)
+	buf.WriteString(`<defs><marker id="arrowhead" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto-start-reverse"><path d="M0,0 L10,5 L0,10 z" fill="#555"/></marker></defs>`)
+
+	buf.WriteString(`<g fill="none" stroke="#555" stroke-width="1.5" marker-end="url(#arrowhead)">`)
+	var labels bytes.Buffer
+	for _, a := range d.arrows {
+		from, to := rects[a.from], rects[a.to]
+		var lx, ly float64
+		switch {
+		case a.from == a.to:
+			x, y := from.x+from.w, from.centerY()
+			fmt.Fprintf(&buf, `<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f"/>`,
+				x, y-8, x+30, y-25, x+30, y+25, x, y+8)
+			lx, ly = x+32, y
+		case to.y > from.y:
+			x1, y1, x2, y2 := from.centerX(), from.y+from.h, to.centerX(), to.y
+			fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, x1, y1, x2, y2)
+			lx, ly = (x1+x2)/2+4, (y1+y2)/2
+		default:
+			// The arrow goes up, or within a layer: draw it as a curve bowing to the right of both boxes.
+			x1, y1, x2, y2 := from.x+from.w, from.centerY(), to.x+to.w, to.centerY()
+			bow := 30 + (from.y-to.y)/4
+			if x2 > x1 {
+				x1 = x2
+			}
+			fmt.Fprintf(&buf, `<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f"/>`,
+				from.x+from.w, y1, x1+bow, y1, x1+bow, y2, x2, y2)
+			lx, ly = x1+bow*3/4+4, (y1+y2)/2
+		}
+		if a.label != "" {
+			fmt.Fprintf(&labels, `<text x="%.1f" y="%.1f">%s</text>`, lx, ly, html.EscapeString(a.label))
+		}
+	}
+	buf.WriteString(`</g>`)
+	fmt.Fprintf(&buf, `<g font-family="sans-serif" font-size="11" fill="#444">%s</g>`, labels.String())
+
+	buf.WriteString(`<g font-family="sans-serif" font-size="13" text-anchor="middle">`)
+	for i, b := range d.boxes {
+		r := rects[i]
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="4" fill="#e8f0fe" stroke="#1f77b4"/>`,
+			r.x, r.y, r.w, r.h)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f">%s</text>`, r.centerX(), r.centerY()+4, html.EscapeString(b.label))
+	}
+	buf.WriteString(`</g></svg>`)
+
+	return buf.String()
+}
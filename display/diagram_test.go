@@ -0,0 +1,39 @@
+package display
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiagramLayers(t *testing.T) {
+	d := NewDiagram().Arrow("a", "b", "").Arrow("b", "c", "").Arrow("c", "a", "back").Arrow("a", "c", "").Box("d", "alone")
+	if got, want := d.layers(), []int{0, 1, 2, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("layers() = %v, want %v", got, want)
+	}
+}
+
+func TestDiagramData(t *testing.T) {
+	data := NewDiagram().Box("api", "API <v2>").Arrow("api", "db", "SQL").Arrow("db", "db", "").Box("cache", "cache").Data()
+
+	text := data.Text()
+	if want := "diagram of 3 boxes and 2 arrows\n  API <v2> -> db: SQL\n  db -> db\n  cache"; text != want {
+		t.Errorf("Text() = %q, want %q", text, want)
+	}
+	svg := data[MIMETypeSVG].(string)
+	for _, want := range []string{"<svg ", ">API &lt;v2&gt;</text>", ">SQL</text>", `marker-end="url(#arrowhead)"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG() does not contain %q:\n%s", want, svg)
+		}
+	}
+	if got := strings.Count(svg, "<rect "); got != 3 {
+		t.Errorf("SVG() has %d boxes, want 3", got)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	d := Graph(map[string][]string{"b": {"c"}, "a": {"b", "c"}})
+	if got := d.String(); got != "diagram of 3 boxes and 3 arrows\n  a -> b\n  a -> c\n  b -> c" {
+		t.Errorf("Graph() = %q", got)
+	}
+}
@@ -0,0 +1,39 @@
+// Package display builds rich representations of values for gophernotes notebooks. A Data value
+// returned as the result of a cell is shown in the richest format the front-end supports.
+package display
+
+// MIME types understood by the Jupyter front-ends.
+const (
+	MIMETypeHTML     = "text/html"
+	MIMETypeJPEG     = "image/jpeg"
+	MIMETypeJSON     = "application/json"
+	MIMETypeMarkdown = "text/markdown"
+	MIMETypePNG      = "image/png"
+	MIMETypeSVG      = "image/svg+xml"
+	MIMETypeText     = "text/plain"
+)
+
+// MIMETypeArrow is the MIME type of tables in the Apache Arrow IPC file format, also known as Feather v2, which
+// the package github.com/gopherdata/gophernotes/display/arrow encodes.
+const MIMETypeArrow = "application/vnd.apache.arrow.file"
+
+// Data holds the representations of a value keyed by MIME type. Every Data should contain at least
+// a MIMETypeText representation so that text-only front-ends can show it.
+type Data map[string]interface{}
+
+// Text returns the plain text representation of the data.
+func (d Data) Text() string {
+	s, _ := d[MIMETypeText].(string)
+	return s
+}
+
+// Unsampled wraps a value to show as text in full, see All.
+type Unsampled struct {
+	Value interface{}
+}
+
+// All returns v wrapped to be shown in full as the result of a cell, when it is a large slice, array or map which
+// is otherwise shown with its first and last elements only.
+func All(v interface{}) Unsampled {
+	return Unsampled{v}
+}
@@ -0,0 +1,3 @@
+module github.com/gopherdata/gophernotes/display
+
+go 1.11
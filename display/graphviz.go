@@ -0,0 +1,74 @@
+package display
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// MIMETypeMermaid is the MIME type of Mermaid diagrams, which JupyterLab renders since version 4.1.
+const MIMETypeMermaid = "text/vnd.mermaid"
+
+// dotCommand is the Graphviz command laying out the graphs of Graphviz.
+var dotCommand = "dot"
+
+// dotTimeout bounds the time Graphviz spends laying out a graph.
+const dotTimeout = 10 * time.Second
+
+// Graphviz returns the graph described in the Graphviz DOT language by dot, rendered as an SVG image by the dot
+// command of Graphviz, which must be installed. The text representation holds the source of the graph, and
+// the reason it could not be rendered, if any.
+func Graphviz(dot string) Data {
+	svg, err := renderDot(dot)
+	if err != nil {
+		return Data{MIMETypeText: fmt.Sprintf("%s\n(not rendered: %v)", strings.TrimRight(dot, "\n"), err)}
+	}
+	return Data{
+		MIMETypeSVG:  svg,
+		MIMETypeText: dot,
+	}
+}
+
+// renderDot lays out the graph described by dot as an SVG image.
+func renderDot(dot string) (string, error) {
+	path, err := exec.LookPath(dotCommand)
+	if err != nil {
+		return "", fmt.Errorf("the %s command of Graphviz is not installed, see https://graphviz.org/download/", dotCommand)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dotTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "-Tsvg")
+	cmd.Stdin = strings.NewReader(dot)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", dotCommand, msg)
+		}
+		return "", fmt.Errorf("%s: %v", dotCommand, err)
+	}
+
+	// Drop the XML declaration and doctype preceding the svg element, which HTML front-ends do not expect.
+	svg := stdout.String()
+	if i := strings.Index(svg, "<svg"); i > 0 {
+		svg = svg[i:]
+	}
+	return svg, nil
+}
+
+// Mermaid returns the Mermaid diagram src. JupyterLab renders it from its MIME type, and the front-ends
+// rendering Markdown with Mermaid, like GitHub, from a mermaid code block.
+func Mermaid(src string) Data {
+	if !strings.HasSuffix(src, "\n") {
+		src += "\n"
+	}
+	return Data{
+		MIMETypeMermaid:  src,
+		MIMETypeMarkdown: "```mermaid\n" + src + "```\n",
+		MIMETypeText:     src,
+	}
+}
@@ -0,0 +1,48 @@
+package display
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGraphviz(t *testing.T) {
+	defer func(cmd string) { dotCommand = cmd }(dotCommand)
+
+	dotCommand = "gophernotes-no-such-dot"
+	data := Graphviz("digraph { a -> b }")
+	if _, ok := data[MIMETypeSVG]; ok || !strings.Contains(data.Text(), "digraph { a -> b }\n(not rendered: the gophernotes-no-such-dot command of Graphviz is not installed") {
+		t.Errorf("Graphviz() without Graphviz = %v", data)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir, err := ioutil.TempDir("", "graphviz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dotCommand = filepath.Join(dir, "dot")
+	script := "#!/bin/sh\ncat >/dev/null\necho '<?xml version=\"1.0\"?>'\necho '<svg><g/></svg>'\n"
+	if err := ioutil.WriteFile(dotCommand, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data = Graphviz("digraph { a -> b }")
+	if got := data[MIMETypeSVG]; got != "<svg><g/></svg>\n" {
+		t.Errorf("Graphviz() SVG = %q, want the svg element alone", got)
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	data := Mermaid("graph TD\n  a --> b")
+	if got, want := data[MIMETypeMarkdown], "```mermaid\ngraph TD\n  a --> b\n```\n"; got != want {
+		t.Errorf("Mermaid() Markdown = %q, want %q", got, want)
+	}
+	if got := data[MIMETypeMermaid]; got != "graph TD\n  a --> b\n" {
+		t.Errorf("Mermaid() = %q", got)
+	}
+}
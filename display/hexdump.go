@@ -0,0 +1,25 @@
+package display
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// maxHexDumpBytes is the number of bytes HexDump shows of longer slices.
+const maxHexDumpBytes = 1024
+
+// HexDump returns b as a hex dump with an ASCII gutter, like `hexdump -C`, ending with its length. Only the first
+// 1024 bytes of longer slices are shown, unless all is set.
+func HexDump(b []byte, all bool) Data {
+	shown := b
+	if !all && len(b) > maxHexDumpBytes {
+		shown = b[:maxHexDumpBytes]
+	}
+	text := hex.Dump(shown)
+	if len(shown) < len(b) {
+		text += fmt.Sprintf("... (%d bytes, the first %d shown, display.All shows them all)", len(b), len(shown))
+	} else {
+		text += fmt.Sprintf("(%d bytes)", len(b))
+	}
+	return Data{MIMETypeText: text}
+}
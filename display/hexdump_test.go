@@ -0,0 +1,52 @@
+package display
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHexDump(t *testing.T) {
+	got := HexDump([]byte("Hello, world\n"), false).Text()
+	want := "00000000  48 65 6c 6c 6f 2c 20 77  6f 72 6c 64 0a           |Hello, world.|\n(13 bytes)"
+	if got != want {
+		t.Errorf("HexDump() = %q, want %q", got, want)
+	}
+
+	long := bytes.Repeat([]byte{0}, 2000)
+	got = HexDump(long, false).Text()
+	if lines := strings.Count(got, "\n"); lines != maxHexDumpBytes/16 || !strings.HasSuffix(got, "... (2000 bytes, the first 1024 shown, display.All shows them all)") {
+		t.Errorf("HexDump() of 2000 bytes has %d lines, ending with %q", lines, got[len(got)-80:])
+	}
+	if data, ok := Render(All(long)); !ok || strings.Count(data.Text(), "\n") != 125 {
+		t.Errorf("Render(All()) of 2000 bytes = %v, want all of them", ok)
+	}
+	if data, ok := Render([]byte{}); !ok || data.Text() != "(0 bytes)" {
+		t.Errorf("Render() of no bytes = %q", data.Text())
+	}
+}
+
+func TestSniffImage(t *testing.T) {
+	cases := []struct {
+		data, want string
+	}{
+		{"\x89PNG\r\n\x1a\n....", MIMETypePNG},
+		{"\xff\xd8\xff\xe0", MIMETypeJPEG},
+		{"GIF89a...", MIMETypeGIF},
+		{"RIFF\x10\x00\x00\x00WEBPVP8 ", MIMETypeWebP},
+		{"RIFF\x10\x00\x00\x00WAVEfmt ", ""},
+		{"\x89PN", ""},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := SniffImage([]byte(c.data)); got != c.want {
+			t.Errorf("SniffImage(%q) = %q, want %q", c.data, got, c.want)
+		}
+	}
+
+	gif := []byte("GIF89a\x01\x00\x01\x00")
+	data, _ := Render(gif)
+	if data[MIMETypeGIF] == nil || !strings.HasPrefix(data.Text(), "00000000  47 49 46") {
+		t.Errorf("Render() of a GIF image = %v, want the image along with its hex dump", data)
+	}
+}
@@ -0,0 +1,54 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+)
+
+// Image formats the front-ends display, besides PNG and JPEG.
+const (
+	MIMETypeGIF  = "image/gif"
+	MIMETypeWebP = "image/webp"
+)
+
+// imageSignatures are the bytes starting the images of each format but WebP.
+var imageSignatures = []struct {
+	magic string
+	mime  string
+}{
+	{"\x89PNG\r\n\x1a\n", MIMETypePNG},
+	{"\xff\xd8\xff", MIMETypeJPEG},
+	{"GIF87a", MIMETypeGIF},
+	{"GIF89a", MIMETypeGIF},
+}
+
+// Image returns img encoded as PNG, along with a text summary of its size.
+func Image(img image.Image) Data {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Data{MIMETypeText: fmt.Sprintf("image: %v", err)}
+	}
+
+	size := img.Bounds().Size()
+	return Data{
+		MIMETypePNG:  buf.Bytes(),
+		MIMETypeText: fmt.Sprintf("%dx%d image", size.X, size.Y),
+	}
+}
+
+// SniffImage returns the MIME type of the image encoded in b, detected from its first bytes: a PNG, JPEG, GIF or
+// WebP image. It returns "" for other data.
+func SniffImage(b []byte) string {
+	for _, sig := range imageSignatures {
+		if bytes.HasPrefix(b, []byte(sig.magic)) {
+			return sig.mime
+		}
+	}
+	// WebP images are RIFF files, whose format follows their size.
+	if len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WEBP" {
+		return MIMETypeWebP
+	}
+	return ""
+}
@@ -0,0 +1,25 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSON returns the representation of v, a value encodable as JSON, as a tree that front-ends like JupyterLab
+// let users expand and collapse. Text-only front-ends show the indented JSON.
+func JSON(v interface{}) Data {
+	text, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return Data{MIMETypeText: fmt.Sprint(v)}
+	}
+
+	// Front-ends expect the JSON value itself, not its encoding. Round trip it to turn structs into objects.
+	var value interface{}
+	if err := json.Unmarshal(text, &value); err != nil {
+		return Data{MIMETypeText: string(text)}
+	}
+	return Data{
+		MIMETypeText: string(text),
+		MIMETypeJSON: value,
+	}
+}
@@ -0,0 +1,175 @@
+package display
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// MIMETypeLaTeX is the MIME type of LaTeX formulas, which the front-ends render with MathJax or KaTeX.
+const MIMETypeLaTeX = "text/latex"
+
+// Matrix is a matrix of float64 values, like the matrices of gonum.org/v1/gonum/mat, which a cell whose result
+// implements it shows as a LaTeX formula.
+type Matrix interface {
+	Dims() (r, c int)
+	At(i, j int) float64
+}
+
+// Math returns the LaTeX formula latex, typeset on its own line by the front-ends and shown as its source by
+// text-only ones.
+func Math(latex string) Data {
+	return Data{
+		MIMETypeLaTeX: "$$" + latex + "$$",
+		MIMETypeText:  latex,
+	}
+}
+
+// Rows returns the matrix whose rows are rows, which must all have the same length.
+func Rows(rows [][]float64) Matrix {
+	return rowsMatrix(rows)
+}
+
+type rowsMatrix [][]float64
+
+func (m rowsMatrix) Dims() (r, c int) {
+	if len(m) == 0 {
+		return 0, 0
+	}
+	return len(m), len(m[0])
+}
+
+func (m rowsMatrix) At(i, j int) float64 {
+	return m[i][j]
+}
+
+// MathMatrix returns m as a LaTeX matrix between brackets, along with its values aligned in columns.
+func MathMatrix(m Matrix) Data {
+	r, c := m.Dims()
+	cells, latexCells := make([][]string, r), make([][]string, r)
+	widths := make([]int, c)
+	for i := range cells {
+		cells[i], latexCells[i] = make([]string, c), make([]string, c)
+		for j := range cells[i] {
+			cells[i][j], latexCells[i][j] = formatNumber(m.At(i, j)), latexNumber(m.At(i, j))
+			if len(cells[i][j]) > widths[j] {
+				widths[j] = len(cells[i][j])
+			}
+		}
+	}
+
+	var latex, text strings.Builder
+	latex.WriteString(`\begin{bmatrix}`)
+	for i, row := range cells {
+		if i > 0 {
+			latex.WriteString(`\\`)
+			text.WriteByte('\n')
+		}
+		latex.WriteString(strings.Join(latexCells[i], " & "))
+
+		left, right := "⎢", "⎥"
+		switch {
+		case r == 1:
+			left, right = "[", "]"
+		case i == 0:
+			left, right = "⎡", "⎤"
+		case i == r-1:
+			left, right = "⎣", "⎦"
+		}
+		text.WriteString(left)
+		for j, cell := range row {
+			fmt.Fprintf(&text, " %*s", widths[j], cell)
+		}
+		text.WriteString(" " + right)
+	}
+	latex.WriteString(`\end{bmatrix}`)
+
+	return Data{
+		MIMETypeLaTeX: "$$" + latex.String() + "$$",
+		MIMETypeText:  text.String(),
+	}
+}
+
+// Polynomial returns the polynomial whose coefficient of variable to the power i is coeffs[i], written from
+// the highest power down as a LaTeX formula and as text.
+func Polynomial(coeffs []float64, variable string) Data {
+	var latex, text strings.Builder
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		c := coeffs[i]
+		if c == 0 {
+			continue
+		}
+
+		sign := "+"
+		if c < 0 {
+			sign, c = "-", -c
+		}
+		switch {
+		case latex.Len() > 0:
+			latex.WriteString(" " + sign + " ")
+			text.WriteString(" " + sign + " ")
+		case sign == "-":
+			latex.WriteString("-")
+			text.WriteString("-")
+		}
+
+		if c != 1 || i == 0 {
+			latex.WriteString(latexNumber(c))
+			text.WriteString(formatNumber(c))
+		}
+		switch i {
+		case 0:
+		case 1:
+			latex.WriteString(variable)
+			text.WriteString(variable)
+		default:
+			fmt.Fprintf(&latex, "%s^{%d}", variable, i)
+			fmt.Fprintf(&text, "%s^%d", variable, i)
+		}
+	}
+	if latex.Len() == 0 {
+		return Math("0")
+	}
+	return Data{
+		MIMETypeLaTeX: "$$" + latex.String() + "$$",
+		MIMETypeText:  text.String(),
+	}
+}
+
+// Fraction returns the fraction x as a LaTeX formula, and as text.
+func Fraction(x *big.Rat) Data {
+	if x.IsInt() {
+		return Data{
+			MIMETypeLaTeX: "$$" + x.Num().String() + "$$",
+			MIMETypeText:  x.Num().String(),
+		}
+	}
+	num, sign := new(big.Int).Abs(x.Num()), ""
+	if x.Sign() < 0 {
+		sign = "-"
+	}
+	return Data{
+		MIMETypeLaTeX: fmt.Sprintf(`$$%s\frac{%s}{%s}$$`, sign, num, x.Denom()),
+		MIMETypeText:  x.RatString(),
+	}
+}
+
+// formatNumber formats a value of a formula: integers without decimals, other values with 6 significant digits.
+func formatNumber(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.6g", v)
+}
+
+// latexNumber formats a value of a LaTeX formula.
+func latexNumber(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return `\infty`
+	case math.IsInf(v, -1):
+		return `-\infty`
+	}
+	return formatNumber(v)
+}
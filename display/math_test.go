@@ -0,0 +1,53 @@
+package display
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMathMatrix(t *testing.T) {
+	data := MathMatrix(Rows([][]float64{{1, 0.5}, {-10, 2}}))
+	if got, want := data[MIMETypeLaTeX], `$$\begin{bmatrix}1 & 0.5\\-10 & 2\end{bmatrix}$$`; got != want {
+		t.Errorf("MathMatrix() LaTeX = %q, want %q", got, want)
+	}
+	if got, want := data.Text(), "⎡   1 0.5 ⎤\n⎣ -10   2 ⎦"; got != want {
+		t.Errorf("MathMatrix() text = %q, want %q", got, want)
+	}
+	if got, want := MathMatrix(Rows([][]float64{{1, 2}})).Text(), "[ 1 2 ]"; got != want {
+		t.Errorf("MathMatrix() of a row = %q, want %q", got, want)
+	}
+}
+
+func TestPolynomial(t *testing.T) {
+	cases := []struct {
+		coeffs      []float64
+		latex, text string
+	}{
+		{[]float64{-1, 0, 3}, "$$3x^{2} - 1$$", "3x^2 - 1"},
+		{[]float64{0, 1, -1}, "$$-x^{2} + x$$", "-x^2 + x"},
+		{[]float64{2.5, -1}, "$$-x + 2.5$$", "-x + 2.5"},
+		{[]float64{0, 0}, "$$0$$", "0"},
+	}
+	for _, c := range cases {
+		data := Polynomial(c.coeffs, "x")
+		if data[MIMETypeLaTeX] != c.latex || data.Text() != c.text {
+			t.Errorf("Polynomial(%v) = %q, %q, want %q, %q", c.coeffs, data[MIMETypeLaTeX], data.Text(), c.latex, c.text)
+		}
+	}
+}
+
+func TestFraction(t *testing.T) {
+	cases := []struct {
+		x           *big.Rat
+		latex, text string
+	}{
+		{big.NewRat(-3, 4), `$$-\frac{3}{4}$$`, "-3/4"},
+		{big.NewRat(6, 3), "$$2$$", "2"},
+	}
+	for _, c := range cases {
+		data := Fraction(c.x)
+		if data[MIMETypeLaTeX] != c.latex || data.Text() != c.text {
+			t.Errorf("Fraction(%v) = %q, %q, want %q, %q", c.x, data[MIMETypeLaTeX], data.Text(), c.latex, c.text)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// plotWidth and plotHeight are the size in pixels of the SVG image of a plot.
+	plotWidth  = 600
+	plotHeight = 300
+
+	// plotMargin is the space left around the plotted area of the SVG image for the axis labels.
+	plotMargin = 40
+
+	// textPlotWidth and textPlotHeight are the size in characters of the text fallback of a plot.
+	textPlotWidth  = 60
+	textPlotHeight = 12
+)
+
+// sparkBars are the characters used by Sparkline, from the lowest to the highest value.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// LinePlot plots the values ys against their index. The result holds an SVG image for rich front-ends and
+// a braille-character plot for consoles and text exports.
+func LinePlot(ys []float64) Data {
+	return Data{
+		MIMETypeSVG:  svgLinePlot(ys),
+		MIMETypeText: TextPlot(ys, textPlotWidth, textPlotHeight),
+	}
+}
+
+// Sparkline returns a one line summary of ys drawn with block characters.
+func Sparkline(ys []float64) string {
+	min, max := bounds(ys)
+
+	var buf strings.Builder
+	for _, y := range ys {
+		if math.IsNaN(y) {
+			buf.WriteRune(' ')
+			continue
+		}
+		i := int(scale(y, min, max) * float64(len(sparkBars)-1))
+		buf.WriteRune(sparkBars[i])
+	}
+	return buf.String()
+}
+
+// TextPlot plots ys against their index with braille characters in an area of width x height characters.
+// Each character holds 2x4 dots, and consecutive points are joined with lines.
+func TextPlot(ys []float64, width, height int) string {
+	if len(ys) == 0 || width <= 0 || height <= 0 {
+		return ""
+	}
+
+	min, max := bounds(ys)
+	cols, rows := 2*width, 4*height
+
+	// dots[row][col] is set when the dot at that position is drawn.
+	dots := make([][]bool, rows)
+	for row := range dots {
+		dots[row] = make([]bool, cols)
+	}
+
+	prevCol, prevRow := -1, -1
+	for i, y := range ys {
+		if math.IsNaN(y) {
+			prevCol = -1
+			continue
+		}
+
+		col := 0
+		if len(ys) > 1 {
+			col = i * (cols - 1) / (len(ys) - 1)
+		}
+		row := rows - 1 - int(math.Round(scale(y, min, max)*float64(rows-1)))
+
+		if prevCol < 0 {
+			dots[row][col] = true
+		} else {
+			drawLine(dots, prevCol, prevRow, col, row)
+		}
+		prevCol, prevRow = col, row
+	}
+
+	maxLabel, minLabel := formatTick(max), formatTick(min)
+	labelWidth := len(maxLabel)
+	if len(minLabel) > labelWidth {
+		labelWidth = len(minLabel)
+	}
+
+	var buf strings.Builder
+	for line := 0; line < height; line++ {
+		label := ""
+		switch line {
+		case 0:
+			label = maxLabel
+		case height - 1:
+			label = minLabel
+		}
+		fmt.Fprintf(&buf, "%*s ┤", labelWidth, label)
+
+		for char := 0; char < width; char++ {
+			var bits rune
+			for dy := 0; dy < 4; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					if dots[4*line+dy][2*char+dx] {
+						bits |= brailleBit(dx, dy)
+					}
+				}
+			}
+			buf.WriteRune(0x2800 + bits)
+		}
+
+		if line < height-1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.String()
+}
+
+// brailleBit returns the bit of a braille character representing the dot in column dx and row dy of its 2x4 grid.
+func brailleBit(dx, dy int) rune {
+	if dy == 3 {
+		return 0x40 << uint(dx)
+	}
+	return 1 << uint(dy+3*dx)
+}
+
+// drawLine sets the dots on the line between (col0, row0) and (col1, row1).
+func drawLine(dots [][]bool, col0, row0, col1, row1 int) {
+	dCol, dRow := abs(col1-col0), -abs(row1-row0)
+	stepCol, stepRow := 1, 1
+	if col0 > col1 {
+		stepCol = -1
+	}
+	if row0 > row1 {
+		stepRow = -1
+	}
+
+	err := dCol + dRow
+	for {
+		dots[row0][col0] = true
+		if col0 == col1 && row0 == row1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dRow {
+			err += dRow
+			col0 += stepCol
+		}
+		if e2 <= dCol {
+			err += dCol
+			row0 += stepRow
+		}
+	}
+}
+
+// svgLinePlot draws ys against their index as an SVG image.
+func svgLinePlot(ys []float64) string {
+	min, max := bounds(ys)
+	innerWidth, innerHeight := float64(plotWidth-2*plotMargin), float64(plotHeight-2*plotMargin)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		plotWidth, plotHeight, plotWidth, plotHeight)
+	fmt.Fprintf(&buf, `<g stroke="#888" stroke-width="1"><line x1="%d" y1="%d" x2="%d" y2="%d"/><line x1="%d" y1="%d" x2="%d" y2="%d"/></g>`,
+		plotMargin, plotMargin, plotMargin, plotHeight-plotMargin,
+		plotMargin, plotHeight-plotMargin, plotWidth-plotMargin, plotHeight-plotMargin)
+	fmt.Fprintf(&buf, `<g font-family="sans-serif" font-size="11" fill="#444" text-anchor="end"><text x="%d" y="%d">%s</text><text x="%d" y="%d">%s</text></g>`,
+		plotMargin-4, plotMargin+4, formatTick(max), plotMargin-4, plotHeight-plotMargin, formatTick(min))
+
+	buf.WriteString(`<polyline fill="none" stroke="#1f77b4" stroke-width="2" points="`)
+	for i, y := range ys {
+		if math.IsNaN(y) {
+			continue
+		}
+		x := 0.0
+		if len(ys) > 1 {
+			x = float64(i) / float64(len(ys)-1)
+		}
+		fmt.Fprintf(&buf, "%.1f,%.1f ", plotMargin+x*innerWidth, plotMargin+(1-scale(y, min, max))*innerHeight)
+	}
+	buf.WriteString(`"/></svg>`)
+
+	return buf.String()
+}
+
+// bounds returns the smallest and largest values of ys, ignoring NaNs.
+func bounds(ys []float64) (min, max float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, y := range ys {
+		if math.IsNaN(y) {
+			continue
+		}
+		min = math.Min(min, y)
+		max = math.Max(max, y)
+	}
+	if min > max {
+		return 0, 0
+	}
+	return min, max
+}
+
+// scale maps y from [min, max] to [0, 1]. All values map to 0.5 when min == max.
+func scale(y, min, max float64) float64 {
+	if max == min {
+		return 0.5
+	}
+	return (y - min) / (max - min)
+}
+
+// formatTick formats an axis label.
+func formatTick(v float64) string {
+	return fmt.Sprintf("%.4g", v)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
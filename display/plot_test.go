@@ -0,0 +1,40 @@
+package display
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	if got, want := Sparkline([]float64{0, 1, 2, 3, 4, 5, 6, 7}), "▁▂▃▄▅▆▇█"; got != want {
+		t.Errorf("Sparkline() = %q, want %q", got, want)
+	}
+	if got, want := Sparkline([]float64{3, 3}), "▄▄"; got != want {
+		t.Errorf("Sparkline() of a constant = %q, want %q", got, want)
+	}
+}
+
+func TestTextPlot(t *testing.T) {
+	plot := TextPlot([]float64{0, 1, 2, 3}, 2, 1)
+	if got, want := plot, "3 ┤⡠⠊"; got != want {
+		t.Errorf("TextPlot() = %q, want %q", got, want)
+	}
+
+	lines := strings.Split(TextPlot([]float64{-1, 5, 2}, 10, 4), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("TextPlot() has %d lines, want 4", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], " 5 ┤") || !strings.HasPrefix(lines[3], "-1 ┤") {
+		t.Errorf("TextPlot() axis labels are wrong:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestLinePlot(t *testing.T) {
+	data := LinePlot([]float64{1, 2})
+	if !strings.HasPrefix(data[MIMETypeSVG].(string), "<svg") {
+		t.Errorf("LinePlot() has no SVG representation")
+	}
+	if data.Text() == "" {
+		t.Errorf("LinePlot() has no text representation")
+	}
+}
@@ -0,0 +1,141 @@
+package display
+
+import (
+	"image"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Renderer returns the representations of v, or false to leave v to the next renderer.
+type Renderer func(v interface{}) (data Data, ok bool)
+
+// renderEntry is a renderer registered for a type, an interface or a kind.
+type renderEntry struct {
+	typ      reflect.Type
+	priority int
+	order    int
+	render   Renderer
+}
+
+// renderRegistry holds the renderers of the values displayed as the result of cells.
+type renderRegistry struct {
+	mu     sync.Mutex
+	types  map[reflect.Type][]renderEntry
+	ifaces []renderEntry
+	kinds  map[reflect.Kind][]renderEntry
+	order  int
+}
+
+// renderers is the registry of Register, RegisterKind and Render.
+var renderers = &renderRegistry{
+	types: make(map[reflect.Type][]renderEntry),
+	kinds: make(map[reflect.Kind][]renderEntry),
+}
+
+func init() {
+	Register(reflect.TypeOf(Data(nil)), 0, func(v interface{}) (Data, bool) {
+		return v.(Data), true
+	})
+	Register(reflect.TypeOf((*image.Image)(nil)).Elem(), 0, func(v interface{}) (Data, bool) {
+		return Image(v.(image.Image)), true
+	})
+	Register(reflect.TypeOf((*Matrix)(nil)).Elem(), 0, func(v interface{}) (Data, bool) {
+		return MathMatrix(v.(Matrix)), true
+	})
+	Register(reflect.TypeOf((*big.Rat)(nil)), 0, func(v interface{}) (Data, bool) {
+		x := v.(*big.Rat)
+		if x == nil {
+			return nil, false
+		}
+		return Fraction(x), true
+	})
+	Register(reflect.TypeOf([]byte(nil)), 0, func(v interface{}) (Data, bool) {
+		return renderBytes(v.([]byte), false), true
+	})
+	Register(reflect.TypeOf(Unsampled{}), 0, func(v interface{}) (Data, bool) {
+		if b, ok := v.(Unsampled).Value.([]byte); ok {
+			return renderBytes(b, true), true
+		}
+		return Render(v.(Unsampled).Value)
+	})
+}
+
+// renderBytes returns the hex dump of b, along with the image it holds if it starts like a PNG, JPEG, GIF or WebP
+// image.
+func renderBytes(b []byte, all bool) Data {
+	data := HexDump(b, all)
+	if mime := SniffImage(b); mime != "" {
+		data[mime] = b
+	}
+	return data
+}
+
+// Register registers fn to render the values of the type t, or the values implementing t if it is an interface,
+// when they are the result of a cell. The renderers of the type of a value are tried first, then those of the
+// interfaces it implements, then those of its kind, each by decreasing priority, the last registered first for
+// equal priorities. The built-in renderers, which display images, matrices, fractions and byte slices, have
+// priority 0, so registering a renderer with the same or a higher priority overrides them.
+func Register(t reflect.Type, priority int, fn Renderer) {
+	renderers.mu.Lock()
+	defer renderers.mu.Unlock()
+	entry := renderers.entry(t, priority, fn)
+	if t.Kind() == reflect.Interface {
+		renderers.ifaces = insertEntry(renderers.ifaces, entry)
+	} else {
+		renderers.types[t] = insertEntry(renderers.types[t], entry)
+	}
+}
+
+// RegisterKind registers fn to render the values of kind k, like reflect.Map, when they are the result of a cell
+// and no renderer of their type or of the interfaces they implement does.
+func RegisterKind(k reflect.Kind, priority int, fn Renderer) {
+	renderers.mu.Lock()
+	defer renderers.mu.Unlock()
+	renderers.kinds[k] = insertEntry(renderers.kinds[k], renderers.entry(nil, priority, fn))
+}
+
+// entry returns a new entry of the registry, ordered after the previous ones.
+func (reg *renderRegistry) entry(t reflect.Type, priority int, fn Renderer) renderEntry {
+	reg.order++
+	return renderEntry{t, priority, reg.order, fn}
+}
+
+// insertEntry inserts e in entries, sorted by decreasing priority then decreasing order.
+func insertEntry(entries []renderEntry, e renderEntry) []renderEntry {
+	entries = append(entries, e)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].priority != entries[j].priority {
+			return entries[i].priority > entries[j].priority
+		}
+		return entries[i].order > entries[j].order
+	})
+	return entries
+}
+
+// Render returns the representations of v given by the first registered renderer accepting it, or false if none
+// does, in which case v is shown as text.
+func Render(v interface{}) (Data, bool) {
+	if v == nil {
+		return nil, false
+	}
+	t := reflect.TypeOf(v)
+
+	renderers.mu.Lock()
+	chain := append([]renderEntry(nil), renderers.types[t]...)
+	for _, e := range renderers.ifaces {
+		if t.Implements(e.typ) {
+			chain = append(chain, e)
+		}
+	}
+	chain = append(chain, renderers.kinds[t.Kind()]...)
+	renderers.mu.Unlock()
+
+	for _, e := range chain {
+		if data, ok := e.render(v); ok {
+			return data, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,71 @@
+package display
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type testMatrix struct{ declined bool }
+
+func (testMatrix) Dims() (r, c int)    { return 1, 1 }
+func (testMatrix) At(i, j int) float64 { return 7 }
+
+type testRow struct{ N int }
+
+func TestRender(t *testing.T) {
+	text := func(v interface{}) string {
+		data, ok := Render(v)
+		if !ok {
+			return "<none>"
+		}
+		return data.Text()
+	}
+
+	if got := text(testMatrix{}); got != "[ 7 ]" {
+		t.Errorf("Render() of a Matrix = %q, want the built-in renderer", got)
+	}
+	if got := text(big.NewRat(1, 2)); got != "1/2" {
+		t.Errorf("Render() of a *big.Rat = %q", got)
+	}
+	if got := text([]testRow{{1}}); got != "<none>" {
+		t.Errorf("Render() of a slice of structs = %q, want no renderer without the arrow package", got)
+	}
+	if got := text([]int{1}); got != "<none>" {
+		t.Errorf("Render() of a slice of ints = %q, want no renderer", got)
+	}
+	if got := text(nil); got != "<none>" {
+		t.Errorf("Render(nil) = %q", got)
+	}
+
+	typ := reflect.TypeOf(testMatrix{})
+	Register(typ, 0, func(v interface{}) (Data, bool) {
+		if v.(testMatrix).declined {
+			return nil, false
+		}
+		return Data{MIMETypeText: "exact"}, true
+	})
+	Register(typ, -1, func(v interface{}) (Data, bool) {
+		return Data{MIMETypeText: "lower priority"}, true
+	})
+	if got := text(testMatrix{}); got != "exact" {
+		t.Errorf("Render() = %q, want the renderer of the exact type", got)
+	}
+	if got := text(testMatrix{declined: true}); got != "lower priority" {
+		t.Errorf("Render() = %q, want the next renderer when the first declines", got)
+	}
+
+	Register(typ, 0, func(v interface{}) (Data, bool) {
+		return Data{MIMETypeText: "override"}, true
+	})
+	if got := text(testMatrix{}); got != "override" {
+		t.Errorf("Render() = %q, want the last renderer registered with the same priority", got)
+	}
+
+	RegisterKind(reflect.Func, 0, func(v interface{}) (Data, bool) {
+		return Data{MIMETypeText: "func"}, true
+	})
+	if got := text(func() {}); got != "func" {
+		t.Errorf("Render() of a func = %q, want the renderer of its kind", got)
+	}
+}
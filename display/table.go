@@ -0,0 +1,40 @@
+package display
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"text/tabwriter"
+)
+
+// Table returns a table with the given column headers and rows as an HTML table, and as aligned columns of
+// text for consoles and text exports.
+func Table(columns []string, rows [][]string) Data {
+	var text, htm bytes.Buffer
+	w := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+
+	htm.WriteString("<table><thead><tr>")
+	for _, column := range columns {
+		fmt.Fprintf(&htm, "<th>%s</th>", html.EscapeString(column))
+	}
+	htm.WriteString("</tr></thead><tbody>")
+
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+
+		htm.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(&htm, "<td>%s</td>", html.EscapeString(cell))
+		}
+		htm.WriteString("</tr>")
+	}
+	w.Flush()
+	htm.WriteString("</tbody></table>")
+
+	return Data{
+		MIMETypeText: text.String(),
+		MIMETypeHTML: htm.String(),
+	}
+}
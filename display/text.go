@@ -0,0 +1,27 @@
+package display
+
+import "fmt"
+
+// HTML returns the HTML fragment s. Text-only front-ends show its source.
+func HTML(s string) Data {
+	return Data{
+		MIMETypeHTML: s,
+		MIMETypeText: s,
+	}
+}
+
+// Markdown returns the Markdown text s, rendered by the front-ends supporting it.
+func Markdown(s string) Data {
+	return Data{
+		MIMETypeMarkdown: s,
+		MIMETypeText:     s,
+	}
+}
+
+// SVG returns the SVG image svg, along with a text summary of its size.
+func SVG(svg string) Data {
+	return Data{
+		MIMETypeSVG:  svg,
+		MIMETypeText: fmt.Sprintf("SVG image (%d bytes)", len(svg)),
+	}
+}
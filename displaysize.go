@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// maxDisplaySize is set by `%opt max_display_size size`: the size of the data of an output beyond which its
+// images are downscaled, then its largest representations dropped, so that it does not exceed the size of the
+// messages the front-ends and the notebook files handle. 0 removes the limit.
+var maxDisplaySize = 8 << 20
+
+// minImageSide is the side below which images are not downscaled further to fit maxDisplaySize.
+const minImageSide = 16
+
+func init() {
+	kernelOptions["max_display_size"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a size such as 8MiB, got %q", strings.Join(args, " "))
+			}
+			size, err := parseByteSize(args[0])
+			if err != nil {
+				return err
+			}
+			maxDisplaySize = size
+			return nil
+		},
+		value: func() string { return formatBytes(uintptr(maxDisplaySize)) },
+	}
+}
+
+// parseByteSize parses a number of bytes, with an optional unit: B, KB, MB, GB or KiB, MiB, GiB.
+func parseByteSize(s string) (int, error) {
+	units := []struct {
+		suffix string
+		size   int
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+		{"B", 1},
+	}
+	number, unit := strings.TrimSpace(s), 1
+	for _, u := range units {
+		if strings.HasSuffix(number, u.suffix) {
+			number, unit = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a size such as 8MiB, got %q", s)
+	}
+	return int(n * float64(unit)), nil
+}
+
+// displaySize returns the size of data once encoded in a message: the bytes of images are encoded in base64.
+func displaySize(data bundledMIMEData) int {
+	size := 0
+	for _, v := range data {
+		size += representationSize(v)
+	}
+	return size
+}
+
+// representationSize returns the size of a representation of some data once encoded in a message.
+func representationSize(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return base64.StdEncoding.EncodedLen(len(v))
+	}
+	b, _ := json.Marshal(v)
+	return len(b)
+}
+
+// fitDisplayData returns data if it does not exceed limit, or a copy of data fitting limit: its PNG and JPEG
+// images are downscaled, then its largest representations but the text dropped, and the text truncated, each
+// change being reported at the end of the text.
+func fitDisplayData(data bundledMIMEData, limit int) bundledMIMEData {
+	if limit <= 0 || displaySize(data) <= limit {
+		return data
+	}
+
+	fitted := make(bundledMIMEData, len(data))
+	for mime, v := range data {
+		fitted[mime] = v
+	}
+	var notes []string
+
+	for _, mime := range representationsBySize(fitted) {
+		if displaySize(fitted) <= limit {
+			break
+		}
+		b, ok := fitted[mime].([]byte)
+		if !ok || (mime != display.MIMETypePNG && mime != display.MIMETypeJPEG) {
+			continue
+		}
+		target := base64.StdEncoding.DecodedLen(representationSize(b) - (displaySize(fitted) - limit))
+		if small, from, to, ok := downscaleImage(b, mime, target); ok {
+			fitted[mime] = small
+			notes = append(notes, fmt.Sprintf("the %s image was downscaled from %dx%d to %dx%d", mime, from.X, from.Y, to.X, to.Y))
+		}
+	}
+
+	for _, mime := range representationsBySize(fitted) {
+		if displaySize(fitted) <= limit {
+			break
+		}
+		if mime == display.MIMETypeText {
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("the %s representation (%s) was dropped", mime, formatBytes(uintptr(representationSize(fitted[mime])))))
+		delete(fitted, mime)
+	}
+
+	note := func() string {
+		return fmt.Sprintf("\n(%s to fit %%opt max_display_size %s)", strings.Join(notes, ", "), formatBytes(uintptr(limit)))
+	}
+	text, _ := fitted[display.MIMETypeText].(string)
+	if displaySize(fitted)+len(note()) > limit {
+		notes = append(notes, "the text was truncated")
+		excess := displaySize(fitted) + len(note()) - limit
+		if excess > len(text) {
+			excess = len(text)
+		}
+		for excess < len(text) && !utf8.RuneStart(text[len(text)-excess]) {
+			excess++
+		}
+		text = text[:len(text)-excess]
+	}
+	fitted[display.MIMETypeText] = text + note()
+	return fitted
+}
+
+// representationsBySize returns the MIME types of data, largest representation first.
+func representationsBySize(data bundledMIMEData) []string {
+	mimes := make([]string, 0, len(data))
+	for mime := range data {
+		mimes = append(mimes, mime)
+	}
+	sort.Slice(mimes, func(i, j int) bool {
+		si, sj := representationSize(data[mimes[i]]), representationSize(data[mimes[j]])
+		return si > sj || (si == sj && mimes[i] < mimes[j])
+	})
+	return mimes
+}
+
+// downscaleImage halves the size of the image encoded in b with the format of mime until it is encoded in at most
+// size bytes, and returns it along with its original and new dimensions. ok is false if b cannot be decoded, or
+// the image cannot be made small enough.
+func downscaleImage(b []byte, mime string, size int) (small []byte, from, to image.Point, ok bool) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, from, to, false
+	}
+	from = img.Bounds().Size()
+	for len(b) > size {
+		to = img.Bounds().Size()
+		if to.X/2 < minImageSide || to.Y/2 < minImageSide {
+			return nil, from, to, false
+		}
+		img = resizeImage(img, to.X/2, to.Y/2)
+		if b, err = encodeImage(img, mime, jpeg.DefaultQuality); err != nil {
+			return nil, from, to, false
+		}
+	}
+	return b, from, img.Bounds().Size(), true
+}
+
+// encodeImage encodes img in the format of mime, PNG or JPEG with the given quality.
+func encodeImage(img image.Image, mime string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if mime == display.MIMETypeJPEG {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// resizeImage returns img resized to width x height, each pixel being the average of the pixels of img it covers.
+func resizeImage(img image.Image, width, height int) *image.NRGBA {
+	src := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := src.Min.Y + y*src.Dy()/height
+		y1 := src.Min.Y + (y+1)*src.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0 := src.Min.X + x*src.Dx()/width
+			x1 := src.Min.X + (x+1)*src.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(img.At(sx, sy)).(color.NRGBA64)
+					r, g, b, a = r+uint64(c.R), g+uint64(c.G), b+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(b / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
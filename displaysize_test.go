@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// TestParseByteSize tests parsing the sizes of %opt max_display_size.
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"100", 100},
+		{"100B", 100},
+		{"2KB", 2000},
+		{"8MiB", 8 << 20},
+		{"1.5 KiB", 1536},
+		{"0", 0},
+	}
+	for _, c := range cases {
+		got, err := parseByteSize(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("\t%s parseByteSize(%q) = %d, %v, expected %d", failure, c.in, got, err, c.want)
+		}
+	}
+	for _, in := range []string{"", "MiB", "-1", "8 parsecs"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("\t%s Expected parseByteSize(%q) to fail", failure, in)
+		}
+	}
+}
+
+// noiseImage returns an image of random pixels, which PNG cannot compress.
+func noiseImage(size int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// TestFitDisplayData tests downscaling the images and dropping the representations of oversized outputs.
+func TestFitDisplayData(t *testing.T) {
+	small := bundledMIMEData{display.MIMETypeText: "small"}
+	if fitted := fitDisplayData(small, 100); fitted[display.MIMETypeText] != "small" {
+		t.Errorf("\t%s Expected the data fitting the limit to be unchanged, got %v", failure, fitted)
+	}
+
+	const limit = 100 << 10
+	data := bundledMIMEData{
+		display.MIMETypePNG:  noiseImage(256),
+		display.MIMETypeText: "256x256 image",
+	}
+	fitted := fitDisplayData(data, limit)
+	if size := displaySize(fitted); size > limit {
+		t.Errorf("\t%s Expected at most %d bytes, got %d", failure, limit, size)
+	}
+	img, err := png.Decode(bytes.NewReader(fitted[display.MIMETypePNG].([]byte)))
+	if err != nil || img.Bounds().Dx() >= 256 {
+		t.Errorf("\t%s Expected a downscaled PNG image, got %v", failure, err)
+	}
+	if text := fitted[display.MIMETypeText].(string); !strings.Contains(text, "image/png image was downscaled from 256x256 to") {
+		t.Errorf("\t%s Expected the text to report the downscaling, got %q", failure, text)
+	}
+	if len(data[display.MIMETypePNG].([]byte)) <= limit {
+		t.Errorf("\t%s Expected the original data to be unchanged", failure)
+	}
+
+	data = bundledMIMEData{
+		display.MIMETypeHTML: strings.Repeat("<p>x</p>", limit),
+		display.MIMETypeText: strings.Repeat("x", 2*limit),
+	}
+	fitted = fitDisplayData(data, limit)
+	if _, ok := fitted[display.MIMETypeHTML]; ok || displaySize(fitted) > limit {
+		t.Errorf("\t%s Expected the HTML to be dropped and the text truncated, got %d bytes", failure, displaySize(fitted))
+	}
+	if text := fitted[display.MIMETypeText].(string); !strings.HasSuffix(text, "the text was truncated to fit %opt max_display_size 100.0 KiB)") {
+		t.Errorf("\t%s Unexpected text ending %q", failure, text[len(text)-100:])
+	}
+}
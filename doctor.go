@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+// doctorCheck is a check of `gophernotes doctor`: the detail of what it found, the fix to apply when it failed,
+// and whether it failed or only warns about a limitation.
+type doctorCheck struct {
+	name   string
+	detail string
+	fix    string
+	failed bool
+	warn   bool
+}
+
+// doctorCommand implements `gophernotes doctor`, which checks that the kernel can run and import packages, and
+// prints how to fix what cannot.
+func doctorCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: gophernotes doctor")
+	}
+	checks := []doctorCheck{
+		checkZMQ(),
+		checkKernelSpecs(jupyterKernelDirs()),
+		checkGoToolchain(),
+		checkPlugins(),
+	}
+	for _, dir := range []string{importCacheDir(), filepath.Join(gomacroGopath(), "src", "gomacro_imports"), crashDir()} {
+		checks = append(checks, checkWritable(dir))
+	}
+	if printDoctorChecks(os.Stdout, checks) {
+		return errors.New("doctor: some checks failed")
+	}
+	return nil
+}
+
+// printDoctorChecks prints the outcome of checks, with the fixes of those which failed or warn, and reports
+// whether any failed.
+func printDoctorChecks(w io.Writer, checks []doctorCheck) (failed bool) {
+	for _, c := range checks {
+		status := "ok  "
+		switch {
+		case c.failed:
+			status, failed = "FAIL", true
+		case c.warn:
+			status = "warn"
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", status, c.name, c.detail)
+		if (c.failed || c.warn) && c.fix != "" {
+			fmt.Fprintf(w, "     fix: %s\n", c.fix)
+		}
+	}
+	return failed
+}
+
+// checkZMQ checks the version of the ZeroMQ library and that the kernel can bind a socket with it.
+func checkZMQ() doctorCheck {
+	c := doctorCheck{name: "ZeroMQ"}
+	major, minor, patch := zmq.Version()
+	if major < 4 {
+		c.detail, c.failed = fmt.Sprintf("libzmq %d.%d.%d is too old", major, minor, patch), true
+		c.fix = "install ZeroMQ 4 (libzmq5 on Debian and Ubuntu, zeromq on Homebrew) and rebuild gophernotes"
+		return c
+	}
+	ctx, err := zmq.NewContext()
+	if err == nil {
+		var socket *zmq.Socket
+		if socket, err = ctx.NewSocket(zmq.ROUTER); err == nil {
+			err = socket.Bind("tcp://127.0.0.1:*")
+			socket.Close()
+		}
+		ctx.Term()
+	}
+	if err != nil {
+		c.detail, c.failed = fmt.Sprintf("libzmq %d.%d.%d cannot bind a socket: %v", major, minor, patch, err), true
+		c.fix = "check that the loopback interface is up and that no firewall blocks local TCP ports"
+		return c
+	}
+	c.detail = fmt.Sprintf("libzmq %d.%d.%d", major, minor, patch)
+	return c
+}
+
+// jupyterKernelDirs returns the kernels directories where Jupyter looks for kernel specs: those of $JUPYTER_PATH,
+// of the user and of the system.
+func jupyterKernelDirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("JUPYTER_PATH")) {
+		dirs = append(dirs, filepath.Join(dir, "kernels"))
+	}
+	dirs = append(dirs, filepath.Join(jupyterDataDir(), "kernels"))
+	if runtime.GOOS == "windows" {
+		return append(dirs, filepath.Join(os.Getenv("PROGRAMDATA"), "jupyter", "kernels"))
+	}
+	return append(dirs, "/usr/local/share/jupyter/kernels", "/usr/share/jupyter/kernels")
+}
+
+// checkKernelSpecs checks that a kernel spec of dirs runs gophernotes, and that its executable exists.
+func checkKernelSpecs(dirs []string) doctorCheck {
+	c := doctorCheck{name: "kernel spec"}
+	var found, broken []string
+	for _, dir := range dirs {
+		specs, _ := filepath.Glob(filepath.Join(dir, "*", "kernel.json"))
+		for _, path := range specs {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var spec kernelSpec
+			if json.Unmarshal(data, &spec) != nil || len(spec.Argv) == 0 ||
+				!strings.HasPrefix(filepath.Base(spec.Argv[0]), "gophernotes") {
+				continue
+			}
+			if _, err := exec.LookPath(spec.Argv[0]); err != nil {
+				broken = append(broken, fmt.Sprintf("%s runs %s, which is not found", path, spec.Argv[0]))
+			} else {
+				found = append(found, path)
+			}
+		}
+	}
+	switch {
+	case len(broken) > 0:
+		c.detail, c.failed = strings.Join(broken, "; "), true
+		c.fix = "run `gophernotes install` to write a kernel spec running this executable"
+	case len(found) == 0:
+		c.detail, c.failed = "no kernel spec runs gophernotes in "+strings.Join(dirs, ", "), true
+		c.fix = "run `gophernotes install`"
+	default:
+		c.detail = strings.Join(found, ", ")
+	}
+	return c
+}
+
+// checkGoToolchain checks that the go command, which builds the imported packages, is installed and matches the
+// version of Go gophernotes was built with, as plugins require.
+func checkGoToolchain() doctorCheck {
+	c := doctorCheck{name: "Go toolchain"}
+	if _, err := exec.LookPath("go"); err != nil {
+		c.detail, c.failed = "the go command is not in the PATH", true
+		c.fix = "install Go " + runtime.Version() + " from https://golang.org/dl/ and add its bin directory to the PATH"
+		return c
+	}
+	out, err := exec.Command("go", "env", "GOVERSION").Output()
+	version := strings.TrimSpace(string(out))
+	if err != nil || version == "" {
+		c.detail, c.warn = "cannot read the version of the go command", true
+		return c
+	}
+	if version != runtime.Version() {
+		c.detail, c.warn = fmt.Sprintf("go is %s but gophernotes was built with %s, so imported packages cannot be loaded as plugins", version, runtime.Version()), true
+		c.fix = "rebuild gophernotes with the installed Go: go get -u github.com/gopherdata/gophernotes"
+		return c
+	}
+	c.detail = version
+	return c
+}
+
+// checkPlugins checks that the platform supports loading imported packages as plugins, which needs cgo.
+func checkPlugins() doctorCheck {
+	c := doctorCheck{name: "plugins"}
+	if runtime.GOOS != "linux" {
+		c.detail, c.warn = "plugins are not supported on "+runtime.GOOS+": imported packages are interpreted from their source, or run in a separate process", true
+		c.fix = "use the Docker image to import packages compiled"
+		return c
+	}
+	out, err := exec.Command("go", "env", "CGO_ENABLED").Output()
+	if err == nil && strings.TrimSpace(string(out)) != "1" {
+		c.detail, c.warn = "cgo is disabled, which plugins need", true
+		c.fix = "set CGO_ENABLED=1 and install a C compiler"
+		return c
+	}
+	c.detail = "supported"
+	return c
+}
+
+// checkWritable checks that the kernel can write files to dir, creating it if needed.
+func checkWritable(dir string) doctorCheck {
+	c := doctorCheck{name: "write access", detail: dir}
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		var f *os.File
+		if f, err = ioutil.TempFile(dir, ".doctor"); err == nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		c.detail, c.failed = err.Error(), true
+		c.fix = "make " + dir + " writable by the user running the kernel, or point the variable setting it elsewhere"
+	}
+	return c
+}
+
+// gomacroGopath returns the GOPATH directory where the interpreter writes the bindings of imported packages.
+func gomacroGopath() string {
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return gopath
+	}
+	return filepath.Join(os.Getenv("HOME"), "go")
+}
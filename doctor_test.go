@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDoctor tests the checks of the kernel specs and of the write access, and how failures are printed.
+func TestDoctor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes-doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kernels := filepath.Join(dir, "kernels")
+	if c := checkKernelSpecs([]string{kernels}); !c.failed || !strings.Contains(c.fix, "gophernotes install") {
+		t.Errorf("\t%s Expected a missing kernel spec to fail, got %+v", failure, c)
+	}
+	if _, err := writeKernelSpec(filepath.Join(kernels, "go"), newKernelSpec(filepath.Join(dir, "gophernotes"), "Go", false, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkKernelSpecs([]string{kernels}); !c.failed || !strings.Contains(c.detail, "not found") {
+		t.Errorf("\t%s Expected a kernel spec running a missing executable to fail, got %+v", failure, c)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "gophernotes"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if c := checkKernelSpecs([]string{kernels}); c.failed {
+		t.Errorf("\t%s Expected the kernel spec to pass, got %+v", failure, c)
+	}
+
+	if c := checkWritable(filepath.Join(dir, "cache")); c.failed {
+		t.Errorf("\t%s Expected a new directory to be writable, got %+v", failure, c)
+	}
+	if c := checkWritable(filepath.Join(dir, "gophernotes", "cache")); !c.failed {
+		t.Errorf("\t%s Expected a directory below a file not to be writable", failure)
+	}
+
+	var out bytes.Buffer
+	failed := printDoctorChecks(&out, []doctorCheck{
+		{name: "ZeroMQ", detail: "libzmq 4.3.4"},
+		{name: "plugins", detail: "not supported", fix: "use Docker", warn: true},
+		{name: "kernel spec", detail: "none", fix: "run `gophernotes install`", failed: true},
+	})
+	want := "ok   ZeroMQ: libzmq 4.3.4\nwarn plugins: not supported\n     fix: use Docker\nFAIL kernel spec: none\n     fix: run `gophernotes install`\n"
+	if !failed || out.String() != want {
+		t.Errorf("\t%s Expected the checks to print\n%s\nbut got\n%s", failure, want, out.String())
+	}
+}
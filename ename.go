@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/scanner"
+	"github.com/gopherdata/gophernotes/assert"
+)
+
+// The names of the errors failing executions, sent as the ename of error replies so that front-ends can tell
+// them apart. The other errors, like those of magic commands, are named "Error".
+const (
+	// enameCompileError is the name of the errors of code that does not parse or that the interpreter rejects,
+	// e.g. for an undefined identifier or mismatched types.
+	enameCompileError = "CompileError"
+
+	// enameRuntimePanic is the name of the panics of the code while it runs.
+	enameRuntimePanic = "RuntimePanic"
+
+	// enameAssertion is the name of the failed assertions of package assert.
+	enameAssertion = "AssertionError"
+
+	enameInterrupted = "Interrupted"
+	enameTimeout     = "Timeout"
+
+	// enamePermission is the name of the errors refusing the requests of users other than the owner of the
+	// kernel.
+	enamePermission = "PermissionDenied"
+)
+
+// executionError is an error failing an execution, along with its name.
+type executionError struct {
+	ename string
+	err   error
+}
+
+func (e executionError) Error() string {
+	return e.err.Error()
+}
+
+// errorName returns the name of err sent as the ename of error replies.
+func errorName(err error) string {
+	if e, ok := err.(executionError); ok {
+		return e.ename
+	}
+	return "Error"
+}
+
+// panicError returns the error of a panic recovered from the interpreter. The interpreter checks the code as
+// it runs it, so its own errors are compile errors while the others are panics of the code.
+func panicError(r interface{}) error {
+	switch r := r.(type) {
+	case executionError:
+		return r
+	case *assert.Failure:
+		return executionError{enameAssertion, r}
+	case base.RuntimeError:
+		return executionError{enameCompileError, r}
+	case scanner.ErrorList:
+		return executionError{enameCompileError, r}
+	case error:
+		return executionError{enameRuntimePanic, r}
+	default:
+		return executionError{enameRuntimePanic, errors.New(fmt.Sprint(r))}
+	}
+}
+
+// assertionFailure returns the failed assertion err is the error of, or nil.
+func assertionFailure(err error) *assert.Failure {
+	if e, ok := err.(executionError); ok {
+		err = e.err
+	}
+	failure, _ := err.(*assert.Failure)
+	return failure
+}
+
+// exitCode returns the exit status of `gophernotes run` failing with err: 2 for compile errors, 3 for runtime
+// panics, 4 for timeouts and 1 for the other errors.
+func exitCode(err error) int {
+	switch errorName(err) {
+	case enameCompileError:
+		return 2
+	case enameRuntimePanic:
+		return 3
+	case enameTimeout:
+		return 4
+	}
+	return 1
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	r "reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// formatValues returns the text of the values produced by a cell, separated by spaces.
+func formatValues(vals []interface{}) string {
+	texts := make([]string, len(vals))
+	for i, v := range vals {
+		texts[i] = formatValue(v)
+	}
+	return strings.Join(texts, " ")
+}
+
+// printSample is set by `%opt print_sample n`: the slices, arrays and maps with more than 2n elements are written
+// with their first and last n elements only, followed by their length, unless they are wrapped by display.All.
+// 0 writes all the elements.
+var printSample = 10
+
+func init() {
+	kernelOptions["print_sample"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) == 1 {
+				if n, err := strconv.Atoi(args[0]); err == nil && n >= 0 {
+					printSample = n
+					return nil
+				}
+			}
+			return fmt.Errorf("expected a non-negative number of elements, got %q", strings.Join(args, " "))
+		},
+		value: func() string { return strconv.Itoa(printSample) },
+	}
+}
+
+// maxFormatLength is the length of the text of a value beyond which formatValue stops writing it.
+const maxFormatLength = 1 << 20
+
+// formatValue returns the text of a value produced by a cell. An error shows its message followed by the type
+// of each error of its chain, and a value with a String or GoString method what it returns. Other values are
+// written like fmt's %v does, calling these methods on the values they hold, but following the pointers at any
+// depth. A pointer, slice or map back to a value being written, as in linked lists and graphs with cycles, is
+// written <cycle *n>, and the value it refers to is prefixed with <ref *n>. The text stops with ... after
+// maxFormatLength bytes. Large collections are sampled, see printSample.
+func formatValue(v interface{}) string {
+	sample := printSample
+	if all, ok := v.(display.Unsampled); ok {
+		v, sample = all.Value, 0
+	}
+	if err, ok := v.(error); ok && !isNilPointer(r.ValueOf(v)) {
+		if text, ok := safeCall(err.Error); ok {
+			return text + errorChain(err)
+		}
+	}
+	p := &valuePrinter{sample: sample, visiting: make(map[visitKey]int), refs: make(map[int]int)}
+	p.print(r.ValueOf(v))
+	return p.String()
+}
+
+// errorChain lists the types of err and of the errors it wraps, as in "\n(*fs.PathError wrapping syscall.Errno)".
+func errorChain(err error) string {
+	var types []string
+	for err != nil && len(types) < 10 {
+		types = append(types, fmt.Sprintf("%T", err))
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	return "\n(" + strings.Join(types, " wrapping ") + ")"
+}
+
+// visitKey identifies a value referenced by a pointer, a map or a slice, by its address and type, since a
+// struct and its first field share their address.
+type visitKey struct {
+	ptr uintptr
+	typ r.Type
+	len int
+}
+
+// valuePrinter writes values like fmt's %v, detecting cycles.
+type valuePrinter struct {
+	buf strings.Builder
+
+	// sample is the number of first and last elements of the large collections written, 0 for all.
+	sample int
+
+	// visiting maps the values being written to the offset in buf where they start.
+	visiting map[visitKey]int
+
+	// refs maps the offsets of the values referred to by cycles to their number.
+	refs map[int]int
+
+	// end is the length of the text once it is truncated at maxFormatLength, 0 until then.
+	end int
+}
+
+// String returns the text written, with the values referred to by cycles prefixed with <ref *n>.
+func (p *valuePrinter) String() string {
+	text := p.buf.String()
+	if p.end > 0 {
+		text = text[:p.end]
+	}
+	if len(p.refs) == 0 {
+		return text
+	}
+	offsets := make([]int, 0, len(p.refs))
+	for offset := range p.refs {
+		if offset <= len(text) {
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Ints(offsets)
+
+	var b strings.Builder
+	last := 0
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%s<ref *%d> ", text[last:offset], p.refs[offset])
+		last = offset
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// print writes v.
+func (p *valuePrinter) print(v r.Value) {
+	if p.buf.Len() > maxFormatLength {
+		if p.end == 0 {
+			p.buf.WriteString("...")
+			p.end = p.buf.Len()
+		}
+		return
+	}
+	if !v.IsValid() {
+		p.buf.WriteString("<nil>")
+		return
+	}
+	if p.printMethod(v) {
+		return
+	}
+
+	switch v.Kind() {
+	case r.Interface:
+		if v.IsNil() {
+			p.buf.WriteString("<nil>")
+			return
+		}
+		p.print(v.Elem())
+	case r.Ptr:
+		if v.IsNil() {
+			p.buf.WriteString("<nil>")
+			return
+		}
+		p.visit(v, func() {
+			p.buf.WriteByte('&')
+			p.print(v.Elem())
+		})
+	case r.Struct:
+		p.buf.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				p.buf.WriteByte(' ')
+			}
+			p.print(v.Field(i))
+		}
+		p.buf.WriteByte('}')
+	case r.Slice:
+		if v.IsNil() {
+			p.buf.WriteString("[]")
+			return
+		}
+		p.visit(v, func() { p.printElems(v) })
+	case r.Array:
+		p.printElems(v)
+	case r.Map:
+		if v.IsNil() {
+			p.buf.WriteString("map[]")
+			return
+		}
+		p.visit(v, func() { p.printMap(v) })
+	default:
+		fmt.Fprint(&p.buf, v)
+	}
+}
+
+// visit calls fn to write v, a pointer, slice or map, unless v is already being written, in which case it writes
+// a reference to it instead.
+func (p *valuePrinter) visit(v r.Value, fn func()) {
+	key := visitKey{v.Pointer(), v.Type(), 0}
+	if v.Kind() == r.Slice {
+		key.len = v.Len()
+	}
+	if offset, ok := p.visiting[key]; ok {
+		n, ok := p.refs[offset]
+		if !ok {
+			n = len(p.refs) + 1
+			p.refs[offset] = n
+		}
+		fmt.Fprintf(&p.buf, "<cycle *%d>", n)
+		return
+	}
+	p.visiting[key] = p.buf.Len()
+	fn()
+	delete(p.visiting, key)
+}
+
+// printElems writes the elements of the slice or array v, sampled if there are many.
+func (p *valuePrinter) printElems(v r.Value) {
+	p.buf.WriteByte('[')
+	n := v.Len()
+	p.sampled(n, func(i int) { p.print(v.Index(i)) })
+	p.buf.WriteByte(']')
+	if p.sampling(n) {
+		if v.Kind() == r.Slice {
+			fmt.Fprintf(&p.buf, " (len %d, cap %d)", n, v.Cap())
+		} else {
+			fmt.Fprintf(&p.buf, " (len %d)", n)
+		}
+	}
+}
+
+// printMap writes the entries of the map v, sorted by key and sampled if there are many.
+func (p *valuePrinter) printMap(v r.Value) {
+	keys := v.MapKeys()
+	sortKeys(keys)
+	p.buf.WriteString("map[")
+	p.sampled(len(keys), func(i int) {
+		p.print(keys[i])
+		p.buf.WriteByte(':')
+		p.print(v.MapIndex(keys[i]))
+	})
+	p.buf.WriteByte(']')
+	if p.sampling(len(keys)) {
+		fmt.Fprintf(&p.buf, " (len %d)", len(keys))
+	}
+}
+
+// sampling reports whether a collection of n elements is sampled.
+func (p *valuePrinter) sampling(n int) bool {
+	return p.sample > 0 && n > 2*p.sample
+}
+
+// sampled calls write for each of n elements separated by spaces, or for the first and last p.sample ones
+// separated by ... if the collection is sampled.
+func (p *valuePrinter) sampled(n int, write func(i int)) {
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			p.buf.WriteByte(' ')
+		}
+		if p.sampling(n) && i == p.sample {
+			p.buf.WriteString("...")
+			i = n - p.sample - 1
+			continue
+		}
+		write(i)
+	}
+}
+
+// printMethod writes v with its Error, String or GoString method, in this order, and reports whether it did.
+// Methods of unexported fields cannot be called, and methods panicking are ignored, except on nil pointers,
+// written as <nil>.
+func (p *valuePrinter) printMethod(v r.Value) bool {
+	if !v.CanInterface() || (v.Kind() == r.Interface && v.IsNil()) {
+		return false
+	}
+	var method func() string
+	switch x := v.Interface().(type) {
+	case error:
+		method = x.Error
+	case fmt.Stringer:
+		method = x.String
+	case fmt.GoStringer:
+		method = x.GoString
+	default:
+		return false
+	}
+	text, ok := safeCall(method)
+	switch {
+	case ok:
+		p.buf.WriteString(text)
+	case isNilPointer(v):
+		p.buf.WriteString("<nil>")
+	default:
+		return false
+	}
+	return true
+}
+
+// safeCall returns the result of method, or false if it panics.
+func safeCall(method func() string) (text string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	return method(), true
+}
+
+// isNilPointer reports whether v is a nil pointer.
+func isNilPointer(v r.Value) bool {
+	return v.Kind() == r.Ptr && v.IsNil()
+}
+
+// sortKeys sorts the keys of a map like fmt does: numbers and strings by value, others by their text.
+func sortKeys(keys []r.Value) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Kind() == b.Kind() {
+			switch a.Kind() {
+			case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+				return a.Int() < b.Int()
+			case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+				return a.Uint() < b.Uint()
+			case r.Float32, r.Float64:
+				return a.Float() < b.Float()
+			case r.String:
+				return a.String() < b.String()
+			}
+		}
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	})
+}
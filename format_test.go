@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+type formatStringer struct{ n int }
+
+func (s *formatStringer) String() string { return fmt.Sprintf("stringer %d", s.n) }
+
+type formatGoStringer struct{}
+
+func (formatGoStringer) GoString() string { return "gostringer" }
+
+type formatPanicker struct{}
+
+func (formatPanicker) String() string { panic("boom") }
+
+type formatNode struct {
+	Value int
+	Next  *formatNode
+}
+
+type formatFields struct {
+	name   string
+	hidden *formatStringer
+	Shown  *formatStringer
+	Tags   map[string]int
+}
+
+// TestFormatValue tests the text of the values produced by cells.
+func TestFormatValue(t *testing.T) {
+	var nilStringer *formatStringer
+	loop := &formatNode{Value: 1}
+	loop.Next = &formatNode{Value: 2, Next: loop}
+	self := []interface{}{1, nil}
+	self[1] = self
+	shared := &formatNode{Value: 3}
+
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "<nil>"},
+		{42, "42"},
+		{"text", "text"},
+		{&formatStringer{3}, "stringer 3"},
+		{nilStringer, "<nil>"},
+		{formatGoStringer{}, "gostringer"},
+		{formatPanicker{}, "{}"},
+		{errors.New("boom"), "boom\n(*errors.errorString)"},
+		{fmt.Errorf("reading: %w", os.ErrNotExist), "reading: file does not exist\n(*fmt.wrapError wrapping *errors.errorString)"},
+		{[]int{1, 2}, "[1 2]"},
+		{map[string]int{"b": 2, "a": 1}, "map[a:1 b:2]"},
+		{map[int]bool{10: true, 9: false}, "map[9:false 10:true]"},
+		{formatFields{"x", &formatStringer{1}, &formatStringer{2}, nil}, "{x &{1} stringer 2 map[]}"},
+		{&formatNode{1, &formatNode{2, nil}}, "&{1 &{2 <nil>}}"},
+		{loop, "<ref *1> &{1 &{2 <cycle *1>}}"},
+		{self, "<ref *1> [1 <cycle *1>]"},
+		{[]*formatNode{loop, loop.Next}, "[<ref *1> &{1 &{2 <cycle *1>}} <ref *2> &{2 &{1 <cycle *2>}}]"},
+		{[]*formatNode{shared, shared}, "[&{3 <nil>} &{3 <nil>}]"},
+	}
+	for i, c := range cases {
+		if got := formatValue(c.v); got != c.want {
+			t.Errorf("\t%s formatValue of case %d = %q, expected %q", failure, i, got, c.want)
+		}
+	}
+
+	var long *formatNode
+	for i := 0; i < maxFormatLength/3; i++ {
+		long = &formatNode{Value: 1, Next: long}
+	}
+	if got := formatValue(long); len(got) > maxFormatLength+10 || !strings.HasSuffix(got, "&{1 &...") {
+		t.Errorf("\t%s Expected a long list to be truncated, got %d bytes ending with %q", failure, len(got), got[len(got)-20:])
+	}
+
+	defer func(n int) { printSample = n }(printSample)
+	printSample = 2
+	big := make([]int, 10, 16)
+	for i := range big {
+		big[i] = i
+	}
+	sampled := []struct {
+		v    interface{}
+		want string
+	}{
+		{big, "[0 1 ... 8 9] (len 10, cap 16)"},
+		{[5]int{1, 2, 3, 4, 5}, "[1 2 ... 4 5] (len 5)"},
+		{[]int{1, 2, 3, 4}, "[1 2 3 4]"},
+		{map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 5}, "map[1:1 2:2 ... 4:4 5:5] (len 5)"},
+		{display.All(big), "[0 1 2 3 4 5 6 7 8 9]"},
+	}
+	for i, c := range sampled {
+		if got := formatValue(c.v); got != c.want {
+			t.Errorf("\t%s formatValue of sampled case %d = %q, expected %q", failure, i, got, c.want)
+		}
+	}
+
+	if got := formatValues([]interface{}{1, "a", nil}); got != "1 a <nil>" {
+		t.Errorf("\t%s formatValues() = %q", failure, got)
+	}
+}
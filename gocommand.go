@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+func init() {
+	lineMagics["go"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) == 0 {
+			return errors.New("expected the arguments of the go command, e.g. get <package>")
+		}
+		return runGoCommand(args)
+	}
+}
+
+// runGoCommand runs the go command with the given arguments, showing its output below the cell. It is mostly
+// used as `%go get <package>` to download and install a package before importing it, since the interpreter
+// builds the bindings of imported packages from their installed archives.
+//
+// The go command reads the settings of private modules, GOPRIVATE, GONOSUMDB and the credentials of ~/.netrc
+// or $NETRC, from the environment of the kernel, see `gophernotes install`. Since nobody can answer the prompts
+// of git in a kernel, they are disabled, and the failures to authenticate explain how to set credentials.
+func runGoCommand(args []string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(hooks.Context(), "go", args...)
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("GIT_TERMINAL_PROMPT"); !ok {
+		cmd.Env = append(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	if err := cmd.Run(); err != nil {
+		if offline && strings.Contains(stderr.String(), "GOPROXY=off") {
+			return fmt.Errorf("%v: the kernel is offline, see %%opt offline, so modules are not downloaded", err)
+		}
+		if authErr := goAuthError(stderr.String()); authErr != nil {
+			return authErr
+		}
+		return err
+	}
+	return nil
+}
+
+// goAuthFailures are the messages of the go command, git and the module proxies telling that a private
+// repository needs credentials, or rejected them.
+var goAuthFailures = []string{
+	"terminal prompts disabled",
+	"could not read Username",
+	"could not read Password",
+	"Authentication failed",
+	"401 Unauthorized",
+	"403 Forbidden",
+	"Permission denied (publickey)",
+	"HTTP Basic: Access denied",
+}
+
+// goChecksumFailures are the messages of the go command failing to verify a module with the checksum database,
+// which knows no private module.
+var goChecksumFailures = []string{
+	"verifying module",
+	"verifying go.mod",
+	"sum.golang.org/lookup",
+}
+
+// goAuthError returns an error explaining how to fix the failure of the go command that wrote stderr, when it
+// failed to authenticate to a private repository or to verify a private module, or nil for other failures.
+func goAuthError(stderr string) error {
+	for _, line := range strings.Split(stderr, "\n") {
+		for _, failure := range goAuthFailures {
+			if strings.Contains(line, failure) {
+				return fmt.Errorf("authentication failed: %s\n"+
+					"The kernel cannot prompt for credentials: add them to ~/.netrc, or to the file named by $NETRC, "+
+					"or use SSH with `git config --global url.\"git@host:\".insteadOf https://host/`, and mark the "+
+					"private modules with GOPRIVATE, e.g. with `gophernotes install -env GOPRIVATE=host/*`",
+					strings.TrimSpace(line))
+			}
+		}
+		for _, failure := range goChecksumFailures {
+			if strings.Contains(line, failure) {
+				return fmt.Errorf("checksum verification failed: %s\n"+
+					"The checksum database only knows public modules: mark the private ones with GOPRIVATE or "+
+					"GONOSUMDB in the environment of the kernel, e.g. with `gophernotes install -env GOPRIVATE=host/*`",
+					strings.TrimSpace(line))
+			}
+		}
+	}
+	return nil
+}
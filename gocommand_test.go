@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGoAuthError tests explaining the failures of the go command to fetch private modules.
+func TestGoAuthError(t *testing.T) {
+	cases := []struct {
+		stderr, want string
+	}{
+		{"go: downloading example.com/lib v1.0.0\n", ""},
+		{"# cd .; git ls-remote https://git.corp.example.com/team/lib\nfatal: could not read Username for 'https://git.corp.example.com': terminal prompts disabled\n",
+			"authentication failed: fatal: could not read Username for 'https://git.corp.example.com': terminal prompts disabled"},
+		{"go: git.corp.example.com/team/lib@v1.2.0: reading https://proxy.example.com/git.corp.example.com/team/lib/@v/v1.2.0.mod: 403 Forbidden\n",
+			"GOPRIVATE"},
+		{"verifying git.corp.example.com/team/lib@v1.2.0: git.corp.example.com/team/lib@v1.2.0: reading https://sum.golang.org/lookup/git.corp.example.com/team/lib@v1.2.0: 410 Gone\n",
+			"checksum verification failed"},
+		{"git@git.corp.example.com: Permission denied (publickey).\n", "~/.netrc"},
+	}
+	for _, c := range cases {
+		err := goAuthError(c.stderr)
+		switch {
+		case c.want == "" && err != nil:
+			t.Errorf("\t%s Expected no explanation for %q but got %v", failure, c.stderr, err)
+		case c.want != "" && (err == nil || !strings.Contains(err.Error(), c.want)):
+			t.Errorf("\t%s Expected the explanation of %q to contain %q but got %v", failure, c.stderr, c.want, err)
+		}
+	}
+}
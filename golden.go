@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gopherdata/gophernotes/assert"
+)
+
+// enameOutputMismatch is the name of the error of a cell whose output differs from its `// Output:` comment.
+const enameOutputMismatch = "OutputMismatch"
+
+// goldenOutput returns the output expected from a cell ending with an `// Output:` or `// Unordered output:`
+// comment, like the examples of go test, and whether it may come in any order. ok is false if the cell has no
+// such comment.
+func goldenOutput(code string) (want string, unordered, ok bool) {
+	lines := strings.Split(strings.Replace(code, "\r\n", "\n", -1), "\n")
+
+	// The comment is among the comment lines ending the cell.
+	start := len(lines)
+	for start > 0 {
+		line := strings.TrimSpace(lines[start-1])
+		if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+		start--
+	}
+
+	for i := start; i < len(lines); i++ {
+		text := commentText(lines[i])
+		var first string
+		switch {
+		case strings.HasPrefix(text, "Output:"):
+			first = text[len("Output:"):]
+		case strings.HasPrefix(text, "Unordered output:"):
+			first, unordered = text[len("Unordered output:"):], true
+		default:
+			continue
+		}
+		out := []string{first}
+		for _, line := range lines[i+1:] {
+			out = append(out, commentText(line))
+		}
+		return strings.Join(out, "\n"), unordered, true
+	}
+	return "", false, false
+}
+
+// commentText returns the text of a `//` comment line, without the space following the slashes.
+func commentText(line string) string {
+	text := strings.TrimPrefix(strings.TrimSpace(line), "//")
+	return strings.TrimPrefix(text, " ")
+}
+
+// checkOutput runs a cell expecting the output want, as returned by goldenOutput, while copying what it writes to
+// the standard output. It fails with the two outputs when they differ once trimmed, or their sorted lines when
+// unordered is set, like go test does for examples.
+func checkOutput(want string, unordered bool, run func() ([]interface{}, error)) ([]interface{}, error) {
+	stdout := os.Stdout
+	rOut, wOut, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	os.Stdout = wOut
+
+	var got bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(io.MultiWriter(stdout, &got), rOut)
+	}()
+
+	vals, err := run()
+
+	wOut.Close()
+	os.Stdout = stdout
+	wg.Wait()
+	rOut.Close()
+	if err != nil {
+		return vals, err
+	}
+
+	gotOut := normalizeOutput(got.String(), unordered)
+	wantOut := normalizeOutput(want, unordered)
+	if gotOut != wantOut {
+		return nil, executionError{enameOutputMismatch, &assert.Failure{
+			Message:  "output does not match the // Output: comment of the cell",
+			Expected: wantOut,
+			Actual:   gotOut,
+		}}
+	}
+	return vals, nil
+}
+
+// normalizeOutput trims the space around out, and sorts its lines if unordered is set.
+func normalizeOutput(out string, unordered bool) string {
+	out = strings.TrimSpace(strings.Replace(out, "\r\n", "\n", -1))
+	if !unordered {
+		return out
+	}
+	lines := strings.Split(out, "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGoldenOutput tests checking the output of cells against their `// Output:` comment.
+func TestGoldenOutput(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code, err string
+	}{
+		{"import \"fmt\"\nfor i := 0; i < 3; i++ {\n\tfmt.Println(i)\n}\n// Output:\n// 0\n// 1\n// 2\n", ""},
+		{"fmt.Println(\"hello\")\n// Output: hello", ""},
+		{"fmt.Println(\"b\")\nfmt.Println(\"a\")\n// Unordered output:\n// a\n// b", ""},
+		// The comments before the code are not checked.
+		{"// Output: nothing\nfmt.Println(\"something\")", ""},
+		{"fmt.Println(\"hello\")\nfmt.Println(\"world\")\n\n// Output:\n// hello\n// gophers",
+			"output does not match the // Output: comment of the cell\n--- expected\n+++ actual\n  hello\n- gophers\n+ world"},
+		{"fmt.Println(\"b\")\nfmt.Println(\"a\")\n// Output:\n// a\n// b", "output does not match"},
+	}
+	for _, c := range cases {
+		_, err := evalCell(ir, nil, c.code)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("\t%s Expected %q to pass but got %v", failure, c.code, err)
+		case c.err != "" && (err == nil || errorName(err) != enameOutputMismatch || !strings.HasPrefix(err.Error(), c.err)):
+			t.Errorf("\t%s Expected %q to fail with %q but got %v", failure, c.code, c.err, err)
+		}
+	}
+}
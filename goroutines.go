@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"os"
+	r "reflect"
+	"strconv"
+	"sync"
+	"unsafe"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// goFuncName is the name of the function starting the goroutines of the go statements of the cells.
+const goFuncName = "__gophernotesGo"
+
+// sessionGoroutines holds what the goroutines started by the cells of the session of ir need: the calls of their
+// go statements, and the declarations of the functions of the session, re-created on the call stack of each
+// goroutine.
+type sessionGoroutines struct {
+	mu    sync.Mutex
+	ir    *classic.Interp
+	calls []*ast.CallExpr
+	funcs map[string]*ast.FuncDecl
+}
+
+var goroutines = &sessionGoroutines{}
+
+// spawnGoroutines rewrites the go statements of node into calls of the function goFuncName, which evaluates the
+// function and the arguments in the calling goroutine, like `go` does, and runs the call in a goroutine of its
+// own. Unlike with the go statement of the interpreter, the function literals and the functions of the session
+// the goroutine calls record their calls on a stack of its own, so that its deferred calls and recover work
+// without corrupting those of the other goroutines, and a panic of the goroutine is reported to the cell that
+// started it instead of crashing the kernel. It returns the replacement of node.
+func spawnGoroutines(ir *classic.Interp, node ast.Node) ast.Node {
+	goroutines.reset(ir)
+
+	// The functions declared by the node are known when the goroutines start, its other names are not.
+	var scope []ast.Node
+	if decl, ok := node.(*ast.FuncDecl); ok {
+		scope = []ast.Node{decl.Type, decl.Body}
+	} else {
+		scope = []ast.Node{node}
+	}
+	declared := declaredNames(scope)
+
+	spawn := func(stmt ast.Stmt) ast.Stmt {
+		g, ok := stmt.(*ast.GoStmt)
+		if !ok || !callsLater(ir, g.Call, declared) {
+			return stmt
+		}
+		goroutines.mu.Lock()
+		index := len(goroutines.calls)
+		goroutines.calls = append(goroutines.calls, g.Call)
+		goroutines.mu.Unlock()
+
+		args := []ast.Expr{
+			&ast.BasicLit{ValuePos: g.Pos(), Kind: token.INT, Value: strconv.Itoa(index)},
+			g.Call.Fun,
+		}
+		return &ast.ExprStmt{X: &ast.CallExpr{
+			Fun:    &ast.Ident{NamePos: g.Pos(), Name: goFuncName},
+			Args:   append(args, g.Call.Args...),
+			Rparen: g.Call.Rparen,
+		}}
+	}
+
+	return rewriteStmts(node, spawn)
+}
+
+// reset forgets the goroutines and functions of the previous session when ir is a new interpreter, and defines
+// the function goFuncName in it.
+func (g *sessionGoroutines) reset(ir *classic.Interp) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.ir == ir {
+		return
+	}
+	g.ir = ir
+	g.calls = nil
+	g.funcs = make(map[string]*ast.FuncDecl)
+
+	fn := builtinFunc(g.start)
+	ir.Env.DefineVar(goFuncName, fn.Type(), fn)
+}
+
+// builtinFunc returns a function of the interpreter calling exec with the environment of the call and the
+// values of its arguments, which only the builtins of the interpreter are given. The interpreter has no exported
+// way to build them, so builtinFunc sets their unexported fields through unsafe, after checking their types, so
+// that a version of the interpreter laying them out differently fails the start of the kernel rather than the
+// calls.
+func builtinFunc(exec func(env *classic.Env, args []r.Value) (r.Value, []r.Value)) r.Value {
+	v := r.New(r.TypeOf(classic.Function{})).Elem()
+	unexportedField(v, "exec", r.TypeOf(exec)).Set(r.ValueOf(exec))
+	unexportedField(v, "argNum", r.TypeOf(0)).SetInt(-1)
+	return v
+}
+
+// unexportedField returns the unexported field name of type typ of the addressable struct v, which can be set.
+func unexportedField(v r.Value, name string, typ r.Type) r.Value {
+	field := v.FieldByName(name)
+	if !field.IsValid() || field.Type() != typ {
+		panic(fmt.Errorf("%v has no field %s of type %v", v.Type(), name, typ))
+	}
+	return r.NewAt(typ, unsafe.Pointer(field.UnsafeAddr())).Elem()
+}
+
+// callsLater reports whether the call of a go or defer statement can be evaluated by a function of the kernel,
+// to be made later: the builtins, and the calls passing the results of a call as arguments, are left to the
+// interpreter.
+func callsLater(ir *classic.Interp, call *ast.CallExpr, declared map[string]bool) bool {
+	if len(call.Args) == 1 {
+		if _, ok := unparen(call.Args[0]).(*ast.CallExpr); ok {
+			return false
+		}
+	}
+	if ident, ok := unparen(call.Fun).(*ast.Ident); ok && !declared[ident.Name] {
+		v := ir.Env.ValueOf(ident.Name)
+		return !v.IsValid() || v.Kind() != r.Struct
+	}
+	return true
+}
+
+// declare records the function declared by node, once evaluated, so that the goroutines can re-create it.
+func (g *sessionGoroutines) declare(node ast.Node) {
+	decl, ok := node.(*ast.FuncDecl)
+	if !ok || decl.Recv != nil || decl.Body == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.funcs[decl.Name.Name] = decl
+}
+
+// start implements goFuncName: args are the index of the call of the go statement, the function it calls and
+// its arguments, evaluated by env.
+func (g *sessionGoroutines) start(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	g.mu.Lock()
+	call := g.calls[args[0].Int()]
+	funcs := make(map[string]*ast.FuncDecl, len(g.funcs))
+	for name, decl := range g.funcs {
+		funcs[name] = decl
+	}
+	g.mu.Unlock()
+
+	fn := args[1]
+	switch fun := unparen(call.Fun).(type) {
+	case *ast.FuncLit:
+		fn = g.stackEnv(env, env, funcs).EvalNode1(fun)
+	case *ast.Ident:
+		if _, ok := funcs[fun.Name]; ok && g.isTopLevel(env, fun.Name) {
+			fn = g.stackEnv(g.ir.Env, env, funcs).ValueOf(fun.Name)
+		}
+	}
+	if fn.Kind() != r.Func {
+		env.Errorf("cannot call non-function %v", call.Fun)
+	}
+	fn = copyValue(fn, fn.Type())
+	in, err := callArgs("go", fn.Type(), args[2:], call.Ellipsis.IsValid())
+	if err != nil {
+		env.Errorf("%v", err)
+	}
+
+	// The panics of the goroutine are shown by the cell that started it, even once it is over, and its
+	// notebook.Context is that of the cell.
+	receipt, _ := hooks.currentReceipt()
+	cell := fmt.Sprintf("In [%d]", ExecCounter)
+	execution := hooks.currentExecution()
+	stepped := steps.spawn(execution)
+	go func() {
+		defer hooks.startGoroutine(execution)()
+		defer steps.exit(stepped)
+		defer func() {
+			if p := recover(); p != nil {
+				reportGoroutinePanic(receipt, cell, p)
+			}
+		}()
+		steps.enter(stepped)
+		callValues(fn, in)
+	}()
+	return base.None, nil
+}
+
+// stackEnv returns an environment inside outer with a call stack of its own, where the functions of the session
+// not shadowed by outer are re-created, along with the check of the depth of their calls, so that their calls
+// are recorded on that stack. Their loops stop when the cell calling stackEnv is interrupted or times out.
+// The environment also has its own copy of the ThreadGlobals of caller, the environment of the go statement,
+// where the interpreter records the position of the code it runs: the goroutines share the variables, types and
+// imports of the session, but not the state of their evaluation.
+func (g *sessionGoroutines) stackEnv(outer, caller *classic.Env, funcs map[string]*ast.FuncDecl) *classic.Env {
+	env := classic.NewEnv(outer, "go")
+	globals := *caller.ThreadGlobals
+	env.ThreadGlobals = &globals
+	env.CallStack = &classic.CallStack{Frames: make([]classic.CallFrame, 1, callStackFrames)}
+
+	enter := enterCall(env.CallStack)
+	env.DefineVar(enterCallFuncName, r.TypeOf(enter), r.ValueOf(enter))
+	check := stopCheck(hooks.currentExecution())
+	env.DefineVar(stopCheckFuncName, r.TypeOf(check), r.ValueOf(check))
+	for name, decl := range funcs {
+		if !g.isTopLevel(outer, name) {
+			continue
+		}
+		fn := env.EvalNode1(&ast.FuncLit{Type: decl.Type, Body: decl.Body})
+		env.DefineFunc(name, fn.Type(), fn)
+	}
+	return env
+}
+
+// isTopLevel reports whether name refers to a function of the session from env, rather than to a name declared
+// by the functions or blocks env is in.
+func (g *sessionGoroutines) isTopLevel(env *classic.Env, name string) bool {
+	for ; env != nil && env != g.ir.Env; env = env.Outer {
+		if _, ok := env.Binds.Get(name); ok {
+			return false
+		}
+	}
+	return env != nil
+}
+
+// callArgs converts args to the types of the parameters of a function of type typ, called by a go or defer
+// statement. The arguments of a variadic function are returned for CallSlice, the variadic ones in a slice, nil
+// if there are none, unless ellipsis is set.
+func callArgs(stmt string, typ r.Type, args []r.Value, ellipsis bool) ([]r.Value, error) {
+	n := typ.NumIn()
+	if typ.IsVariadic() && !ellipsis {
+		if len(args) < n-1 {
+			return nil, fmt.Errorf("not enough arguments in %s statement: have %d, want at least %d", stmt, len(args), n-1)
+		}
+	} else if len(args) != n {
+		return nil, fmt.Errorf("wrong number of arguments in %s statement: have %d, want %d", stmt, len(args), n)
+	}
+	in := make([]r.Value, n)
+	for i := 0; i < n; i++ {
+		if i == n-1 && typ.IsVariadic() && !ellipsis {
+			break
+		}
+		in[i] = copyValue(args[i], typ.In(i))
+	}
+	if typ.IsVariadic() && !ellipsis {
+		rest := r.Zero(typ.In(n - 1))
+		for _, arg := range args[n-1:] {
+			rest = r.Append(rest, copyValue(arg, typ.In(n-1).Elem()))
+		}
+		in[n-1] = rest
+	}
+	return in, nil
+}
+
+// copyValue returns a copy of v converted to t, or the zero value of t if v is nil. The values of the
+// interpreter may be variables, changed after a go or defer statement evaluated them.
+func copyValue(v r.Value, t r.Type) r.Value {
+	c := r.New(t).Elem()
+	if v.IsValid() {
+		c.Set(v.Convert(t))
+	}
+	return c
+}
+
+// callValues calls fn with in, as returned by callArgs.
+func callValues(fn r.Value, in []r.Value) []r.Value {
+	if fn.Type().IsVariadic() {
+		return fn.CallSlice(in)
+	}
+	return fn.Call(in)
+}
+
+// reportGoroutinePanic shows the panic p of a goroutine started by the cell, on the standard error of the cell
+// of receipt, or of the kernel when there is none.
+func reportGoroutinePanic(receipt *msgReceipt, cell string, p interface{}) {
+	msg := fmt.Sprintf("panic in goroutine started by %s: %v\n", cell, panicError(p))
+	if receipt == nil {
+		fmt.Fprint(os.Stderr, msg)
+		return
+	}
+	stderr := JupyterStreamWriter{StreamStderr, receipt}
+	stderr.Write([]byte(msg))
+}
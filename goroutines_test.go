@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGoroutines tests that many goroutines can defer calls and recover their panics at once, in function
+// literals and in functions of the session, recursive ones included.
+func TestGoroutines(t *testing.T) {
+	testConformance(t, []conformanceCase{
+		{`import "sync"
+var wg sync.WaitGroup
+var mu sync.Mutex
+recovered := 0
+func check(i int) {
+	defer func() {
+		var p interface{} = recover()
+		if p != nil {
+			mu.Lock()
+			recovered++
+			mu.Unlock()
+		}
+	}()
+	if i%2 == 0 {
+		panic(i)
+	}
+}
+for i := 0; i < 200; i++ {
+	wg.Add(1)
+	go func(i int) {
+		defer wg.Done()
+		check(i)
+	}(i)
+}
+wg.Wait()
+recovered`, "100"},
+		{`func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+results := make(chan int)
+func send(n int, out chan<- int) {
+	defer func() { out <- fib(n) }()
+}
+for i := 0; i < 50; i++ {
+	go send(10, results)
+}
+total := 0
+for i := 0; i < 50; i++ {
+	total += <-results
+}
+total`, "2750"},
+		{`import "sort"
+done := make(chan string)
+func run(words ...string) {
+	defer func() { done <- fmt.Sprint(recover(), words) }()
+	panic("boom")
+}
+go run("a", "b")
+go run([]string{"c"}...)
+go run()
+got := []string{<-done, <-done, <-done}
+sort.Strings(got)
+got`, "[boom[] boom[a b] boom[c]]"},
+	})
+}
+
+// TestGoroutinePanic tests that the panic of a goroutine is reported, instead of crashing the kernel.
+func TestGoroutinePanic(t *testing.T) {
+	rErr, wErr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rErr.Close()
+	stderr := os.Stderr
+	os.Stderr = wErr
+	defer func() { os.Stderr = stderr }()
+
+	ir := newInterp()
+	vals, err := doEval(ir, "go func() { panic(\"boom\") }()\n\"started\"")
+	if err != nil || len(vals) != 1 || vals[0] != "started" {
+		t.Fatalf("\t%s Expected the cell to go on but got %v, %v", failure, vals, err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		line, _ := bufio.NewReader(rErr).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		want := fmt.Sprintf("panic in goroutine started by In [%d]: boom", ExecCounter)
+		if strings.TrimSpace(line) != want {
+			t.Errorf("\t%s Expected %q but got %q", failure, want, line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("\t%s Expected the panic to be reported", failure)
+	}
+}
+
+// TestGoroutinesShareSession tests that goroutines left running by a cell keep reading and writing the variables
+// of the session, and calling its functions, while the following cells declare new ones. Run with -race.
+func TestGoroutinesShareSession(t *testing.T) {
+	ir := newInterp()
+	cells := []string{`import "sync"
+var mu sync.Mutex
+var wg sync.WaitGroup
+stop := make(chan struct{})
+total := 0
+func add(n int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + add(n-1)
+}
+for i := 0; i < 20; i++ {
+	wg.Add(1)
+	go func(i int) {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n := add(i % 5)
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}
+	}(i)
+}`}
+	for i := 0; i < 20; i++ {
+		cells = append(cells, fmt.Sprintf("var v%d = %d\nfunc f%d() int { return v%d + add(2) }\nf%d()", i, i, i, i, i))
+	}
+	cells = append(cells, `import "time"
+busy := func() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return total > 0
+}
+for i := 0; i < 500 && !busy(); i++ {
+	time.Sleep(10 * time.Millisecond)
+}
+close(stop)
+wg.Wait()
+busy()`)
+
+	for i, cell := range cells {
+		vals, err := doEval(ir, cell)
+		if err != nil {
+			t.Fatalf("\t%s Cell %d failed: %v", failure, i, err)
+		}
+		if i > 0 && i <= 20 && (len(vals) != 1 || vals[0] != i+1) {
+			t.Errorf("\t%s Expected %d but got %v from\n%s", failure, i+1, vals, cell)
+		}
+		if i == len(cells)-1 && (len(vals) != 1 || vals[0] != true) {
+			t.Errorf("\t%s Expected the goroutines to add to the total but got %v", failure, vals)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+)
+
+// kernelHooks implements notebook.Kernel for the cell currently being executed.
+type kernelHooks struct {
+	mu sync.Mutex
+
+	// ir is the interpreter of the kernel.
+	ir *classic.Interp
+
+	// receipt is the execute_request being handled, nil between executions.
+	receipt *msgReceipt
+
+	// execution is the execution of the cell being executed, nil between executions.
+	execution *cellExecution
+
+	// executions maps the goroutines running code of the cells, by id, to the executions of the cells that
+	// started them.
+	executions map[int64]*cellExecution
+
+	// comms holds the widget comms opened by the kernel, indexed by comm id.
+	comms map[string]widgetComm
+
+	// reactives holds the outputs created by notebook.Reactive, in order of creation.
+	reactives []*reactive
+}
+
+// hooks is installed into the notebook package by runKernel.
+var hooks = &kernelHooks{comms: make(map[string]widgetComm), executions: make(map[int64]*cellExecution)}
+
+// Reasons for a cell execution to stop early.
+const (
+	stopInterrupted int32 = iota + 1
+	stopTimedOut
+)
+
+// cellExecution is the execution of a cell. Its context is done when the cell is interrupted or times out, but
+// not when the cell completes, so that the goroutines it started keep running.
+type cellExecution struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+
+	// stopped is the reason the execution stopped early, 0 until then.
+	stopped int32
+}
+
+// stop stops the execution for the given reason, unless it already stopped.
+func (e *cellExecution) stop(reason int32) {
+	if atomic.CompareAndSwapInt32(&e.stopped, 0, reason) {
+		e.cancel()
+	}
+}
+
+// stopReason returns the reason the execution stopped early, or 0.
+func (e *cellExecution) stopReason() int32 {
+	return atomic.LoadInt32(&e.stopped)
+}
+
+// startCell records the receipt of the execute_request being handled and starts the execution of its cell by
+// the calling goroutine, which times out after timeout unless it is 0.
+func (h *kernelHooks) startCell(receipt *msgReceipt, timeout time.Duration) *cellExecution {
+	e := &cellExecution{}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	if timeout > 0 {
+		e.timer = time.AfterFunc(timeout, func() { e.stop(stopTimedOut) })
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.receipt = receipt
+	h.execution = e
+	h.executions[goroutineID()] = e
+	return e
+}
+
+// endCell forgets the execution recorded by startCell, without cancelling its context.
+func (h *kernelHooks) endCell() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.execution != nil && h.execution.timer != nil {
+		h.execution.timer.Stop()
+	}
+	h.receipt = nil
+	h.execution = nil
+	delete(h.executions, goroutineID())
+}
+
+// startGoroutine records that the calling goroutine runs code started by the cell of execution, until the
+// returned function is called.
+func (h *kernelHooks) startGoroutine(execution *cellExecution) (end func()) {
+	if execution == nil {
+		return func() {}
+	}
+	id := goroutineID()
+	h.mu.Lock()
+	h.executions[id] = execution
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.executions, id)
+		h.mu.Unlock()
+	}
+}
+
+// interrupt stops the cell being executed, if any, and reports whether it was already interrupted.
+func (h *kernelHooks) interrupt() (again bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.execution == nil {
+		return false
+	}
+	again = h.execution.stopReason() == stopInterrupted
+	h.execution.stop(stopInterrupted)
+	return again
+}
+
+// currentExecution returns the execution of the cell that started the calling goroutine, or nil.
+func (h *kernelHooks) currentExecution() *cellExecution {
+	id := goroutineID()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.executions[id]
+}
+
+// currentReceipt returns the receipt of the execute_request being handled, or an error when
+// called outside of a cell execution.
+func (h *kernelHooks) currentReceipt() (*msgReceipt, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.receipt == nil {
+		return nil, notebook.ErrNoKernel
+	}
+	return h.receipt, nil
+}
+
+// Context implements notebook.Kernel.Context: the context of the cell that started the calling goroutine, done
+// when that cell is interrupted or times out. Outside of the cells, and in the goroutines they start in other
+// ways than with go statements, like those of compiled packages, the context is never done.
+func (h *kernelHooks) Context() context.Context {
+	if e := h.currentExecution(); e != nil {
+		return e.ctx
+	}
+	return context.Background()
+}
+
+// Display implements notebook.Kernel.Display.
+func (h *kernelHooks) Display(data display.Data) error {
+	receipt, err := h.currentReceipt()
+	if err != nil {
+		return err
+	}
+	return receipt.PublishDisplayData(bundledMIMEData(data), nil, "")
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// imageFormat is set by `%opt image_format png|jpeg`: the format the PNG images of the outputs larger than
+// imageConvertSize are converted to, keeping notebooks with many plots small. png leaves them unchanged.
+var imageFormat = "png"
+
+// imageQuality is set by `%opt image_quality n`: the quality, from 1 to 100, of the JPEG images converted.
+var imageQuality = 85
+
+// imageConvertSize is set by `%opt image_convert_size size`: the size of the PNG images converted to imageFormat.
+var imageConvertSize = 100 << 10
+
+// imageMaxDims is set by `%opt image_max_dims WxH`: the PNG and JPEG images of the outputs larger than these
+// dimensions are downscaled, keeping their aspect ratio. A zero dimension is not limited.
+var imageMaxDims image.Point
+
+func init() {
+	kernelOptions["image_format"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected png or jpeg, got %q", strings.Join(args, " "))
+			}
+			switch args[0] {
+			case "png", "jpeg":
+				imageFormat = args[0]
+				return nil
+			case "webp":
+				return errors.New("webp is not supported: neither the standard library nor the packages gophernotes " +
+					"vendors can encode WebP images, use jpeg")
+			}
+			return fmt.Errorf("expected png or jpeg, got %q", args[0])
+		},
+		value: func() string { return imageFormat },
+	}
+	kernelOptions["image_quality"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) == 1 {
+				if quality, err := strconv.Atoi(args[0]); err == nil && quality >= 1 && quality <= 100 {
+					imageQuality = quality
+					return nil
+				}
+			}
+			return fmt.Errorf("expected a quality from 1 to 100, got %q", strings.Join(args, " "))
+		},
+		value: func() string { return strconv.Itoa(imageQuality) },
+	}
+	kernelOptions["image_convert_size"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a size such as 100KiB, got %q", strings.Join(args, " "))
+			}
+			size, err := parseByteSize(args[0])
+			if err != nil {
+				return err
+			}
+			imageConvertSize = size
+			return nil
+		},
+		value: func() string { return formatBytes(uintptr(imageConvertSize)) },
+	}
+	kernelOptions["image_max_dims"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) == 1 {
+				if dims, err := parseDims(args[0]); err == nil {
+					imageMaxDims = dims
+					return nil
+				}
+			}
+			return fmt.Errorf("expected dimensions such as 1024x768, or 0x0 for none, got %q", strings.Join(args, " "))
+		},
+		value: func() string { return fmt.Sprintf("%dx%d", imageMaxDims.X, imageMaxDims.Y) },
+	}
+}
+
+// parseDims parses dimensions written WxH.
+func parseDims(s string) (image.Point, error) {
+	i := strings.IndexByte(s, 'x')
+	if i < 0 {
+		return image.Point{}, fmt.Errorf("expected WxH, got %q", s)
+	}
+	w, err := strconv.Atoi(s[:i])
+	if err != nil || w < 0 {
+		return image.Point{}, fmt.Errorf("expected WxH, got %q", s)
+	}
+	h, err := strconv.Atoi(s[i+1:])
+	if err != nil || h < 0 {
+		return image.Point{}, fmt.Errorf("expected WxH, got %q", s)
+	}
+	return image.Point{w, h}, nil
+}
+
+// imageOptions are the options compressing the images of the outputs.
+type imageOptions struct {
+	format      string
+	quality     int
+	convertSize int
+	maxDims     image.Point
+}
+
+// currentImageOptions returns the image options set by %opt.
+func currentImageOptions() imageOptions {
+	return imageOptions{imageFormat, imageQuality, imageConvertSize, imageMaxDims}
+}
+
+// compressImages returns data with its images downscaled to opts.maxDims, and its PNG image converted to
+// opts.format if it is larger than opts.convertSize. data is returned unchanged if it has no such image, and
+// images which cannot be decoded are left as they are.
+func compressImages(data bundledMIMEData, opts imageOptions) bundledMIMEData {
+	var compressed bundledMIMEData
+	for _, mime := range []string{display.MIMETypePNG, display.MIMETypeJPEG} {
+		b, ok := data[mime].([]byte)
+		if !ok {
+			continue
+		}
+		convert := mime == display.MIMETypePNG && opts.format == "jpeg" && len(b) > opts.convertSize
+		img, _, err := image.Decode(bytes.NewReader(b))
+		if err != nil {
+			continue
+		}
+		size := img.Bounds().Size()
+		fitted := fitDims(size, opts.maxDims)
+		if !convert && fitted == size {
+			continue
+		}
+		if fitted != size {
+			img = resizeImage(img, fitted.X, fitted.Y)
+		}
+		format := mime
+		if convert {
+			format = display.MIMETypeJPEG
+			img = flattenImage(img)
+		}
+		encoded, err := encodeImage(img, format, opts.quality)
+		if err != nil {
+			continue
+		}
+
+		if compressed == nil {
+			compressed = make(bundledMIMEData, len(data))
+			for k, v := range data {
+				compressed[k] = v
+			}
+		}
+		delete(compressed, mime)
+		compressed[format] = encoded
+	}
+	if compressed == nil {
+		return data
+	}
+	return compressed
+}
+
+// fitDims returns size scaled down to fit max, keeping its aspect ratio. A zero dimension of max is not limited.
+func fitDims(size, max image.Point) image.Point {
+	scaled := size
+	if max.X > 0 && scaled.X > max.X {
+		scaled = image.Point{max.X, scaled.Y * max.X / scaled.X}
+	}
+	if max.Y > 0 && scaled.Y > max.Y {
+		scaled = image.Point{scaled.X * max.Y / scaled.Y, max.Y}
+	}
+	if scaled.X < 1 {
+		scaled.X = 1
+	}
+	if scaled.Y < 1 {
+		scaled.Y = 1
+	}
+	return scaled
+}
+
+// flattenImage returns img drawn over a white background, since JPEG images have no transparency.
+func flattenImage(img image.Image) image.Image {
+	flat := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flat
+}
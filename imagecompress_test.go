@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// TestFitDims tests scaling dimensions down to %opt image_max_dims.
+func TestFitDims(t *testing.T) {
+	cases := []struct {
+		size, max, want image.Point
+	}{
+		{image.Pt(800, 600), image.Pt(0, 0), image.Pt(800, 600)},
+		{image.Pt(800, 600), image.Pt(400, 0), image.Pt(400, 300)},
+		{image.Pt(800, 600), image.Pt(0, 300), image.Pt(400, 300)},
+		{image.Pt(800, 600), image.Pt(1000, 150), image.Pt(200, 150)},
+		{image.Pt(100, 50), image.Pt(400, 300), image.Pt(100, 50)},
+	}
+	for _, c := range cases {
+		if got := fitDims(c.size, c.max); got != c.want {
+			t.Errorf("\t%s fitDims(%v, %v) = %v, expected %v", failure, c.size, c.max, got, c.want)
+		}
+	}
+}
+
+// TestCompressImages tests converting large PNG images to JPEG and downscaling images.
+func TestCompressImages(t *testing.T) {
+	data := bundledMIMEData{
+		display.MIMETypePNG:  noiseImage(256),
+		display.MIMETypeText: "256x256 image",
+	}
+
+	if got := compressImages(data, imageOptions{"png", 85, 100 << 10, image.Point{}}); got[display.MIMETypePNG] == nil {
+		t.Errorf("\t%s Expected the image to be left unchanged with the default options", failure)
+	}
+
+	got := compressImages(data, imageOptions{"jpeg", 50, 100 << 10, image.Pt(128, 0)})
+	if _, ok := got[display.MIMETypePNG]; ok {
+		t.Errorf("\t%s Expected the PNG image to be converted", failure)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(got[display.MIMETypeJPEG].([]byte)))
+	if err != nil || img.Bounds().Size() != image.Pt(128, 128) {
+		t.Errorf("\t%s Expected a 128x128 JPEG image, got %v", failure, err)
+	}
+	if got[display.MIMETypeText] != "256x256 image" || data[display.MIMETypePNG] == nil {
+		t.Errorf("\t%s Expected the text and the original data to be unchanged", failure)
+	}
+
+	got = compressImages(data, imageOptions{"jpeg", 50, 1 << 20, image.Pt(64, 64)})
+	img, err = png.Decode(bytes.NewReader(got[display.MIMETypePNG].([]byte)))
+	if err != nil || img.Bounds().Size() != image.Pt(64, 64) {
+		t.Errorf("\t%s Expected a small PNG image downscaled to 64x64 but not converted, got %v", failure, err)
+	}
+}
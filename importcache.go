@@ -0,0 +1,167 @@
+//go:build linux && !android && !gccgo
+// +build linux,!android,!gccgo
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"plugin"
+	r "reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// importCacheKey returns the directory caching the bindings of the package with the given import path, along
+// with the entry describing them. The directory depends on the version of the package and on the Go version,
+// so that upgrading either invalidates the cache. Packages of the module cache are versioned by their module,
+// the others by their compiled package file. ok is false if the package is not installed.
+func importCacheKey(path string) (dir string, entry importCacheEntry, ok bool) {
+	pkg, err := build.Import(path, "", build.FindOnly)
+	if err != nil {
+		return "", entry, false
+	}
+
+	entry = importCacheEntry{Path: path, GoVersion: runtime.Version()}
+	if module, version, ok := moduleVersion(build.Default.GOPATH, pkg.Dir); ok {
+		entry.Module, entry.Version = module, version
+	} else if pkg.PkgObj == "" {
+		return "", entry, false
+	} else if info, err := os.Stat(pkg.PkgObj); err != nil {
+		return "", entry, false
+	} else {
+		entry.Version = fmt.Sprintf("devel-%d-%d", info.Size(), info.ModTime().UnixNano())
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		entry.Path, entry.Module, entry.Version, entry.GoVersion, runtime.GOOS, runtime.GOARCH}, "\n")))
+	return filepath.Join(importCacheDir(), hex.EncodeToString(sum[:12])), entry, true
+}
+
+// Try the plugins of the import cache, then compile a plugin, and interpret the source of the package when
+// the plugin cannot be built or loaded, e.g. because the package is not installed. Packages the interpreter
+// cannot run are compiled into an RPC server, and those using cgo skip interpreting.
+func init() {
+	importLoaders = []importLoader{
+		{"cached plugin", true, loadCachedPlugin},
+		{"plugin", true, compileImportPlugin},
+		{"source", false, interpretPackage},
+		{"rpc", true, loadRPCPackage},
+	}
+}
+
+// loadCachedPlugin loads the bindings of the package from the plugin compiled by an earlier session.
+func loadCachedPlugin(ir *classic.Interp, path string) (imports.Package, error) {
+	dir, _, ok := importCacheKey(path)
+	if !ok {
+		return imports.Package{}, errors.New("not installed")
+	}
+	pkg, err := loadImportPlugin(filepath.Join(dir, "plugin.so"))
+	if os.IsNotExist(err) {
+		return imports.Package{}, errors.New("not cached")
+	} else if err != nil {
+		log.Printf("Ignoring the cached bindings of %s: %v\n", path, err)
+		os.RemoveAll(dir)
+		return imports.Package{}, err
+	}
+	return pkg, nil
+}
+
+// compileImportPlugin has the interpreter generate the bindings of the package and compile them into a
+// plugin, which is then copied into the import cache.
+func compileImportPlugin(ir *classic.Interp, path string) (pkg imports.Package, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	ref := ir.ImportPackage(filepath.Base(path), path)
+	if ref == nil {
+		return imports.Package{}, errors.New("no bindings generated")
+	}
+
+	if dir, entry, ok := importCacheKey(path); ok {
+		if err := storeImport(path, dir, entry); err != nil {
+			log.Printf("Error caching the bindings of %s: %v\n", path, err)
+			os.RemoveAll(dir)
+		}
+	}
+	return ref.Package, nil
+}
+
+// loadImportPlugin loads the bindings compiled into the plugin file by the interpreter.
+func loadImportPlugin(file string) (imports.Package, error) {
+	if _, err := os.Stat(file); err != nil {
+		return imports.Package{}, err
+	}
+	p, err := plugin.Open(file)
+	if err != nil {
+		return imports.Package{}, err
+	}
+	sym, err := p.Lookup("Exports")
+	if err != nil {
+		return imports.Package{}, err
+	}
+	exports, ok := sym.(func() (map[string]r.Value, map[string]r.Type, map[string]r.Type, map[string]string, map[string][]string))
+	if !ok {
+		return imports.Package{}, fmt.Errorf("unexpected Exports function %T", sym)
+	}
+	binds, types, proxies, untypeds, wrappers := exports()
+	return imports.Package{
+		Binds:    binds,
+		Types:    types,
+		Proxies:  proxies,
+		Untypeds: untypeds,
+		Wrappers: wrappers,
+	}, nil
+}
+
+// storeImport copies the plugin compiled by the interpreter for the given import path into the import cache.
+func storeImport(path, dir string, entry importCacheEntry) error {
+	// The interpreter compiles the bindings of a/b/c into $GOPATH/src/gomacro_imports/a/b/c/c.so.
+	src := filepath.Join(gomacroGopath(), "src", "gomacro_imports", filepath.FromSlash(path), filepath.Base(path)+".so")
+
+	in, err := os.Open(src)
+	if os.IsNotExist(err) {
+		// The package exports nothing, so no plugin was compiled.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	out, err := os.Create(filepath.Join(dir, "plugin.so"))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	entry.Created = time.Now()
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "entry.json"), data, 0600)
+}
@@ -0,0 +1,13 @@
+//go:build !linux || android || gccgo
+// +build !linux android gccgo
+
+package main
+
+// Interpret the source of imported packages, as the interpreter cannot load plugins on this platform. Packages
+// the interpreter cannot run are compiled into an RPC server, and those using cgo skip interpreting.
+func init() {
+	importLoaders = []importLoader{
+		{"source", false, interpretPackage},
+		{"rpc", true, loadRPCPackage},
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// importLoader is a way of making the bindings of an imported package available to the interpreter. compiled
+// is set when the package runs compiled, which packages using cgo require.
+type importLoader struct {
+	name     string
+	compiled bool
+	load     func(ir *classic.Interp, path string) (imports.Package, error)
+}
+
+// importLoaders are the loaders supported by this platform, tried in order until one succeeds.
+var importLoaders []importLoader
+
+// cgoImports is set by `%cgo`: how the packages using cgo, directly or through a dependency outside of the
+// standard library, are imported. With "auto" the compiled loaders are tried in order, "rpc" always runs them
+// in a separate process, and "off" refuses them.
+var cgoImports = "auto"
+
+func init() {
+	lineMagics["cgo"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) == 0 {
+			fmt.Println(cgoImports)
+			return nil
+		}
+		if len(args) != 1 || args[0] != "auto" && args[0] != "rpc" && args[0] != "off" {
+			return fmt.Errorf("expected \"auto\", \"rpc\" or \"off\", got %q", strings.Join(args, " "))
+		}
+		cgoImports = args[0]
+		return nil
+	}
+}
+
+// importPackages makes the packages imported by decl available to the interpreter, so that evaluating decl
+// only binds their names. The interpreter does not support dot and blank imports, so they are done here: a
+// dot import binds the exported names of the package in the file scope, and a blank import only loads the
+// package, running its init functions. It returns the remaining imports for the interpreter, or nil if none.
+func importPackages(ir *classic.Interp, decl *ast.GenDecl) (*ast.GenDecl, error) {
+	rest := *decl
+	rest.Specs = nil
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ImportSpec)
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			rest.Specs = append(rest.Specs, spec)
+			continue
+		}
+		// The helper packages left out of the import set the kernel was built with are loaded by their full path.
+		if _, registered := imports.Packages[path]; !registered && helperPackages[path] != "" {
+			path = helperPackages[path]
+			spec.Path = &ast.BasicLit{ValuePos: spec.Path.Pos(), Kind: token.STRING, Value: strconv.Quote(path)}
+		}
+		if err := importPackage(ir, path); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case spec.Name == nil:
+			// The interpreter names the package after the last element of its path.
+			if name, ok := importNames[path]; ok {
+				spec.Name = &ast.Ident{NamePos: spec.Path.Pos(), Name: name}
+			}
+			rest.Specs = append(rest.Specs, spec)
+		case spec.Name.Name == ".":
+			ir.FileEnv().MergePackage(imports.Packages[path])
+		case spec.Name.Name != "_":
+			rest.Specs = append(rest.Specs, spec)
+		}
+	}
+	if len(rest.Specs) == 0 {
+		return nil, nil
+	}
+	return &rest, nil
+}
+
+// importPackage registers the bindings of the package with the given import path in imports.Packages, using
+// the first of importLoaders that succeeds.
+func importPackage(ir *classic.Interp, path string) error {
+	if _, ok := imports.Packages[path]; ok || path == "C" {
+		return nil
+	}
+
+	// The interpreter cannot run cgo, so such packages skip the loaders interpreting their source.
+	loaders := importLoaders
+	if usesCgo(path, make(map[string]bool)) {
+		loaders = nil
+		for _, loader := range importLoaders {
+			if loader.compiled && (cgoImports == "auto" || cgoImports == "rpc" && loader.name == "rpc") {
+				loaders = append(loaders, loader)
+			}
+		}
+		if len(loaders) == 0 {
+			return fmt.Errorf("cannot import %q: the package uses cgo, see %%cgo", path)
+		}
+	}
+
+	// The compiled loaders build the package of the GOPATH, so vendored packages are interpreted.
+	if _, ok := vendoredPackage(path); ok {
+		var interpreted []importLoader
+		for _, loader := range loaders {
+			if !loader.compiled {
+				interpreted = append(interpreted, loader)
+			}
+		}
+		if len(interpreted) == 0 {
+			return fmt.Errorf("cannot import %q: the vendored package uses cgo", path)
+		}
+		loaders = interpreted
+	}
+
+	var failures []string
+	for _, loader := range loaders {
+		pkg, err := loader.load(ir, path)
+		if err == nil {
+			imports.Packages[path] = pkg
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", loader.name, err))
+	}
+	return fmt.Errorf("cannot import %q (%s)", path, strings.Join(failures, "; "))
+}
+
+// usesCgo reports whether the package with the given import path, or one of its dependencies outside of the
+// standard library, has cgo files. seen holds the packages already visited.
+func usesCgo(path string, seen map[string]bool) bool {
+	if seen[path] || path == "C" {
+		return path == "C"
+	}
+	seen[path] = true
+	bpkg, err := importSource(path)
+	if err != nil || bpkg.Goroot {
+		return false
+	}
+	if len(bpkg.CgoFiles) > 0 {
+		return true
+	}
+	for _, dep := range bpkg.Imports {
+		if usesCgo(dep, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// interpretPackage evaluates the source of the package with the given import path in a separate interpreter
+// and returns its exported declarations. This is much slower than compiled bindings but works on every
+// platform, as long as the package does not use cgo.
+func interpretPackage(ir *classic.Interp, path string) (imports.Package, error) {
+	bpkg, err := importSource(path)
+	if err != nil {
+		return imports.Package{}, err
+	}
+	if len(bpkg.CgoFiles) > 0 {
+		return imports.Package{}, errors.New("the package uses cgo")
+	}
+	for _, dep := range bpkg.Imports {
+		if err := importPackage(ir, dep); err != nil {
+			return imports.Package{}, err
+		}
+	}
+
+	// Go allows package level declarations in any order, the interpreter evaluates them one at a time: declare
+	// the types, then the constants and functions, then initialize the variables and run the init functions.
+	var imps, types, consts, funcs, vars, inits []ast.Decl
+	fset := token.NewFileSet()
+	for _, name := range bpkg.GoFiles {
+		file, err := parser.ParseFile(fset, filepath.Join(bpkg.Dir, name), nil, 0)
+		if err != nil {
+			return imports.Package{}, err
+		}
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				switch decl.Tok {
+				case token.IMPORT:
+					imps = append(imps, decl)
+				case token.TYPE:
+					types = append(types, decl)
+				case token.CONST:
+					consts = append(consts, decl)
+				case token.VAR:
+					vars = append(vars, decl)
+				}
+			case *ast.FuncDecl:
+				if decl.Name.Name == "init" && decl.Recv == nil {
+					inits = append(inits, decl)
+				} else {
+					funcs = append(funcs, decl)
+				}
+			}
+		}
+	}
+
+	sub := classic.New()
+	sub.Stdout, sub.Stderr = ir.Stdout, ir.Stderr
+	eval := func(decl ast.Node) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s: %v", fset.Position(decl.Pos()), r)
+			}
+		}()
+		sub.EvalNode(decl)
+		return nil
+	}
+
+	// Imports are evaluated once per package: the interpreter has no file scope.
+	for _, decl := range imps {
+		rest, err := importPackages(sub, decl.(*ast.GenDecl))
+		if err != nil {
+			return imports.Package{}, err
+		}
+		if rest != nil {
+			if err := eval(rest); err != nil {
+				return imports.Package{}, err
+			}
+		}
+	}
+
+	// A type may refer to a type declared after it, so retry the failed declarations while some succeed.
+	for len(types) > 0 {
+		var failed []ast.Decl
+		var err error
+		for _, decl := range types {
+			if e := eval(decl); e != nil {
+				failed, err = append(failed, decl), e
+			}
+		}
+		if len(failed) == len(types) {
+			return imports.Package{}, err
+		}
+		types = failed
+	}
+
+	for _, decls := range [][]ast.Decl{consts, funcs, vars} {
+		for _, decl := range decls {
+			if err := eval(decl); err != nil {
+				return imports.Package{}, err
+			}
+		}
+	}
+	for _, decl := range inits {
+		fn := decl.(*ast.FuncDecl)
+		call := &ast.CallExpr{Fun: &ast.FuncLit{Type: fn.Type, Body: fn.Body}, Lparen: fn.Pos()}
+		if err := eval(call); err != nil {
+			return imports.Package{}, err
+		}
+	}
+
+	all := sub.Env.AsPackage()
+	pkg := imports.Package{}
+	pkg.Init()
+	for name, v := range all.Binds {
+		if ast.IsExported(name) {
+			pkg.Binds[name] = v
+		}
+	}
+	for name, t := range all.Types {
+		if ast.IsExported(name) {
+			pkg.Types[name] = t
+		}
+	}
+	return pkg, nil
+}
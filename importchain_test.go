@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+// TestInterpretPackage tests that packages which cannot be loaded as plugins are interpreted from source.
+func TestInterpretPackage(t *testing.T) {
+	files := map[string]string{
+		"greet.go": `package greet
+
+import (
+	"fmt"
+	"strings"
+)
+
+var Greeting = prefix + "hello"
+
+func Hello(p Person) string {
+	return fmt.Sprintf("%s, %s", Greeting, strings.ToUpper(p.Name))
+}
+
+func init() {
+	count++
+}
+`,
+		"person.go": `package greet
+
+const prefix = "> "
+
+type Person struct {
+	Name string
+	Home Place
+}
+
+type Place struct{ City string }
+
+var count int
+
+func Count() int { return count }
+`,
+	}
+	defer setTestGOPATH(t, map[string]map[string]string{"example.com/greet": files})()
+
+	vals, err := doEval(newInterp(), `import ("example.com/greet"; "fmt")
+greet.Hello(greet.Person{Name: "go"}) + fmt.Sprint(greet.Count())`)
+	if err != nil {
+		t.Fatalf("\t%s doEval: %s", failure, err)
+	}
+	if want := []interface{}{"> hello, GO1"}; !reflect.DeepEqual(vals, want) {
+		t.Errorf("\t%s Expected %v but got %v", failure, want, vals)
+	}
+
+	if _, err := doEval(newInterp(), `import "example.com/missing"`); err == nil {
+		t.Errorf("\t%s Importing a missing package did not fail", failure)
+	}
+}
+
+// setTestGOPATH makes the packages found by go/build those of a temporary GOPATH, holding the given source files
+// by import path. It returns a function restoring the GOPATH.
+func setTestGOPATH(t *testing.T, pkgs map[string]map[string]string) func() {
+	gopath, err := ioutil.TempDir("", "gopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, files := range pkgs {
+		dir := filepath.Join(gopath, "src", filepath.FromSlash(path))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for name, src := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	old := build.Default.GOPATH
+	build.Default.GOPATH = gopath
+	return func() {
+		build.Default.GOPATH = old
+		os.RemoveAll(gopath)
+	}
+}
+
+// TestImportCgo tests that the packages using cgo, directly or through a dependency, are only imported by the
+// compiled loaders allowed by %cgo.
+func TestImportCgo(t *testing.T) {
+	defer setTestGOPATH(t, map[string]map[string]string{
+		"example.com/sqlite": {"sqlite.go": "package sqlite\n\n// int version() { return 3; }\nimport \"C\"\n\nfunc Version() int { return int(C.version()) }\n"},
+		"example.com/store":  {"store.go": "package store\n\nimport \"example.com/sqlite\"\n\nvar Version = sqlite.Version()\n"},
+		"example.com/plain":  {"plain.go": "package plain\n\nimport \"os\"\n\nvar Args = os.Args\n"},
+	})()
+	for path, want := range map[string]bool{"example.com/sqlite": true, "example.com/store": true, "example.com/plain": false} {
+		if got := usesCgo(path, make(map[string]bool)); got != want {
+			t.Errorf("\t%s Expected usesCgo(%q) to be %v", failure, path, want)
+		}
+	}
+
+	var tried []string
+	loader := func(name string, compiled bool) importLoader {
+		return importLoader{name, compiled, func(ir *classic.Interp, path string) (imports.Package, error) {
+			tried = append(tried, name)
+			return imports.Package{}, errors.New("failed")
+		}}
+	}
+	oldLoaders, oldMode := importLoaders, cgoImports
+	defer func() { importLoaders, cgoImports = oldLoaders, oldMode }()
+	importLoaders = []importLoader{loader("plugin", true), loader("source", false), loader("rpc", true)}
+
+	for _, c := range []struct {
+		mode, path string
+		want       []string
+	}{
+		{"auto", "example.com/store", []string{"plugin", "rpc"}},
+		{"rpc", "example.com/sqlite", []string{"rpc"}},
+		{"off", "example.com/sqlite", nil},
+		{"off", "example.com/plain", []string{"plugin", "source", "rpc"}},
+	} {
+		tried, cgoImports = nil, c.mode
+		if err := importPackage(newInterp(), c.path); err == nil {
+			t.Errorf("\t%s Expected importing %q to fail", failure, c.path)
+		}
+		if !reflect.DeepEqual(tried, c.want) {
+			t.Errorf("\t%s Expected %%cgo %s to try %v for %q but tried %v", failure, c.mode, c.want, c.path, tried)
+		}
+	}
+}
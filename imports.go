@@ -0,0 +1,123 @@
+package main
+
+import (
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/imports"
+	"github.com/gopherdata/gophernotes/assert"
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+)
+
+// importNames maps the paths of the packages bundled with the kernel whose name is not the last element of their
+// path to their name.
+var importNames = make(map[string]string)
+
+// init makes the gophernotes helper packages importable from notebook cells, both by their full import
+// path and by their path within gophernotes (e.g. `import "notebook"` or `import "notebook/kube"`), and the
+// libraries bundled with them by their path. This is the minimal import set; imports_standard.go and
+// imports_full.go add the helpers built on larger libraries, selected by build tags.
+func init() {
+	registerPackage("github.com/gopherdata/gophernotes/assert", "assert", imports.Package{
+		Binds: map[string]r.Value{
+			"Equal":    r.ValueOf(assert.Equal),
+			"Error":    r.ValueOf(assert.Error),
+			"Format":   r.ValueOf(assert.Format),
+			"NoError":  r.ValueOf(assert.NoError),
+			"NotEqual": r.ValueOf(assert.NotEqual),
+			"Panics":   r.ValueOf(assert.Panics),
+			"True":     r.ValueOf(assert.True),
+		},
+		Types: map[string]r.Type{
+			"Failure": r.TypeOf((*assert.Failure)(nil)).Elem(),
+		},
+	})
+	registerPackage("github.com/gopherdata/gophernotes/display", "display", imports.Package{
+		Binds: map[string]r.Value{
+			"All":              r.ValueOf(display.All),
+			"Fraction":         r.ValueOf(display.Fraction),
+			"Graph":            r.ValueOf(display.Graph),
+			"Graphviz":         r.ValueOf(display.Graphviz),
+			"HTML":             r.ValueOf(display.HTML),
+			"HexDump":          r.ValueOf(display.HexDump),
+			"Image":            r.ValueOf(display.Image),
+			"JSON":             r.ValueOf(display.JSON),
+			"LinePlot":         r.ValueOf(display.LinePlot),
+			"MIMETypeArrow":    r.ValueOf(display.MIMETypeArrow),
+			"MIMETypeGIF":      r.ValueOf(display.MIMETypeGIF),
+			"MIMETypeHTML":     r.ValueOf(display.MIMETypeHTML),
+			"MIMETypeJPEG":     r.ValueOf(display.MIMETypeJPEG),
+			"MIMETypeJSON":     r.ValueOf(display.MIMETypeJSON),
+			"MIMETypeLaTeX":    r.ValueOf(display.MIMETypeLaTeX),
+			"MIMETypeMarkdown": r.ValueOf(display.MIMETypeMarkdown),
+			"MIMETypeMermaid":  r.ValueOf(display.MIMETypeMermaid),
+			"MIMETypePNG":      r.ValueOf(display.MIMETypePNG),
+			"MIMETypeSVG":      r.ValueOf(display.MIMETypeSVG),
+			"MIMETypeText":     r.ValueOf(display.MIMETypeText),
+			"MIMETypeWebP":     r.ValueOf(display.MIMETypeWebP),
+			"Markdown":         r.ValueOf(display.Markdown),
+			"Math":             r.ValueOf(display.Math),
+			"MathMatrix":       r.ValueOf(display.MathMatrix),
+			"Mermaid":          r.ValueOf(display.Mermaid),
+			"NewDiagram":       r.ValueOf(display.NewDiagram),
+			"Polynomial":       r.ValueOf(display.Polynomial),
+			"Register":         r.ValueOf(display.Register),
+			"RegisterKind":     r.ValueOf(display.RegisterKind),
+			"Render":           r.ValueOf(display.Render),
+			"Rows":             r.ValueOf(display.Rows),
+			"SVG":              r.ValueOf(display.SVG),
+			"SniffImage":       r.ValueOf(display.SniffImage),
+			"Sparkline":        r.ValueOf(display.Sparkline),
+			"Table":            r.ValueOf(display.Table),
+			"TextPlot":         r.ValueOf(display.TextPlot),
+		},
+		Types: map[string]r.Type{
+			"Data":      r.TypeOf((*display.Data)(nil)).Elem(),
+			"Diagram":   r.TypeOf((*display.Diagram)(nil)).Elem(),
+			"Matrix":    r.TypeOf((*display.Matrix)(nil)).Elem(),
+			"Renderer":  r.TypeOf((*display.Renderer)(nil)).Elem(),
+			"Unsampled": r.TypeOf((*display.Unsampled)(nil)).Elem(),
+		},
+	})
+	registerPackage("github.com/gopherdata/gophernotes/notebook", "notebook", imports.Package{
+		Binds: map[string]r.Value{
+			"Active":          r.ValueOf(notebook.Active),
+			"Context":         r.ValueOf(notebook.Context),
+			"Delete":          r.ValueOf(notebook.Delete),
+			"Display":         r.ValueOf(notebook.Display),
+			"ErrNoKernel":     r.ValueOf(&notebook.ErrNoKernel).Elem(),
+			"Interact":        r.ValueOf(notebook.Interact),
+			"Live":            r.ValueOf(notebook.Live),
+			"Reactive":        r.ValueOf(notebook.Reactive),
+			"Reader":          r.ValueOf(notebook.Reader),
+			"Recv":            r.ValueOf(notebook.Recv),
+			"SetControlValue": r.ValueOf(notebook.SetControlValue),
+			"Sleep":           r.ValueOf(notebook.Sleep),
+			"Tick":            r.ValueOf(notebook.Tick),
+		},
+		Types: map[string]r.Type{
+			"CapturedOutput": r.TypeOf((*notebook.CapturedOutput)(nil)).Elem(),
+			"Control":        r.TypeOf((*notebook.Control)(nil)).Elem(),
+			"Dropdown":       r.TypeOf((*notebook.Dropdown)(nil)).Elem(),
+			"Slider":         r.TypeOf((*notebook.Slider)(nil)).Elem(),
+		},
+	})
+}
+
+// registerPackage adds pkg to the packages that interpreted code can import, under path and under alias unless
+// it is empty.
+func registerPackage(path, alias string, pkg imports.Package) {
+	if pkg.Proxies == nil {
+		pkg.Proxies = make(map[string]r.Type)
+	}
+	if pkg.Untypeds == nil {
+		pkg.Untypeds = make(map[string]string)
+	}
+	if pkg.Wrappers == nil {
+		pkg.Wrappers = make(map[string][]string)
+	}
+	imports.Packages[path] = pkg
+	if alias != "" {
+		imports.Packages[alias] = pkg
+	}
+}
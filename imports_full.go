@@ -0,0 +1,149 @@
+//go:build gophernotes_full
+// +build gophernotes_full
+
+package main
+
+import (
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/imports"
+	"github.com/gopherdata/gophernotes/notebook/grpcclient"
+	"github.com/gopherdata/gophernotes/notebook/kube"
+	"github.com/gopherdata/gophernotes/notebook/stream"
+	"github.com/nats-io/nats.go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// init registers the full import set, added by the gophernotes_full build tag: the gRPC, Kubernetes and
+// streaming helpers, and the libraries they are built on.
+func init() {
+	registerPackage("github.com/gopherdata/gophernotes/notebook/grpcclient", "notebook/grpcclient", imports.Package{
+		Binds: map[string]r.Value{
+			"Dial": r.ValueOf(grpcclient.Dial),
+		},
+		Types: map[string]r.Type{
+			"Client": r.TypeOf((*grpcclient.Client)(nil)).Elem(),
+		},
+	})
+	registerPackage("github.com/gopherdata/gophernotes/notebook/kube", "notebook/kube", imports.Package{
+		Binds: map[string]r.Value{
+			"Dial": r.ValueOf(kube.Dial),
+		},
+		Types: map[string]r.Type{
+			"Client": r.TypeOf((*kube.Client)(nil)).Elem(),
+		},
+	})
+	registerPackage("github.com/gopherdata/gophernotes/notebook/stream", "notebook/stream", imports.Package{
+		Binds: map[string]r.Value{
+			"Consume": r.ValueOf(stream.Consume),
+		},
+		Types: map[string]r.Type{
+			"Consumer": r.TypeOf((*stream.Consumer)(nil)).Elem(),
+			"Message":  r.TypeOf((*stream.Message)(nil)).Elem(),
+		},
+	})
+
+	// The libraries the helpers are built on, importable by their path only.
+	importNames["github.com/nats-io/nats.go"] = "nats"
+	registerPackage("github.com/nats-io/nats.go", "", imports.Package{
+		Binds: map[string]r.Value{
+			"Connect":    r.ValueOf(nats.Connect),
+			"DefaultURL": r.ValueOf(nats.DefaultURL),
+			"ErrTimeout": r.ValueOf(&nats.ErrTimeout).Elem(),
+			"Name":       r.ValueOf(nats.Name),
+			"Secure":     r.ValueOf(nats.Secure),
+			"Timeout":    r.ValueOf(nats.Timeout),
+			"Token":      r.ValueOf(nats.Token),
+			"UserInfo":   r.ValueOf(nats.UserInfo),
+		},
+		Types: map[string]r.Type{
+			"Conn":         r.TypeOf((*nats.Conn)(nil)).Elem(),
+			"Msg":          r.TypeOf((*nats.Msg)(nil)).Elem(),
+			"Option":       r.TypeOf((*nats.Option)(nil)).Elem(),
+			"Subscription": r.TypeOf((*nats.Subscription)(nil)).Elem(),
+		},
+	})
+	registerPackage("github.com/twmb/franz-go/pkg/kgo", "", imports.Package{
+		Binds: map[string]r.Value{
+			"ClientID":            r.ValueOf(kgo.ClientID),
+			"ConsumeResetOffset":  r.ValueOf(kgo.ConsumeResetOffset),
+			"ConsumeTopics":       r.ValueOf(kgo.ConsumeTopics),
+			"ConsumerGroup":       r.ValueOf(kgo.ConsumerGroup),
+			"DefaultProduceTopic": r.ValueOf(kgo.DefaultProduceTopic),
+			"DialTLSConfig":       r.ValueOf(kgo.DialTLSConfig),
+			"KeyStringRecord":     r.ValueOf(kgo.KeyStringRecord),
+			"NewClient":           r.ValueOf(kgo.NewClient),
+			"NewOffset":           r.ValueOf(kgo.NewOffset),
+			"SASL":                r.ValueOf(kgo.SASL),
+			"SeedBrokers":         r.ValueOf(kgo.SeedBrokers),
+			"StringRecord":        r.ValueOf(kgo.StringRecord),
+		},
+		Types: map[string]r.Type{
+			"Client":  r.TypeOf((*kgo.Client)(nil)).Elem(),
+			"Fetches": r.TypeOf((*kgo.Fetches)(nil)).Elem(),
+			"Offset":  r.TypeOf((*kgo.Offset)(nil)).Elem(),
+			"Opt":     r.TypeOf((*kgo.Opt)(nil)).Elem(),
+			"Record":  r.TypeOf((*kgo.Record)(nil)).Elem(),
+		},
+	})
+	// The types of the Kubernetes objects most used when investigating a cluster with kube.Client.
+	registerPackage("k8s.io/api/apps/v1", "", imports.Package{
+		Types: map[string]r.Type{
+			"DaemonSet":       r.TypeOf((*appsv1.DaemonSet)(nil)).Elem(),
+			"DaemonSetList":   r.TypeOf((*appsv1.DaemonSetList)(nil)).Elem(),
+			"Deployment":      r.TypeOf((*appsv1.Deployment)(nil)).Elem(),
+			"DeploymentList":  r.TypeOf((*appsv1.DeploymentList)(nil)).Elem(),
+			"ReplicaSet":      r.TypeOf((*appsv1.ReplicaSet)(nil)).Elem(),
+			"ReplicaSetList":  r.TypeOf((*appsv1.ReplicaSetList)(nil)).Elem(),
+			"StatefulSet":     r.TypeOf((*appsv1.StatefulSet)(nil)).Elem(),
+			"StatefulSetList": r.TypeOf((*appsv1.StatefulSetList)(nil)).Elem(),
+		},
+	})
+	registerPackage("k8s.io/api/core/v1", "", imports.Package{
+		Binds: map[string]r.Value{
+			"PodFailed":    r.ValueOf(corev1.PodFailed),
+			"PodPending":   r.ValueOf(corev1.PodPending),
+			"PodRunning":   r.ValueOf(corev1.PodRunning),
+			"PodSucceeded": r.ValueOf(corev1.PodSucceeded),
+			"PodUnknown":   r.ValueOf(corev1.PodUnknown),
+		},
+		Types: map[string]r.Type{
+			"ConfigMap":       r.TypeOf((*corev1.ConfigMap)(nil)).Elem(),
+			"ConfigMapList":   r.TypeOf((*corev1.ConfigMapList)(nil)).Elem(),
+			"Container":       r.TypeOf((*corev1.Container)(nil)).Elem(),
+			"ContainerStatus": r.TypeOf((*corev1.ContainerStatus)(nil)).Elem(),
+			"Event":           r.TypeOf((*corev1.Event)(nil)).Elem(),
+			"EventList":       r.TypeOf((*corev1.EventList)(nil)).Elem(),
+			"Namespace":       r.TypeOf((*corev1.Namespace)(nil)).Elem(),
+			"NamespaceList":   r.TypeOf((*corev1.NamespaceList)(nil)).Elem(),
+			"Node":            r.TypeOf((*corev1.Node)(nil)).Elem(),
+			"NodeList":        r.TypeOf((*corev1.NodeList)(nil)).Elem(),
+			"Pod":             r.TypeOf((*corev1.Pod)(nil)).Elem(),
+			"PodList":         r.TypeOf((*corev1.PodList)(nil)).Elem(),
+			"PodLogOptions":   r.TypeOf((*corev1.PodLogOptions)(nil)).Elem(),
+			"PodPhase":        r.TypeOf((*corev1.PodPhase)(nil)).Elem(),
+			"PodSpec":         r.TypeOf((*corev1.PodSpec)(nil)).Elem(),
+			"PodStatus":       r.TypeOf((*corev1.PodStatus)(nil)).Elem(),
+			"Secret":          r.TypeOf((*corev1.Secret)(nil)).Elem(),
+			"SecretList":      r.TypeOf((*corev1.SecretList)(nil)).Elem(),
+			"Service":         r.TypeOf((*corev1.Service)(nil)).Elem(),
+			"ServiceList":     r.TypeOf((*corev1.ServiceList)(nil)).Elem(),
+		},
+	})
+	registerPackage("k8s.io/apimachinery/pkg/apis/meta/v1", "", imports.Package{
+		Binds: map[string]r.Value{
+			"Now": r.ValueOf(metav1.Now),
+		},
+		Types: map[string]r.Type{
+			"DeleteOptions": r.TypeOf((*metav1.DeleteOptions)(nil)).Elem(),
+			"GetOptions":    r.TypeOf((*metav1.GetOptions)(nil)).Elem(),
+			"LabelSelector": r.TypeOf((*metav1.LabelSelector)(nil)).Elem(),
+			"ListOptions":   r.TypeOf((*metav1.ListOptions)(nil)).Elem(),
+			"ObjectMeta":    r.TypeOf((*metav1.ObjectMeta)(nil)).Elem(),
+			"Time":          r.TypeOf((*metav1.Time)(nil)).Elem(),
+		},
+	})
+}
@@ -0,0 +1,28 @@
+//go:build gophernotes_full
+// +build gophernotes_full
+
+package main
+
+import (
+	"testing"
+)
+
+// TestFullLibraryImports tests importing the libraries of the full import set from a cell.
+func TestFullLibraryImports(t *testing.T) {
+	cases := []struct {
+		cell string
+		want interface{}
+	}{
+		{"import \"github.com/nats-io/nats.go\"\nnats.DefaultURL", "nats://127.0.0.1:4222"},
+		{"import \"github.com/twmb/franz-go/pkg/kgo\"\nkgo.StringRecord(\"hello\").Value[0]", byte('h')},
+		{"import corev1 \"k8s.io/api/core/v1\"\nvar pod corev1.Pod\npod.Status.Phase = corev1.PodRunning\nstring(pod.Status.Phase)", "Running"},
+		{"import metav1 \"k8s.io/apimachinery/pkg/apis/meta/v1\"\nmetav1.ListOptions{LabelSelector: \"app=web\"}.LabelSelector", "app=web"},
+	}
+	for _, c := range cases {
+		ir := newInterp()
+		vals, err := doEval(ir, c.cell)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v from\n%s\nbut got %v, %v", failure, c.want, c.cell, vals, err)
+		}
+	}
+}
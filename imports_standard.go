@@ -0,0 +1,78 @@
+//go:build !gophernotes_minimal || gophernotes_full
+// +build !gophernotes_minimal gophernotes_full
+
+package main
+
+import (
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/imports"
+	"github.com/gopherdata/gophernotes/display/arrow"
+	"github.com/gopherdata/gophernotes/notebook/tables"
+	"github.com/parquet-go/parquet-go"
+	"github.com/xuri/excelize/v2"
+)
+
+// init registers the standard import set, left out by the gophernotes_minimal build tag: the helpers for
+// tables, whose import also sends the results of cells that are slices of structs as Arrow tables, and the
+// libraries they are built on.
+func init() {
+	registerPackage("github.com/gopherdata/gophernotes/display/arrow", "display/arrow", imports.Package{
+		Binds: map[string]r.Value{
+			"File":      r.ValueOf(arrow.File),
+			"WriteFile": r.ValueOf(arrow.WriteFile),
+		},
+	})
+	registerPackage("github.com/gopherdata/gophernotes/notebook/tables", "notebook/tables", imports.Package{
+		Binds: map[string]r.Value{
+			"ReadExcel":    r.ValueOf(tables.ReadExcel),
+			"ReadParquet":  r.ValueOf(tables.ReadParquet),
+			"WriteExcel":   r.ValueOf(tables.WriteExcel),
+			"WriteParquet": r.ValueOf(tables.WriteParquet),
+		},
+	})
+
+	// The libraries the helpers are built on, importable by their path only.
+	importNames["github.com/parquet-go/parquet-go"] = "parquet"
+	registerPackage("github.com/parquet-go/parquet-go", "", imports.Package{
+		Binds: map[string]r.Value{
+			"Compression": r.ValueOf(parquet.Compression),
+			"CreatedBy":   r.ValueOf(parquet.CreatedBy),
+			"Gzip":        r.ValueOf(&parquet.Gzip).Elem(),
+			"NewReader":   r.ValueOf(parquet.NewReader),
+			"NewSchema":   r.ValueOf(parquet.NewSchema),
+			"NewWriter":   r.ValueOf(parquet.NewWriter),
+			"OpenFile":    r.ValueOf(parquet.OpenFile),
+			"SchemaOf":    r.ValueOf(parquet.SchemaOf),
+			"Snappy":      r.ValueOf(&parquet.Snappy).Elem(),
+			"Zstd":        r.ValueOf(&parquet.Zstd).Elem(),
+		},
+		Types: map[string]r.Type{
+			"File":     r.TypeOf((*parquet.File)(nil)).Elem(),
+			"Reader":   r.TypeOf((*parquet.Reader)(nil)).Elem(),
+			"Row":      r.TypeOf((*parquet.Row)(nil)).Elem(),
+			"RowGroup": r.TypeOf((*parquet.RowGroup)(nil)).Elem(),
+			"Schema":   r.TypeOf((*parquet.Schema)(nil)).Elem(),
+			"Value":    r.TypeOf((*parquet.Value)(nil)).Elem(),
+			"Writer":   r.TypeOf((*parquet.Writer)(nil)).Elem(),
+		},
+	})
+	importNames["github.com/xuri/excelize/v2"] = "excelize"
+	registerPackage("github.com/xuri/excelize/v2", "", imports.Package{
+		Binds: map[string]r.Value{
+			"CellNameToCoordinates": r.ValueOf(excelize.CellNameToCoordinates),
+			"ColumnNameToNumber":    r.ValueOf(excelize.ColumnNameToNumber),
+			"ColumnNumberToName":    r.ValueOf(excelize.ColumnNumberToName),
+			"CoordinatesToCellName": r.ValueOf(excelize.CoordinatesToCellName),
+			"NewFile":               r.ValueOf(excelize.NewFile),
+			"OpenFile":              r.ValueOf(excelize.OpenFile),
+			"OpenReader":            r.ValueOf(excelize.OpenReader),
+		},
+		Types: map[string]r.Type{
+			"File":    r.TypeOf((*excelize.File)(nil)).Elem(),
+			"Options": r.TypeOf((*excelize.Options)(nil)).Elem(),
+			"Rows":    r.TypeOf((*excelize.Rows)(nil)).Elem(),
+			"Style":   r.TypeOf((*excelize.Style)(nil)).Elem(),
+		},
+	})
+}
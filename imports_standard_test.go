@@ -0,0 +1,27 @@
+//go:build !gophernotes_minimal || gophernotes_full
+// +build !gophernotes_minimal gophernotes_full
+
+package main
+
+import (
+	"testing"
+)
+
+// TestLibraryImports tests importing the libraries of the standard import set from a cell.
+func TestLibraryImports(t *testing.T) {
+	cases := []struct {
+		cell string
+		want interface{}
+	}{
+		{"import \"github.com/xuri/excelize/v2\"\nname, _ := excelize.CoordinatesToCellName(2, 3)\nname", "B3"},
+		{"import \"display/arrow\"\ntype row struct{ N int }\nfile, _ := arrow.File([]row{row{N: 1}})\nlen(file) > 0", true},
+		{"import \"github.com/parquet-go/parquet-go\"\nparquet.SchemaOf(struct{ Name string }{}).Columns()[0][0]", "Name"},
+	}
+	for _, c := range cases {
+		ir := newInterp()
+		vals, err := doEval(ir, c.cell)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v from\n%s\nbut got %v, %v", failure, c.want, c.cell, vals, err)
+		}
+	}
+}
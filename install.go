@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// goEnvVars are the environment variables of the go command and of the network that the import pipeline
+// depends on, and those of gophernotes, captured into kernel specs by `gophernotes install -capture`.
+var goEnvVars = []string{
+	"GOPATH", "GOROOT", "GOFLAGS", "GO111MODULE", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOSUMDB",
+	"GOINSECURE", "GOMODCACHE", "GOAUTH", "NETRC", "GOPHERNOTES_CACHE", "GOPHERNOTES_OFFLINE", "GOPHERNOTES_AUDIT",
+	"GOPHERNOTES_SHARED", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+}
+
+// kernelSpec is the kernel.json file describing how Jupyter starts a kernel.
+type kernelSpec struct {
+	Argv        []string          `json:"argv"`
+	DisplayName string            `json:"display_name"`
+	Language    string            `json:"language"`
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+// installCommand implements `gophernotes install [-name name] [-display-name name] [-dir dir] [-capture]
+// [-env name=value]...`, which installs a kernel spec running this executable. Kernel specs with different names
+// and environments can be installed side by side, e.g. one per GOPATH or with the GOPRIVATE settings of a
+// company.
+func installCommand(args []string) error {
+	var env paramsFlag
+
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	name := flags.String("name", "gophernotes", "the `name` of the kernel spec directory")
+	displayName := flags.String("display-name", "Go", "the `name` of the kernel shown by the front-ends")
+	dir := flags.String("dir", "", "the kernels `directory` (default: the kernels directory of the Jupyter data directory)")
+	capture := flags.Bool("capture", false, "store the current values of the go environment variables, like GOPATH and GOPRIVATE")
+	flags.Var(&env, "env", "set the environment variable `name=value` of the kernel (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gophernotes install [-name name] [-display-name name] [-dir dir] [-capture] [-env name=value]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return errors.New("install: unexpected arguments")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	spec := newKernelSpec(exe, *displayName, *capture, env)
+
+	if *dir == "" {
+		*dir = filepath.Join(jupyterDataDir(), "kernels")
+	}
+	path, err := writeKernelSpec(filepath.Join(*dir, *name), spec)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Installed the kernel spec %q in %s", *displayName, path)
+	if len(spec.Env) > 0 {
+		fmt.Print(" with the environment:")
+		names := make([]string, 0, len(spec.Env))
+		for name := range spec.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("\n\t%s=%s", name, spec.Env[name])
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// newKernelSpec returns the kernel spec running the executable exe. With capture set, its environment holds
+// the values of goEnvVars set in the current environment, then the name=value settings of env.
+func newKernelSpec(exe, displayName string, capture bool, env []string) kernelSpec {
+	spec := kernelSpec{
+		Argv:        []string{exe, "{connection_file}"},
+		DisplayName: displayName,
+		Language:    "go",
+		Env:         make(map[string]string),
+	}
+	if capture {
+		for _, name := range goEnvVars {
+			if value, ok := os.LookupEnv(name); ok {
+				spec.Env[name] = value
+			}
+		}
+	}
+	for _, setting := range env {
+		i := strings.IndexByte(setting, '=')
+		spec.Env[setting[:i]] = setting[i+1:]
+	}
+	return spec
+}
+
+// writeKernelSpec writes spec as the kernel.json file of the directory dir, along with the logos of the kernel
+// when they are found next to the sources of gophernotes, and returns the path of the file.
+func writeKernelSpec(dir string, spec kernelSpec) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "kernel.json")
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+
+	for _, gopath := range filepath.SplitList(os.Getenv("GOPATH")) {
+		src := filepath.Join(gopath, "src", "github.com", "gopherdata", "gophernotes", "kernel")
+		for _, logo := range []string{"logo-32x32.png", "logo-64x64.png"} {
+			if data, err := ioutil.ReadFile(filepath.Join(src, logo)); err == nil {
+				ioutil.WriteFile(filepath.Join(dir, logo), data, 0644)
+			}
+		}
+	}
+	return path, nil
+}
+
+// jupyterDataDir returns the data directory of Jupyter, $JUPYTER_DATA_DIR or the default of the platform.
+func jupyterDataDir() string {
+	if dir := os.Getenv("JUPYTER_DATA_DIR"); dir != "" {
+		return dir
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(os.Getenv("HOME"), "Library", "Jupyter")
+	case "windows":
+		return filepath.Join(os.Getenv("APPDATA"), "jupyter")
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "jupyter")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share", "jupyter")
+}
+
+// expandGoEnv expands the references to other variables, like $HOME, and a leading ~ in the values of
+// goEnvVars, which the kernel specs may set unexpanded since Jupyter passes them as they are. The go command
+// and the interpreter building the plugins of imported packages thus see the directories meant.
+func expandGoEnv() {
+	home := os.Getenv("HOME")
+	if runtime.GOOS == "windows" {
+		home = os.Getenv("USERPROFILE")
+	}
+	for _, name := range goEnvVars {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		expanded := os.ExpandEnv(value)
+		if home != "" {
+			list := filepath.SplitList(expanded)
+			for i, dir := range list {
+				if dir == "~" || strings.HasPrefix(dir, "~/") {
+					list[i] = home + dir[1:]
+				}
+			}
+			expanded = strings.Join(list, string(os.PathListSeparator))
+		}
+		if expanded != value {
+			os.Setenv(name, expanded)
+		}
+	}
+
+	// The default build context read them on startup.
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		build.Default.GOPATH = gopath
+	}
+	if goroot := os.Getenv("GOROOT"); goroot != "" {
+		build.Default.GOROOT = goroot
+	}
+}
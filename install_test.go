@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestInstallKernelSpec tests writing kernel specs with the captured go environment and explicit settings.
+func TestInstallKernelSpec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes-install")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer os.Setenv("GOPRIVATE", os.Getenv("GOPRIVATE"))
+	os.Setenv("GOPRIVATE", "corp.example.com/*")
+
+	spec := newKernelSpec("/usr/bin/gophernotes", "Go (corp)", true, []string{"GOFLAGS=-mod=mod", "GOPRIVATE=git.corp/*"})
+	path, err := writeKernelSpec(filepath.Join(dir, "go-corp"), spec)
+	if err != nil {
+		t.Fatalf("\t%s writeKernelSpec: %v", failure, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got kernelSpec
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("\t%s Expected %s to hold JSON: %v", failure, path, err)
+	}
+	if want := []string{"/usr/bin/gophernotes", "{connection_file}"}; !reflect.DeepEqual(got.Argv, want) {
+		t.Errorf("\t%s Expected argv %q but got %q", failure, want, got.Argv)
+	}
+	if got.Env["GOPRIVATE"] != "git.corp/*" || got.Env["GOFLAGS"] != "-mod=mod" {
+		t.Errorf("\t%s Expected the explicit settings to override the captured ones, got %v", failure, got.Env)
+	}
+	if gopath, ok := os.LookupEnv("GOPATH"); ok && got.Env["GOPATH"] != gopath {
+		t.Errorf("\t%s Expected GOPATH=%s to be captured, got %v", failure, gopath, got.Env)
+	}
+}
+
+// TestExpandGoEnv tests expanding the variables and home directories in the go environment set by kernel specs.
+func TestExpandGoEnv(t *testing.T) {
+	gopath, goprivate, home := os.Getenv("GOPATH"), os.Getenv("GOPRIVATE"), os.Getenv("HOME")
+	defaultGopath := build.Default.GOPATH
+	defer func() {
+		os.Setenv("GOPATH", gopath)
+		os.Setenv("GOPRIVATE", goprivate)
+		os.Setenv("HOME", home)
+		build.Default.GOPATH = defaultGopath
+	}()
+
+	os.Setenv("HOME", "/home/gopher")
+	os.Setenv("GOPATH", "~/go"+string(os.PathListSeparator)+"$HOME/work")
+	os.Setenv("GOPRIVATE", "corp.example.com/*")
+	expandGoEnv()
+
+	want := "/home/gopher/go" + string(os.PathListSeparator) + "/home/gopher/work"
+	if got := os.Getenv("GOPATH"); got != want || build.Default.GOPATH != want {
+		t.Errorf("\t%s Expected GOPATH %q but got %q (build context: %q)", failure, want, got, build.Default.GOPATH)
+	}
+	if got := os.Getenv("GOPRIVATE"); got != "corp.example.com/*" {
+		t.Errorf("\t%s Expected GOPRIVATE to be left alone but got %q", failure, got)
+	}
+}
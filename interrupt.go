@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"go/ast"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	r "reflect"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+	"github.com/gopherdata/gophernotes/notebook"
+)
+
+// init replaces the bindings of commonly used blocking functions with versions that return early when the
+// cell calling them is interrupted, since the interpreter cannot stop a cell blocked in them. Called from a
+// goroutine a cell left running, they return early only when that cell is interrupted, which it no longer can
+// be once it completed.
+func init() {
+	imports.Packages["time"].Binds["Sleep"] = r.ValueOf(func(d time.Duration) {
+		notebook.Sleep(d)
+	})
+
+	imports.Packages["net"].Binds["Dial"] = r.ValueOf(func(network, address string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(notebook.Context(), network, address)
+	})
+	imports.Packages["net"].Binds["DialTimeout"] = r.ValueOf(func(network, address string, timeout time.Duration) (net.Conn, error) {
+		dialer := net.Dialer{Timeout: timeout}
+		return dialer.DialContext(notebook.Context(), network, address)
+	})
+
+	imports.Packages["net/http"].Binds["Get"] = r.ValueOf(func(url string) (*http.Response, error) {
+		return doHTTP(http.NewRequest(http.MethodGet, url, nil))
+	})
+	imports.Packages["net/http"].Binds["Head"] = r.ValueOf(func(url string) (*http.Response, error) {
+		return doHTTP(http.NewRequest(http.MethodHead, url, nil))
+	})
+	imports.Packages["net/http"].Binds["Post"] = r.ValueOf(func(url, contentType string, body io.Reader) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPost, url, body)
+		if err == nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return doHTTP(req, err)
+	})
+	imports.Packages["net/http"].Binds["PostForm"] = r.ValueOf(func(rawURL string, data url.Values) (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodPost, rawURL, strings.NewReader(data.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		return doHTTP(req, err)
+	})
+
+	imports.Packages["bufio"].Binds["NewReader"] = r.ValueOf(func(rd io.Reader) *bufio.Reader {
+		return bufio.NewReader(interruptibleStdin(rd))
+	})
+	imports.Packages["bufio"].Binds["NewScanner"] = r.ValueOf(func(rd io.Reader) *bufio.Scanner {
+		return bufio.NewScanner(interruptibleStdin(rd))
+	})
+}
+
+// doHTTP sends req with the default client, like the http.Get family of functions, cancelling it when the
+// cell is interrupted. It takes the results of http.NewRequest.
+func doHTTP(req *http.Request, err error) (*http.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req.WithContext(notebook.Context()))
+}
+
+// interruptibleStdin wraps rd with notebook.Reader when it is the standard input.
+func interruptibleStdin(rd io.Reader) io.Reader {
+	if f, ok := rd.(*os.File); ok && f == os.Stdin {
+		return notebook.Reader(rd)
+	}
+	return rd
+}
+
+// handleInterrupts interrupts the cell being executed whenever the kernel receives SIGINT, which front-ends
+// send to interrupt the kernel. The interpreter cannot stop a running cell, so the cell only stops early at the
+// next iteration of one of its loops, or when it waits in one of the functions above, in notebook.Sleep,
+// notebook.Tick, notebook.Recv or on notebook.Context(). A cell still running when interrupted again, e.g. in
+// a long call of a compiled package, is terminated along with the kernel, as SIGINT does by default, and the
+// front-end restarts the kernel.
+func handleInterrupts() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	go func() {
+		for range interrupts {
+			if hooks.interrupt() {
+				log.Println("the cell did not stop since it was interrupted, exiting")
+				signal.Reset(os.Interrupt)
+				p, err := os.FindProcess(os.Getpid())
+				if err == nil {
+					err = p.Signal(os.Interrupt)
+				}
+				if err != nil {
+					os.Exit(130)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// stopCheckFuncName is the name of the function called first by each iteration of the loops of the cells, to
+// stop them when their cell is interrupted or times out.
+const stopCheckFuncName = "__gophernotesCheckStop"
+
+// stopLoops instruments the loops of nodes so that they panic once the cell running them is interrupted or
+// times out, even when they do not wait for anything, like `for {}`.
+func stopLoops(ir *classic.Interp, nodes []ast.Node) {
+	defineStopCheck(ir, hooks.currentExecution())
+
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			var body *ast.BlockStmt
+			switch n := n.(type) {
+			case *ast.ForStmt:
+				body = n.Body
+			case *ast.RangeStmt:
+				body = n.Body
+			}
+			if body != nil {
+				call := &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent(stopCheckFuncName)}}
+				body.List = append([]ast.Stmt{call}, body.List...)
+			}
+			return true
+		})
+	}
+}
+
+// defineStopCheck binds the function called by the loops of the session to the check of execution, so that they
+// stop when it is interrupted or times out, even those of functions declared by earlier cells.
+func defineStopCheck(ir *classic.Interp, execution *cellExecution) {
+	check := stopCheck(execution)
+	ir.Env.DefineVar(stopCheckFuncName, r.TypeOf(check), r.ValueOf(check))
+}
+
+// stopCheck returns the function panicking once the execution of the cell running the calling goroutine stopped
+// early. The functions of the session keep calling it after the cell completes, from callbacks of widgets or of
+// compiled packages, e.g. time.AfterFunc: the execution is thus looked up when it runs, and the check never panics
+// in a goroutine that runs no cell. execution, the execution of the cell defining the check, only saves that
+// lookup while it did not stop.
+func stopCheck(execution *cellExecution) func() {
+	return func() {
+		if execution == nil || execution.stopReason() == 0 {
+			return
+		}
+		current := hooks.currentExecution()
+		if current == nil {
+			return
+		}
+		switch current.stopReason() {
+		case stopInterrupted:
+			panic(errors.New("Interrupted"))
+		case stopTimedOut:
+			panic(errors.New("Timeout"))
+		}
+	}
+}
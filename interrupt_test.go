@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	r "reflect"
+	"testing"
+	"time"
+)
+
+// TestCellExecution tests stopping the cells that time out or are interrupted, and the contexts of the
+// goroutines they start.
+func TestCellExecution(t *testing.T) {
+	ir := newInterp()
+
+	// A loop stops when its cell times out, even when it does not wait for anything.
+	execution := hooks.startCell(nil, 50*time.Millisecond)
+	_, err := doEval(ir, "n := 0\nfor {\n\tn++\n}")
+	hooks.endCell()
+	if err == nil || execution.stopReason() != stopTimedOut {
+		t.Errorf("\t%s Expected the loop to stop when the cell times out, got %v", failure, err)
+	}
+
+	// The loops of the functions of the session do not stop outside of the cells, e.g. in the callbacks of
+	// widgets or of compiled packages, once a cell was interrupted.
+	if _, err := doEval(ir, "func count(n int) int {\n\tc := 0\n\tfor i := 0; i < n; i++ {\n\t\tc++\n\t}\n\treturn c\n}"); err != nil {
+		t.Fatalf("\t%s Expected count to be declared, got %v", failure, err)
+	}
+	interrupted := hooks.startCell(nil, 0)
+	hooks.interrupt()
+	doEval(ir, "count(1)")
+	hooks.endCell()
+	count := ir.Env.ValueOf("count")
+	results := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				results <- p
+			}
+		}()
+		results <- count.Call([]r.Value{r.ValueOf(3)})[0].Interface()
+	}()
+	if got := <-results; got != 3 || interrupted.stopReason() != stopInterrupted {
+		t.Errorf("\t%s Expected count(3) = 3 outside of the cells after an interrupt, got %v", failure, got)
+	}
+
+	// The goroutines started by a cell keep its context once it completes, and are not stopped when a later cell
+	// is interrupted.
+	contexts := make(chan context.Context, 1)
+	release := make(chan bool)
+	report := func() { contexts <- hooks.Context() }
+	ir.Env.DefineVar("report", r.TypeOf(report), r.ValueOf(report))
+	ir.Env.DefineVar("release", r.TypeOf(release), r.ValueOf(release))
+
+	first := hooks.startCell(nil, time.Minute)
+	if _, err := doEval(ir, "go func() {\n\t<-release\n\treport()\n}()"); err != nil {
+		t.Fatalf("\t%s Expected the goroutine to start, got %v", failure, err)
+	}
+	hooks.endCell()
+
+	second := hooks.startCell(nil, 0)
+	if hooks.interrupt() || !hooks.interrupt() {
+		t.Errorf("\t%s Expected the second interrupt of a cell to be reported", failure)
+	}
+	if hooks.Context() != second.ctx || second.ctx.Err() == nil {
+		t.Errorf("\t%s Expected the context of the interrupted cell to be done", failure)
+	}
+	close(release)
+	ctx := <-contexts
+	hooks.endCell()
+	if ctx != first.ctx || ctx.Err() != nil {
+		t.Errorf("\t%s Expected the goroutine to keep the context of the cell that started it, not done", failure)
+	}
+	if hooks.Context().Done() != nil {
+		t.Errorf("\t%s Expected the context outside of the cells never to be done", failure)
+	}
+}
+
+// TestDialAfterInterrupt tests that the network calls of a goroutine left running by a cell are not cancelled
+// when the cell completes, nor when a later cell is interrupted.
+func TestDialAfterInterrupt(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("\t%s Listening: %v", failure, err)
+	}
+	defer listener.Close()
+
+	ir := newInterp()
+	errs := make(chan error, 1)
+	release := make(chan bool)
+	report := func(err error) { errs <- err }
+	ir.Env.DefineVar("report", r.TypeOf(report), r.ValueOf(report))
+	ir.Env.DefineVar("release", r.TypeOf(release), r.ValueOf(release))
+
+	hooks.startCell(nil, 0)
+	_, err = doEval(ir, fmt.Sprintf(`import "net"
+go func() {
+	<-release
+	conn, err := net.Dial("tcp", %q)
+	if err == nil {
+		conn.Close()
+	}
+	report(err)
+}()`, listener.Addr()))
+	hooks.endCell()
+	if err != nil {
+		t.Fatalf("\t%s Expected the goroutine to start, got %v", failure, err)
+	}
+
+	hooks.startCell(nil, 0)
+	hooks.interrupt()
+	close(release)
+	err = <-errs
+	hooks.endCell()
+	if err != nil {
+		t.Errorf("\t%s Expected the goroutine to dial after the next cell was interrupted, got %v", failure, err)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamRate is set by `%opt stream_rate n`: the number of lines per second of a stream of a cell beyond which
+// the lines are dropped, and counted in a "... n lines suppressed" line, so that cells printing millions of
+// lines do not overwhelm the front-end. The default is far above what a cell printing results writes, even in a
+// loop, so that only runaway output is dropped. 0 removes the limit.
+var streamRate = 100000
+
+// streamInterval is set by `%opt stream_interval duration`: the output of a cell written within this interval
+// is published as a single stream message.
+var streamInterval = 50 * time.Millisecond
+
+// maxStreamMessage is the size of the output published at once, even within streamInterval.
+const maxStreamMessage = 1 << 20
+
+func init() {
+	kernelOptions["stream_rate"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a number of lines per second, got %q", strings.Join(args, " "))
+			}
+			rate, err := strconv.Atoi(args[0])
+			if err != nil || rate < 0 {
+				return fmt.Errorf("expected a non-negative number of lines per second, got %q", args[0])
+			}
+			streamRate = rate
+			return nil
+		},
+		value: func() string { return strconv.Itoa(streamRate) },
+	}
+	kernelOptions["stream_interval"] = kernelOption{
+		set: func(args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected a duration, got %q", strings.Join(args, " "))
+			}
+			interval, err := time.ParseDuration(args[0])
+			if err != nil || interval <= 0 {
+				return fmt.Errorf("expected a positive duration such as 50ms, got %q", args[0])
+			}
+			streamInterval = interval
+			return nil
+		},
+		value: func() string { return streamInterval.String() },
+	}
+}
+
+// forwardStream publishes what is read from r to w until r is closed: the output read within interval is
+// written at once, and the lines beyond rate per second are suppressed. Since a single chunk read from r is waiting
+// to be published at a time, a cell writing faster than the front-end reads blocks.
+func forwardStream(r io.Reader, w io.Writer, rate int, interval time.Duration) {
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buf)
+				chunks <- chunk
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	limiter := &lineLimiter{w: w, rate: rate, now: time.Now}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pending []byte
+	flush := func() {
+		if len(pending) > 0 {
+			limiter.Write(pending)
+			pending = nil
+		}
+	}
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				flush()
+				limiter.Close()
+				return
+			}
+			pending = append(pending, chunk...)
+			if len(pending) >= maxStreamMessage {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// lineLimiter writes at most rate lines per second to w, counting the others to report them once the second
+// is over, or when it is closed.
+type lineLimiter struct {
+	w    io.Writer
+	rate int
+	now  func() time.Time
+
+	// window is the start of the current second, and lines the number of lines written since.
+	window time.Time
+	lines  int
+
+	// suppressed is the number of lines dropped since the last report.
+	suppressed int
+
+	// inLine is set when the last write ended in the middle of a line, which dropping tells whether it is
+	// being dropped.
+	inLine   bool
+	dropping bool
+}
+
+// Write implements io.Writer.
+func (l *lineLimiter) Write(p []byte) (int, error) {
+	if l.rate <= 0 {
+		return l.w.Write(p)
+	}
+
+	n := len(p)
+	var out []byte
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		p = p[len(line):]
+
+		if !l.inLine {
+			if now := l.now(); now.Sub(l.window) >= time.Second {
+				out = append(out, l.summary()...)
+				l.window, l.lines = now, 0
+			}
+			l.dropping = l.lines >= l.rate
+			if l.dropping {
+				l.suppressed++
+			} else {
+				l.lines++
+			}
+		}
+		l.inLine = line[len(line)-1] != '\n'
+		if !l.dropping {
+			out = append(out, line...)
+		}
+	}
+
+	if len(out) > 0 {
+		if _, err := l.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Close writes the number of lines suppressed since the last report, if any.
+func (l *lineLimiter) Close() error {
+	summary := l.summary()
+	if len(summary) == 0 {
+		return nil
+	}
+	if l.inLine && !l.dropping {
+		summary = "\n" + summary
+	}
+	_, err := io.WriteString(l.w, summary)
+	return err
+}
+
+// summary returns the line reporting the lines suppressed since the last report, and starts counting anew.
+func (l *lineLimiter) summary() string {
+	if l.suppressed == 0 {
+		return ""
+	}
+	s := fmt.Sprintf("... %d lines suppressed (see %%opt stream_rate)\n", l.suppressed)
+	l.suppressed = 0
+	return s
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingWriter records the writes made to it, as the stream messages published.
+type recordingWriter struct {
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+// TestLineLimiter tests suppressing the lines written beyond the rate, and reporting them.
+func TestLineLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	var out bytes.Buffer
+	l := &lineLimiter{w: &out, rate: 2, now: func() time.Time { return now }}
+
+	io.WriteString(l, "a\nb")
+	io.WriteString(l, "c\nd\ne\n")
+	now = now.Add(time.Second)
+	io.WriteString(l, "f\ng\nh")
+	l.Close()
+
+	want := "a\nbc\n... 2 lines suppressed (see %opt stream_rate)\nf\ng\n... 1 lines suppressed (see %opt stream_rate)\n"
+	if out.String() != want {
+		t.Errorf("\t%s Expected %q, got %q", failure, want, out.String())
+	}
+
+	out.Reset()
+	l = &lineLimiter{w: &out, rate: 1, now: func() time.Time { return now }}
+	io.WriteString(l, "a")
+	l.Close()
+	if out.String() != "a" {
+		t.Errorf("\t%s Expected nothing suppressed, got %q", failure, out.String())
+	}
+
+	out.Reset()
+	l = &lineLimiter{w: &out, rate: 0, now: func() time.Time { return now }}
+	io.WriteString(l, strings.Repeat("x\n", 100))
+	l.Close()
+	if out.Len() != 200 {
+		t.Errorf("\t%s Expected no limit with a rate of 0, got %d bytes", failure, out.Len())
+	}
+}
+
+// TestForwardStream tests coalescing the output written to a stream into few messages.
+func TestForwardStream(t *testing.T) {
+	r, w := io.Pipe()
+	var rec recordingWriter
+	done := make(chan struct{})
+	go func() {
+		forwardStream(r, &rec, 0, time.Hour)
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		io.WriteString(w, "line\n")
+	}
+	w.Close()
+	<-done
+
+	if len(rec.writes) != 1 || rec.writes[0] != strings.Repeat("line\n", 100) {
+		t.Errorf("\t%s Expected the output in a single message, got %d messages", failure, len(rec.writes))
+	}
+}
+
+// TestForwardStreamDefaultRate tests that the default rate limit lets through the output of a cell printing
+// results in a loop.
+func TestForwardStreamDefaultRate(t *testing.T) {
+	r, w := io.Pipe()
+	var rec recordingWriter
+	done := make(chan struct{})
+	go func() {
+		forwardStream(r, &rec, streamRate, time.Hour)
+		close(done)
+	}()
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintln(w, i)
+	}
+	w.Close()
+	<-done
+
+	if out := strings.Join(rec.writes, ""); strings.Count(out, "\n") != 2000 || strings.Contains(out, "suppressed") {
+		t.Errorf("\t%s Expected the 2000 lines written, got %d lines", failure, strings.Count(out, "\n"))
+	}
+}
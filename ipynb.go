@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ipynbNotebook holds the parts of a Jupyter notebook file (nbformat 4) used by the kernel.
+type ipynbNotebook struct {
+	Cells []ipynbCell `json:"cells"`
+}
+
+// ipynbCell holds a cell of a Jupyter notebook file.
+type ipynbCell struct {
+	CellType string                 `json:"cell_type"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Source   ipynbSource            `json:"source"`
+}
+
+// ipynbSource is the source of a cell, stored either as a single string or as a list of lines.
+type ipynbSource string
+
+// UnmarshalJSON implements json.Unmarshaler for both representations of a cell source.
+func (src *ipynbSource) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*src = ipynbSource(strings.Join(lines, ""))
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("cell source is neither a string nor a list of strings: %v", err)
+	}
+	*src = ipynbSource(text)
+	return nil
+}
+
+// hasTag reports whether the cell is tagged with tag.
+func (cell ipynbCell) hasTag(tag string) bool {
+	tags, _ := cell.Metadata["tags"].([]interface{})
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// readNotebook reads and parses the Jupyter notebook file at path.
+func readNotebook(path string) (ipynbNotebook, error) {
+	var nb ipynbNotebook
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nb, err
+	}
+
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nb, fmt.Errorf("%s: %v", path, err)
+	}
+	return nb, nil
+}
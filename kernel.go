@@ -5,17 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
-	"io"
+	"go/token"
 	"io/ioutil"
 	"log"
 	"os"
+	r "reflect"
 	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cosmos72/gomacro/ast2"
 	"github.com/cosmos72/gomacro/base"
 	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/notebook"
 	zmq "github.com/pebbe/zmq4"
 )
 
@@ -87,13 +90,33 @@ const (
 
 // runKernel is the main entry point to start the kernel.
 func runKernel(connectionFile string) {
+	profile := newStartupProfile(*profileStartup, startupBegin)
+	profile.mark("package initialization")
 
-	// Set up the "Session" with the replpkg.
-	ir := classic.New()
+	// Set up the "Session" with the replpkg. Front-ends wait for the sockets to be bound, not for the
+	// interpreter, so it is built meanwhile and the first message waits for it.
+	interpReady := make(chan *classic.Interp, 1)
+	go func() {
+		begin := time.Now()
+		ir := newInterp()
+		profile.measure("interpreter (in the background)", begin)
+		interpReady <- ir
+	}()
+	var ir *classic.Interp
+	interp := func() *classic.Interp {
+		if ir == nil {
+			ir = <-interpReady
+			hooks.ir = ir
+			profile.report(os.Stderr, "first message handled")
+		}
+		return ir
+	}
 
-	// Throw out the error/warning messages that gomacro outputs writes to these streams.
-	ir.Stdout = ioutil.Discard
-	ir.Stderr = ioutil.Discard
+	// Let the notebook helpers talk to the front-end.
+	notebook.SetKernel(hooks)
+
+	// Interrupt the cell being executed when the front-end sends SIGINT.
+	handleInterrupts()
 
 	// Parse the connection info.
 	var connInfo ConnectionInfo
@@ -106,17 +129,24 @@ func runKernel(connectionFile string) {
 	if err = json.Unmarshal(connData, &connInfo); err != nil {
 		log.Fatal(err)
 	}
+	profile.mark("connection file")
 
 	// Set up the ZMQ sockets through which the kernel will communicate.
 	sockets, err := prepareSockets(connInfo)
 	if err != nil {
 		log.Fatal(err)
 	}
+	profile.mark("sockets")
 
 	// TODO connect all channel handlers to a WaitGroup to ensure shutdown before returning from runKernel.
 
 	// Start up the heartbeat handler.
 	startHeartbeat(sockets.HBSocket, &sync.WaitGroup{})
+	profile.mark("heartbeat")
+	profile.report(os.Stderr, "kernel reachable")
+
+	// Write a crash report when the kernel fails.
+	defer crashOnPanic()
 
 	// TODO gracefully shutdown the heartbeat handler on kernel shutdown by closing the chan returned by startHeartbeat.
 
@@ -131,8 +161,12 @@ func runKernel(connectionFile string) {
 	// Start a message receiving loop.
 	for {
 		polled, err := poller.Poll(-1)
+		if zmq.AsErrno(err) == zmq.Errno(syscall.EINTR) {
+			// The kernel was interrupted while idle.
+			continue
+		}
 		if err != nil {
-			log.Fatal(err)
+			kernelFatal(err)
 		}
 
 		for _, item := range polled {
@@ -153,7 +187,7 @@ func runKernel(connectionFile string) {
 					return
 				}
 
-				handleShellMsg(ir, msgReceipt{msg, ids, sockets})
+				handleShellMsg(interp(), msgReceipt{Msg: msg, Identities: ids, Sockets: sockets})
 
 				// TODO Handle stdin socket.
 			case sockets.StdinSocket:
@@ -173,12 +207,28 @@ func runKernel(connectionFile string) {
 					return
 				}
 
-				handleShellMsg(ir, msgReceipt{msg, ids, sockets})
+				handleShellMsg(interp(), msgReceipt{Msg: msg, Identities: ids, Sockets: sockets})
 			}
 		}
 	}
 }
 
+// newInterp creates the interpreter that runs the code of a notebook.
+func newInterp() *classic.Interp {
+	ir := classic.New()
+
+	// Throw out the error/warning messages that gomacro outputs writes to these streams.
+	ir.Stdout = ioutil.Discard
+	ir.Stderr = ioutil.Discard
+
+	values := ir.Env.ValueOf("Values")
+	ir.Env.DefineVar(valuesFuncName, values.Type(), values)
+	defineBuiltins(ir)
+
+	ir.Env.CallStack.Frames = make([]classic.CallFrame, 1, callStackFrames)
+	return ir
+}
+
 // prepareSockets sets up the ZMQ sockets through which the kernel
 // will communicate.
 func prepareSockets(connInfo ConnectionInfo) (SocketGroup, error) {
@@ -243,17 +293,36 @@ func prepareSockets(connInfo ConnectionInfo) (SocketGroup, error) {
 
 // handleShellMsg responds to a message on the shell ROUTER socket.
 func handleShellMsg(ir *classic.Interp, receipt msgReceipt) {
+	crashes.recordMessage(receipt.Msg)
+	if err := owner.check(receipt.Msg.Header); err != nil {
+		refuseMessage(receipt, err)
+		return
+	}
 	switch receipt.Msg.Header.MsgType {
 	case "kernel_info_request":
 		if err := sendKernelInfo(receipt); err != nil {
-			log.Fatal(err)
+			kernelFatal(err)
 		}
 	case "execute_request":
 		if err := handleExecuteRequest(ir, receipt); err != nil {
-			log.Fatal(err)
+			kernelFatal(err)
+		}
+	case "complete_request":
+		if err := handleCompleteRequest(ir, receipt); err != nil {
+			kernelFatal(err)
 		}
 	case "shutdown_request":
 		handleShutdownRequest(receipt)
+	case "comm_open":
+		handleCommOpen(receipt)
+	case "comm_msg":
+		handleCommMsg(ir, receipt)
+	case "comm_close":
+		handleCommClose(receipt)
+	case "comm_info_request":
+		if err := handleCommInfoRequest(receipt); err != nil {
+			kernelFatal(err)
+		}
 	default:
 		log.Println("Unhandled shell message: ", receipt.Msg.Header.MsgType)
 	}
@@ -292,6 +361,7 @@ func handleExecuteRequest(ir *classic.Interp, receipt msgReceipt) error {
 	if !silent {
 		ExecCounter++
 	}
+	crashes.recordCell(ExecCounter, code)
 
 	// Prepare the map that will hold the reply content.
 	content := make(map[string]interface{})
@@ -313,51 +383,69 @@ func handleExecuteRequest(ir *classic.Interp, receipt msgReceipt) error {
 		log.Printf("Error publishing execution input: %v\n", err)
 	}
 
-	// Redirect the standard out from the REPL.
-	oldStdout := os.Stdout
-	rOut, wOut, err := os.Pipe()
-	if err != nil {
-		return err
+	// Read the execution flags from the tags of the cell.
+	flags, flagsErr := parseCellFlags(receipt.Msg.Metadata)
+
+	if flagsErr == nil && flags.skip {
+		content["status"] = "ok"
+		content["user_expressions"] = make(map[string]string)
+		audit.record(&receipt, ExecCounter, code, map[string]interface{}{"status": "skipped"})
+		return receipt.Reply("execute_reply", content)
 	}
-	os.Stdout = wOut
 
-	// Redirect the standard error from the REPL.
-	oldStderr := os.Stderr
-	rErr, wErr, err := os.Pipe()
+	// Let the notebook helpers publish to the front-end on behalf of this execution, which stops early when the
+	// cell is interrupted or times out.
+	execution := hooks.startCell(&receipt, flags.timeout)
+	defer hooks.endCell()
+
+	// Redirect the standard out and error from the REPL.
+	restoreStreams, err := redirectStreams(&receipt)
 	if err != nil {
 		return err
 	}
-	os.Stderr = wErr
-
-	var writersWG sync.WaitGroup
-	writersWG.Add(2)
 
-	// Forward all data written to stdout/stderr to the front-end.
-	go func() {
-		defer writersWG.Done()
-		jupyterStdOut := JupyterStreamWriter{StreamStdout, &receipt}
-		io.Copy(&jupyterStdOut, rOut)
-	}()
-
-	go func() {
-		defer writersWG.Done()
-		jupyterStdErr := JupyterStreamWriter{StreamStderr, &receipt}
-		io.Copy(&jupyterStdErr, rErr)
-	}()
+	var vals []interface{}
+	executionErr := flagsErr
+	if executionErr == nil {
+		allocated := cellAllocs.start()
+		vals, executionErr = evalCell(ir, &receipt, code)
+		cellAllocs.record(fmt.Sprintf("In [%d]", ExecCounter), code, allocated)
+	}
 
-	vals, executionErr := doEval(ir, code)
+	// A cell still running when its timeout expired fails, even if it completed later on. Likewise, an
+	// interrupted cell fails even if it handled the interruption.
+	switch execution.stopReason() {
+	case stopTimedOut:
+		vals, executionErr = nil, executionError{enameTimeout, fmt.Errorf("Timeout: cell did not complete within %v", flags.timeout)}
+	case stopInterrupted:
+		vals, executionErr = nil, executionError{enameInterrupted, errors.New("Interrupted")}
+	}
 
-	//TODO if value is a certain type like image then display it instead
+	if executionErr == nil {
+		// Track the symbols the cell defines and reads, and re-run the cells it made stale if asked to.
+		var defines []string
+		if !silent {
+			id := cellID(&receipt, ExecCounter)
+			defines = deps.record(ir, id, fmt.Sprintf("In [%d]", ExecCounter), code)
+			if vetOn {
+				vetCell(ir, id)
+			}
+			if deps.autorun && len(deps.stale) > 0 {
+				executionErr = deps.rerunStale(ir, &receipt)
+			}
+		}
 
-	// Close and restore the streams.
-	wOut.Close()
-	os.Stdout = oldStdout
+		// Show the reactive outputs created by the cell and update those depending on what it defined.
+		hooks.refreshReactives(ir, &receipt, defines)
+	}
 
-	wErr.Close()
-	os.Stderr = oldStderr
+	// Restore the streams once the data written is forwarded.
+	restoreStreams()
 
-	// Wait for the writers to finish forwarding the data.
-	writersWG.Wait()
+	// Hand over the output collected by a `%%capture` cell magic.
+	if receipt.capture != nil {
+		receipt.capture.finish()
+	}
 
 	if executionErr == nil {
 		content["status"] = "ok"
@@ -365,36 +453,94 @@ func handleExecuteRequest(ir *classic.Interp, receipt msgReceipt) error {
 
 		if !silent && vals != nil {
 			// Publish the result of the execution.
-			if err := receipt.PublishExecutionResult(ExecCounter, fmt.Sprint(vals...)); err != nil {
+			if err := receipt.PublishExecutionResult(ExecCounter, renderValues(vals)); err != nil {
 				log.Printf("Error publishing execution result: %v\n", err)
 			}
 		}
 	} else {
-		content["status"] = "error"
-		content["ename"] = "ERROR"
-		content["evalue"] = executionErr.Error()
-		content["traceback"] = nil
-
-		if err := receipt.PublishExecutionError(executionErr.Error(), []string{executionErr.Error()}); err != nil {
+		// Show the values compared by a failed assertion side by side, which the error message cannot.
+		if failure := assertionFailure(executionErr); failure != nil && !silent {
+			if err := receipt.PublishDisplayData(bundledMIMEData(failure.Data()), nil, ""); err != nil {
+				log.Printf("Error publishing assertion failure: %v\n", err)
+			}
+		}
+		if err := receipt.PublishExecutionError(errorName(executionErr), executionErr.Error(), []string{executionErr.Error()}); err != nil {
 			log.Printf("Error publishing execution error: %v\n", err)
 		}
+
+		// An error expected by the "raises-exception" tag is shown but does not fail the execution.
+		if flags.raisesException {
+			content["status"] = "ok"
+			content["user_expressions"] = make(map[string]string)
+		} else {
+			content["status"] = "error"
+			content["ename"] = errorName(executionErr)
+			content["evalue"] = executionErr.Error()
+			content["traceback"] = nil
+		}
 	}
 
+	audit.record(&receipt, ExecCounter, code, content)
+
 	// Send the output back to the notebook.
 	return receipt.Reply("execute_reply", content)
 }
 
+// redirectStreams forwards the data written to the standard output and error to the front-end as stream messages
+// of receipt, coalesced and rate limited, until the returned function restores them once the data is forwarded.
+func redirectStreams(receipt *msgReceipt) (restore func(), err error) {
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	rOut, wOut, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	rErr, wErr, err := os.Pipe()
+	if err != nil {
+		rOut.Close()
+		wOut.Close()
+		return nil, err
+	}
+	os.Stdout, os.Stderr = wOut, wErr
+
+	var writersWG sync.WaitGroup
+	writersWG.Add(2)
+	rate, interval := streamRate, streamInterval
+	go func() {
+		defer writersWG.Done()
+		forwardStream(rOut, &JupyterStreamWriter{StreamStdout, receipt}, rate, interval)
+	}()
+	go func() {
+		defer writersWG.Done()
+		forwardStream(rErr, &JupyterStreamWriter{StreamStderr, receipt}, rate, interval)
+	}()
+
+	return func() {
+		wOut.Close()
+		wErr.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		writersWG.Wait()
+		rOut.Close()
+		rErr.Close()
+	}, nil
+}
+
 // doEval evaluates the code in the interpreter. This function captures an uncaught panic
 // as well as the values of the last statement/expression.
 func doEval(ir *classic.Interp, code string) (_ []interface{}, err error) {
 
+	// Refuse to run code from within another evaluation, which would corrupt the state of the interpreter.
+	if err := evaluation.enter(); err != nil {
+		return nil, err
+	}
+	defer evaluation.exit()
+
+	// Index the symbols defined by the code for completion, even if it fails midway.
+	defer symbols.update(ir)
+
 	// Capture a panic from the evaluation if one occurs and store it in the `err` return parameter.
 	defer func() {
 		if r := recover(); r != nil {
-			var ok bool
-			if err, ok = r.(error); !ok {
-				err = errors.New(fmt.Sprint(r))
-			}
+			err = panicError(r)
 		}
 	}()
 
@@ -410,28 +556,138 @@ func doEval(ir *classic.Interp, code string) (_ []interface{}, err error) {
 	// Reset the error line so that error messages correspond to the lines from the cell.
 	env.Line = 0
 
-	// Parse the input code (and don't preform gomacro's macroexpansion).
-	src := ir.ParseOnly(code)
+	// Parse the input code (and don't preform gomacro's macroexpansion). The parser only accepts labels in
+	// functions: those of the top-level statements are wrapped in one while parsing.
+	src := ir.ParseOnly(wrapTopLevelLabels(code))
 
 	if src == nil {
 		return nil, nil
 	}
 
-	// Check if the last node is an expression.
-	var srcEndsWithExpr bool
-
-	// If the parsed ast is a single node, check if the node implements `ast.Expr`. Otherwise if the is multiple
-	// nodes then just check if the last one is an expression. These are currently the 2 cases to consider from
-	// gomacro's `ParseOnly`.
+	// Collect the top-level nodes of the source. If the parsed ast is a single node, it is the only one. Otherwise
+	// the source is a slice of nodes. These are currently the 2 cases to consider from gomacro's `ParseOnly`.
+	var nodes []ast.Node
 	if srcAstWithNode, ok := src.(ast2.AstWithNode); ok {
-		_, srcEndsWithExpr = srcAstWithNode.Node().(ast.Expr)
+		nodes = []ast.Node{srcAstWithNode.Node()}
 	} else if srcNodeSlice, ok := src.(ast2.NodeSlice); ok {
-		nodes := srcNodeSlice.X
-		_, srcEndsWithExpr = nodes[len(nodes)-1].(ast.Expr)
+		nodes = srcNodeSlice.X
 	}
+	nodes = unwrapTopLevelLabels(nodes)
 
-	// Evaluate the code.
-	result, results := ir.EvalAst(src)
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	// Check if the last node is an expression.
+	last := nodes[len(nodes)-1]
+	_, srcEndsWithExpr := last.(ast.Expr)
+
+	// Report the errors of the switch statements that gc reports and the interpreter does not.
+	if err := checkSwitches(ir, nodes); err != nil {
+		return nil, executionError{enameCompileError, err}
+	}
+
+	// Show the warnings about the code that runs but likely does not do what was meant, as gc or vet would.
+	printWarnings(ir, warnCell(ir, nodes))
+
+	// Make the labeled break and continue statements leave the statements they name.
+	nodes = fixLabeledBranches(nodes)
+
+	// Give each iteration of the loops variables of their own when they may outlive it.
+	fixLoopVars(nodes)
+
+	// Compute the constant expressions once and for all, and build the strings concatenated by loops without
+	// copying them at each iteration.
+	if err := foldConstants(ir, nodes); err != nil {
+		return nil, executionError{enameCompileError, err}
+	}
+	rewriteConcatLoops(ir, nodes)
+
+	// Do what the interpreter cannot with unsafe.Pointer when `%unsafe on` is set.
+	rewriteUnsafe(ir, nodes)
+
+	// Give the variables of type switches the types the specification requires.
+	fixTypeSwitches(nodes)
+
+	// Turn self tail calls into loops, and stop the other runaway recursions before they overflow the stack of
+	// the kernel.
+	eliminateTailCalls(nodes)
+	limitRecursion(ir, nodes)
+
+	// Stop the loops of the cell when it is interrupted or times out.
+	stopLoops(ir, nodes)
+
+	// Record the channel operations for `%chans` when `%chans on` is set. Those of the cell are over when it
+	// ends, even if it panics. With `%chans step`, the cell runs in turn with the goroutines stepped.
+	nodes = instrumentChanOps(ir, nodes)
+	if chansOn {
+		defer chans.end()
+		stepped := steps.spawn(hooks.currentExecution())
+		steps.enter(stepped)
+		defer steps.exit(stepped)
+	}
+
+	// Log the statements run by the cell when `%trace_on` is set.
+	var trace *executionTrace
+	if traceOn {
+		trace = startTrace(ir, nodes)
+		defer trace.finish()
+	}
+
+	// Record the statements run by the cell when it starts with `%coverage`.
+	var coverage *cellCoverage
+	if coverCell {
+		coverCell = false
+		coverage = startCoverage(ir, nodes, code)
+		defer coverage.finish()
+	}
+
+	// Evaluate the code one top-level node at a time.
+	var result r.Value
+	var results []r.Value
+	previewIDs := make(map[string]string)
+	for _, node := range nodes {
+		// The nodes inserted by the instrumentations have no position.
+		inserted := !node.Pos().IsValid()
+		if coverage != nil && !inserted {
+			coverage.coverNode(ir, node)
+		}
+
+		// Load the imported packages with the loaders supported by this platform.
+		if decl, ok := node.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			rest, err := importPackages(ir, decl)
+			if err != nil {
+				return nil, executionError{enameCompileError, err}
+			} else if rest == nil {
+				continue
+			}
+			node = rest
+		}
+
+		// Give the goroutines started by the node stacks of their own, and evaluate the deferred calls when they
+		// are deferred. Run the range statements over integers and functions. Then bind the method expressions
+		// and values to the types and variables defined so far, and fix the calls of the variadic functions
+		// among them.
+		node = spawnGoroutines(ir, node)
+		node = fixDefers(ir, node)
+		node = fixRanges(ir, node)
+		node = bindMethods(ir, node)
+		node = fixVariadicCalls(ir, node)
+		node = fixMusts(ir, node)
+
+		result, results = evalNodeImporting(ir, node)
+		if decl, ok := node.(*ast.FuncDecl); ok && decl.Recv != nil {
+			fixVariadicMethods(ir)
+		}
+		goroutines.declare(node)
+
+		if imagePreview {
+			previewImages(ir, node, previewIDs)
+		}
+		if trace != nil && !inserted {
+			trace.traceNode(ir, node)
+		}
+	}
 
 	// If the source ends with an expression, then the result of the execution is the value of the expression. In the
 	// event that all return values are nil, the result is also nil.
@@ -456,6 +712,7 @@ func doEval(ir *classic.Interp, code string) (_ []interface{}, err error) {
 		}
 
 		if nonNilCount > 0 {
+			printWarnings(ir, warnResults(values, last.Pos()))
 			return values, nil
 		}
 		return nil, nil
@@ -478,6 +735,8 @@ func handleShutdownRequest(receipt msgReceipt) {
 	}
 
 	log.Println("Shutting down in response to shutdown_request")
+	closeSQLConnections()
+	stopRPCServers()
 	os.Exit(0)
 }
 
@@ -504,7 +763,7 @@ func startHeartbeat(hbSocket *zmq.Socket, wg *sync.WaitGroup) (shutdown chan str
 				// Check for received messages waiting at most 500ms for once to arrive.
 				pingEvents, err := poller.Poll(500 * time.Millisecond)
 				if err != nil {
-					log.Fatalf("Error polling heartbeat channel: %v\n", err)
+					kernelFatal(fmt.Sprintf("Error polling heartbeat channel: %v", err))
 				}
 
 				// If there is at least 1 message waiting then echo it.
@@ -512,7 +771,7 @@ func startHeartbeat(hbSocket *zmq.Socket, wg *sync.WaitGroup) (shutdown chan str
 					// Read a message from the heartbeat channel as a simple byte string.
 					pingMsg, err := hbSocket.RecvBytes(0)
 					if err != nil {
-						log.Fatalf("Error reading heartbeat ping bytes: %v\n", err)
+						kernelFatal(fmt.Sprintf("Error reading heartbeat ping bytes: %v", err))
 					}
 
 					// Send the received byte string back to let the front-end know that the kernel is alive.
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"strings"
 	"testing"
@@ -142,6 +147,18 @@ func TestEvaluate(t *testing.T) {
 			"}()",
 			"<-out",
 		}, "123 true"},
+		{[]string{
+			`import f "fmt"`,
+			`f.Sprint("aliased")`,
+		}, "aliased"},
+		{[]string{
+			`import (`,
+			`    . "math"`,
+			`    _ "image/png"`,
+			`    "strconv"`,
+			`)`,
+			`strconv.Itoa(int(Sqrt(16)))`,
+		}, "4"},
 	}
 
 	t.Logf("Should be able to evaluate valid code in notebook cells.")
@@ -217,6 +234,39 @@ func TestPanicGeneratesError(t *testing.T) {
 	}
 }
 
+// TestErrorNames tests that error replies name the kind of error failing the execution.
+func TestErrorNames(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	cases := []struct {
+		code, ename string
+	}{
+		{"x := 1 +", "CompileError"},
+		{"undefinedName + 1", "CompileError"},
+		{"panic(\"error\")", "RuntimePanic"},
+		{"n := 0\n1 / n", "RuntimePanic"},
+		{"%vet maybe", "Error"},
+	}
+	for _, c := range cases {
+		content, pub := client.executeCode(t, c.code)
+		if ename := getString(t, "content", content, "ename"); ename != c.ename {
+			t.Errorf("\t%s Expected the ename %s for %q but got %s: %v", failure, c.ename, c.code, ename, content["evalue"])
+			continue
+		}
+		for _, pubMsg := range pub {
+			if pubMsg.Header.MsgType == "error" {
+				if ename := getString(t, "content", getMsgContentAsJSONObject(t, pubMsg), "ename"); ename != c.ename {
+					t.Errorf("\t%s Expected the published ename %s for %q but got %s", failure, c.ename, c.code, ename)
+				}
+			}
+		}
+	}
+	if code := exitCode(executionError{enameTimeout, errors.New("Timeout")}); code != 4 {
+		t.Errorf("\t%s Expected the exit status 4 for a timeout but got %d", failure, code)
+	}
+}
+
 // TestPrintStdout tests that data written to stdout publishes the same data in a "stdout" "stream" message.
 func TestPrintStdout(t *testing.T) {
 	cases := []struct {
@@ -322,6 +372,711 @@ cases:
 	}
 }
 
+// TestInteract tests that notebook.Interact opens a widget comm per parameter and displays the result of
+// the function called with the initial control values.
+func TestInteract(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, pub := client.executeCode(t, strings.Join([]string{
+		`import "notebook"`,
+		"notebook.Interact(func(n int, s string) int {",
+		"    return n * 2",
+		`}, notebook.Slider{Label: "n", Min: 1, Max: 10, Step: 1})`,
+	}, "\n"))
+
+	status := getString(t, "content", content, "status")
+
+	if status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	var commOpens int
+	var output string
+	for _, pubMsg := range pub {
+		switch pubMsg.Header.MsgType {
+		case "comm_open":
+			commOpens++
+		case "display_data":
+			content = getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			output = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	if commOpens != 2 {
+		t.Fatalf("\t%s Expected 2 \"comm_open\" messages but got %d", failure, commOpens)
+	}
+
+	if output != "2" {
+		t.Fatalf("\t%s Expected the interactive output \"2\" but got %q", failure, output)
+	}
+	t.Logf("\t%s Displayed the controls and the interactive output.", success)
+}
+
+// TestInteractUpdate tests that changing a control re-runs the interactive function like a cell, forwarding what it
+// prints before updating the interactive output.
+func TestInteractUpdate(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, pub := client.executeCode(t, strings.Join([]string{
+		`import "fmt"`,
+		`import "notebook"`,
+		"notebook.Interact(func(n int) int {",
+		`    fmt.Println("n =", n)`,
+		"    return n * 2",
+		`}, notebook.Slider{Label: "n", Min: 1, Max: 10, Step: 1})`,
+	}, "\n"))
+
+	status := getString(t, "content", content, "status")
+
+	if status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	var commID string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "comm_open" {
+			content = getMsgContentAsJSONObject(t, pubMsg)
+			commID = getString(t, "content", content, "comm_id")
+		}
+	}
+
+	request, err := NewMsg("comm_msg", ComposedMsg{})
+	if err != nil {
+		t.Fatalf("\t%s NewMsg: %s", failure, err)
+	}
+	request.Header.Session = sessionID
+	request.Header.Username = "KernelTester"
+	request.Content = map[string]interface{}{
+		"comm_id": commID,
+		"data": map[string]interface{}{
+			"method": "update",
+			"state":  map[string]interface{}{"value": 3},
+		},
+	}
+	client.sendShellRequest(t, request)
+
+	var stdout, output string
+	for {
+		subMsg := client.recvIOSub(t, 1*time.Second)
+		content = getMsgContentAsJSONObject(t, subMsg)
+		if subMsg.Header.MsgType == "status" && getString(t, "content", content, "execution_state") == kernelIdle {
+			break
+		}
+		switch subMsg.Header.MsgType {
+		case "stream":
+			stdout += getString(t, "content", content, "text")
+		case "update_display_data":
+			data := getJSONObject(t, "content", content, "data")
+			output = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	if stdout != "n = 3\n" {
+		t.Fatalf("\t%s Expected the interactive function to print \"n = 3\\n\" but got %q", failure, stdout)
+	}
+	if output != "6" {
+		t.Fatalf("\t%s Expected the interactive output to be updated to \"6\" but got %q", failure, output)
+	}
+	t.Logf("\t%s Forwarded the output of the interactive function and updated its result.", success)
+}
+
+// TestImagePreview tests that successive assignments of images to a variable display a single preview which is
+// then updated in place when the `%preview` magic is on.
+func TestImagePreview(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, pub := client.executeCode(t, strings.Join([]string{
+		"%preview on",
+		`import "image"`,
+		"img := image.NewGray(image.Rect(0, 0, 2, 2))",
+		"img = image.NewGray(image.Rect(0, 0, 4, 4))",
+	}, "\n"))
+
+	status := getString(t, "content", content, "status")
+
+	if status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	var displays, updates []string
+	for _, pubMsg := range pub {
+		switch pubMsg.Header.MsgType {
+		case "display_data", "update_display_data":
+			content = getMsgContentAsJSONObject(t, pubMsg)
+			transient := getJSONObject(t, "content", content, "transient")
+			displayID := getString(t, `content["transient"]`, transient, "display_id")
+
+			if pubMsg.Header.MsgType == "display_data" {
+				displays = append(displays, displayID)
+			} else {
+				updates = append(updates, displayID)
+			}
+		}
+	}
+
+	if len(displays) != 1 || len(updates) != 1 || displays[0] != updates[0] {
+		t.Fatalf("\t%s Expected a preview and an update of it but got displays %v and updates %v", failure, displays, updates)
+	}
+	t.Logf("\t%s Displayed and updated a single image preview.", success)
+
+	client.executeCode(t, "%preview off")
+}
+
+// TestCaptureMagic tests that the output of a cell run with `%%capture` is stored in a variable instead of being
+// published.
+func TestCaptureMagic(t *testing.T) {
+	stdout, stderr := testOutputStream(t, strings.Join([]string{
+		"%%capture out",
+		`import "fmt"`,
+		`import "os"`,
+		`fmt.Print("captured")`,
+		`fmt.Fprint(os.Stderr, "also captured")`,
+		"3",
+	}, "\n"))
+
+	if len(stdout) != 0 || len(stderr) != 0 {
+		t.Fatalf("\t%s Captured cell published stdout %v and stderr %v", failure, stdout, stderr)
+	}
+
+	if result := testEvaluate(t, "out.Stdout + out.Stderr"); result != "capturedalso captured" {
+		t.Fatalf("\t%s Expected the captured streams but got %q", failure, result)
+	}
+
+	if result := testEvaluate(t, "out.Outputs[0].Text()"); result != "3" {
+		t.Fatalf("\t%s Expected the captured result but got %q", failure, result)
+	}
+	t.Logf("\t%s Captured the output of the cell.", success)
+}
+
+// TestCellFlags tests that the "skip", "timeout=<duration>" and "raises-exception" tags sent in the metadata of
+// an execute request control the execution of the cell.
+func TestCellFlags(t *testing.T) {
+	cases := []struct {
+		Tag    string
+		Input  []string
+		Status string
+		Error  bool
+	}{
+		{"skip", []string{`panic("not run")`}, "ok", false},
+		{"timeout=100ms", []string{
+			`import "time"`,
+			"time.Sleep(300 * time.Millisecond)",
+		}, "error", true},
+		{"timeout=1s", []string{"1 + 1"}, "ok", false},
+		{"raises-exception", []string{`panic("expected")`}, "ok", true},
+		{"timeout=forever", []string{"1 + 1"}, "error", true},
+	}
+
+	t.Logf("Should honor the execution flags in the tags of a cell.")
+
+	for k, tc := range cases {
+		// Give a progress report.
+		t.Logf("  Evaluating code snippet %d/%d.", k+1, len(cases))
+
+		client, closeClient := newTestJupyterClient(t)
+		metadata := map[string]interface{}{"tags": []string{"unrelated", tc.Tag}}
+		content, pub := client.executeCodeWithMetadata(t, strings.Join(tc.Input, "\n"), metadata)
+		closeClient()
+
+		status := getString(t, "content", content, "status")
+
+		var published bool
+		for _, pubMsg := range pub {
+			if pubMsg.Header.MsgType == "error" {
+				published = true
+			}
+		}
+
+		if status != tc.Status || published != tc.Error {
+			t.Errorf("\t%s Tag %q gave status %q and published error %v.", failure, tc.Tag, status, published)
+			continue
+		}
+		t.Logf("\t%s Honored tag %q.", success, tc.Tag)
+	}
+}
+
+// TestDepsMagic tests that re-running a cell marks the cells reading its symbols as stale, and that `%deps`
+// lists the dependencies between the cells.
+func TestDepsMagic(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	cells := []struct {
+		ID   string
+		Code string
+	}{
+		{"deps-a", "depsX := 1"},
+		{"deps-b", "depsY := depsX + 1"},
+		{"deps-a", "depsX := 2"},
+	}
+	for _, cell := range cells {
+		content, _ := client.executeCodeWithMetadata(t, cell.Code, map[string]interface{}{"cellId": cell.ID})
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+		}
+	}
+
+	_, pub := client.executeCode(t, "%deps")
+
+	var listing string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "display_data" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			listing = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	if !strings.Contains(listing, "(depsX)") || !strings.Contains(listing, "is stale") {
+		t.Fatalf("\t%s Expected a stale dependency on depsX but got %q", failure, listing)
+	}
+	t.Logf("\t%s Listed the stale dependency.", success)
+}
+
+// TestReactive tests that an output created by notebook.Reactive is displayed when its cell completes and updated
+// when a later cell assigns a variable it references.
+func TestReactive(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	cells := []string{
+		"reactiveX := 1",
+		"import \"notebook\"\nnotebook.Reactive(\"reactiveX * 10\")",
+		"reactiveX = 5",
+	}
+
+	var outputs, displayIDs []string
+	for _, code := range cells {
+		content, pub := client.executeCode(t, code)
+		if status := getString(t, "content", content, "status"); status != "ok" {
+			t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+		}
+
+		for _, pubMsg := range pub {
+			switch pubMsg.Header.MsgType {
+			case "display_data", "update_display_data":
+				content := getMsgContentAsJSONObject(t, pubMsg)
+				data := getJSONObject(t, "content", content, "data")
+				transient := getJSONObject(t, "content", content, "transient")
+				outputs = append(outputs, pubMsg.Header.MsgType+" "+getString(t, `content["data"]`, data, "text/plain"))
+				displayIDs = append(displayIDs, getString(t, `content["transient"]`, transient, "display_id"))
+			}
+		}
+	}
+
+	expected := []string{"display_data 10", "update_display_data 50"}
+	if strings.Join(outputs, ", ") != strings.Join(expected, ", ") || displayIDs[0] != displayIDs[1] {
+		t.Fatalf("\t%s Expected outputs %q but got %q with display ids %v", failure, expected, outputs, displayIDs)
+	}
+	t.Logf("\t%s Displayed and updated the reactive output.", success)
+}
+
+// TestTrace tests that `%trace_on` displays the statements executed by a cell along with the values they assign.
+func TestTrace(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, pub := client.executeCode(t, strings.Join([]string{
+		"%trace_on",
+		"traceSum := 0",
+		"for i := 0; i < 3; i++ {",
+		"    traceSum += i",
+		"}",
+	}, "\n"))
+	client.executeCode(t, "%trace_off")
+
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	var trace string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "display_data" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			trace = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	expected := "line 2: traceSum = 0\nline 4: traceSum = 0\nline 4: traceSum = 1\nline 4: traceSum = 3\nline 3\n"
+	if trace != expected {
+		t.Fatalf("\t%s Expected the trace %q but got %q", failure, expected, trace)
+	}
+	t.Logf("\t%s Displayed the execution trace.", success)
+}
+
+// TestCoverage tests that `%coverage` displays the source of the cell with the statements that ran marked.
+func TestCoverage(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, pub := client.executeCode(t, strings.Join([]string{
+		"%coverage",
+		"coverN := 1",
+		"if coverN > 1 {",
+		"    coverN = 0",
+		"}",
+	}, "\n"))
+
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	var coverage string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "display_data" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			coverage = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	expected := "  \n+ coverN := 1\n+ if coverN > 1 {\n-     coverN = 0\n  }\n"
+	if coverage != expected {
+		t.Fatalf("\t%s Expected the coverage %q but got %q", failure, expected, coverage)
+	}
+	t.Logf("\t%s Displayed the coverage of the cell.", success)
+}
+
+// TestInterrupt tests that interrupting the kernel stops cells blocked in time.Sleep, http.Get or notebook.Recv.
+func TestInterrupt(t *testing.T) {
+	// silent accepts connections but never responds to the requests sent on them.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("\t%s net.Listen: %s", failure, err)
+	}
+	defer silent.Close()
+
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cases := [][]string{
+		{`import "time"`, "time.Sleep(time.Minute)"},
+		{`import "net/http"`, fmt.Sprintf(`http.Get("http://%s")`, silent.Addr())},
+		{`import "notebook"`, "notebook.Recv(make(chan int))"},
+	}
+
+	t.Logf("Should stop blocked cells when interrupted.")
+
+	for k, tc := range cases {
+		// Give a progress report.
+		t.Logf("  Evaluating code snippet %d/%d.", k+1, len(cases))
+
+		client, closeClient := newTestJupyterClient(t)
+
+		// Interrupt the kernel the way the SIGINT handler does, since the signal would also interrupt the
+		// sockets of the test client.
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			hooks.interrupt()
+		}()
+
+		start := time.Now()
+		content, _ := client.executeCode(t, strings.Join(tc, "\n"))
+		closeClient()
+
+		status := getString(t, "content", content, "status")
+		if status != "error" || content["evalue"] != "Interrupted" {
+			t.Errorf("\t%s Expected the cell to be interrupted but got status %q: %v", failure, status, content["evalue"])
+			continue
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("\t%s The cell took %v to stop", failure, elapsed)
+			continue
+		}
+		t.Logf("\t%s Interrupted the cell.", success)
+	}
+}
+
+// TestReentrancy tests that code run while a cell is running is rejected, and that a stale cell running
+// `%deps stale` does not re-run itself forever.
+func TestReentrancy(t *testing.T) {
+	if err := evaluation.enter(); err != nil {
+		t.Fatalf("\t%s Starting an evaluation: %s", failure, err)
+	}
+	_, err := doEval(newInterp(), "1 + 1")
+	evaluation.exit()
+
+	if err != errReentrant {
+		t.Fatalf("\t%s Expected a nested evaluation to fail with %q but got %v", failure, errReentrant, err)
+	}
+
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	cells := []struct {
+		ID   string
+		Code string
+	}{
+		{"reentrant-a", "reentrantX := 1"},
+		{"reentrant-b", "%deps stale\nreentrantY := reentrantX"},
+		{"reentrant-a", "reentrantX := 2"},
+		{"reentrant-c", "%deps stale"},
+	}
+
+	var content map[string]interface{}
+	for _, cell := range cells {
+		content, _ = client.executeCodeWithMetadata(t, cell.Code, map[string]interface{}{"cellId": cell.ID})
+	}
+
+	evalue, _ := content["evalue"].(string)
+	if status := getString(t, "content", content, "status"); status != "error" || !strings.Contains(evalue, "already being re-run") {
+		t.Fatalf("\t%s Expected the nested re-run to fail but got status %q: %s", failure, status, evalue)
+	}
+	t.Logf("\t%s Rejected the nested executions.", success)
+}
+
+// TestDelete tests that `%delete` and notebook.Delete remove symbols from the session.
+func TestDelete(t *testing.T) {
+	cases := []struct {
+		Input []string
+		Error string
+	}{
+		{[]string{"deleteBig := make([]byte, 1<<20)", "type deleteT int"}, ""},
+		{[]string{"%delete deleteBig deleteT"}, ""},
+		{[]string{"deleteBig"}, "undefined identifier: deleteBig"},
+		{[]string{"var x deleteT"}, "undefined identifier: deleteT"},
+		{[]string{"%delete deleteBig"}, "%delete: deleteBig is not defined"},
+		{[]string{"deleteX := 1", `import "notebook"`, `notebook.Delete("deleteX")`}, ""},
+		{[]string{"deleteX"}, "undefined identifier: deleteX"},
+	}
+
+	t.Logf("Should delete symbols from the session.")
+
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	for k, tc := range cases {
+		// Give a progress report.
+		t.Logf("  Evaluating code snippet %d/%d.", k+1, len(cases))
+
+		content, _ := client.executeCode(t, strings.Join(tc.Input, "\n"))
+
+		evalue, _ := content["evalue"].(string)
+		if tc.Error == "" && evalue != "" || !strings.Contains(evalue, tc.Error) {
+			t.Errorf("\t%s Expected error %q but got %q.", failure, tc.Error, evalue)
+			continue
+		}
+		t.Logf("\t%s Got the expected result.", success)
+	}
+}
+
+// TestMemwhos tests that `%memwhos` lists the variables of the session with the memory they retain.
+func TestMemwhos(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, _ := client.executeCode(t, strings.Join([]string{
+		"memwhosBig := make([]byte, 1<<20)",
+		"memwhosCycle := []interface{}{nil, make([]byte, 1<<10)}",
+		"memwhosCycle[0] = memwhosCycle",
+	}, "\n"))
+
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	_, pub := client.executeCode(t, "%memwhos")
+
+	var listing string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "display_data" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			listing = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(listing, "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+
+	expected := []string{"Name Type Size", "memwhosBig []uint8 1.0 MiB", "memwhosCycle []interface {} 1.1 KiB"}
+	if len(lines) < 3 || strings.Join(lines[:3], "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("\t%s Expected the listing to start with %q but got:\n%s", failure, expected, listing)
+	}
+	t.Logf("\t%s Listed the memory retained by the variables.", success)
+}
+
+// TestPkginfo tests that `%pkginfo` lists the exported symbols of a package matching a filter.
+func TestPkginfo(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, _ := client.executeCode(t, `import str "strings"`)
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	_, pub := client.executeCode(t, "%pkginfo str splitafter")
+
+	var listing string
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "display_data" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			listing = getString(t, `content["data"]`, data, "text/plain")
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(listing), "\n") {
+		lines = append(lines, strings.Join(strings.Fields(line), " "))
+	}
+
+	// The documentation depends on the version of Go, only check that it is there.
+	expected := []string{
+		"Kind Name Signature Doc",
+		"func SplitAfter func SplitAfter(s, sep string) []string SplitAfter slices s ",
+		"func SplitAfterN func SplitAfterN(s, sep string, n int) []string SplitAfterN slices s ",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("\t%s Expected %d lines but got:\n%s", failure, len(expected), listing)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line+" ", expected[i]) {
+			t.Fatalf("\t%s Expected line %d to start with %q but got:\n%s", failure, i+1, expected[i], listing)
+		}
+	}
+	t.Logf("\t%s Listed the exported symbols of the package.", success)
+}
+
+// TestArrowResult tests that a slice of structs is displayed along with an Arrow table.
+func TestArrowResult(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	content, pub := client.executeCode(t, strings.Join([]string{
+		"type arrowRow struct {",
+		"    Name  string",
+		"    Count int",
+		"}",
+		`[]arrowRow{arrowRow{"a", 1}, arrowRow{"b", 2}}`,
+	}, "\n"))
+
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+
+	for _, pubMsg := range pub {
+		if pubMsg.Header.MsgType == "execute_result" {
+			content := getMsgContentAsJSONObject(t, pubMsg)
+			data := getJSONObject(t, "content", content, "data")
+			if table := getString(t, `content["data"]`, data, "application/vnd.apache.arrow.file"); table == "" {
+				t.Fatalf("\t%s Empty Arrow table", failure)
+			}
+			t.Logf("\t%s Displayed an Arrow table.", success)
+			return
+		}
+	}
+	t.Fatalf("\t%s No execute_result published", failure)
+}
+
+// TestSQLMagic tests connecting a database with %sql_connect and querying it with %%sql cells.
+func TestSQLMagic(t *testing.T) {
+	client, closeClient := newTestJupyterClient(t)
+	defer closeClient()
+
+	displayed := func(pub []ComposedMsg) string {
+		for _, pubMsg := range pub {
+			if pubMsg.Header.MsgType == "display_data" {
+				content := getMsgContentAsJSONObject(t, pubMsg)
+				data := getJSONObject(t, "content", content, "data")
+				return getString(t, `content["data"]`, data, "text/plain")
+			}
+		}
+		return ""
+	}
+	normalize := func(text string) string {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+			lines = append(lines, strings.Join(strings.Fields(line), " "))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	content, pub := client.executeCode(t, "%sql_connect sqldb test database gophernotes-test")
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+	if health := displayed(pub); !strings.Contains(health, "sqldb") || !strings.Contains(health, "ok (ping") {
+		t.Fatalf("\t%s Expected the health of the connection but got:\n%s", failure, health)
+	}
+
+	content, pub = client.executeCode(t, "%%sql\nSELECT id, name FROM users")
+	if status := getString(t, "content", content, "status"); status != "ok" {
+		t.Fatalf("\t%s Execution encountered error [%s]: %s", failure, content["ename"], content["evalue"])
+	}
+	expected := "id name\n1 ada\n2 NULL"
+	if table := displayed(pub); normalize(table) != expected {
+		t.Fatalf("\t%s Expected the table %q but got:\n%s", failure, expected, table)
+	}
+
+	// The connection is also available to Go code.
+	if result := testEvaluate(t, "sqldb.Ping() == nil"); result != "true" {
+		t.Fatalf("\t%s Expected the sqldb variable to hold the connection, got %s", failure, result)
+	}
+
+	content, _ = client.executeCode(t, "%%sql other\nSELECT 1")
+	if status := getString(t, "content", content, "status"); status != "error" {
+		t.Fatalf("\t%s Expected an error querying an unknown connection", failure)
+	}
+	t.Logf("\t%s Queried the connected database.", success)
+}
+
+func init() {
+	sql.Register("gophernotes-test", testSQLDriver{})
+}
+
+// testSQLDriver is a database/sql driver whose queries all return the same users table.
+type testSQLDriver struct{}
+
+func (testSQLDriver) Open(name string) (driver.Conn, error) { return testSQLConn{}, nil }
+
+type testSQLConn struct{}
+
+func (testSQLConn) Prepare(query string) (driver.Stmt, error) { return testSQLStmt{}, nil }
+func (testSQLConn) Close() error                              { return nil }
+func (testSQLConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type testSQLStmt struct{}
+
+func (testSQLStmt) Close() error  { return nil }
+func (testSQLStmt) NumInput() int { return -1 }
+func (testSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (testSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &testSQLRows{values: [][]driver.Value{{int64(1), "ada"}, {int64(2), nil}}}, nil
+}
+
+type testSQLRows struct {
+	values [][]driver.Value
+}
+
+func (rows *testSQLRows) Columns() []string { return []string{"id", "name"} }
+func (rows *testSQLRows) Close() error      { return nil }
+func (rows *testSQLRows) Next(dest []driver.Value) error {
+	if len(rows.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, rows.values[0])
+	rows.values = rows.values[1:]
+	return nil
+}
+
 //==============================================================================
 
 // testJupyterClient holds references to the 2 sockets it uses to communicate with the kernel.
@@ -509,6 +1264,13 @@ func (client *testJupyterClient) performJupyterRequest(t *testing.T, request Com
 func (client *testJupyterClient) executeCode(t *testing.T, code string) (map[string]interface{}, []ComposedMsg) {
 	t.Helper()
 
+	return client.executeCodeWithMetadata(t, code, make(map[string]interface{}))
+}
+
+// executeCodeWithMetadata is like executeCode but sends the given metadata along with the execute request.
+func (client *testJupyterClient) executeCodeWithMetadata(t *testing.T, code string, metadata map[string]interface{}) (map[string]interface{}, []ComposedMsg) {
+	t.Helper()
+
 	// Create a message.
 	request, err := NewMsg("execute_request", ComposedMsg{})
 	if err != nil {
@@ -520,7 +1282,7 @@ func (client *testJupyterClient) executeCode(t *testing.T, code string) (map[str
 	request.Header.Username = "KernelTester"
 
 	// Fill in Metadata.
-	request.Metadata = make(map[string]interface{})
+	request.Metadata = metadata
 
 	// Fill in content.
 	content := make(map[string]interface{})
@@ -628,3 +1390,52 @@ func testOutputStream(t *testing.T, codeIn string) ([]string, []string) {
 
 	return stdout, stderr
 }
+
+// TestAutoImport tests that a statement using a package that is not imported imports it and runs again, or
+// suggests the import, depending on `%autoimport`.
+func TestAutoImport(t *testing.T) {
+	defer func() { autoImport = "on" }()
+
+	ir := newInterp()
+	vals, err := doEval(ir, "n := 2\nstrings.Repeat(\"ab\", n)")
+	if err != nil || len(vals) != 1 || vals[0] != "abab" {
+		t.Fatalf("\t%s Expected the missing import to be added but got %v, %v", failure, vals, err)
+	}
+
+	autoImport = "suggest"
+	if _, err := doEval(ir, "rand.Intn(3)"); err == nil || !strings.Contains(err.Error(), `missing import "math/rand"?`) {
+		t.Fatalf("\t%s Expected a suggestion to import math/rand but got %v", failure, err)
+	}
+
+	autoImport = "off"
+	if _, err := doEval(ir, "rand.Intn(3)"); err == nil || strings.Contains(err.Error(), "missing import") {
+		t.Fatalf("\t%s Expected the error alone but got %v", failure, err)
+	}
+	t.Logf("\t%s Imported the missing package.", success)
+}
+
+// TestRecursionLimit tests that deep recursions panic instead of overflowing the stack of the kernel.
+func TestRecursionLimit(t *testing.T) {
+	defer func() { recursionLimit = 10000 }()
+
+	ir := newInterp()
+	if _, err := doEval(ir, "func down(n int) int { return 1 + down(n+1) }"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doEval(ir, "down(0)"); err == nil || !strings.Contains(err.Error(), "maximum recursion depth exceeded") {
+		t.Fatalf("\t%s Expected the recursion to be stopped but got %v", failure, err)
+	}
+
+	recursionLimit = 50
+	vals, err := doEval(ir, `var caught interface{}
+func try() {
+	defer func() { caught = recover() }()
+	down(0)
+}
+try()
+caught != nil`)
+	if err != nil || len(vals) != 1 || vals[0] != true {
+		t.Fatalf("\t%s Expected the recursion to be recovered from but got %v, %v", failure, vals, err)
+	}
+	t.Logf("\t%s Stopped the recursion.", success)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+const (
+	// breakFlagPrefix and continueFlagPrefix start the names of the variables telling that a labeled break or
+	// continue statement is leaving the statements between it and its target.
+	breakFlagPrefix    = "__gophernotesBreak_"
+	continueFlagPrefix = "__gophernotesContinue_"
+
+	// labelsFuncName is the name of the function wrapping the labeled statements at the top level of the cells
+	// while they are parsed. It is never called.
+	labelsFuncName = "__gophernotesLabels"
+)
+
+// branchTarget is a for, range, switch, type switch or select statement enclosing the statements being fixed.
+type branchTarget struct {
+	labels []string
+	loop   bool
+	// breakFlag and continueFlag are the names of the flags of the branch statements to the target, once some
+	// need them.
+	breakFlag, continueFlag string
+	// exits are the branch statements inside the target leaving it for an enclosing one.
+	exits []branchExit
+}
+
+// branchExit is a labeled branch statement leaving a target for an enclosing one.
+type branchExit struct {
+	target *branchTarget
+	tok    token.Token
+}
+
+// branchFixer rewrites the labeled branch statements of the body of a function, or of the top level of a cell.
+type branchFixer struct {
+	targets []*branchTarget
+}
+
+// fixLabeledBranches rewrites the labeled break and continue statements of nodes, at their top level and in
+// their functions, that the interpreter would get wrong: it ignores their labels, so that they break the
+// innermost for, range, switch or select statement, and continue the innermost loop. Such a statement sets a
+// flag and breaks the innermost statement, and every statement it leaves is followed by the check of the flag
+// breaking the next one, until the labeled one is broken or continued. The labels are then removed, as the
+// interpreter loops forever on labeled statements. The top-level labels are parsed thanks to wrapTopLevelLabels.
+// It returns the nodes replacing nodes.
+func fixLabeledBranches(nodes []ast.Node) []ast.Node {
+	var bodies []*ast.BlockStmt
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Body != nil {
+					bodies = append(bodies, n.Body)
+				}
+			case *ast.FuncLit:
+				bodies = append(bodies, n.Body)
+			}
+			return true
+		})
+	}
+	// The statements of nested function literals are left to their own fixer.
+	for _, body := range bodies {
+		var f branchFixer
+		body.List = f.stmts(body.List)
+	}
+
+	fixed := make([]ast.Node, 0, len(nodes))
+	for _, node := range nodes {
+		stmt, ok := node.(ast.Stmt)
+		if !ok {
+			fixed = append(fixed, node)
+			continue
+		}
+		// The top-level statements enclose no target, so that each is fixed on its own.
+		var f branchFixer
+		for _, stmt := range f.stmts([]ast.Stmt{stmt}) {
+			fixed = append(fixed, stmt)
+		}
+	}
+	for i, node := range fixed {
+		fixed[i] = rewriteStmts(node, unlabel)
+	}
+	return fixed
+}
+
+// wrapTopLevelLabels returns code with its top-level labeled statements wrapped in function literals passed to
+// labelsFuncName, as the parser of the interpreter only accepts labels in functions. The code is inserted at the
+// end of the line before the label when there is one, and after the end of the labeled statement, so that the
+// other statements keep their positions. unwrapTopLevelLabels undoes it once code is parsed.
+func wrapTopLevelLabels(code string) string {
+	if !strings.Contains(code, ":") {
+		return code
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(code))
+	var s scanner.Scanner
+	s.Init(file, []byte(code), nil, 0)
+
+	// scanned is a token and its offset in code. The semicolons ending lines also have the offset of the end of
+	// the line before its comment, if any, in end.
+	type scanned struct {
+		tok         token.Token
+		lit         string
+		offset, end int
+	}
+	var inserts []scanned
+	insert := func(offset int, text string) {
+		inserts = append(inserts, scanned{lit: text, offset: offset})
+	}
+	// wrapping is set from a label to the end of its statement, which is the first semicolon outside of braces
+	// once its body, if any, is over: labeled tells that the tokens are still labels, and braced that the
+	// statement is a for, switch or select one, whose header may contain semicolons.
+	depth := 0
+	wrapping, labeled, braced := false, false, false
+	start := scanned{tok: token.SEMICOLON, offset: -1}
+	before, prev, end := start, start, 0
+	for {
+		pos, tok, lit := s.Scan()
+		offset := file.Offset(pos)
+		if labeled && tok != token.IDENT && tok != token.COLON {
+			labeled = false
+			braced = tok == token.FOR || tok == token.SWITCH || tok == token.SELECT
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+			if depth == 0 && tok == token.RBRACE {
+				braced = false
+			}
+		case token.SEMICOLON, token.EOF:
+			if depth == 0 && wrapping && (!braced || tok == token.EOF) {
+				insert(offset, "})")
+				wrapping = false
+			}
+		case token.COLON:
+			// A label starts a statement: the token before it ends the previous one, if any.
+			if depth == 0 && !wrapping && prev.tok == token.IDENT && before.tok == token.SEMICOLON {
+				text := labelsFuncName + "(func() {"
+				switch {
+				case before.offset < 0:
+					insert(prev.offset, text)
+				case before.lit == ";":
+					insert(before.offset+1, text)
+				default:
+					insert(before.end, "; "+text)
+				}
+				wrapping, labeled = true, true
+			}
+		}
+		if tok == token.EOF {
+			break
+		}
+		before, prev = prev, scanned{tok, lit, offset, end}
+		if tok != token.SEMICOLON || lit == ";" {
+			if lit == "" {
+				lit = tok.String()
+			}
+			end = offset + len(lit)
+		}
+	}
+
+	for i := len(inserts) - 1; i >= 0; i-- {
+		code = code[:inserts[i].offset] + inserts[i].lit + code[inserts[i].offset:]
+	}
+	return code
+}
+
+// unwrapTopLevelLabels replaces the calls of labelsFuncName wrapping the top-level labeled statements of nodes
+// with these statements.
+func unwrapTopLevelLabels(nodes []ast.Node) []ast.Node {
+	unwrapped := make([]ast.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if call, ok := node.(*ast.CallExpr); ok && len(call.Args) == 1 {
+			fun, isIdent := call.Fun.(*ast.Ident)
+			if lit, isLit := call.Args[0].(*ast.FuncLit); isIdent && fun.Name == labelsFuncName && isLit {
+				for _, stmt := range lit.Body.List {
+					unwrapped = append(unwrapped, stmt)
+				}
+				continue
+			}
+		}
+		unwrapped = append(unwrapped, node)
+	}
+	return unwrapped
+}
+
+// unlabel returns the statement labeled by stmt, or stmt if it is not labeled.
+func unlabel(stmt ast.Stmt) ast.Stmt {
+	for {
+		labeled, ok := stmt.(*ast.LabeledStmt)
+		if !ok {
+			return stmt
+		}
+		stmt = labeled.Stmt
+	}
+}
+
+// stmts returns the statements replacing list.
+func (f *branchFixer) stmts(list []ast.Stmt) []ast.Stmt {
+	fixed := make([]ast.Stmt, 0, len(list))
+	for _, stmt := range list {
+		var labels []string
+		inner := stmt
+		for {
+			labeled, ok := inner.(*ast.LabeledStmt)
+			if !ok {
+				break
+			}
+			labels = append(labels, labeled.Label.Name)
+			inner = labeled.Stmt
+		}
+
+		var loop bool
+		switch inner.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			loop = true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		default:
+			fixed = append(fixed, f.stmt(stmt))
+			continue
+		}
+
+		t := &branchTarget{labels: labels, loop: loop}
+		f.targets = append(f.targets, t)
+		f.stmt(inner)
+		f.targets = f.targets[:len(f.targets)-1]
+
+		for _, name := range []string{t.breakFlag, t.continueFlag} {
+			if name != "" {
+				fixed = append(fixed, &ast.DeclStmt{Decl: &ast.GenDecl{
+					Tok: token.VAR,
+					Specs: []ast.Spec{&ast.ValueSpec{
+						Names: []*ast.Ident{ast.NewIdent(name)},
+						Type:  ast.NewIdent("bool"),
+					}},
+				}})
+			}
+		}
+		fixed = append(fixed, stmt)
+		fixed = append(fixed, f.exitChecks(t)...)
+	}
+	return fixed
+}
+
+// exitChecks returns the statements following the target t, which break or continue the enclosing target
+// when a branch statement inside t left it for that target or an outer one.
+func (f *branchFixer) exitChecks(t *branchTarget) []ast.Stmt {
+	var checks []ast.Stmt
+	for _, exit := range t.exits {
+		var body []ast.Stmt
+		outer := f.targets[len(f.targets)-1]
+		flag := exit.target.breakFlag
+		if exit.tok == token.CONTINUE {
+			flag = exit.target.continueFlag
+			if exit.target == outer {
+				body = append(body, &ast.AssignStmt{
+					Lhs: []ast.Expr{ast.NewIdent(flag)},
+					Tok: token.ASSIGN,
+					Rhs: []ast.Expr{ast.NewIdent("false")},
+				})
+			}
+		}
+		tok := token.BREAK
+		if exit.tok == token.CONTINUE && exit.target == outer {
+			tok = token.CONTINUE
+		}
+		body = append(body, &ast.BranchStmt{Tok: tok})
+		checks = append(checks, &ast.IfStmt{Cond: ast.NewIdent(flag), Body: &ast.BlockStmt{List: body}})
+	}
+	return checks
+}
+
+// stmt returns the statement replacing stmt, whose inner statements are fixed.
+func (f *branchFixer) stmt(stmt ast.Stmt) ast.Stmt {
+	switch stmt := stmt.(type) {
+	case *ast.BranchStmt:
+		return f.branch(stmt)
+	case *ast.LabeledStmt:
+		stmt.Stmt = f.stmt(stmt.Stmt)
+	case *ast.BlockStmt:
+		stmt.List = f.stmts(stmt.List)
+	case *ast.IfStmt:
+		stmt.Body.List = f.stmts(stmt.Body.List)
+		if stmt.Else != nil {
+			stmt.Else = f.stmt(stmt.Else)
+		}
+	case *ast.ForStmt:
+		stmt.Body.List = f.stmts(stmt.Body.List)
+	case *ast.RangeStmt:
+		stmt.Body.List = f.stmts(stmt.Body.List)
+	case *ast.SwitchStmt:
+		f.clauses(stmt.Body)
+	case *ast.TypeSwitchStmt:
+		f.clauses(stmt.Body)
+	case *ast.SelectStmt:
+		f.clauses(stmt.Body)
+	}
+	return stmt
+}
+
+// clauses fixes the statements of the clauses of a switch, type switch or select statement.
+func (f *branchFixer) clauses(body *ast.BlockStmt) {
+	for _, clause := range body.List {
+		switch clause := clause.(type) {
+		case *ast.CaseClause:
+			clause.Body = f.stmts(clause.Body)
+		case *ast.CommClause:
+			clause.Body = f.stmts(clause.Body)
+		}
+	}
+}
+
+// branch returns the statement replacing the branch statement stmt: the labeled break statements whose target
+// is not the innermost target, and the labeled continue statements whose target is not the innermost loop, set
+// the flag of their target and break the innermost target.
+func (f *branchFixer) branch(stmt *ast.BranchStmt) ast.Stmt {
+	if stmt.Label == nil || (stmt.Tok != token.BREAK && stmt.Tok != token.CONTINUE) {
+		return stmt
+	}
+	index := -1
+	innermost := len(f.targets) - 1
+	for i := len(f.targets) - 1; i >= 0; i-- {
+		t := f.targets[i]
+		if stmt.Tok == token.CONTINUE && !t.loop && innermost == i {
+			innermost--
+		}
+		if t.hasLabel(stmt.Label.Name) {
+			index = i
+			break
+		}
+	}
+	if index < 0 || index == innermost {
+		// Invalid, or already right.
+		return stmt
+	}
+
+	t := f.targets[index]
+	var flag string
+	if stmt.Tok == token.BREAK {
+		if t.breakFlag == "" {
+			t.breakFlag = breakFlagPrefix + stmt.Label.Name
+		}
+		flag = t.breakFlag
+	} else {
+		if t.continueFlag == "" {
+			t.continueFlag = continueFlagPrefix + stmt.Label.Name
+		}
+		flag = t.continueFlag
+	}
+	for _, inner := range f.targets[index+1:] {
+		inner.addExit(branchExit{t, stmt.Tok})
+	}
+	return &ast.BlockStmt{Lbrace: stmt.Pos(), List: []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs:    []ast.Expr{&ast.Ident{NamePos: stmt.Pos(), Name: flag}},
+			TokPos: stmt.Pos(),
+			Tok:    token.ASSIGN,
+			Rhs:    []ast.Expr{ast.NewIdent("true")},
+		},
+		&ast.BranchStmt{TokPos: stmt.Pos(), Tok: token.BREAK},
+	}}
+}
+
+// hasLabel reports whether name labels t.
+func (t *branchTarget) hasLabel(name string) bool {
+	for _, label := range t.labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addExit records exit, unless t has it already.
+func (t *branchTarget) addExit(exit branchExit) {
+	for _, e := range t.exits {
+		if e == exit {
+			return
+		}
+	}
+	t.exits = append(t.exits, exit)
+}
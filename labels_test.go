@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestLabeledBranches tests that the labeled break and continue statements leave the statements they name, across
+// nested loops, switches and selects.
+func TestLabeledBranches(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{`func continueOuter() int {
+	n := 0
+Outer:
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			switch j {
+			case 1:
+				continue Outer
+			}
+			n += i*10 + j
+		}
+	}
+	return n
+}
+continueOuter()`, 30},
+		{`func breakOuter() int {
+	n := 0
+Outer:
+	for i := 0; ; i++ {
+		for j := 0; j < 3; j++ {
+			switch {
+			case i == 2:
+				break Outer
+			}
+			n += i*10 + j
+		}
+	}
+	return n
+}
+breakOuter()`, 36},
+		{`func breakLoop() int {
+	c := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		c <- i
+	}
+	n := 0
+Loop:
+	for {
+		select {
+		case v := <-c:
+			if v == 5 {
+				break Loop
+			}
+			n += v
+		}
+	}
+	return n
+}
+breakLoop()`, 10},
+		{`func breakSwitch() int {
+	n := 0
+Sw:
+	switch {
+	default:
+		for i := 0; ; i++ {
+			if i == 4 {
+				break Sw
+			}
+			n++
+		}
+		n = 100
+	}
+	return n
+}
+breakSwitch()`, 4},
+		// A labeled continue of the innermost loop is left alone.
+		{`func continueInner() int {
+	n := 0
+L:
+	for i := 0; i < 3; i++ {
+		n++
+		continue L
+	}
+	return n
+}
+continueInner()`, 3},
+		// The labels of function literals are theirs.
+		{`func nested() int {
+	n := 0
+	f := func() {
+	Outer:
+		for i := 0; i < 3; i++ {
+			for {
+				n++
+				continue Outer
+			}
+		}
+	}
+	f()
+	return n
+}
+nested()`, 3},
+		// The labels of the top level of the cells, after other statements or first, are the cell's.
+		{`n := 0
+L:
+for i := 0; i < 3; i++ {
+	switch i {
+	case 1:
+		break L
+	}
+	n++
+}
+n`, 1},
+		{`Outer:
+for i := 0; i < 3; i++ {
+	for j := 0; j < 3; j++ {
+		if j == 1 {
+			continue Outer
+		}
+		n += 10
+	}
+}
+n`, 31},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+}
+
+// TestWrapTopLevelLabels tests that the top-level labeled statements are wrapped for the parser without moving the
+// other statements.
+func TestWrapTopLevelLabels(t *testing.T) {
+	cases := []struct {
+		code string
+		want string
+	}{
+		{"L:\nfor {\n\tbreak L\n}\n1", "__gophernotesLabels(func() {L:\nfor {\n\tbreak L\n}})\n1"},
+		{"n := 0 // c\nA: B: for i := 0; i < 3; i++ {\n}\nn", "n := 0; __gophernotesLabels(func() { // c\nA: B: for i := 0; i < 3; i++ {\n}})\nn"},
+		{"x := 1; L: switch x { case 1: break L }; x", "x := 1;__gophernotesLabels(func() { L: switch x { case 1: break L }}); x"},
+		{"m := map[string]int{\"a\": 1}\nfunc f() {\nL:\n\tfor {\n\t\tbreak L\n\t}\n}", "m := map[string]int{\"a\": 1}\nfunc f() {\nL:\n\tfor {\n\t\tbreak L\n\t}\n}"},
+	}
+	for _, c := range cases {
+		if got := wrapTopLevelLabels(c.code); got != c.want {
+			t.Errorf("\t%s Expected %q but got %q", failure, c.want, got)
+		}
+	}
+}
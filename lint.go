@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// lintAnalyzers holds the analyzers enabled or disabled by `%lint enable|disable`. When an analyzer is enabled,
+// only the enabled ones run, otherwise all of them but those disabled, like the flags of go vet.
+var lintAnalyzers = make(map[string]bool)
+
+// lintTool is the vet tool set by `%lint tool path`, running its analyzers instead of those of go vet.
+var lintTool string
+
+func init() {
+	lineMagics["lint"] = lintMagic
+}
+
+// lintMagic implements `%lint [enable analyzer...|disable analyzer...|all|tool path|tool default]`.
+func lintMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if len(args) == 0 {
+		return publishLint(ir, receipt)
+	}
+
+	switch args[0] {
+	case "enable", "disable":
+		if len(args) == 1 {
+			return fmt.Errorf("%s: expected the names of analyzers", args[0])
+		}
+		for _, name := range args[1:] {
+			lintAnalyzers[name] = args[0] == "enable"
+		}
+	case "all":
+		lintAnalyzers = make(map[string]bool)
+	case "tool":
+		if len(args) != 2 {
+			return errors.New("tool: expected the path of a vet tool, or default")
+		}
+		if args[1] == "default" {
+			lintTool = ""
+			return nil
+		}
+		tool, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+		lintTool = tool
+	default:
+		return fmt.Errorf("unknown subcommand %q, expected enable, disable, all or tool", args[0])
+	}
+	return nil
+}
+
+// lintFlags returns the flags of go vet selecting the analyzers configured with `%lint`.
+func lintFlags() []string {
+	var flags []string
+	if lintTool != "" {
+		flags = append(flags, "-vettool="+lintTool)
+	}
+	for name, enabled := range lintAnalyzers {
+		flags = append(flags, fmt.Sprintf("-%s=%v", name, enabled))
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// publishLint checks the code of the session with the configured analyzers and displays their findings,
+// grouped by cell.
+func publishLint(ir *classic.Interp, receipt *msgReceipt) error {
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	diags, err := vetSession(ir, deps.sortedCells(), lintFlags())
+	if err != nil {
+		return err
+	}
+	markdown, text := lintReport(diags)
+	return receipt.PublishDisplayData(bundledMIMEData{
+		"text/markdown": markdown,
+		"text/plain":    text,
+	}, nil, "")
+}
+
+// markdownEscaper escapes the characters of findings that Markdown would take for emphasis.
+var markdownEscaper = strings.NewReplacer("*", `\*`, "_", `\_`)
+
+// lintReport renders findings, sorted by cell, as Markdown and plain text listings grouped by cell.
+func lintReport(diags []vetDiagnostic) (markdown, text string) {
+	if len(diags) == 0 {
+		return "No findings.\n", "No findings.\n"
+	}
+
+	var md, plain strings.Builder
+	for i, d := range diags {
+		if i == 0 || diags[i-1].cell != d.cell {
+			if i > 0 {
+				md.WriteString("\n")
+			}
+			fmt.Fprintf(&md, "**%s**\n\n", d.cell.label)
+			fmt.Fprintf(&plain, "%s\n", d.cell.label)
+		}
+		finding := fmt.Sprintf("line %d:%d: %s (%s)", d.line, d.column, d.message, d.analyzer)
+		fmt.Fprintf(&md, "- %s\n", markdownEscaper.Replace(finding))
+		fmt.Fprintf(&plain, "\t%s\n", finding)
+	}
+	return md.String(), plain.String()
+}
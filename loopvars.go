@@ -0,0 +1,150 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// loopVarPtrPrefix starts the names of the variables pointing to the copy of a variable of a for loop made for
+// the current iteration.
+const loopVarPtrPrefix = "__gophernotesLoopVar_"
+
+// fixLoopVars rewrites the loops of nodes whose variables may outlive an iteration, captured by a function
+// literal or by taking their address, so that each iteration has variables of its own, like in Go 1.22. The
+// interpreter declares them once per loop instead.
+func fixLoopVars(nodes []ast.Node) {
+	for i, node := range nodes {
+		if stmt, ok := node.(ast.Stmt); ok {
+			nodes[i] = fixLoopVar(stmt)
+		}
+	}
+	instrumentBlocks(nodes, func(stmts []ast.Stmt) []ast.Stmt {
+		for i, stmt := range stmts {
+			stmts[i] = fixLoopVar(stmt)
+		}
+		return stmts
+	})
+}
+
+// fixLoopVar returns the statement replacing stmt if it is a loop to fix, or stmt. The variables of a range
+// statement are declared again from themselves at the start of its body. A for statement
+//
+//	for i := 0; i < n; i++ { body }
+//
+// becomes
+//
+//	{
+//		i := 0
+//		p := &i
+//		for ; i < n; func() { i = *p; i++ }() {
+//			i := i
+//			p = &i
+//			body
+//		}
+//	}
+//
+// so that the post statement starts from the value the variable has at the end of the iteration.
+func fixLoopVar(stmt ast.Stmt) ast.Stmt {
+	switch loop := stmt.(type) {
+	case *ast.RangeStmt:
+		if loop.Tok != token.DEFINE {
+			return stmt
+		}
+		names := identNames(loop.Key, loop.Value)
+		if len(names) == 0 || !capturesVars(loop.Body, names) {
+			return stmt
+		}
+		loop.Body.List = append([]ast.Stmt{redeclare(names)}, loop.Body.List...)
+		return stmt
+
+	case *ast.ForStmt:
+		init, ok := loop.Init.(*ast.AssignStmt)
+		if !ok || init.Tok != token.DEFINE {
+			return stmt
+		}
+		names := identNames(init.Lhs...)
+		if len(names) == 0 || !(capturesVars(loop.Body, names) || capturesVars(loop.Cond, names) ||
+			capturesVars(loop.Post, names)) {
+			return stmt
+		}
+
+		// The block has the position of the loop, so that it is traced and covered like it.
+		block := &ast.BlockStmt{Lbrace: loop.Pos(), List: []ast.Stmt{init}, Rbrace: loop.End() - 1}
+		var copyBack, point []ast.Stmt
+		for _, name := range names {
+			ptr := loopVarPtrPrefix + name
+			block.List = append(block.List, &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(ptr)},
+				Tok: token.DEFINE,
+				Rhs: []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent(name)}},
+			})
+			copyBack = append(copyBack, &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(name)},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.StarExpr{X: ast.NewIdent(ptr)}},
+			})
+			point = append(point, &ast.AssignStmt{
+				Lhs: []ast.Expr{ast.NewIdent(ptr)},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent(name)}},
+			})
+		}
+		if loop.Post != nil {
+			copyBack = append(copyBack, loop.Post)
+		}
+		loop.Init = nil
+		loop.Post = &ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.FuncLit{
+			Type: &ast.FuncType{Params: &ast.FieldList{}},
+			Body: &ast.BlockStmt{List: copyBack},
+		}}}
+		body := append([]ast.Stmt{redeclare(names)}, point...)
+		loop.Body.List = append(body, loop.Body.List...)
+		block.List = append(block.List, stmt)
+		return block
+	}
+	return stmt
+}
+
+// identNames returns the names of exprs that are identifiers other than `_`.
+func identNames(exprs ...ast.Expr) []string {
+	var names []string
+	for _, expr := range exprs {
+		if ident, ok := expr.(*ast.Ident); ok && ident.Name != "_" {
+			names = append(names, ident.Name)
+		}
+	}
+	return names
+}
+
+// capturesVars reports whether node has a function literal, or takes the address of one of the variables
+// names.
+func capturesVars(node ast.Node, names []string) bool {
+	if node == nil {
+		return false
+	}
+	captures := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			captures = true
+		case *ast.UnaryExpr:
+			if ident, ok := n.X.(*ast.Ident); ok && n.Op == token.AND {
+				for _, name := range names {
+					captures = captures || ident.Name == name
+				}
+			}
+		}
+		return !captures
+	})
+	return captures
+}
+
+// redeclare returns the declaration of the variables names from the variables of the same names.
+func redeclare(names []string) ast.Stmt {
+	assign := &ast.AssignStmt{Tok: token.DEFINE}
+	for _, name := range names {
+		assign.Lhs = append(assign.Lhs, ast.NewIdent(name))
+		assign.Rhs = append(assign.Rhs, ast.NewIdent(name))
+	}
+	return assign
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestLoopVars tests that each iteration of a loop has variables of its own, like in Go 1.22.
+func TestLoopVars(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{`var fs []func() int
+for i := 0; i < 3; i++ {
+	fs = append(fs, func() int { return i })
+}
+fs[0]() + fs[1]()*10 + fs[2]()*100`, 210},
+		{`var ps []*int
+for i := 0; i < 3; i++ {
+	ps = append(ps, &i)
+}
+*ps[0] + *ps[1]*10 + *ps[2]*100`, 210},
+		// The changes of the body and the continue statements carry over to the next iteration.
+		{`var seen []func() int
+for i := 0; i < 10; i++ {
+	if i%2 == 1 {
+		continue
+	}
+	seen = append(seen, func() int { return i })
+	i++
+}
+seen[0]() + seen[1]()*10 + seen[4]()*100`, 931},
+		{`var gs []func() string
+for k, v := range []string{"a", "b"} {
+	gs = append(gs, func() string { return v + string(rune('0'+k)) })
+}
+gs[0]() + gs[1]()`, "a0b1"},
+		{`func collect() int {
+	var fs []func() int
+	for i, j := 0, 10; i < 3; i, j = i+1, j-1 {
+		fs = append(fs, func() int { return i * j })
+	}
+	return fs[0]() + fs[1]() + fs[2]()
+}
+collect()`, 0 + 9 + 16},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// magicFunc runs a magic command with the given arguments on behalf of the cell being executed.
+type magicFunc func(ir *classic.Interp, receipt *msgReceipt, args []string) error
+
+// lineMagics maps the name of each supported line magic, e.g. "preview" for `%preview on`, to its handler.
+// Magics register themselves from the init function of the file implementing them.
+var lineMagics = make(map[string]magicFunc)
+
+// cellMagicFunc runs a cell magic, e.g. `%%capture out`, with the given arguments on the body of the cell (the
+// cell without its first line) and returns the values the cell evaluates to.
+type cellMagicFunc func(ir *classic.Interp, receipt *msgReceipt, args []string, body string) ([]interface{}, error)
+
+// cellMagics maps the name of each supported cell magic to its handler. Like line magics, they register
+// themselves from the init function of the file implementing them.
+var cellMagics = make(map[string]cellMagicFunc)
+
+// evalCell runs the cell magic on the first line of a cell, if any. Otherwise it runs the line magics at the
+// top of the cell, followed by its Go code, and checks its output against its `// Output:` comment, if any.
+func evalCell(ir *classic.Interp, receipt *msgReceipt, code string) ([]interface{}, error) {
+	if strings.HasPrefix(code, "%%") {
+		// Keep the first line of the body blank so that line numbers still match the cell.
+		firstLine, body := code, ""
+		if i := strings.IndexByte(code, '\n'); i >= 0 {
+			firstLine, body = code[:i], code[i:]
+		}
+
+		fields := strings.Fields(firstLine[2:])
+		if len(fields) == 0 {
+			return nil, errors.New("missing magic name after %%")
+		}
+
+		magic, ok := cellMagics[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown cell magic %%%%%s", fields[0])
+		}
+		vals, err := magic(ir, receipt, fields[1:], body)
+		if _, ok := err.(executionError); ok {
+			// The errors of the code run by the magic keep their name.
+			return vals, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%%%%%s: %v", fields[0], err)
+		}
+		return vals, nil
+	}
+
+	// Options set by line magics for a single cell, like `%coverage`, must not leak into the next one.
+	coverCell = false
+
+	code, err := runLineMagics(ir, receipt, code)
+	if err != nil {
+		return nil, err
+	}
+
+	// A cell ending with an `// Output:` comment fails when its output differs.
+	if want, unordered, ok := goldenOutput(code); ok {
+		return checkOutput(want, unordered, func() ([]interface{}, error) {
+			return doEval(ir, code)
+		})
+	}
+	return doEval(ir, code)
+}
+
+// runLineMagics runs the `%magic args` lines at the top of a cell, in order, and returns the code with
+// these lines blanked out so that the line numbers of later errors still match the cell.
+func runLineMagics(ir *classic.Interp, receipt *msgReceipt, code string) (string, error) {
+	lines := strings.SplitAfter(code, "\n")
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "%") || strings.HasPrefix(trimmed, "%%") {
+			break
+		}
+
+		fields := strings.Fields(trimmed[1:])
+		if len(fields) == 0 {
+			return code, fmt.Errorf("line %d: missing magic name after %%", i+1)
+		}
+
+		magic, ok := lineMagics[fields[0]]
+		if !ok {
+			return code, fmt.Errorf("line %d: unknown magic %%%s", i+1, fields[0])
+		}
+		if err := magic(ir, receipt, fields[1:]); err != nil {
+			return code, fmt.Errorf("%%%s: %v", fields[0], err)
+		}
+
+		lines[i] = strings.Repeat("\n", strings.Count(line, "\n"))
+	}
+
+	return strings.Join(lines, ""), nil
+}
+
+// parseSwitch parses the single "on" or "off" argument of a magic toggling an option.
+func parseSwitch(args []string) (bool, error) {
+	if len(args) == 1 {
+		switch args[0] {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("expected \"on\" or \"off\", got %q", strings.Join(args, " "))
+}
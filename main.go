@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 )
 
 const (
@@ -22,6 +23,39 @@ func main() {
 		log.Fatalln("Need a command line argument specifying the connection file.")
 	}
 
+	// Kernel specs may set the go environment unexpanded.
+	expandGoEnv()
+
+	// Run the subcommands.
+	switch flag.Arg(0) {
+	case "install":
+		if err := installCommand(flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	case "run":
+		if err := runCommand(flag.Args()[1:]); err != nil {
+			log.Println(err)
+			os.Exit(exitCode(err))
+		}
+		return
+	case "scaffold":
+		if err := scaffoldCommand(flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	case "doctor":
+		if err := doctorCommand(flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	case "cache":
+		if err := cacheCommand(flag.Args()[1:]); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	// Run the kernel.
 	runKernel(flag.Arg(0))
 }
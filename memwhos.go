@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	r "reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+)
+
+func init() {
+	lineMagics["memwhos"] = memwhosMagic
+}
+
+// bindSize is the estimated memory retained by a top-level symbol of the session.
+type bindSize struct {
+	name string
+	typ  r.Type
+	size uintptr
+}
+
+// memwhosMagic implements `%memwhos [size|name|type]`, which lists the top-level variables, constants and
+// functions of the session with an estimate of the memory each retains, sorted by the given column.
+func memwhosMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+
+	sortBy := "size"
+	if len(args) > 0 {
+		sortBy = args[0]
+	}
+
+	var sizes []bindSize
+	for name, value := range ir.Env.Binds.AsMap() {
+		// Imported packages and the helpers defined by the kernel are not user data.
+		if strings.HasPrefix(name, "__gophernotes") || value.Type() == r.TypeOf((*base.PackageRef)(nil)) {
+			continue
+		}
+		sizes = append(sizes, bindSize{name: name, typ: value.Type(), size: deepSize(value)})
+	}
+
+	var less func(a, b bindSize) bool
+	switch sortBy {
+	case "size":
+		less = func(a, b bindSize) bool { return a.size > b.size || a.size == b.size && a.name < b.name }
+	case "name":
+		less = func(a, b bindSize) bool { return a.name < b.name }
+	case "type":
+		less = func(a, b bindSize) bool { return a.typ.String() < b.typ.String() || a.typ == b.typ && a.name < b.name }
+	default:
+		return fmt.Errorf("cannot sort by %q, expected size, name or type", sortBy)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return less(sizes[i], sizes[j]) })
+
+	return receipt.PublishDisplayData(bundledMIMEData{
+		"text/plain": memwhosText(sizes),
+		"text/html":  memwhosHTML(sizes),
+	}, nil, "")
+}
+
+// memwhosText formats sizes as a text table.
+func memwhosText(sizes []bindSize) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tType\tSize")
+	for _, s := range sizes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.name, s.typ, formatBytes(s.size))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// memwhosHTML formats sizes as an HTML table.
+func memwhosHTML(sizes []bindSize) string {
+	var buf bytes.Buffer
+	buf.WriteString("<table><thead><tr><th>Name</th><th>Type</th><th>Size</th></tr></thead><tbody>")
+	for _, s := range sizes {
+		fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td><td>%s</td></tr>",
+			html.EscapeString(s.name), html.EscapeString(s.typ.String()), formatBytes(s.size))
+	}
+	buf.WriteString("</tbody></table>")
+	return buf.String()
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(n uintptr) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uintptr(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// deepSize estimates the memory retained by v: its own size plus the size of the memory it references
+// through pointers, slices, maps, strings, interfaces and channels. Memory referenced several times, e.g.
+// through cycles, is counted once.
+func deepSize(v r.Value) uintptr {
+	return v.Type().Size() + referencedSize(v, make(map[uintptr]bool))
+}
+
+// referencedSize returns the size of the memory referenced by v that was not seen yet.
+func referencedSize(v r.Value, seen map[uintptr]bool) uintptr {
+	switch v.Kind() {
+	case r.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return v.Elem().Type().Size() + referencedSize(v.Elem(), seen)
+	case r.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := uintptr(v.Cap()) * v.Type().Elem().Size()
+		if hasPointers(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				size += referencedSize(v.Index(i), seen)
+			}
+		}
+		return size
+	case r.Array:
+		var size uintptr
+		if hasPointers(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				size += referencedSize(v.Index(i), seen)
+			}
+		}
+		return size
+	case r.String:
+		return uintptr(v.Len())
+	case r.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		var size uintptr
+		for _, key := range v.MapKeys() {
+			value := v.MapIndex(key)
+			size += key.Type().Size() + referencedSize(key, seen)
+			size += value.Type().Size() + referencedSize(value, seen)
+		}
+		return size
+	case r.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return v.Elem().Type().Size() + referencedSize(v.Elem(), seen)
+	case r.Struct:
+		var size uintptr
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen)
+		}
+		return size
+	case r.Chan:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return uintptr(v.Cap()) * v.Type().Elem().Size()
+	}
+	return 0
+}
+
+// hasPointers reports whether values of type t may reference other memory.
+func hasPointers(t r.Type) bool {
+	switch t.Kind() {
+	case r.Bool, r.Int, r.Int8, r.Int16, r.Int32, r.Int64, r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64,
+		r.Uintptr, r.Float32, r.Float64, r.Complex64, r.Complex128:
+		return false
+	case r.Array:
+		return hasPointers(t.Elem())
+	case r.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
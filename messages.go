@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/nu7hatch/gouuid"
@@ -35,6 +36,10 @@ type msgReceipt struct {
 	Msg        ComposedMsg
 	Identities [][]byte
 	Sockets    SocketGroup
+
+	// capture collects the streams and displays published on behalf of a cell run with the `%%capture`
+	// magic instead of sending them to the front-end.
+	capture *outputCapture
 }
 
 // bundledMIMEData holds data that can be presented in multiple formats. The keys are MIME types
@@ -130,8 +135,14 @@ func (msg ComposedMsg) ToWireMsg(signkey []byte) ([][]byte, error) {
 	return msgparts, nil
 }
 
+// sendMu serializes the messages sent by SendResponse, which goroutines publishing outputs in the background,
+// like stream.Consume, call concurrently with the cell being executed.
+var sendMu sync.Mutex
+
 // SendResponse sends a message back to return identites of the received message.
 func (receipt *msgReceipt) SendResponse(socket *zmq.Socket, msg ComposedMsg) error {
+	sendMu.Lock()
+	defer sendMu.Unlock()
 
 	for _, idt := range receipt.Identities {
 		_, err := socket.Send(string(idt), zmq.SNDMORE)
@@ -239,8 +250,8 @@ func (receipt *msgReceipt) PublishExecutionInput(execCount int, code string) err
 	)
 }
 
-// PublishExecuteResult publishes the result of the `execCount` execution as a string.
-func (receipt *msgReceipt) PublishExecutionResult(execCount int, output string) error {
+// PublishExecuteResult publishes the result of the `execCount` execution.
+func (receipt *msgReceipt) PublishExecutionResult(execCount int, data bundledMIMEData) error {
 	return receipt.Publish("execute_result",
 		struct {
 			ExecCount int             `json:"execution_count"`
@@ -248,27 +259,107 @@ func (receipt *msgReceipt) PublishExecutionResult(execCount int, output string)
 			Metadata  bundledMIMEData `json:"metadata"`
 		}{
 			ExecCount: execCount,
-			Data:      newTextBundledMIMEData(output),
+			Data:      fitDisplayData(compressImages(data, currentImageOptions()), maxDisplaySize),
 			Metadata:  make(bundledMIMEData),
 		},
 	)
 }
 
-// PublishExecuteResult publishes a serialized error that was encountered during execution.
-func (receipt *msgReceipt) PublishExecutionError(err string, trace []string) error {
+// PublishExecutionError publishes a serialized error that was encountered during execution, named ename.
+func (receipt *msgReceipt) PublishExecutionError(ename, err string, trace []string) error {
 	return receipt.Publish("error",
 		struct {
 			Name  string   `json:"ename"`
 			Value string   `json:"evalue"`
 			Trace []string `json:"traceback"`
 		}{
-			Name:  "ERROR",
+			Name:  ename,
 			Value: err,
 			Trace: trace,
 		},
 	)
 }
 
+// PublishDisplayData publishes a rich representation of some data to be displayed on the front-end. If displayID
+// is not empty, the output can later be replaced with PublishUpdateDisplayData.
+func (receipt *msgReceipt) PublishDisplayData(data, metadata bundledMIMEData, displayID string) error {
+	return receipt.publishDisplay("display_data", data, metadata, displayID)
+}
+
+// PublishUpdateDisplayData replaces the data of the output previously published with the given displayID.
+func (receipt *msgReceipt) PublishUpdateDisplayData(data, metadata bundledMIMEData, displayID string) error {
+	return receipt.publishDisplay("update_display_data", data, metadata, displayID)
+}
+
+// publishDisplay publishes a "display_data" or "update_display_data" message.
+func (receipt *msgReceipt) publishDisplay(msgType string, data, metadata bundledMIMEData, displayID string) error {
+	data = fitDisplayData(compressImages(data, currentImageOptions()), maxDisplaySize)
+	if receipt.capture != nil {
+		if msgType == "update_display_data" {
+			receipt.capture.update(data, displayID)
+		} else {
+			receipt.capture.display(data, displayID)
+		}
+		return nil
+	}
+
+	if metadata == nil {
+		metadata = make(bundledMIMEData)
+	}
+
+	transient := make(map[string]interface{})
+	if displayID != "" {
+		transient["display_id"] = displayID
+	}
+
+	return receipt.Publish(msgType,
+		struct {
+			Data      bundledMIMEData        `json:"data"`
+			Metadata  bundledMIMEData        `json:"metadata"`
+			Transient map[string]interface{} `json:"transient"`
+		}{
+			Data:      data,
+			Metadata:  metadata,
+			Transient: transient,
+		},
+	)
+}
+
+// PublishCommOpen publishes a "comm_open" message opening a comm with the given id on the front-end.
+func (receipt *msgReceipt) PublishCommOpen(commID, targetName string, data map[string]interface{}, metadata map[string]interface{}) error {
+	msg, err := NewMsg("comm_open", receipt.Msg)
+	if err != nil {
+		return err
+	}
+
+	if metadata != nil {
+		msg.Metadata = metadata
+	}
+	msg.Content = struct {
+		CommID     string                 `json:"comm_id"`
+		TargetName string                 `json:"target_name"`
+		Data       map[string]interface{} `json:"data"`
+	}{
+		CommID:     commID,
+		TargetName: targetName,
+		Data:       data,
+	}
+	return receipt.SendResponse(receipt.Sockets.IOPubSocket, msg)
+}
+
+// PublishCommMsg publishes a "comm_msg" message carrying data to the comm with the given id.
+func (receipt *msgReceipt) PublishCommMsg(commID string, data map[string]interface{}) error {
+	return receipt.Publish("comm_msg",
+		struct {
+			CommID string                 `json:"comm_id"`
+			Data   map[string]interface{} `json:"data"`
+		}{
+			CommID: commID,
+			Data:   data,
+		},
+	)
+}
+
 const (
 	// StreamStdout defines the stream name for standard out on the front-end. It
 	// is used in `PublishWriteStream` to specify the stream to write to.
@@ -282,6 +373,11 @@ const (
 // PublishWriteStream prints the data string to a stream on the front-end. This is
 // either `StreamStdout` or `StreamStderr`.
 func (receipt *msgReceipt) PublishWriteStream(stream string, data string) error {
+	if receipt.capture != nil {
+		receipt.capture.write(stream, data)
+		return nil
+	}
+
 	return receipt.Publish("stream",
 		struct {
 			Stream string `json:"name"`
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	r "reflect"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// methodFuncPrefix prefixes the names of the functions implementing method expressions, and binding method values
+// to a copy of their receiver.
+const methodFuncPrefix = "__gophernotesMethod"
+
+// methodKey identifies a function of methodFuncs: the method expression of the method name of typ, or the method
+// value binding it when value is set.
+type methodKey struct {
+	typ   r.Type
+	name  string
+	value bool
+}
+
+// sessionMethods holds the names of the functions defined for the method expressions and values of the session
+// of ir.
+type sessionMethods struct {
+	ir    *classic.Interp
+	names map[methodKey]string
+}
+
+var methodFuncs = &sessionMethods{}
+
+// bindMethods rewrites the method expressions of node, like `(*bytes.Buffer).WriteString` or `T.Get`, which the
+// interpreter does not support, into functions taking the receiver as first argument. It also rewrites the method
+// values of the variables of the session, like `f := v.Get`, so that they are bound to a copy of v, or of the
+// pointer v, as the specification requires, instead of to the variable itself. The types and variables must be
+// known when node is evaluated: those local to functions are left to the interpreter. It returns the
+// replacement of node.
+func bindMethods(ir *classic.Interp, node ast.Node) ast.Node {
+	if methodFuncs.ir != ir {
+		methodFuncs.ir = ir
+		methodFuncs.names = make(map[methodKey]string)
+	}
+	declared := declaredNames([]ast.Node{node})
+
+	// The methods called at once behave like in compiled Go.
+	called := make(map[ast.Expr]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			called[unparen(call.Fun)] = true
+		}
+		return true
+	})
+
+	return rewriteExprs(node, func(expr ast.Expr) ast.Expr {
+		sel, ok := expr.(*ast.SelectorExpr)
+		if !ok {
+			return expr
+		}
+		name := sel.Sel.Name
+		if typ := sessionType(ir, sel.X, declared); typ != nil {
+			if fn := methodExpr(ir, typ, name); fn.IsValid() {
+				return &ast.Ident{NamePos: sel.Pos(), Name: methodFuncs.define(methodKey{typ, name, false}, fn)}
+			}
+			return expr
+		}
+
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok || called[sel] || declared[ident.Name] {
+			return expr
+		}
+		v := ir.Env.ValueOf(ident.Name)
+		if !v.IsValid() || v.Type() == nil {
+			return expr
+		}
+		if v.Type() == packageRefType {
+			return expr
+		}
+		if fn := methodValue(ir, v.Type(), name); fn.IsValid() {
+			return &ast.CallExpr{
+				Fun:    &ast.Ident{NamePos: sel.Pos(), Name: methodFuncs.define(methodKey{v.Type(), name, true}, fn)},
+				Args:   []ast.Expr{sel.X},
+				Rparen: sel.End(),
+			}
+		}
+		return expr
+	})
+}
+
+// define defines the function fn under a name of its own, and returns the name.
+func (m *sessionMethods) define(key methodKey, fn r.Value) string {
+	if name, ok := m.names[key]; ok {
+		return name
+	}
+	name := methodFuncPrefix + strconv.Itoa(len(m.names))
+	m.ir.Env.DefineVar(name, fn.Type(), fn)
+	m.names[key] = name
+	return name
+}
+
+// unparen returns expr without its parentheses.
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		paren, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.X
+	}
+}
+
+// sessionType returns the type expr refers to, a type of the session or of an imported package or a pointer to
+// one, or nil if expr is not a type or is declared by the node being evaluated.
+func sessionType(ir *classic.Interp, expr ast.Expr, declared map[string]bool) r.Type {
+	switch expr := unparen(expr).(type) {
+	case *ast.StarExpr:
+		if t := sessionType(ir, expr.X, declared); t != nil {
+			return r.PtrTo(t)
+		}
+	case *ast.Ident:
+		if declared[expr.Name] {
+			return nil
+		}
+		for env := ir.Env; env != nil; env = env.Outer {
+			if _, ok := env.Binds.Get(expr.Name); ok {
+				return nil
+			}
+			if t, ok := env.Types.Get(expr.Name); ok {
+				return t
+			}
+		}
+	case *ast.SelectorExpr:
+		if pkg, ok := expr.X.(*ast.Ident); ok && !declared[pkg.Name] {
+			if ref := packageRef(ir.Env.ValueOf(pkg.Name)); ref != nil {
+				return ref.Types[expr.Sel.Name]
+			}
+		}
+	}
+	return nil
+}
+
+// methodOf returns the method name of recv bound to it, looked up like the interpreter does, or the zero Value.
+func methodOf(ir *classic.Interp, recv r.Value, name string) r.Value {
+	if m := ir.Env.ObjMethodByName(recv, name); m.IsValid() {
+		return m
+	}
+	if recv.Kind() == r.Ptr {
+		if recv.IsNil() {
+			panic(errors.New("invalid memory address or nil pointer dereference"))
+		}
+		return ir.Env.ObjMethodByName(recv.Elem(), name)
+	}
+	return r.Value{}
+}
+
+// methodType returns the signature of the method name of the values of typ, without the receiver, or nil if
+// there is none.
+func methodType(ir *classic.Interp, typ r.Type, name string) r.Type {
+	if typ.Kind() == r.Interface {
+		if m, ok := typ.MethodByName(name); ok {
+			return m.Type
+		}
+		return nil
+	}
+	var m r.Value
+	if typ.Kind() == r.Ptr {
+		if m = ir.Env.ObjMethodByName(r.Zero(typ), name); !m.IsValid() {
+			m = ir.Env.ObjMethodByName(r.Zero(typ.Elem()), name)
+		}
+	} else {
+		m = ir.Env.ObjMethodByName(r.Zero(typ), name)
+	}
+	if !m.IsValid() {
+		return nil
+	}
+	return m.Type()
+}
+
+// methodExpr returns the function implementing the method expression typ.name, which takes the receiver as
+// first argument, or the zero Value if typ has no such method.
+func methodExpr(ir *classic.Interp, typ r.Type, name string) r.Value {
+	sig := methodType(ir, typ, name)
+	if sig == nil {
+		return r.Value{}
+	}
+	in := []r.Type{typ}
+	for i := 0; i < sig.NumIn(); i++ {
+		in = append(in, sig.In(i))
+	}
+	var out []r.Type
+	for i := 0; i < sig.NumOut(); i++ {
+		out = append(out, sig.Out(i))
+	}
+	return r.MakeFunc(r.FuncOf(in, out, sig.IsVariadic()), func(args []r.Value) []r.Value {
+		m := methodOf(ir, args[0], name)
+		if sig.IsVariadic() {
+			return m.CallSlice(args[1:])
+		}
+		return m.Call(args[1:])
+	})
+}
+
+// methodValue returns the function binding the method name to a copy of a receiver of type typ, or the zero
+// Value if the method needs no copy or typ has no such method. The methods with a pointer receiver of a value
+// are bound to its address, which the interpreter already does.
+func methodValue(ir *classic.Interp, typ r.Type, name string) r.Value {
+	st := typ
+	if st.Kind() == r.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() == r.Struct {
+		// The interpreter exports the fields of the struct types it creates.
+		c, size := utf8.DecodeRuneInString(name)
+		if _, ok := st.FieldByName(name); ok {
+			return r.Value{}
+		} else if _, ok := st.FieldByName(string(unicode.ToUpper(c)) + name[size:]); ok {
+			return r.Value{}
+		}
+	}
+	sig := methodType(ir, typ, name)
+	if sig == nil {
+		return r.Value{}
+	}
+	return r.MakeFunc(r.FuncOf([]r.Type{typ}, []r.Type{sig}, false), func(args []r.Value) []r.Value {
+		if args[0].Kind() == r.Interface && args[0].IsNil() {
+			panic(errors.New("invalid memory address or nil pointer dereference"))
+		}
+		return []r.Value{methodOf(ir, args[0], name)}
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	r "reflect"
+	"strconv"
+	"sync"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// mustName is the name of the builtin of the sessions unwrapping the results of a call that returns an error
+	// last, e.g. `n := must(strconv.Atoi(s))`, and failing the cell with the error when it is not nil.
+	mustName = "must"
+
+	// mustFuncName is the name of the function the calls of must with the call of a function are rewritten
+	// into: the interpreter only passes the first result of a call to a builtin.
+	mustFuncName = "__gophernotesMust"
+)
+
+// sessionMusts holds the calls passed to must by the cells of the session of ir, made by mustFuncName. Like the
+// range statements, those of functions are kept with them, the others only until the next node is fixed.
+type sessionMusts struct {
+	mu        sync.Mutex
+	ir        *classic.Interp
+	calls     map[int]*ast.CallExpr
+	next      int
+	transient []int
+}
+
+var musts = &sessionMusts{}
+
+// fixMusts rewrites the calls of the builtin must of node passing it the call of a function into calls of
+// mustFuncName, which makes the call and passes all its results to must. It returns the replacement of node.
+func fixMusts(ir *classic.Interp, node ast.Node) ast.Node {
+	musts.reset(ir)
+	declared := declaredNames([]ast.Node{node})
+	if declared[mustName] {
+		return node
+	}
+	if _, ok := ir.Env.Binds.Get(mustName); ok {
+		return node
+	}
+
+	inFunc := make(map[*ast.CallExpr]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			body = n.Body
+		case *ast.FuncLit:
+			body = n.Body
+		default:
+			return true
+		}
+		if body != nil {
+			ast.Inspect(body, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					inFunc[call] = true
+				}
+				return true
+			})
+		}
+		return false
+	})
+
+	return rewriteExprs(node, func(expr ast.Expr) ast.Expr {
+		call, ok := expr.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+			return expr
+		}
+		fun, ok := unparen(call.Fun).(*ast.Ident)
+		if !ok || fun.Name != mustName {
+			return expr
+		}
+		arg, ok := unparen(call.Args[0]).(*ast.CallExpr)
+		if !ok {
+			return expr
+		}
+		return musts.add(call, arg, inFunc[call])
+	})
+}
+
+// add records the call arg passed to must by call, kept if inFunc is set, and returns the call of mustFuncName
+// replacing call.
+func (m *sessionMusts) add(call, arg *ast.CallExpr, inFunc bool) ast.Expr {
+	m.mu.Lock()
+	index := m.next
+	m.next++
+	m.calls[index] = arg
+	if !inFunc {
+		m.transient = append(m.transient, index)
+	}
+	m.mu.Unlock()
+
+	return &ast.CallExpr{
+		Fun:    &ast.Ident{NamePos: call.Fun.Pos(), Name: mustFuncName},
+		Lparen: call.Lparen,
+		Args:   []ast.Expr{&ast.BasicLit{ValuePos: arg.Pos(), Kind: token.INT, Value: strconv.Itoa(index)}},
+		Rparen: call.Rparen,
+	}
+}
+
+// reset forgets the calls of the previous session when ir is a new interpreter, and defines must and
+// mustFuncName in it. Otherwise it forgets those of the previous node outside of functions, which it ran already.
+func (m *sessionMusts) reset(ir *classic.Interp) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, index := range m.transient {
+		delete(m.calls, index)
+	}
+	m.transient = nil
+	if m.ir == ir {
+		return
+	}
+	m.ir = ir
+	m.calls = make(map[int]*ast.CallExpr)
+
+	fn := builtinFunc(builtinMust)
+	ir.Env.TopEnv().DefineVar(mustName, fn.Type(), fn)
+	fn = builtinFunc(m.call)
+	ir.Env.DefineVar(mustFuncName, fn.Type(), fn)
+}
+
+// call implements mustFuncName: args is the index of the call passed to must, made in env.
+func (m *sessionMusts) call(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	m.mu.Lock()
+	call := m.calls[int(args[0].Int())]
+	m.mu.Unlock()
+
+	v, vals := env.EvalNode(call)
+	if vals == nil && v != base.None {
+		vals = []r.Value{v}
+	}
+	return mustValues(env, call, vals)
+}
+
+// builtinMust implements must with explicit arguments, e.g. `must(n, err)`.
+func builtinMust(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	return mustValues(env, nil, args)
+}
+
+// mustValues returns vals without the error last, or fails the cell with the error if it is not nil. The error is
+// reported with the position of the call returning vals, when known.
+func mustValues(env *classic.Env, call ast.Expr, vals []r.Value) (r.Value, []r.Value) {
+	if len(vals) == 0 {
+		env.Errorf("must: expected values ending with an error, found none")
+	}
+	last := vals[len(vals)-1]
+	if last.IsValid() && last != base.Nil && !last.Type().Implements(errorType) {
+		env.Errorf("must: expected values ending with an error, found %v", last.Type())
+	}
+	if err, _ := base.ValueInterface(last).(error); err != nil {
+		msg := err.Error()
+		if call != nil {
+			msg = fmt.Sprintf("%s: %s: %s", env.Fileset.Position(call.Pos()), types.ExprString(call), msg)
+		}
+		panic(executionError{fmt.Sprintf("%T", err), fmt.Errorf("%s", msg)})
+	}
+
+	switch vals = vals[:len(vals)-1]; len(vals) {
+	case 0:
+		return base.None, nil
+	case 1:
+		return vals[0], nil
+	}
+	return vals[0], vals
+}
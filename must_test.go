@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMust tests unwrapping the results of the calls returning an error with must.
+func TestMust(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{"import \"strconv\"\nmust(strconv.Atoi(\"42\"))", 42},
+		{"func pair() (int, string, error) { return 1, \"a\", nil }\nn, s := must(pair())\nstrconv.Itoa(n) + s", "1a"},
+		{"func check() error { return nil }\nmust(check())\n\"ok\"", "ok"},
+		{"v, err := strconv.ParseBool(\"true\")\nmust(v, err)", true},
+		{"func half(s string) int {\n\treturn must(strconv.Atoi(s)) / 2\n}\nhalf(\"8\") + half(\"4\")", 6},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %q to evaluate to %v but got %v, %v", failure, c.code, c.want, vals, err)
+		}
+	}
+
+	// A non-nil error fails the cell, named after its type.
+	_, err := doEval(ir, "x := 1\nx = must(strconv.Atoi(\"forty\"))")
+	if err == nil || errorName(err) != "*strconv.NumError" ||
+		!strings.HasSuffix(err.Error(), `:2:10: strconv.Atoi("forty"): strconv.Atoi: parsing "forty": invalid syntax`) {
+		t.Errorf("\t%s Expected a *strconv.NumError at the call of strconv.Atoi but got %v (%s)", failure, err, errorName(err))
+	}
+	if _, err := doEval(ir, "must(half(\"2\"))"); err == nil || !strings.Contains(err.Error(), "expected values ending with an error, found int") {
+		t.Errorf("\t%s Expected an error for a call without error result but got %v", failure, err)
+	}
+
+	// A function of the session named must is called instead.
+	if vals, err := doEval(ir, "func must(n int) int { return -n }\nmust(half(\"2\"))"); err != nil || len(vals) != 1 || vals[0] != -1 {
+		t.Errorf("\t%s Expected the function must of the session to be called but got %v, %v", failure, vals, err)
+	}
+}
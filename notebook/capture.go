@@ -0,0 +1,12 @@
+package notebook
+
+import "github.com/gopherdata/gophernotes/display"
+
+// CapturedOutput holds the output of a cell run with the %%capture magic instead of showing it.
+type CapturedOutput struct {
+	Stdout string
+	Stderr string
+
+	// Outputs holds the rich outputs of the cell, including its result, in the order they were produced.
+	Outputs []display.Data
+}
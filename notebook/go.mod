@@ -0,0 +1,7 @@
+module github.com/gopherdata/gophernotes/notebook
+
+go 1.25.0
+
+replace github.com/gopherdata/gophernotes/display => ../display
+
+require github.com/gopherdata/gophernotes/display v0.0.0-00010101000000-000000000000
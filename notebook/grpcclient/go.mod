@@ -0,0 +1,21 @@
+module github.com/gopherdata/gophernotes/notebook/grpcclient
+
+go 1.26.0
+
+replace github.com/gopherdata/gophernotes/display => ../../display
+
+replace github.com/gopherdata/gophernotes/notebook => ../../notebook
+
+require (
+	github.com/gopherdata/gophernotes/display v0.0.0-00010101000000-000000000000
+	github.com/gopherdata/gophernotes/notebook v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.84.0
+	google.golang.org/protobuf v1.36.12
+)
+
+require (
+	golang.org/x/net v0.58.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.41.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+)
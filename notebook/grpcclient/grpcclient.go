@@ -0,0 +1,344 @@
+// Package grpcclient explores gRPC servers from notebooks through their reflection service, and calls their
+// methods with JSON requests. It is a module of its own, so that the users of the notebook package do not depend
+// on gRPC.
+package grpcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// reflectionMethods are the methods of the reflection services, newest first. Both exchange the same
+// messages.
+var reflectionMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// Client explores a gRPC server through its reflection service: it lists the services and methods of the
+// server and calls them with JSON requests, without generated code.
+type Client struct {
+	conn *grpc.ClientConn
+
+	// reflection is the method of the reflection service supported by the server, found by the first call.
+	reflection string
+
+	// protos holds the descriptors of the files loaded from the server by name, and files the registry built
+	// from them.
+	protos map[string]*descriptorpb.FileDescriptorProto
+	files  *protoregistry.Files
+}
+
+// Dial connects to the gRPC server at target and checks that it supports reflection. target is
+// "host:port" for a server without TLS, or "https://host:port" for a server with TLS.
+func Dial(target string) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if strings.HasPrefix(target, "https://") {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	target = strings.TrimPrefix(strings.TrimPrefix(target, "https://"), "http://")
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("grpcclient: %v", err)
+	}
+
+	c := newClient(conn)
+	if _, err := c.Services(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient(conn *grpc.ClientConn) *Client {
+	return &Client{
+		conn:   conn,
+		protos: make(map[string]*descriptorpb.FileDescriptorProto),
+		files:  new(protoregistry.Files),
+	}
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Services returns the names of the services of the server, e.g. "helloworld.Greeter".
+func (c *Client) Services() ([]string, error) {
+	response, err := c.reflect(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// Methods returns the signatures of the methods of service, e.g.
+// "SayHello(helloworld.HelloRequest) returns (helloworld.HelloReply)".
+func (c *Client) Methods(service string) ([]string, error) {
+	s, err := c.service(service)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := s.Methods()
+	signatures := make([]string, methods.Len())
+	for i := range signatures {
+		m := methods.Get(i)
+		input, output := string(m.Input().FullName()), string(m.Output().FullName())
+		if m.IsStreamingClient() {
+			input = "stream " + input
+		}
+		if m.IsStreamingServer() {
+			output = "stream " + output
+		}
+		signatures[i] = fmt.Sprintf("%s(%s) returns (%s)", m.Name(), input, output)
+	}
+	return signatures, nil
+}
+
+// service returns the descriptor of service, loading the files defining it and their dependencies when needed.
+func (c *Client) service(service string) (protoreflect.ServiceDescriptor, error) {
+	if s, ok := c.findService(service); ok {
+		return s, nil
+	}
+
+	response, err := c.reflect(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.addFiles(response); err != nil {
+		return nil, err
+	}
+	// Ask for the dependencies the server did not send along, falling back to the well-known types linked into
+	// the kernel for those it does not know.
+	for missing := c.missingDeps(); len(missing) > 0; missing = c.missingDeps() {
+		for _, name := range missing {
+			response, err := c.reflect(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			})
+			if err == nil {
+				err = c.addFiles(response)
+			}
+			if c.protos[name] != nil {
+				continue
+			}
+			file, globalErr := protoregistry.GlobalFiles.FindFileByPath(name)
+			if globalErr != nil {
+				if err == nil {
+					err = fmt.Errorf("grpcclient: the gRPC server did not send %s", name)
+				}
+				return nil, err
+			}
+			c.protos[name] = protodesc.ToFileDescriptorProto(file)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, file := range c.protos {
+		set.File = append(set.File, file)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("grpcclient: invalid descriptors from the gRPC server: %v", err)
+	}
+	c.files = files
+
+	s, ok := c.findService(service)
+	if !ok {
+		return nil, fmt.Errorf("grpcclient: unknown gRPC service %s", service)
+	}
+	return s, nil
+}
+
+func (c *Client) findService(service string) (protoreflect.ServiceDescriptor, bool) {
+	d, err := c.files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, false
+	}
+	s, ok := d.(protoreflect.ServiceDescriptor)
+	return s, ok
+}
+
+// addFiles records the file descriptors of the reflection response.
+func (c *Client) addFiles(response *reflectionpb.ServerReflectionResponse) error {
+	for _, data := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(data, file); err != nil {
+			return fmt.Errorf("grpcclient: invalid descriptor from the gRPC server: %v", err)
+		}
+		c.protos[file.GetName()] = file
+	}
+	return nil
+}
+
+// missingDeps returns the dependencies of the files loaded that are not loaded yet.
+func (c *Client) missingDeps() []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, file := range c.protos {
+		for _, dep := range file.GetDependency() {
+			if c.protos[dep] == nil && !seen[dep] {
+				seen[dep] = true
+				missing = append(missing, dep)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// reflect sends a request to the reflection service and returns its response, or the error it reports.
+func (c *Client) reflect(request *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	methods := reflectionMethods
+	if c.reflection != "" {
+		methods = []string{c.reflection}
+	}
+
+	var response *reflectionpb.ServerReflectionResponse
+	var err error
+	for _, method := range methods {
+		if response, err = c.reflectWith(method, request); err == nil {
+			c.reflection = method
+			break
+		}
+		if status.Code(err) != codes.Unimplemented {
+			return nil, fmt.Errorf("grpcclient: %v", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("grpcclient: the gRPC server does not support reflection: %v", err)
+	}
+	if e := response.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("grpcclient: gRPC reflection: %s", e.GetErrorMessage())
+	}
+	return response, nil
+}
+
+// reflectWith sends request on a new stream of the reflection method, and returns the response.
+func (c *Client) reflectWith(method string, request *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	ctx, cancel := context.WithCancel(notebook.Context())
+	defer cancel()
+
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, method)
+	if err != nil {
+		return nil, err
+	}
+	// An io.EOF means the server ended the stream, with the status RecvMsg returns.
+	if err := stream.SendMsg(request); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	response := new(reflectionpb.ServerReflectionResponse)
+	if err := stream.RecvMsg(response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Invoke calls method, named "package.Service/Method" or "package.Service.Method", with the request given as a
+// JSON object and returns the response as collapsible JSON, following the proto3 JSON mapping. The decoded
+// response is available as data[display.MIMETypeJSON]. The responses of server streaming methods are returned
+// as a JSON array. The call stops when the cell is interrupted.
+func (c *Client) Invoke(method, request string) (display.Data, error) {
+	method = strings.TrimPrefix(method, "/")
+	i := strings.LastIndexAny(method, "/.")
+	if i < 0 {
+		return nil, fmt.Errorf("grpcclient: expected a method named package.Service/Method, got %q", method)
+	}
+	service, name := method[:i], method[i+1:]
+
+	s, err := c.service(service)
+	if err != nil {
+		return nil, err
+	}
+	m := s.Methods().ByName(protoreflect.Name(name))
+	if m == nil {
+		return nil, fmt.Errorf("grpcclient: %s has no method %s", service, name)
+	}
+	if m.IsStreamingClient() {
+		return nil, fmt.Errorf("grpcclient: client streaming method %s is not supported", name)
+	}
+
+	types := dynamicpb.NewTypes(c.files)
+	input := dynamicpb.NewMessage(m.Input())
+	if strings.TrimSpace(request) != "" {
+		if err := (protojson.UnmarshalOptions{Resolver: types}).Unmarshal([]byte(request), input); err != nil {
+			return nil, fmt.Errorf("grpcclient: invalid JSON request: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(notebook.Context())
+	defer cancel()
+	stream, err := c.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: m.IsStreamingServer()}, "/"+service+"/"+name)
+	if err != nil {
+		return nil, fmt.Errorf("grpcclient: %v", err)
+	}
+	if err := stream.SendMsg(input); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("grpcclient: %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("grpcclient: %v", err)
+	}
+
+	var results []interface{}
+	for {
+		output := dynamicpb.NewMessage(m.Output())
+		if err := stream.RecvMsg(output); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("grpcclient: %v", err)
+		}
+		data, err := protojson.MarshalOptions{Resolver: types}.Marshal(output)
+		if err != nil {
+			return nil, fmt.Errorf("grpcclient: %v", err)
+		}
+		var result interface{}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("grpcclient: %v", err)
+		}
+		results = append(results, result)
+		if !m.IsStreamingServer() {
+			break
+		}
+	}
+	if m.IsStreamingServer() {
+		return display.JSON(results), nil
+	}
+	if len(results) != 1 {
+		return nil, fmt.Errorf("grpcclient: expected a single response, got %d", len(results))
+	}
+	return display.JSON(results[0]), nil
+}
@@ -0,0 +1,191 @@
+package grpcclient
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gopherdata/gophernotes/display"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testProtoFiles returns the registry of
+//
+//	package greet;
+//	import "google/protobuf/timestamp.proto";
+//	enum Color { RED = 0; BLUE = 1; }
+//	message Req {
+//	  string name = 1;
+//	  repeated int64 ids = 2;
+//	  map<string, int32> tags = 3;
+//	  Color color = 4;
+//	  google.protobuf.Timestamp at = 5;
+//	}
+//	service Greeter { rpc Echo(Req) returns (Req); }
+//
+// with the well-known types it imports.
+func testProtoFiles(t *testing.T) *protoregistry.Files {
+	field := func(name string, number int32, label descriptorpb.FieldDescriptorProto_Label,
+		typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    label.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("greet.proto"),
+		Package:    proto.String("greet"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Req"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("ids", 2, repeated, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("tags", 3, repeated, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".greet.Req.TagsEntry"),
+				field("color", 4, optional, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".greet.Color"),
+				field("at", 5, optional, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("TagsEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, optional, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("value", 2, optional, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("RED"), Number: proto.Int32(0)},
+				{Name: proto.String("BLUE"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Echo"),
+				InputType:  proto.String(".greet.Req"),
+				OutputType: proto.String(".greet.Req"),
+			}},
+		}},
+	}
+
+	d, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := new(protoregistry.Files)
+	for _, f := range []protoreflect.FileDescriptor{d.Imports().Get(0).FileDescriptor, d} {
+		if err := files.RegisterFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// testGRPCServer starts a server with the reflection service and greet.Greeter/Echo, which returns its request.
+func testGRPCServer(t *testing.T) (addr string, stop func()) {
+	files := testProtoFiles(t)
+	d, err := files.FindDescriptorByName("greet.Req")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := d.(protoreflect.MessageDescriptor)
+
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "greet.Greeter",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Echo",
+			Handler: func(_ interface{}, _ context.Context, decode func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				m := dynamicpb.NewMessage(req)
+				return m, decode(m)
+			},
+		}},
+		Metadata: "greet.proto",
+	}, struct{}{})
+	reflectionpb.RegisterServerReflectionServer(server,
+		reflection.NewServerV1(reflection.ServerOptions{Services: server, DescriptorResolver: files}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	return l.Addr().String(), server.Stop
+}
+
+func TestClient(t *testing.T) {
+	addr, stop := testGRPCServer(t)
+	defer stop()
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	services, err := c.Services()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(services, []string{"greet.Greeter", "grpc.reflection.v1.ServerReflection"}) {
+		t.Errorf("Services() = %v", services)
+	}
+
+	methods, err := c.Methods("greet.Greeter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(methods, []string{"Echo(greet.Req) returns (greet.Req)"}) {
+		t.Errorf("Methods() = %v", methods)
+	}
+
+	data, err := c.Invoke("greet.Greeter/Echo",
+		`{"name": "gopher", "ids": [1, "9007199254740993"], "tags": {"a": 2}, "color": "BLUE", "at": "2024-05-01T12:00:00Z"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":  "gopher",
+		"ids":   []interface{}{"1", "9007199254740993"},
+		"tags":  map[string]interface{}{"a": float64(2)},
+		"color": "BLUE",
+		"at":    "2024-05-01T12:00:00Z",
+	}
+	if got := data[display.MIMETypeJSON]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invoke() = %#v, want %#v", got, want)
+	}
+
+	if _, err := c.Invoke("greet.Greeter/Echo", `{"unknown": 1}`); err == nil {
+		t.Errorf("Invoke() with an unknown field did not fail")
+	}
+	if _, err := c.Invoke("greet.Greeter/Missing", `{}`); err == nil {
+		t.Errorf("Invoke() of an unknown method did not fail")
+	}
+	if _, err := c.Methods("greet.Missing"); err == nil {
+		t.Errorf("Methods() of an unknown service did not fail")
+	}
+}
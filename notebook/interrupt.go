@@ -0,0 +1,84 @@
+package notebook
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// contextReader is the reader returned by Reader.
+type contextReader struct {
+	r io.Reader
+
+	// pending delivers the result of the read still running in the background, if any.
+	pending chan readResult
+
+	// buf holds data read in the background but not returned yet, and err the error of that read.
+	buf []byte
+	err error
+}
+
+// readResult is the outcome of a read running in the background.
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// Reader returns a reader reading from r whose Read returns early with the error of Context when the current
+// cell is interrupted or times out. The read of r then goes on in the background and its data is returned by
+// the next call to Read, so no input is lost. Wrap os.Stdin or network connections with it, e.g.
+//
+//	bufio.NewScanner(notebook.Reader(conn))
+func Reader(r io.Reader) io.Reader {
+	return &contextReader{r: r}
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if len(cr.buf) > 0 || cr.err != nil {
+		n := copy(p, cr.buf)
+		cr.buf = cr.buf[n:]
+		if len(cr.buf) > 0 {
+			return n, nil
+		}
+		err := cr.err
+		cr.err = nil
+		return n, err
+	}
+
+	if cr.pending == nil {
+		buf := make([]byte, len(p))
+		pending := make(chan readResult, 1)
+		go func() {
+			n, err := cr.r.Read(buf)
+			pending <- readResult{data: buf[:n], err: err}
+		}()
+		cr.pending = pending
+	}
+
+	select {
+	case res := <-cr.pending:
+		cr.pending = nil
+		cr.buf, cr.err = res.data, res.err
+		return cr.Read(p)
+	case <-Context().Done():
+		return 0, Context().Err()
+	}
+}
+
+// Recv receives a value from the channel ch, like the expression <-ch, but returns early with the error of
+// Context when the current cell is interrupted or times out. ok is false when ch is closed.
+func Recv(ch interface{}) (v interface{}, ok bool, err error) {
+	chValue := reflect.ValueOf(ch)
+	if chValue.Kind() != reflect.Chan || chValue.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, false, fmt.Errorf("notebook: Recv expects a channel to receive from, got %T", ch)
+	}
+
+	chosen, recv, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: chValue},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(Context().Done())},
+	})
+	if chosen == 1 {
+		return nil, false, Context().Err()
+	}
+	return recv.Interface(), ok, nil
+}
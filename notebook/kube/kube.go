@@ -0,0 +1,251 @@
+// Package kube reads the resources of Kubernetes clusters from notebooks, and displays them as the tables shown by
+// kubectl get. It is a module of its own, so that the users of the notebook package do not depend on client-go.
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// tableAccept asks the API server to render lists as tables, with the columns shown by kubectl get.
+const tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io,application/json"
+
+// resourcePaths maps the resources listed by Client.Table to the path of their API group and version.
+var resourcePaths = map[string]string{
+	"configmaps":             "/api/v1",
+	"endpoints":              "/api/v1",
+	"events":                 "/api/v1",
+	"namespaces":             "/api/v1",
+	"nodes":                  "/api/v1",
+	"persistentvolumeclaims": "/api/v1",
+	"persistentvolumes":      "/api/v1",
+	"pods":                   "/api/v1",
+	"secrets":                "/api/v1",
+	"serviceaccounts":        "/api/v1",
+	"services":               "/api/v1",
+	"daemonsets":             "/apis/apps/v1",
+	"deployments":            "/apis/apps/v1",
+	"replicasets":            "/apis/apps/v1",
+	"statefulsets":           "/apis/apps/v1",
+	"cronjobs":               "/apis/batch/v1",
+	"jobs":                   "/apis/batch/v1",
+	"ingresses":              "/apis/networking.k8s.io/v1",
+}
+
+// clusterResources lists the resources of resourcePaths that do not belong to a namespace.
+var clusterResources = map[string]bool{
+	"namespaces":        true,
+	"nodes":             true,
+	"persistentvolumes": true,
+}
+
+// Client reads the resources of a Kubernetes cluster through its API server, and displays them as the
+// tables shown by kubectl get. It is built on client-go: CoreV1 and AppsV1 return the typed clients controllers
+// use, working with the types of k8s.io/api.
+type Client struct {
+	// Namespace is the namespace used when methods are given none, the one of the kubeconfig context by default.
+	Namespace string
+
+	config *rest.Config
+	core   *corev1client.CoreV1Client
+	apps   *appsv1client.AppsV1Client
+}
+
+// Dial connects to the cluster of the current context of the kubeconfig file at path. An empty path
+// stands for the files listed by $KUBECONFIG, or ~/.kube/config, or the service account of the pod when the
+// kernel runs inside the cluster and there is no kubeconfig file.
+func Dial(path string) (*Client, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kube: %v", err)
+	}
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("kube: %v", err)
+	}
+	return newClient(config, namespace)
+}
+
+func newClient(config *rest.Config, namespace string) (*Client, error) {
+	config = rest.CopyConfig(config)
+	config.UserAgent = "gophernotes"
+
+	core, err := corev1client.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kube: %v", err)
+	}
+	apps, err := appsv1client.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("kube: %v", err)
+	}
+	return &Client{Namespace: namespace, config: config, core: core, apps: apps}, nil
+}
+
+// CoreV1 returns the client of the core API group, like clientset.CoreV1() in a controller, e.g.
+//
+//	pod, err := k.CoreV1().Pods("default").Get(notebook.Context(), "web-0", metav1.GetOptions{})
+func (c *Client) CoreV1() corev1client.CoreV1Interface {
+	return c.core
+}
+
+// AppsV1 returns the client of the apps API group, like clientset.AppsV1() in a controller.
+func (c *Client) AppsV1() appsv1client.AppsV1Interface {
+	return c.apps
+}
+
+// Config returns a copy of the configuration of the connection to the API server, to create other clients from.
+func (c *Client) Config() *rest.Config {
+	return rest.CopyConfig(c.config)
+}
+
+// Get decodes the JSON object returned by the API server for path into v, e.g.
+//
+//	var pod corev1.Pod
+//	k.Get("/api/v1/namespaces/default/pods/web-0", &pod)
+//
+// v may also point to a map, for resources without a Go type.
+func (c *Client) Get(path string, v interface{}) error {
+	body, err := c.get(path, "application/json")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Pods returns the table of the pods of namespace, like kubectl get pods. See Table.
+func (c *Client) Pods(namespace string) (display.Data, error) {
+	return c.Table("pods", namespace)
+}
+
+// Deployments returns the table of the deployments of namespace, like kubectl get deployments. See Table.
+func (c *Client) Deployments(namespace string) (display.Data, error) {
+	return c.Table("deployments", namespace)
+}
+
+// Table returns the table of the resources of namespace, with the columns shown by kubectl get. resource is
+// the plural name of a built-in resource, e.g. "pods" or "services", or the API path of other resources, e.g.
+// "/apis/cert-manager.io/v1/certificates". An empty namespace stands for c.Namespace, and "*" for all namespaces.
+func (c *Client) Table(resource, namespace string) (display.Data, error) {
+	path := resource
+	if !strings.HasPrefix(resource, "/") {
+		group, ok := resourcePaths[resource]
+		if !ok {
+			return nil, fmt.Errorf("kube: unknown Kubernetes resource %s, give its API path instead", resource)
+		}
+		if namespace == "" {
+			namespace = c.Namespace
+		}
+		if clusterResources[resource] || namespace == "*" {
+			path = group + "/" + resource
+		} else {
+			path = group + "/namespaces/" + namespace + "/" + resource
+		}
+	}
+
+	body, err := c.get(path, tableAccept)
+	if err != nil {
+		return nil, err
+	}
+
+	var table metav1.Table
+	if err := json.Unmarshal(body, &table); err != nil {
+		return nil, err
+	}
+
+	withNamespace := namespace == "*"
+	var columns []string
+	var rows [][]string
+	if withNamespace {
+		columns = append(columns, "NAMESPACE")
+	}
+
+	// Servers without table support return the list of objects, shown by name and age.
+	if table.Kind != "Table" {
+		var list metav1.PartialObjectMetadataList
+		if err := json.Unmarshal(body, &list); err != nil {
+			return nil, err
+		}
+		columns = append(columns, "NAME", "AGE")
+		for _, item := range list.Items {
+			row := []string{item.Name, age(item.CreationTimestamp.Time)}
+			if withNamespace {
+				row = append([]string{item.Namespace}, row...)
+			}
+			rows = append(rows, row)
+		}
+		return display.Table(columns, rows), nil
+	}
+
+	// Like kubectl get, only show the columns of priority 0. Wider columns need "-o wide".
+	var shown []int
+	for i, column := range table.ColumnDefinitions {
+		if column.Priority == 0 {
+			shown = append(shown, i)
+			columns = append(columns, strings.ToUpper(column.Name))
+		}
+	}
+	for _, r := range table.Rows {
+		var row []string
+		if withNamespace {
+			// The rows hold the metadata of their object by default.
+			var object metav1.PartialObjectMetadata
+			json.Unmarshal(r.Object.Raw, &object)
+			row = append(row, object.Namespace)
+		}
+		for _, i := range shown {
+			cell := ""
+			if i < len(r.Cells) && r.Cells[i] != nil {
+				cell = fmt.Sprint(r.Cells[i])
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+	if withNamespace {
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	}
+	return display.Table(columns, rows), nil
+}
+
+// get returns the body of the response of the API server to a GET request for path. The request stops when
+// the cell is interrupted.
+func (c *Client) get(path, accept string) ([]byte, error) {
+	// Error decodes the Status the server returns along with errors, unlike DoRaw.
+	result := c.core.RESTClient().Get().AbsPath(path).SetHeader("Accept", accept).Do(notebook.Context())
+	if err := result.Error(); err != nil {
+		return nil, fmt.Errorf("kube: %v", err)
+	}
+	return result.Raw()
+}
+
+// age formats the time elapsed since t like kubectl, e.g. "5d" or "3h".
+func age(t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
@@ -0,0 +1,121 @@
+package kube
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"apiVersion": "v1", "kind": "Status", "status": "Failure", "message": "Unauthorized", "reason": "Unauthorized", "code": 401}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/web/pods":
+			if !strings.Contains(r.Header.Get("Accept"), "as=Table") {
+				t.Errorf("unexpected Accept header %q", r.Header.Get("Accept"))
+			}
+			w.Write([]byte(`{
+				"kind": "Table",
+				"columnDefinitions": [
+					{"name": "Name", "priority": 0},
+					{"name": "Ready", "priority": 0},
+					{"name": "IP", "priority": 1}
+				],
+				"rows": [
+					{"cells": ["web-0", "1/1", "10.0.0.1"], "object": {"metadata": {"namespace": "web"}}},
+					{"cells": ["web-1", "0/1", null], "object": {"metadata": {"namespace": "web"}}}
+				]
+			}`))
+		case "/api/v1/namespaces/web/pods/web-0":
+			w.Write([]byte(`{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "web-0"}, "status": {"phase": "Running"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"apiVersion": "v1", "kind": "Status", "status": "Failure", "message": "not found", "reason": "NotFound", "code": 404}`))
+		}
+	}))
+	defer server.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	config := strings.Join([]string{
+		"clusters:",
+		"- name: test",
+		"  cluster:",
+		"    server: " + server.URL,
+		"    certificate-authority-data: " + base64.StdEncoding.EncodeToString(ca),
+		"contexts:",
+		"- name: test",
+		"  context:",
+		"    cluster: test",
+		"    namespace: web",
+		"    user: test",
+		"current-context: test",
+		"users:",
+		"- name: test",
+		"  user:",
+		"    token: secret",
+	}, "\n")
+
+	dir, err := ioutil.TempDir("", "kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Namespace != "web" {
+		t.Errorf("Namespace = %q, want web", k.Namespace)
+	}
+
+	pods, err := k.Pods("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := display.Table([]string{"NAME", "READY"}, [][]string{{"web-0", "1/1"}, {"web-1", "0/1"}})
+	if !reflect.DeepEqual(pods, want) {
+		t.Errorf("Pods() = %v, want %v", pods, want)
+	}
+
+	var pod corev1.Pod
+	if err := k.Get("/api/v1/namespaces/web/pods/web-0", &pod); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Kind != "Pod" || pod.Name != "web-0" {
+		t.Errorf("Get() = %+v", pod)
+	}
+
+	typed, err := k.CoreV1().Pods("web").Get(notebook.Context(), "web-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typed.Name != "web-0" || typed.Status.Phase != corev1.PodRunning {
+		t.Errorf("CoreV1().Pods().Get() = %+v", typed)
+	}
+
+	if _, err := k.Deployments(""); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Deployments() = %v, want a not found error", err)
+	}
+}
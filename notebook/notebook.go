@@ -0,0 +1,287 @@
+// Package notebook provides helpers for Go code running inside a gophernotes notebook.
+//
+// The package does not depend on the kernel, which installs itself with SetKernel on startup, so libraries can
+// import it to show rich output when they run in a notebook: outside of one, Active reports false and Display
+// does nothing, e.g.
+//
+//	if notebook.Active() {
+//		notebook.Display(display.HTML(report))
+//	}
+package notebook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// Kernel is implemented by the running gophernotes kernel. The helpers in this package
+// talk to the front-end through it.
+type Kernel interface {
+
+	// Interact displays the given controls and calls fn with their current values
+	// whenever the user changes one of them, updating the displayed output.
+	Interact(fn reflect.Value, controls []Control) error
+
+	// Context returns the context of the cell that started the calling goroutine.
+	Context() context.Context
+
+	// Reactive displays the value of the Go expression expr once the cell being executed completes,
+	// and updates it whenever a later cell reassigns one of the symbols expr references.
+	Reactive(expr string) error
+
+	// Delete removes the top-level symbols with the given names from the interpreter.
+	Delete(names ...string) error
+
+	// Live displays data in an output that the returned function replaces, even after the cell being executed
+	// completes, followed by a button with the given label calling stop when clicked.
+	Live(data display.Data, label string, stop func()) (update func(display.Data) error, err error)
+
+	// Display shows data below the cell being executed, before its result.
+	Display(data display.Data) error
+}
+
+// kernel is the Kernel installed by gophernotes, nil when running outside of a notebook.
+var kernel Kernel
+
+// SetKernel installs the Kernel used by the helpers in this package. It is called by
+// gophernotes on startup.
+func SetKernel(k Kernel) {
+	kernel = k
+}
+
+// Active reports whether the code runs inside a gophernotes kernel, i.e. whether its rich output is shown.
+func Active() bool {
+	return kernel != nil
+}
+
+// Display shows data below the cell being executed, like its result but while it runs, e.g. the progress of a
+// long computation. Outside of a notebook it does nothing.
+func Display(data display.Data) error {
+	if kernel == nil {
+		return nil
+	}
+	return kernel.Display(data)
+}
+
+// Live displays data in an output below the cell being executed that the returned function replaces, even after
+// the cell completes, followed by a button with the given label calling stop when clicked, e.g. to show the
+// progress of a background job. Outside of a notebook it returns ErrNoKernel.
+func Live(data display.Data, label string, stop func()) (update func(display.Data) error, err error) {
+	if kernel == nil {
+		return nil, ErrNoKernel
+	}
+	return kernel.Live(data, label, stop)
+}
+
+// Context returns a context that is done when the cell that started the calling goroutine should stop, because
+// it is interrupted or exceeded the timeout set by its "timeout=<duration>" tag. Long-running cells can watch it
+// to stop early. It is not done when the cell completes, so the goroutines the cell leaves running are not
+// stopped. Outside of a notebook the context is never done.
+func Context() context.Context {
+	if kernel == nil {
+		return context.Background()
+	}
+	return kernel.Context()
+}
+
+// Reactive displays the value of the Go expression expr below the current cell once it completes, and
+// re-evaluates it to update that output in place whenever a later cell assigns one of the variables,
+// functions or types expr references, e.g.
+//
+//	notebook.Reactive("display.LinePlot(prices)")
+//
+// keeps a plot of prices up to date with the cells changing it.
+func Reactive(expr string) error {
+	if kernel == nil {
+		return ErrNoKernel
+	}
+	return kernel.Reactive(expr)
+}
+
+// Delete removes the variables, constants, functions or types with the given names from the notebook session,
+// releasing the memory they reference, e.g. a large slice, without restarting the kernel.
+func Delete(names ...string) error {
+	if kernel == nil {
+		return ErrNoKernel
+	}
+	return kernel.Delete(names...)
+}
+
+// ErrNoKernel is returned by the helpers that need a front-end when no kernel is installed.
+var ErrNoKernel = errors.New("notebook: not running inside a gophernotes kernel")
+
+// Slider requests a slider control for a numeric parameter of an interactive function.
+type Slider struct {
+	Label          string
+	Min, Max, Step float64
+}
+
+// Dropdown requests a drop-down control listing the given options for a string parameter
+// of an interactive function.
+type Dropdown struct {
+	Label   string
+	Options []string
+}
+
+// Control describes the input control built for one parameter of an interactive function.
+type Control struct {
+	Label string
+	Type  reflect.Type
+	Value reflect.Value
+
+	// Min, Max and Step bound numeric controls.
+	Min, Max, Step float64
+
+	// Options lists the choices of a drop-down control.
+	Options []string
+}
+
+// Interact displays an input control for each parameter of fn and re-runs fn whenever the user
+// changes one of them, replacing the displayed output with the new result. Numeric parameters
+// get sliders, bool parameters checkboxes and string parameters text boxes. The optional specs
+// customize the control of the parameter at the same position and may be a Slider, a Dropdown
+// or a string used as the control's label.
+func Interact(fn interface{}, specs ...interface{}) error {
+	if kernel == nil {
+		return ErrNoKernel
+	}
+
+	fnValue := reflect.ValueOf(fn)
+	if fnValue.Kind() != reflect.Func {
+		return fmt.Errorf("notebook: Interact expects a function, got %T", fn)
+	}
+
+	fnType := fnValue.Type()
+	if len(specs) > fnType.NumIn() {
+		return fmt.Errorf("notebook: Interact got %d controls for a function with %d parameters", len(specs), fnType.NumIn())
+	}
+
+	controls := make([]Control, fnType.NumIn())
+	for i := range controls {
+		var spec interface{}
+		if i < len(specs) {
+			spec = specs[i]
+		}
+
+		control, err := newControl(fnType.In(i), spec)
+		if err != nil {
+			return fmt.Errorf("notebook: parameter %d: %v", i, err)
+		}
+		if control.Label == "" {
+			control.Label = fmt.Sprintf("arg%d", i)
+		}
+		controls[i] = control
+	}
+
+	return kernel.Interact(fnValue, controls)
+}
+
+// newControl builds the Control for a parameter of type typ from the optional spec.
+func newControl(typ reflect.Type, spec interface{}) (Control, error) {
+	control := Control{
+		Type:  typ,
+		Value: reflect.New(typ).Elem(),
+		Min:   0,
+		Max:   100,
+		Step:  1,
+	}
+
+	switch typ.Kind() {
+	case reflect.Float32, reflect.Float64:
+		control.Max = 1
+		control.Step = 0.01
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Bool, reflect.String:
+	default:
+		return control, fmt.Errorf("unsupported parameter type %v", typ)
+	}
+
+	switch spec := spec.(type) {
+	case nil:
+	case string:
+		control.Label = spec
+	case Slider:
+		if !isNumeric(typ) {
+			return control, fmt.Errorf("a Slider needs a numeric parameter, got %v", typ)
+		}
+		if spec.Step <= 0 || spec.Max < spec.Min {
+			return control, fmt.Errorf("invalid Slider range [%v, %v] with step %v", spec.Min, spec.Max, spec.Step)
+		}
+		control.Label = spec.Label
+		control.Min, control.Max, control.Step = spec.Min, spec.Max, spec.Step
+	case Dropdown:
+		if typ.Kind() != reflect.String {
+			return control, fmt.Errorf("a Dropdown needs a string parameter, got %v", typ)
+		}
+		if len(spec.Options) == 0 {
+			return control, errors.New("a Dropdown needs at least one option")
+		}
+		control.Label = spec.Label
+		control.Options = spec.Options
+		control.Value.SetString(spec.Options[0])
+	default:
+		return control, fmt.Errorf("unsupported control %T", spec)
+	}
+
+	if isNumeric(typ) {
+		if err := SetControlValue(control.Value, control.Min); err != nil {
+			return control, err
+		}
+	}
+
+	return control, nil
+}
+
+// isNumeric reports whether a slider can drive a parameter of type typ.
+func isNumeric(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String:
+		return false
+	}
+	return true
+}
+
+// SetControlValue stores the value x received from a front-end control into v, converting
+// it to v's type.
+func SetControlValue(v reflect.Value, x interface{}) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := x.(float64)
+		if !ok {
+			return fmt.Errorf("notebook: expected a number, got %T", x)
+		}
+		v.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := x.(float64)
+		if !ok || f < 0 {
+			return fmt.Errorf("notebook: expected a non-negative number, got %v", x)
+		}
+		v.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		f, ok := x.(float64)
+		if !ok {
+			return fmt.Errorf("notebook: expected a number, got %T", x)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return fmt.Errorf("notebook: expected a bool, got %T", x)
+		}
+		v.SetBool(b)
+	case reflect.String:
+		s, ok := x.(string)
+		if !ok {
+			return fmt.Errorf("notebook: expected a string, got %T", x)
+		}
+		v.SetString(s)
+	default:
+		return fmt.Errorf("notebook: unsupported control type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package notebook
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// displayKernel records the data displayed through it.
+type displayKernel struct {
+	Kernel
+	shown []display.Data
+}
+
+func (k *displayKernel) Display(data display.Data) error {
+	k.shown = append(k.shown, data)
+	return nil
+}
+
+func TestDisplay(t *testing.T) {
+	defer SetKernel(kernel)
+
+	SetKernel(nil)
+	if Active() {
+		t.Error("Active() = true without a kernel")
+	}
+	if err := Display(display.HTML("<b>ignored</b>")); err != nil {
+		t.Errorf("Display without a kernel: %v", err)
+	}
+
+	k := &displayKernel{}
+	SetKernel(k)
+	if !Active() {
+		t.Error("Active() = false with a kernel")
+	}
+	if err := Display(display.Markdown("**shown**")); err != nil {
+		t.Errorf("Display: %v", err)
+	}
+	want := []display.Data{{display.MIMETypeMarkdown: "**shown**", display.MIMETypeText: "**shown**"}}
+	if !reflect.DeepEqual(k.shown, want) {
+		t.Errorf("displayed %v, want %v", k.shown, want)
+	}
+}
@@ -0,0 +1,25 @@
+module github.com/gopherdata/gophernotes/notebook/stream
+
+go 1.26.0
+
+replace github.com/gopherdata/gophernotes/display => ../../display
+
+replace github.com/gopherdata/gophernotes/notebook => ../../notebook
+
+require (
+	github.com/gopherdata/gophernotes/display v0.0.0-00010101000000-000000000000
+	github.com/gopherdata/gophernotes/notebook v0.0.0-00010101000000-000000000000
+	github.com/nats-io/nats.go v1.53.1
+	github.com/twmb/franz-go v1.22.1
+	github.com/twmb/franz-go/pkg/kfake v0.0.0-20260918054303-01f206a7e32c
+	github.com/twmb/franz-go/pkg/kmsg v1.14.0
+)
+
+require (
+	github.com/klauspost/compress v1.20.0 // indirect
+	github.com/nats-io/nkeys v0.4.15 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.30 // indirect
+	golang.org/x/crypto v0.55.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// kafkaDialTimeout bounds the time taken to connect to a Kafka broker, and to find the end of the partitions of
+// the topic.
+const kafkaDialTimeout = 10 * time.Second
+
+// kafkaSubscription receives the messages of a Kafka topic through a franz-go client, which negotiates the
+// versions of the requests with the brokers.
+type kafkaSubscription struct {
+	client *kgo.Client
+}
+
+// subscribeKafka connects to the Kafka cluster of the bootstrap broker of u, with TLS if tlsConfig is not nil
+// and SASL if u holds credentials, and consumes topic from the current end of each of its partitions.
+func subscribeKafka(u *url.URL, topic string, tlsConfig *tls.Config) (*kafkaSubscription, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(u.Host),
+		kgo.ClientID("gophernotes"),
+		kgo.DialTimeout(kafkaDialTimeout),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	if u.User != nil {
+		mechanism, err := kafkaSASL(u.User, u.Query().Get("sasl"))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mechanism)
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("stream: Kafka: %v", err)
+	}
+	offsets, err := kafkaEndOffsets(client, topic)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("stream: Kafka topic %s: %v", topic, err)
+	}
+	client.AddConsumePartitions(map[string]map[int32]kgo.Offset{topic: offsets})
+	return &kafkaSubscription{client: client}, nil
+}
+
+// kafkaSASL returns the option authenticating as user with the SASL mechanism, plain when empty.
+func kafkaSASL(user *url.Userinfo, mechanism string) (kgo.Opt, error) {
+	password, _ := user.Password()
+	switch mechanism {
+	case "", "plain":
+		return kgo.SASL(plain.Auth{User: user.Username(), Pass: password}.AsMechanism()), nil
+	case "scram-sha-256":
+		return kgo.SASL(scram.Auth{User: user.Username(), Pass: password}.AsSha256Mechanism()), nil
+	case "scram-sha-512":
+		return kgo.SASL(scram.Auth{User: user.Username(), Pass: password}.AsSha512Mechanism()), nil
+	}
+	return nil, fmt.Errorf("stream: unsupported SASL mechanism %q, expected plain, scram-sha-256 or scram-sha-512",
+		mechanism)
+}
+
+// kafkaEndOffsets returns the offsets following the last message of each partition of topic. They are listed
+// before consuming, rather than left to the client to resolve, so that every message produced once Consume
+// returns is received.
+func kafkaEndOffsets(client *kgo.Client, topic string) (map[int32]kgo.Offset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaDialTimeout)
+	defer cancel()
+
+	metadata := kmsg.NewPtrMetadataRequest()
+	metadataTopic := kmsg.NewMetadataRequestTopic()
+	metadataTopic.Topic = kmsg.StringPtr(topic)
+	metadata.Topics = append(metadata.Topics, metadataTopic)
+	topics, err := metadata.RequestWith(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	list := kmsg.NewPtrListOffsetsRequest()
+	listTopic := kmsg.NewListOffsetsRequestTopic()
+	listTopic.Topic = topic
+	for _, t := range topics.Topics {
+		if t.Topic == nil || *t.Topic != topic {
+			continue
+		}
+		if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+			return nil, err
+		}
+		for _, p := range t.Partitions {
+			partition := kmsg.NewListOffsetsRequestTopicPartition()
+			partition.Partition = p.Partition
+			partition.Timestamp = -1 // the latest offset
+			listTopic.Partitions = append(listTopic.Partitions, partition)
+		}
+	}
+	if len(listTopic.Partitions) == 0 {
+		return nil, kerr.UnknownTopicOrPartition
+	}
+	list.Topics = append(list.Topics, listTopic)
+	ends, err := list.RequestWith(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int32]kgo.Offset)
+	for _, t := range ends.Topics {
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return nil, fmt.Errorf("partition %d: %v", p.Partition, err)
+			}
+			offsets[p.Partition] = kgo.NewOffset().At(p.Offset)
+		}
+	}
+	return offsets, nil
+}
+
+func (s *kafkaSubscription) next() ([]Message, error) {
+	fetches := s.client.PollFetches(context.Background())
+	if fetches.IsClientClosed() {
+		return nil, errConsumerClosed
+	}
+	for _, err := range fetches.Errors() {
+		// The client retries the other errors itself, and resumes after reporting data loss.
+		var loss *kgo.ErrDataLoss
+		if errors.As(err.Err, &loss) {
+			continue
+		}
+		return nil, fmt.Errorf("stream: Kafka topic %s partition %d: %v", err.Topic, err.Partition, err.Err)
+	}
+
+	var messages []Message
+	fetches.EachRecord(func(r *kgo.Record) {
+		messages = append(messages, Message{
+			Topic:     r.Topic,
+			Key:       r.Key,
+			Value:     r.Value,
+			Partition: r.Partition,
+			Offset:    r.Offset,
+			Time:      r.Timestamp,
+		})
+	})
+	return messages, nil
+}
+
+func (s *kafkaSubscription) close() error {
+	s.client.Close()
+	return nil
+}
@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// natsDialTimeout bounds the time taken to connect to a NATS server, and for it to accept the subscription.
+	natsDialTimeout = 10 * time.Second
+
+	// natsPollInterval is the time next waits for a message before returning none.
+	natsPollInterval = time.Minute
+)
+
+// natsSubscription receives the messages of a NATS subject through a nats.go connection, which reconnects when
+// the server goes away.
+type natsSubscription struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+// subscribeNATS connects to the NATS server of u, with TLS if tlsConfig is not nil and authenticating with the
+// credentials of u if any, and subscribes to subject.
+func subscribeNATS(u *url.URL, subject string, tlsConfig *tls.Config) (*natsSubscription, error) {
+	opts := []nats.Option{
+		nats.Name("gophernotes"),
+		nats.Timeout(natsDialTimeout),
+		nats.PermissionErrOnSubscribe(true),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			opts = append(opts, nats.UserInfo(u.User.Username(), password))
+		} else {
+			opts = append(opts, nats.Token(u.User.Username()))
+		}
+	}
+
+	conn, err := nats.Connect("nats://"+u.Host, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("stream: NATS server %s: %v", u.Host, err)
+	}
+	sub, err := conn.SubscribeSync(subject)
+	if err == nil {
+		// The server reports a subject it rejects before answering the PING sent by Flush.
+		if err = conn.FlushTimeout(natsDialTimeout); err == nil {
+			err = conn.LastError()
+		} else if last := conn.LastError(); last != nil {
+			err = last
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("stream: NATS server %s: %v", u.Host, err)
+	}
+	return &natsSubscription{conn: conn, sub: sub}, nil
+}
+
+func (s *natsSubscription) next() ([]Message, error) {
+	m, err := s.sub.NextMsg(natsPollInterval)
+	if err == nats.ErrTimeout {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stream: NATS %v", err)
+	}
+	return []Message{{Topic: m.Subject, Value: m.Data, Time: time.Now()}}, nil
+}
+
+func (s *natsSubscription) close() error {
+	s.conn.Close()
+	return nil
+}
@@ -0,0 +1,354 @@
+// Package stream consumes Kafka topics and NATS subjects from notebooks, showing their messages in live outputs.
+// It is a module of its own, so that the users of the notebook package do not depend on the Kafka and NATS
+// clients.
+package stream
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/gopherdata/gophernotes/notebook"
+)
+
+const (
+	// consumeBufferSize is the number of recent messages kept by a Consumer.
+	consumeBufferSize = 100
+
+	// consumeShown is the number of recent messages shown by the live output of a Consumer.
+	consumeShown = 20
+
+	// consumeRefresh is the minimum delay between two updates of the live output of a Consumer.
+	consumeRefresh = 250 * time.Millisecond
+
+	// consumeValueWidth is the number of characters of keys and values shown by the live output.
+	consumeValueWidth = 120
+)
+
+// Message is a message received by a Consumer.
+type Message struct {
+	// Topic is the Kafka topic or the NATS subject of the message.
+	Topic string
+
+	// Key is the key of a Kafka message, nil for NATS.
+	Key   []byte
+	Value []byte
+
+	// Partition and Offset locate a Kafka message in its topic. They are zero for NATS.
+	Partition int32
+	Offset    int64
+
+	// Time is the timestamp of a Kafka message, or the time a NATS message was received.
+	Time time.Time
+}
+
+// subscription delivers the messages of a topic to a Consumer.
+type subscription interface {
+	// next blocks until messages arrive, and may return none.
+	next() ([]Message, error)
+
+	// close releases the connections of the subscription, making a blocked next return.
+	close() error
+}
+
+// Consumer streams the messages of a Kafka topic or a NATS subject into a live output. It keeps the most
+// recent messages in a bounded buffer.
+type Consumer struct {
+	source string
+	sub    subscription
+
+	// handler is called for each message, if not nil.
+	handler func(Message)
+
+	// update replaces the live output, nil outside of a notebook.
+	update func(display.Data) error
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+	done     chan struct{}
+
+	mu sync.Mutex
+
+	// recent is a ring buffer of the last messages received, and first the index of the oldest one.
+	recent []Message
+	first  int
+
+	count int
+	err   error
+
+	// dirty is set when the live output is out of date.
+	dirty bool
+}
+
+// Consume subscribes to topic and streams its messages in the background into a live output below the current
+// cell, until the Stop button of the output is clicked or Stop is called. topic is a URL naming the broker,
+// e.g.
+//
+//	stream.Consume("kafka://localhost:9092/orders", nil)
+//	stream.Consume("nats://localhost:4222/orders.>", nil)
+//
+// Kafka consumption starts at the end of each partition of the topic, and NATS subjects may use wildcards.
+// Credentials go in the URL, as user:password@ or, for NATS, token@. The query ?tls=true connects with TLS, and
+// for Kafka ?sasl=scram-sha-256 or ?sasl=scram-sha-512 authenticates with SCRAM instead of PLAIN.
+// handler, if not nil, is called with each message from the background goroutine receiving them, e.g. to
+// aggregate them into a variable.
+func Consume(topic string, handler func(Message)) (*Consumer, error) {
+	u, err := url.Parse(topic)
+	if err != nil {
+		return nil, fmt.Errorf("stream: invalid topic URL: %v", err)
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || name == "" {
+		return nil, fmt.Errorf("stream: expected a topic URL like kafka://host:port/topic, got %q", topic)
+	}
+
+	tlsConfig, err := consumeTLS(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var sub subscription
+	switch u.Scheme {
+	case "kafka":
+		sub, err = subscribeKafka(u, name, tlsConfig)
+	case "nats":
+		sub, err = subscribeNATS(u, name, tlsConfig)
+	default:
+		return nil, fmt.Errorf("stream: unsupported broker %q, expected kafka or nats", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		source:  u.Scheme + "://" + u.Host + "/" + name,
+		sub:     sub,
+		handler: handler,
+		stopped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if notebook.Active() {
+		if c.update, err = notebook.Live(c.render(), "Stop", c.stop); err != nil {
+			sub.close()
+			return nil, err
+		}
+	}
+
+	go c.receive()
+	go c.refresh()
+	return c, nil
+}
+
+// receive delivers the messages of the subscription until the consumer stops.
+func (c *Consumer) receive() {
+	defer close(c.done)
+
+	for {
+		messages, err := c.sub.next()
+		select {
+		case <-c.stopped:
+			return
+		default:
+		}
+		if err == nil {
+			err = c.deliver(messages)
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.dirty = true
+			c.mu.Unlock()
+			c.stop()
+			return
+		}
+	}
+}
+
+// deliver records messages and passes them to the handler, turning a panic of the handler into an error.
+func (c *Consumer) deliver(messages []Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("stream: Consume handler panicked: %v", r)
+		}
+	}()
+
+	for _, m := range messages {
+		c.mu.Lock()
+		if len(c.recent) < consumeBufferSize {
+			c.recent = append(c.recent, m)
+		} else {
+			c.recent[c.first] = m
+			c.first = (c.first + 1) % consumeBufferSize
+		}
+		c.count++
+		c.dirty = true
+		c.mu.Unlock()
+
+		if c.handler != nil {
+			c.handler(m)
+		}
+	}
+	return nil
+}
+
+// refresh updates the live output at most every consumeRefresh, and a last time once the consumer stops.
+func (c *Consumer) refresh() {
+	if c.update == nil {
+		return
+	}
+
+	ticker := time.NewTicker(consumeRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.done:
+			c.update(c.render())
+			return
+		}
+
+		c.mu.Lock()
+		dirty := c.dirty
+		c.dirty = false
+		c.mu.Unlock()
+		if dirty {
+			c.update(c.render())
+		}
+	}
+}
+
+// Stop stops consuming messages and returns the error that stopped the consumer earlier, if any.
+func (c *Consumer) Stop() error {
+	c.stop()
+	<-c.done
+	return c.Err()
+}
+
+func (c *Consumer) stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopped)
+		c.sub.close()
+	})
+}
+
+// Messages returns the most recent messages received, oldest first.
+func (c *Consumer) Messages() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	messages := make([]Message, 0, len(c.recent))
+	messages = append(messages, c.recent[c.first:]...)
+	return append(messages, c.recent[:c.first]...)
+}
+
+// Count returns the number of messages received so far.
+func (c *Consumer) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+// Err returns the error that stopped the consumer, if any.
+func (c *Consumer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Wait blocks until the consumer stops, or the current cell is interrupted or times out.
+func (c *Consumer) Wait() error {
+	select {
+	case <-c.done:
+		return c.Err()
+	case <-notebook.Context().Done():
+		return notebook.Context().Err()
+	}
+}
+
+// render returns the live output of the consumer: its status followed by the most recent messages.
+func (c *Consumer) render() display.Data {
+	messages := c.Messages()
+	if len(messages) > consumeShown {
+		messages = messages[len(messages)-consumeShown:]
+	}
+
+	c.mu.Lock()
+	status := fmt.Sprintf("Consuming %s: %d messages", c.source, c.count)
+	select {
+	case <-c.stopped:
+		status = fmt.Sprintf("Stopped consuming %s after %d messages", c.source, c.count)
+	default:
+	}
+	if c.err != nil {
+		status += fmt.Sprintf(" (%v)", c.err)
+	}
+	c.mu.Unlock()
+
+	var text, htm bytes.Buffer
+	text.WriteString(status + "\n")
+	fmt.Fprintf(&htm, "<p>%s</p>", html.EscapeString(status))
+	if len(messages) > 0 {
+		w := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "Time\tTopic\tPartition\tOffset\tKey\tValue")
+		htm.WriteString("<table><thead><tr><th>Time</th><th>Topic</th><th>Partition</th><th>Offset</th>" +
+			"<th>Key</th><th>Value</th></tr></thead><tbody>")
+		for _, m := range messages {
+			when := m.Time.Format("15:04:05.000")
+			key, value := consumeFormat(m.Key), consumeFormat(m.Value)
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", when, m.Topic, m.Partition, m.Offset, key, value)
+			fmt.Fprintf(&htm, "<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td></tr>",
+				when, html.EscapeString(m.Topic), m.Partition, m.Offset, html.EscapeString(key), html.EscapeString(value))
+		}
+		w.Flush()
+		htm.WriteString("</tbody></table>")
+	}
+
+	return display.Data{
+		display.MIMETypeText: text.String(),
+		display.MIMETypeHTML: htm.String(),
+	}
+}
+
+// consumeFormat returns the text shown for the key or value b of a message, quoted unless it is valid UTF-8
+// without control characters, and truncated to consumeValueWidth characters.
+func consumeFormat(b []byte) string {
+	s := string(b)
+	if !utf8.Valid(b) || strings.IndexFunc(s, func(r rune) bool { return r < ' ' }) >= 0 {
+		s = fmt.Sprintf("%q", b)
+	}
+	if utf8.RuneCountInString(s) > consumeValueWidth {
+		s = string([]rune(s)[:consumeValueWidth-3]) + "..."
+	}
+	return s
+}
+
+// consumeTLS returns the TLS configuration requested by the tls parameter of the topic URL u, or nil for plain
+// connections.
+func consumeTLS(u *url.URL) (*tls.Config, error) {
+	value := u.Query().Get("tls")
+	if value == "" {
+		return nil, nil
+	}
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("stream: invalid tls parameter %q, expected true or false", value)
+	}
+	if !on {
+		return nil, nil
+	}
+	return &tls.Config{ServerName: u.Hostname()}, nil
+}
+
+// errConsumerClosed is returned by subscriptions used after close.
+var errConsumerClosed = errors.New("stream: consumer closed")
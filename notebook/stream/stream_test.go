@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopherdata/gophernotes/display"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// testListener returns a listener on a local port, calling serve for each connection.
+func testListener(t *testing.T, serve func(net.Conn)) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return l
+}
+
+// testConsume consumes topic until a message arrives, and checks it.
+func testConsume(t *testing.T, topic string, want Message) {
+	received := make(chan Message, 10)
+	c, err := Consume(topic, func(m Message) { received <- m })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-received:
+		if m.Topic != want.Topic || string(m.Key) != string(want.Key) || string(m.Value) != string(want.Value) ||
+			m.Partition != want.Partition || m.Offset != want.Offset {
+			t.Errorf("received %+v, want %+v", m, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message received from %s: %v", topic, c.Err())
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Errorf("Stop() = %v", err)
+	}
+	if c.Count() != 1 || len(c.Messages()) != 1 {
+		t.Errorf("Count() = %d, len(Messages()) = %d, want 1", c.Count(), len(c.Messages()))
+	}
+	text := c.render()[display.MIMETypeText].(string)
+	if !strings.Contains(text, "Stopped consuming") || !strings.Contains(text, string(want.Value)) {
+		t.Errorf("unexpected output:\n%s", text)
+	}
+}
+
+func TestConsumeNATS(t *testing.T) {
+	l := testListener(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "INFO {\"server_id\":\"test\",\"auth_required\":true}\r\n")
+		var sid string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "CONNECT ") && !strings.Contains(line, `"user":"u","pass":"p"`):
+				io.WriteString(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			case strings.HasPrefix(line, "SUB orders.* "):
+				sid = strings.Fields(line)[2]
+			case strings.HasPrefix(line, "SUB "):
+				io.WriteString(conn, "-ERR 'unexpected subject'\r\n")
+			case line == "PING\r\n" && sid != "":
+				io.WriteString(conn, "PONG\r\nMSG orders.new "+sid+" 5\r\nhello\r\n")
+				sid = ""
+			case line == "PING\r\n":
+				io.WriteString(conn, "PONG\r\n")
+			}
+		}
+	})
+	defer l.Close()
+
+	testConsume(t, "nats://u:p@"+l.Addr().String()+"/orders.*", Message{Topic: "orders.new", Value: []byte("hello")})
+
+	if _, err := Consume("nats://u:p@"+l.Addr().String()+"/other", nil); err == nil {
+		t.Errorf("Consume() of a rejected subject did not fail")
+	}
+	if _, err := Consume("nats://"+l.Addr().String()+"/orders.*", nil); err == nil {
+		t.Errorf("Consume() without credentials did not fail")
+	}
+}
+
+func TestConsumeKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(2), kfake.SeedTopics(3, "orders"), kfake.EnableSASL(),
+		kfake.Superuser("SCRAM-SHA-256", "admin", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	addr := cluster.ListenAddrs()[0]
+
+	producer, err := kgo.NewClient(kgo.SeedBrokers(addr), kgo.DefaultProduceTopic("orders"),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+		kgo.SASL(scram.Auth{User: "admin", Pass: "secret"}.AsSha256Mechanism()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	produce := func(value string) {
+		r := &kgo.Record{Key: []byte("k"), Value: []byte(value), Partition: 2}
+		if err := producer.ProduceSync(context.Background(), r).FirstErr(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Consumption starts after the messages produced before Consume.
+	produce("old")
+	received := make(chan Message, 10)
+	c, err := Consume("kafka://admin:secret@"+addr+"/orders?sasl=scram-sha-256", func(m Message) { received <- m })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	produce("new")
+
+	select {
+	case m := <-received:
+		if m.Topic != "orders" || string(m.Key) != "k" || string(m.Value) != "new" || m.Partition != 2 || m.Offset != 1 {
+			t.Errorf("received %+v, want the message new at offset 1 of partition 2", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no message received: %v", c.Err())
+	}
+
+	for _, topic := range []string{
+		"kafka://admin:secret@" + addr + "/missing?sasl=scram-sha-256",
+		"kafka://admin:secret@" + addr + "/orders?sasl=gssapi",
+		"kafka://admin:secret@" + addr + "/orders?tls=maybe",
+	} {
+		if c, err := Consume(topic, nil); err == nil {
+			c.Stop()
+			t.Errorf("Consume(%q) did not fail", topic)
+		}
+	}
+}
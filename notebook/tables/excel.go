@@ -0,0 +1,108 @@
+package tables
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// WriteExcel writes rows, a slice or array of structs or of pointers to structs, as the only worksheet of an
+// Excel workbook (.xlsx) at path. The first row holds the names of the fields, and each following row the
+// fields of a struct. Fields must be booleans, numbers or strings.
+func WriteExcel(path string, rows interface{}) error {
+	fields, structs, err := tableColumns(rows)
+	if err != nil {
+		return err
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+
+	cells := make([]interface{}, len(fields))
+	for i, field := range fields {
+		cells[i] = field.Name
+	}
+	if err := f.SetSheetRow(sheet, "A1", &cells); err != nil {
+		return fmt.Errorf("tables: writing %s: %v", path, err)
+	}
+	for j, s := range structs {
+		for i, field := range fields {
+			cells[i] = s.FieldByIndex(field.Index).Interface()
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, j+2)
+		if err := f.SetSheetRow(sheet, cell, &cells); err != nil {
+			return fmt.Errorf("tables: writing %s: %v", path, err)
+		}
+	}
+	return f.SaveAs(path)
+}
+
+// ReadExcel reads the first worksheet of the Excel workbook (.xlsx) at path and appends its rows to the slice
+// of structs, or of pointers to structs, rows points to. The first row of the worksheet holds the names of the
+// columns, and each column is stored into the field with the same name, compared case-insensitively when no
+// field has the exact name. Columns without a field are skipped, and empty cells and errors like #DIV/0! leave
+// fields unchanged.
+func ReadExcel(path string, rows interface{}) error {
+	slice, err := tableDest(rows)
+	if err != nil {
+		return err
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := readExcel(f, slice); err != nil {
+		return fmt.Errorf("tables: reading %s: %v", path, err)
+	}
+	return nil
+}
+
+func readExcel(f *excelize.File, slice reflect.Value) error {
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return errors.New("no worksheet")
+	}
+	sheet := sheets[0]
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// The values are read as stored, not formatted by the number formats of their cells.
+	var fields []int
+	for i := 1; rows.Next(); i++ {
+		values, err := rows.Columns(excelize.Options{RawCellValue: true})
+		if err != nil {
+			return err
+		}
+		if fields == nil {
+			fields = columnFields(slice.Type().Elem(), values)
+			continue
+		}
+		if strings.Join(values, "") == "" {
+			continue
+		}
+
+		s := appendRow(slice)
+		for col, v := range values {
+			if v == "" || col >= len(fields) || fields[col] < 0 {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(col+1, i)
+			if typ, err := f.GetCellType(sheet, cell); err == nil && typ == excelize.CellTypeError {
+				continue
+			}
+			if err := setFieldString(s.Field(fields[col]), v); err != nil {
+				return fmt.Errorf("cell %s: %v", cell, err)
+			}
+		}
+	}
+	return rows.Error()
+}
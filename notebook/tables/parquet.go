@@ -0,0 +1,163 @@
+package tables
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// WriteParquet writes rows, a slice or array of structs or of pointers to structs, as a table in the Parquet
+// format compressed with Snappy to path, so that pandas, pyarrow, polars or Spark can load it. Each field of the
+// structs becomes a column. Fields must be booleans, numbers or strings.
+func WriteParquet(path string, rows interface{}) (err error) {
+	fields, structs, err := tableColumns(rows)
+	if err != nil {
+		return err
+	}
+
+	// The rows are written as structs of their exported fields, from which parquet-go derives the schema.
+	columns := make([]reflect.StructField, len(fields))
+	for i, field := range fields {
+		columns[i] = reflect.StructField{Name: field.Name, Type: field.Type}
+	}
+	row := reflect.New(reflect.StructOf(columns)).Elem()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	w := parquet.NewWriter(f, parquet.SchemaOf(row.Interface()), parquet.Compression(&parquet.Snappy),
+		parquet.CreatedBy("gophernotes", "", ""))
+	for _, s := range structs {
+		for i, field := range fields {
+			row.Field(i).Set(s.FieldByIndex(field.Index))
+		}
+		if err := w.Write(row.Interface()); err != nil {
+			return fmt.Errorf("tables: writing %s: %v", path, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("tables: writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// ReadParquet reads the Parquet file at path and appends its rows to the slice of structs, or of pointers to
+// structs, rows points to. Each column is stored into the field with the same name, compared case-insensitively
+// when no field has the exact name. Columns without a field are skipped, and null values leave fields unchanged.
+//
+// Only flat schemas of boolean, integer, floating-point and byte array columns are supported. All the
+// compressions of the format are, among them the Snappy, gzip and zstd used by pandas, pyarrow and Spark.
+func ReadParquet(path string, rows interface{}) error {
+	slice, err := tableDest(rows)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := readParquet(f, slice); err != nil {
+		return fmt.Errorf("tables: reading %s: %v", path, err)
+	}
+	return nil
+}
+
+func readParquet(f *os.File, slice reflect.Value) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	file, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var unsigned []bool
+	for _, field := range file.Schema().Fields() {
+		if !field.Leaf() || field.Repeated() {
+			return fmt.Errorf("nested column %s is not supported", field.Name())
+		}
+		names = append(names, field.Name())
+		var integer *format.IntType
+		if logical := field.Type().LogicalType(); logical != nil {
+			integer, _ = logical.Value.(*format.IntType)
+		}
+		unsigned = append(unsigned, integer != nil && !integer.IsSigned)
+	}
+	fields := columnFields(slice.Type().Elem(), names)
+
+	buf := make([]parquet.Row, 64)
+	for _, group := range file.RowGroups() {
+		rows := group.Rows()
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				s := appendRow(slice)
+				for _, value := range row {
+					col := value.Column()
+					if col < 0 || col >= len(fields) || fields[col] < 0 || value.IsNull() {
+						continue
+					}
+					v, ok := parquetValue(value, unsigned[col])
+					if !ok {
+						rows.Close()
+						return fmt.Errorf("column %s of type %v is not supported", names[col], value.Kind())
+					}
+					if err := setField(s.Field(fields[col]), v); err != nil {
+						rows.Close()
+						return fmt.Errorf("column %s: %v", names[col], err)
+					}
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parquetValue returns the bool, int64, float64 or []byte stored by v, a value of a column of unsigned integers
+// if unsigned is set, or false if its type is not supported.
+func parquetValue(v parquet.Value, unsigned bool) (interface{}, bool) {
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean(), true
+	case parquet.Int32:
+		if unsigned {
+			return int64(v.Uint32()), true
+		}
+		return int64(v.Int32()), true
+	case parquet.Int64:
+		// setField converts the unsigned integers above the largest int64 back.
+		return v.Int64(), true
+	case parquet.Float:
+		return float64(v.Float()), true
+	case parquet.Double:
+		return v.Double(), true
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return v.ByteArray(), true
+	}
+	return nil, false
+}
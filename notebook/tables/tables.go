@@ -0,0 +1,208 @@
+// Package tables reads and writes slices of structs as Parquet and Excel files, to exchange tables with other
+// tools from notebooks. It is a module of its own, so that the users of the notebook package do not depend on the
+// Parquet and Excel libraries.
+package tables
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// This file holds the conversions between Go structs and the rows of the tables read and written by
+// ReadParquet, WriteParquet, ReadExcel and WriteExcel.
+
+// tableColumns returns the exported fields of the structs in rows, a slice or array of structs or of pointers
+// to structs, and the structs themselves. Fields must be booleans, numbers or strings.
+func tableColumns(rows interface{}) ([]reflect.StructField, []reflect.Value, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, nil, fmt.Errorf("tables: expected a slice of structs, got %T", rows)
+	}
+
+	rowType := v.Type().Elem()
+	pointers := rowType.Kind() == reflect.Ptr
+	if pointers {
+		rowType = rowType.Elem()
+	}
+	if rowType.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("tables: expected a slice of structs, got %T", rows)
+	}
+
+	var fields []reflect.StructField
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, nil, fmt.Errorf("tables: unsupported column %s of type %v", field.Name, field.Type)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("tables: %v has no exported fields", rowType)
+	}
+
+	structs := make([]reflect.Value, v.Len())
+	for i := range structs {
+		structs[i] = v.Index(i)
+		if pointers {
+			if structs[i].IsNil() {
+				return nil, nil, errors.New("tables: nil row")
+			}
+			structs[i] = structs[i].Elem()
+		}
+	}
+	return fields, structs, nil
+}
+
+// tableDest checks that rows is a pointer to a slice of structs or of pointers to structs, and returns the
+// slice.
+func tableDest(rows interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Slice {
+		elem := v.Elem().Type().Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Struct {
+			return v.Elem(), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("tables: expected a pointer to a slice of structs, got %T", rows)
+}
+
+// appendRow appends a zero struct to slice, and returns it so that its fields can be set.
+func appendRow(slice reflect.Value) reflect.Value {
+	elem := slice.Type().Elem()
+	row := reflect.New(elem).Elem()
+	if elem.Kind() == reflect.Ptr {
+		row.Set(reflect.New(elem.Elem()))
+	}
+	slice.Set(reflect.Append(slice, row))
+
+	row = slice.Index(slice.Len() - 1)
+	if row.Kind() == reflect.Ptr {
+		row = row.Elem()
+	}
+	return row
+}
+
+// columnFields returns, for each column name, the index of the exported field of structs of type t with that name,
+// compared case-insensitively when no field has the exact name, or -1 when there is none.
+func columnFields(t reflect.Type, names []string) []int {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = -1
+		for j := 0; j < t.NumField(); j++ {
+			if t.Field(j).PkgPath != "" {
+				// Unexported fields cannot be set.
+				continue
+			}
+			if t.Field(j).Name == name {
+				indexes[i] = j
+				break
+			}
+			if indexes[i] < 0 && strings.EqualFold(t.Field(j).Name, name) {
+				indexes[i] = j
+			}
+		}
+	}
+	return indexes
+}
+
+// setField stores v, a bool, int64, float64, string or []byte, into field, converting it to the type of the
+// field. A nil v leaves the field unchanged.
+func setField(field reflect.Value, v interface{}) error {
+	if b, ok := v.([]byte); ok {
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8 {
+			field.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		v = string(b)
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return setFieldString(field, v)
+	case bool:
+		if field.Kind() == reflect.Bool {
+			field.SetBool(v)
+			return nil
+		}
+	case int64:
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.SetInt(v)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			field.SetUint(uint64(v))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			field.SetFloat(float64(v))
+			return nil
+		}
+	case float64:
+		switch field.Kind() {
+		case reflect.Float32, reflect.Float64:
+			field.SetFloat(v)
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v == float64(int64(v)) {
+				field.SetInt(int64(v))
+				return nil
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v >= 0 && v == float64(uint64(v)) {
+				field.SetUint(uint64(v))
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("cannot store %v into a %v", v, field.Type())
+}
+
+// setFieldString parses s according to the type of field and stores it.
+func setFieldString(field reflect.Value, s string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		// Integers too large for a float64 are parsed exactly.
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return setField(field, i)
+		}
+		return setField(field, f)
+	}
+	return fmt.Errorf("cannot store %q into a %v", s, field.Type())
+}
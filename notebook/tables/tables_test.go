@@ -0,0 +1,114 @@
+package tables
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type tableRow struct {
+	Name  string
+	Count int
+	Small int8
+	Size  uint32
+	Ratio float64
+	Half  float32
+	OK    bool
+}
+
+var tableRows = []tableRow{
+	{"a", 1, -2, 3, 0.5, 1.5, true},
+	{"b & <c>", -1, 7, 40000, 2.25, -0.25, false},
+	{"", 1 << 40, 0, 0, 0, 0, true},
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	testTableRoundTrip(t, "rows.parquet", WriteParquet, ReadParquet)
+}
+
+func TestExcelRoundTrip(t *testing.T) {
+	testTableRoundTrip(t, "rows.xlsx", WriteExcel, ReadExcel)
+}
+
+func testTableRoundTrip(t *testing.T, name string, write, read func(string, interface{}) error) {
+	dir, err := ioutil.TempDir("", "gophernotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+
+	if err := write(path, tableRows); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []tableRow
+	if err := read(path, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, tableRows) {
+		t.Errorf("read %+v, want %+v", got, tableRows)
+	}
+
+	// Columns are matched case-insensitively, and missing fields are skipped.
+	var lower []*struct {
+		Name string
+		ok   bool
+		OK2  bool
+		Half float64
+	}
+	if err := read(path, &lower); err != nil {
+		t.Fatal(err)
+	}
+	if len(lower) != len(tableRows) || lower[1].Name != tableRows[1].Name || lower[0].Half != 1.5 {
+		t.Errorf("read %+v into a different struct", lower)
+	}
+
+	if err := write(path, []int{1}); err == nil {
+		t.Errorf("writing a slice of ints did not fail")
+	}
+	if err := read(path, got); err == nil {
+		t.Errorf("reading into a slice did not fail")
+	}
+}
+
+func TestReadParquetNulls(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nulls.parquet")
+
+	// A file with an optional column, compressed with gzip, as written by other tools.
+	type optionalRow struct {
+		Name  string
+		Count *int64
+	}
+	two := int64(2)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := parquet.NewGenericWriter[optionalRow](f, parquet.Compression(&parquet.Gzip))
+	if _, err := w.Write([]optionalRow{{"none", nil}, {"two", &two}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got := []tableRow{{Count: 7}}
+	if err := ReadParquet(path, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []tableRow{{Count: 7}, {Name: "none"}, {Name: "two", Count: 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("read %+v, want %+v", got, want)
+	}
+}
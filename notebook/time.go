@@ -0,0 +1,45 @@
+package notebook
+
+import "time"
+
+// Sleep pauses the current cell for at least the duration d, like time.Sleep, but returns early with the
+// error of Context when the cell is interrupted or times out.
+func Sleep(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-Context().Done():
+		return Context().Err()
+	}
+}
+
+// Tick returns a channel delivering the time every d, like time.Tick, until the current cell is interrupted
+// or times out. The channel is then closed, which ends loops ranging over it.
+func Tick(d time.Duration) <-chan time.Time {
+	ctx := Context()
+	ticks := make(chan time.Time)
+
+	go func() {
+		defer close(ticks)
+
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case t := <-ticker.C:
+				select {
+				case ticks <- t:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ticks
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// offline is set by `%opt offline on`, or on startup by GOPHERNOTES_OFFLINE=1 in the environment of the kernel,
+// e.g. set by its kernel spec. Imports then resolve from the vendor directory of the working directory first,
+// then from the packages installed in the GOPATH and the module cache, and the go command never downloads.
+var offline bool
+
+// onlineEnv holds the values of the environment variables changed by the offline mode, to restore them when it
+// is turned off. A nil value stands for an unset variable.
+var onlineEnv map[string]*string
+
+func init() {
+	kernelOptions["offline"] = kernelOption{
+		set: func(args []string) error {
+			on, err := parseSwitch(args)
+			if err != nil {
+				return err
+			}
+			setOffline(on)
+			return nil
+		},
+		value: func() string {
+			if offline {
+				return "on"
+			}
+			return "off"
+		},
+	}
+
+	if on, _ := strconv.ParseBool(os.Getenv("GOPHERNOTES_OFFLINE")); on {
+		setOffline(true)
+	}
+}
+
+// setOffline turns the offline mode on or off. On, the go command run by `%go` and by the import loaders uses
+// no module proxy nor checksum database, and uses the vendor directory of the working directory if it has one.
+func setOffline(on bool) {
+	if on == offline {
+		return
+	}
+	offline = on
+
+	if !on {
+		for name, value := range onlineEnv {
+			if value == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *value)
+			}
+		}
+		onlineEnv = nil
+		return
+	}
+
+	env := map[string]string{
+		"GOPROXY": "off",
+		// The modules of the cache were verified when downloaded.
+		"GOSUMDB": "off",
+	}
+	if _, err := os.Stat(filepath.Join("vendor", "modules.txt")); err == nil {
+		env["GOFLAGS"] = strings.TrimSpace(os.Getenv("GOFLAGS") + " -mod=vendor")
+	}
+	onlineEnv = make(map[string]*string)
+	for name, value := range env {
+		if old, ok := os.LookupEnv(name); ok {
+			onlineEnv[name] = &old
+		} else {
+			onlineEnv[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+}
+
+// vendoredPackage returns the directory of the package with the given import path in the vendor directory of
+// the working directory, in offline mode. ok is false outside of offline mode, and for the packages of the
+// standard library or not vendored.
+func vendoredPackage(path string) (dir string, ok bool) {
+	if !offline || !strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+		return "", false
+	}
+	dir, err := filepath.Abs(filepath.Join("vendor", filepath.FromSlash(path)))
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// importSource returns the source package with the given import path, from the vendor directory in offline mode
+// or else from the GOPATH.
+func importSource(path string) (*build.Package, error) {
+	dir, ok := vendoredPackage(path)
+	if !ok {
+		return build.Import(path, "", 0)
+	}
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("vendored package %s: %v", path, err)
+	}
+	pkg.ImportPath = path
+	return pkg, nil
+}
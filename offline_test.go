@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOffline tests importing vendored packages in offline mode, where the go command cannot download.
+func TestOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes-offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pkg := filepath.Join(dir, "vendor", "example.com", "shout")
+	if err := os.MkdirAll(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := "package shout\n\nimport \"strings\"\n\nfunc Hello(name string) string { return \"hello \" + strings.ToUpper(name) }\n"
+	if err := ioutil.WriteFile(filepath.Join(pkg, "shout.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	proxy, hasProxy := os.LookupEnv("GOPROXY")
+
+	ir := newInterp()
+	if _, err := evalCell(ir, nil, "%opt offline on"); err != nil {
+		t.Fatalf("\t%s %%opt offline on: %v", failure, err)
+	}
+	if got := os.Getenv("GOPROXY"); got != "off" {
+		t.Errorf("\t%s Expected GOPROXY=off in offline mode but got %q", failure, got)
+	}
+	vals, err := evalCell(ir, nil, "import \"example.com/shout\"\nshout.Hello(\"gopher\")")
+	if err != nil || len(vals) != 1 || vals[0] != "hello GOPHER" {
+		t.Errorf("\t%s Expected the vendored package to be imported but got %v, %v", failure, vals, err)
+	}
+
+	if _, err := evalCell(ir, nil, "%opt offline off"); err != nil {
+		t.Fatalf("\t%s %%opt offline off: %v", failure, err)
+	}
+	if got, ok := os.LookupEnv("GOPROXY"); got != proxy || ok != hasProxy {
+		t.Errorf("\t%s Expected GOPROXY to be restored to %q but got %q", failure, proxy, got)
+	}
+}
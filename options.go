@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// kernelOption is an option of the kernel set with `%opt name value...`.
+type kernelOption struct {
+	// set sets the option from the arguments of the magic after its name, and value returns its value as shown
+	// by `%opt`.
+	set   func(args []string) error
+	value func() string
+}
+
+// kernelOptions maps the names of the options of the kernel to them. Like magics, they register themselves from
+// the init function of the file implementing them.
+var kernelOptions = make(map[string]kernelOption)
+
+func init() {
+	lineMagics["opt"] = optMagic
+}
+
+// optMagic implements `%opt [name value...]`: it sets the option name, or lists the options and their values
+// when given no arguments.
+func optMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(kernelOptions))
+		for name := range kernelOptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", name, kernelOptions[name].value())
+		}
+		return nil
+	}
+
+	opt, ok := kernelOptions[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown option %q", args[0])
+	}
+	if err := opt.set(args[1:]); err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	return nil
+}
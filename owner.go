@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ownerGuard refuses the requests of users other than the owner of the kernel: the user of the first request
+// carrying a user name. The connection key authenticates the front-ends, not their users, so a kernel
+// mistakenly shared by the users of a server would let each of them read and change the variables of the
+// others. The guard is off when the kernel is meant to be shared, e.g. for real-time collaboration, with
+// GOPHERNOTES_SHARED=1 in its environment.
+type ownerGuard struct {
+	mu     sync.Mutex
+	owner  string
+	shared bool
+}
+
+// owner guards the session of the kernel.
+var owner = newOwnerGuard(os.Getenv("GOPHERNOTES_SHARED"))
+
+// newOwnerGuard returns a guard, which is off if shared parses as true.
+func newOwnerGuard(shared string) *ownerGuard {
+	on, _ := strconv.ParseBool(shared)
+	return &ownerGuard{shared: on}
+}
+
+// check returns an error if the message with the given header comes from another user than the owner of the
+// kernel. Messages without a user name, and kernel_info_request messages, which reveal nothing of the session,
+// are always accepted.
+func (g *ownerGuard) check(header MsgHeader) error {
+	if g.shared || header.Username == "" || header.MsgType == "kernel_info_request" {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.owner == "" {
+		g.owner = header.Username
+	}
+	if header.Username != g.owner {
+		return executionError{enamePermission, fmt.Errorf("this kernel belongs to %s: user %s cannot use it, "+
+			"start a kernel of your own (set GOPHERNOTES_SHARED=1 to share kernels between users)", g.owner, header.Username)}
+	}
+	return nil
+}
+
+// refuseMessage answers a message refused by the owner guard with err: requests get an error reply, the other
+// messages are dropped.
+func refuseMessage(receipt msgReceipt, err error) {
+	msgType := receipt.Msg.Header.MsgType
+	log.Printf("Refusing %s from %s: %v\n", msgType, receipt.Msg.Header.Username, err)
+	if msgType == "execute_request" {
+		content, _ := receipt.Msg.Content.(map[string]interface{})
+		code, _ := content["code"].(string)
+		audit.record(&receipt, ExecCounter, code, map[string]interface{}{"status": "refused", "ename": enamePermission})
+	}
+	if !strings.HasSuffix(msgType, "_request") {
+		return
+	}
+	reply := map[string]interface{}{
+		"status":    "error",
+		"ename":     errorName(err),
+		"evalue":    err.Error(),
+		"traceback": []string{err.Error()},
+	}
+	if err := receipt.Reply(strings.TrimSuffix(msgType, "_request")+"_reply", reply); err != nil {
+		log.Printf("Error replying to %s: %v\n", msgType, err)
+	}
+}
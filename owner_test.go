@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestOwnerGuard tests refusing the requests of users other than the owner of the kernel.
+func TestOwnerGuard(t *testing.T) {
+	g := newOwnerGuard("")
+	cases := []struct {
+		user, msgType string
+		refused       bool
+	}{
+		{"", "execute_request", false},
+		{"ada", "execute_request", false},
+		{"ada", "complete_request", false},
+		{"bob", "kernel_info_request", false},
+		{"bob", "complete_request", true},
+		{"bob", "execute_request", true},
+		{"", "comm_msg", false},
+		{"ada", "execute_request", false},
+	}
+	for _, c := range cases {
+		err := g.check(MsgHeader{Username: c.user, MsgType: c.msgType})
+		switch {
+		case c.refused && (err == nil || errorName(err) != enamePermission || !strings.Contains(err.Error(), "belongs to ada")):
+			t.Errorf("\t%s Expected the %s of %q to be refused, got %v", failure, c.msgType, c.user, err)
+		case !c.refused && err != nil:
+			t.Errorf("\t%s Expected the %s of %q to be accepted, got %v", failure, c.msgType, c.user, err)
+		}
+	}
+
+	shared := newOwnerGuard("1")
+	shared.check(MsgHeader{Username: "ada", MsgType: "execute_request"})
+	if err := shared.check(MsgHeader{Username: "bob", MsgType: "execute_request"}); err != nil {
+		t.Errorf("\t%s Expected a shared kernel to accept other users, got %v", failure, err)
+	}
+}
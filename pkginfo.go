@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"html"
+	"path/filepath"
+	r "reflect"
+	"sort"
+	"strings"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+func init() {
+	lineMagics["pkginfo"] = pkginfoMagic
+}
+
+// pkgSymbol is an exported symbol of a package, as listed by `%pkginfo`.
+type pkgSymbol struct {
+	kind, name, signature, doc string
+}
+
+// pkgKindOrder sorts the symbols of a package like godoc.
+var pkgKindOrder = map[string]int{"const": 0, "var": 1, "func": 2, "type": 3}
+
+// pkginfoMagic implements `%pkginfo package [filter]`, which shows the exported constants, variables,
+// functions and types of an imported package with their signatures and the first sentence of their
+// documentation. The package is given by import path or by the name it is imported as. Only the symbols
+// whose name or documentation contains filter, ignoring case, are shown, and the HTML table can be searched.
+func pkginfoMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("expected an import path or package name, and an optional filter")
+	}
+
+	path := args[0]
+	if ref := packageRef(ir.ValueOf(path)); ref != nil {
+		path = ref.Path
+	}
+	pkg, ok := imports.Packages[path]
+	if !ok {
+		return fmt.Errorf("package %q is not imported", path)
+	}
+
+	symbols := packageSymbols(path, pkg)
+	if len(args) == 2 {
+		filter := strings.ToLower(args[1])
+		var matches []pkgSymbol
+		for _, s := range symbols {
+			if strings.Contains(strings.ToLower(s.name), filter) || strings.Contains(strings.ToLower(s.doc), filter) {
+				matches = append(matches, s)
+			}
+		}
+		symbols = matches
+	}
+
+	rows := make([][]string, len(symbols))
+	for i, s := range symbols {
+		rows[i] = []string{s.kind, s.name, s.signature, s.doc}
+	}
+	data := display.Table([]string{"Kind", "Name", "Signature", "Doc"}, rows)
+
+	// Hide the rows not containing the text typed in the search box.
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	data[display.MIMETypeHTML] = fmt.Sprintf(`<div id="pkginfo-%s"><input type="search" placeholder="Search %s" oninput="`+
+		`var q = this.value.toLowerCase(); `+
+		`document.querySelectorAll('#pkginfo-%s tbody tr').forEach(function(tr) { `+
+		`tr.style.display = tr.textContent.toLowerCase().indexOf(q) < 0 ? 'none' : ''; })">%s</div>`,
+		id, html.EscapeString(path), id, data[display.MIMETypeHTML])
+
+	return receipt.PublishDisplayData(bundledMIMEData(data), nil, "")
+}
+
+// packageSymbols returns the exported symbols of the package with the given import path, from its bindings
+// and, when its source is available, its documentation.
+func packageSymbols(path string, pkg imports.Package) []pkgSymbol {
+	docs := packageDocs(path)
+
+	var symbols []pkgSymbol
+	for name, v := range pkg.Binds {
+		if !ast.IsExported(name) {
+			continue
+		}
+		s := pkgSymbol{kind: "const", name: name, signature: v.Type().String()}
+		if v.CanAddr() {
+			s.kind = "var"
+		} else if v.Kind() == r.Func {
+			s.kind = "func"
+		}
+		if kind, ok := pkg.Untypeds[name]; ok {
+			s.signature = "untyped " + strings.SplitN(kind, ":", 2)[0]
+		}
+		if d, ok := docs[name]; ok {
+			if d.signature != "" {
+				s.signature = d.signature
+			}
+			s.doc = d.doc
+		}
+		symbols = append(symbols, s)
+	}
+	for name, t := range pkg.Types {
+		if !ast.IsExported(name) {
+			continue
+		}
+		s := pkgSymbol{kind: "type", name: name, signature: t.Kind().String()}
+		if t.Kind() == r.Ptr {
+			s.signature = t.String()
+		}
+		s.doc = docs[name].doc
+		symbols = append(symbols, s)
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if a.kind != b.kind {
+			return pkgKindOrder[a.kind] < pkgKindOrder[b.kind]
+		}
+		return a.name < b.name
+	})
+	return symbols
+}
+
+// packageDocs returns the first sentence of the documentation of the exported symbols of a package, and
+// the declarations of its functions, by name. It is empty if the source of the package is not found.
+func packageDocs(path string) map[string]pkgSymbol {
+	docs := make(map[string]pkgSymbol)
+	bpkg, err := build.Import(path, "", 0)
+	if err != nil {
+		return docs
+	}
+
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+	for _, name := range bpkg.GoFiles {
+		filename := filepath.Join(bpkg.Dir, name)
+		if file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments); err == nil {
+			files[filename] = file
+		}
+	}
+	dpkg := doc.New(&ast.Package{Name: bpkg.Name, Files: files}, path, 0)
+
+	addFuncs := func(funcs []*doc.Func) {
+		for _, f := range funcs {
+			decl := *f.Decl
+			decl.Doc, decl.Body = nil, nil
+			var buf bytes.Buffer
+			printer.Fprint(&buf, fset, &decl)
+			docs[f.Name] = pkgSymbol{signature: buf.String(), doc: doc.Synopsis(f.Doc)}
+		}
+	}
+	addValues := func(values []*doc.Value) {
+		for _, v := range values {
+			for _, name := range v.Names {
+				docs[name] = pkgSymbol{doc: doc.Synopsis(v.Doc)}
+			}
+		}
+	}
+	addFuncs(dpkg.Funcs)
+	addValues(dpkg.Consts)
+	addValues(dpkg.Vars)
+	for _, t := range dpkg.Types {
+		docs[t.Name] = pkgSymbol{doc: doc.Synopsis(t.Doc)}
+		addFuncs(t.Funcs)
+		addValues(t.Consts)
+		addValues(t.Vars)
+	}
+	return docs
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"image"
+	"log"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+// imagePreview is toggled by `%preview on|off`. When set, each statement assigning an image.Image to a
+// variable updates a single preview of that variable below the cell.
+var imagePreview bool
+
+func init() {
+	lineMagics["preview"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) (err error) {
+		imagePreview, err = parseSwitch(args)
+		return err
+	}
+}
+
+// previewImages publishes the images assigned by node. displayIDs maps the variables already previewed
+// by the cell to the display id of their preview, which is updated instead of displaying a new image.
+func previewImages(ir *classic.Interp, node ast.Node, displayIDs map[string]string) {
+	receipt, err := hooks.currentReceipt()
+	if err != nil {
+		return
+	}
+
+	for _, name := range assignedNames(node) {
+		img, ok := base.ValueInterface(ir.ValueOf(name)).(image.Image)
+		if !ok {
+			continue
+		}
+
+		data := bundledMIMEData(display.Image(img))
+
+		if displayID, ok := displayIDs[name]; ok {
+			err = receipt.PublishUpdateDisplayData(data, nil, displayID)
+		} else {
+			if displayIDs[name], err = newUUID(); err != nil {
+				log.Printf("Error creating display id: %v\n", err)
+				continue
+			}
+			err = receipt.PublishDisplayData(data, nil, displayIDs[name])
+		}
+		if err != nil {
+			log.Printf("Error publishing image preview: %v\n", err)
+		}
+	}
+}
+
+// assignedNames returns the names of the variables assigned or declared by a top-level node of a cell.
+func assignedNames(node ast.Node) []string {
+	var idents []*ast.Ident
+
+	switch node := node.(type) {
+	case *ast.AssignStmt:
+		for _, lhs := range node.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok {
+				idents = append(idents, ident)
+			}
+		}
+	case *ast.DeclStmt:
+		return assignedNames(node.Decl)
+	case *ast.GenDecl:
+		if node.Tok != token.VAR {
+			break
+		}
+		for _, spec := range node.Specs {
+			if spec, ok := spec.(*ast.ValueSpec); ok {
+				idents = append(idents, spec.Names...)
+			}
+		}
+	}
+
+	var names []string
+	for _, ident := range idents {
+		if ident.Name != "_" {
+			names = append(names, ident.Name)
+		}
+	}
+	return names
+}
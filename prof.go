@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/google/pprof/profile"
+	"github.com/gopherdata/gophernotes/display"
+)
+
+func init() {
+	cellMagics["prof"] = profMagic
+	lineMagics["profcmp"] = profcmpMagic
+}
+
+// profiles maps the names of the CPU profiles captured by `%%prof` to the last of them.
+var profiles = make(map[string]*profile.Profile)
+
+// profFlags parses the arguments of the profiling magics: `-top n` and the given number of names.
+func profFlags(args []string, names int) (top int, rest []string, err error) {
+	flags := flag.NewFlagSet("prof", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	n := flags.Int("top", 20, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != names || *n < 1 {
+		return 0, nil, fmt.Errorf("expected [-top n] and %d profile names, got %q", names, strings.Join(args, " "))
+	}
+	return *n, flags.Args(), nil
+}
+
+// profMagic implements `%%prof [-top n] name`: it runs the body of the cell while capturing a CPU profile,
+// records the profile under name for %profcmp, and shows the n functions using the most CPU time.
+func profMagic(ir *classic.Interp, receipt *msgReceipt, args []string, body string) ([]interface{}, error) {
+	top, names, err := profFlags(args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, err
+	}
+	vals, err := evalCell(ir, receipt, body)
+	pprof.StopCPUProfile()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := profile.Parse(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("reading the CPU profile: %v", err)
+	}
+	profiles[names[0]] = p
+	if receipt != nil {
+		if err := receipt.PublishDisplayData(bundledMIMEData(profileTopTable(p, top)), nil, ""); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// profcmpMagic implements `%profcmp [-top n] old new`, which compares the CPU profiles old and new captured by
+// `%%prof`, like pprof -diff_base does: it shows the n functions whose CPU time changed the most.
+func profcmpMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if receipt == nil {
+		return errors.New("needs a front-end")
+	}
+	top, names, err := profFlags(args, 2)
+	if err != nil {
+		return err
+	}
+	var ps [2]*profile.Profile
+	for i, name := range names {
+		if ps[i] = profiles[name]; ps[i] == nil {
+			return fmt.Errorf("no profile named %q, capture it with %%%%prof %s", name, name)
+		}
+	}
+	return receipt.PublishDisplayData(bundledMIMEData(profileDiffTable(names[0], names[1], ps[0], ps[1], top)), nil, "")
+}
+
+// profileFunc is the CPU time, or another sampled value, of a function in a profile: self counts the samples in
+// the function itself, cum those in the function or the functions it calls.
+type profileFunc struct {
+	name      string
+	self, cum int64
+}
+
+// profileFuncs returns the values of the given sample type of the functions of the samples of p, like their CPU
+// time in nanoseconds for "cpu", and their total. The last sample type is used if p has none of this type.
+func profileFuncs(p *profile.Profile, sampleType string) (funcs map[string]*profileFunc, total int64) {
+	index := len(p.SampleType) - 1
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			index = i
+		}
+	}
+
+	funcs = make(map[string]*profileFunc)
+	get := func(name string) *profileFunc {
+		f := funcs[name]
+		if f == nil {
+			f = &profileFunc{name: name}
+			funcs[name] = f
+		}
+		return f
+	}
+	for _, s := range p.Sample {
+		if index < 0 || index >= len(s.Value) {
+			continue
+		}
+		v := s.Value[index]
+		total += v
+		// The lines of a location are innermost first, after the functions inlined into it. A recursive
+		// function counts once in the cumulative time of a sample.
+		seen := make(map[string]bool)
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				name := "?"
+				if line.Function != nil {
+					name = line.Function.Name
+				}
+				if i == 0 && j == 0 {
+					get(name).self += v
+				}
+				if !seen[name] {
+					seen[name] = true
+					get(name).cum += v
+				}
+			}
+		}
+	}
+	return funcs, total
+}
+
+// profileTopTable returns the n functions using the most CPU time in p, like pprof's top command.
+func profileTopTable(p *profile.Profile, n int) display.Data {
+	funcs, total := profileFuncs(p, "cpu")
+	sorted := make([]*profileFunc, 0, len(funcs))
+	for _, f := range funcs {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.self != b.self {
+			return a.self > b.self
+		}
+		if a.cum != b.cum {
+			return a.cum > b.cum
+		}
+		return a.name < b.name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+
+	percent := func(v int64) string {
+		if total == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%.2f%%", 100*float64(v)/float64(total))
+	}
+	rows := make([][]string, len(sorted))
+	sum := int64(0)
+	for i, f := range sorted {
+		sum += f.self
+		rows[i] = []string{time.Duration(f.self).String(), percent(f.self), percent(sum),
+			time.Duration(f.cum).String(), percent(f.cum), f.name}
+	}
+	if len(rows) == 0 {
+		rows = append(rows, []string{"", "", "", "", "", fmt.Sprintf("no samples in %v", time.Duration(p.DurationNanos))})
+	}
+	return display.Table([]string{"self", "self%", "sum%", "cum", "cum%", "function"}, rows)
+}
+
+// profileDiffTable returns the n functions whose CPU time changed the most from the profile before, named
+// beforeName, to the profile after, sorted by the change of their cumulative time.
+func profileDiffTable(beforeName, afterName string, before, after *profile.Profile, n int) display.Data {
+	beforeFuncs, _ := profileFuncs(before, "cpu")
+	afterFuncs, _ := profileFuncs(after, "cpu")
+	type change struct {
+		name                string
+		before, after       profileFunc
+		selfDelta, cumDelta int64
+	}
+	names := make(map[string]bool)
+	for name := range beforeFuncs {
+		names[name] = true
+	}
+	for name := range afterFuncs {
+		names[name] = true
+	}
+	var changes []change
+	for name := range names {
+		c := change{name: name}
+		if f := beforeFuncs[name]; f != nil {
+			c.before = *f
+		}
+		if f := afterFuncs[name]; f != nil {
+			c.after = *f
+		}
+		c.selfDelta, c.cumDelta = c.after.self-c.before.self, c.after.cum-c.before.cum
+		if c.selfDelta != 0 || c.cumDelta != 0 {
+			changes = append(changes, c)
+		}
+	}
+	abs := func(v int64) int64 {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if abs(a.cumDelta) != abs(b.cumDelta) {
+			return abs(a.cumDelta) > abs(b.cumDelta)
+		}
+		if abs(a.selfDelta) != abs(b.selfDelta) {
+			return abs(a.selfDelta) > abs(b.selfDelta)
+		}
+		return a.name < b.name
+	})
+	if len(changes) > n {
+		changes = changes[:n]
+	}
+
+	delta := func(v int64) string {
+		if v > 0 {
+			return "+" + time.Duration(v).String()
+		}
+		return time.Duration(v).String()
+	}
+	rows := make([][]string, len(changes))
+	for i, c := range changes {
+		rows[i] = []string{time.Duration(c.before.self).String(), time.Duration(c.after.self).String(), delta(c.selfDelta),
+			time.Duration(c.before.cum).String(), time.Duration(c.after.cum).String(), delta(c.cumDelta), c.name}
+	}
+	columns := []string{beforeName + " self", afterName + " self", "self delta",
+		beforeName + " cum", afterName + " cum", "cum delta", "function"}
+	return display.Table(columns, rows)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// testProfile returns a CPU profile with a sample of the given CPU time, in milliseconds, per stack of
+// function names, innermost first.
+func testProfile(samples map[string]int64) *profile.Profile {
+	p := &profile.Profile{SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}}
+	funcs := make(map[string]*profile.Function)
+	for stack, ms := range samples {
+		s := &profile.Sample{Value: []int64{ms / 10, ms * 1e6}}
+		for _, name := range strings.Fields(stack) {
+			if funcs[name] == nil {
+				funcs[name] = &profile.Function{Name: name}
+			}
+			s.Location = append(s.Location, &profile.Location{Line: []profile.Line{{Function: funcs[name]}}})
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+// tableLines returns the lines of the text of a table, with single spaces between the columns.
+func tableLines(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestProfileTables tests the tables of the functions of CPU profiles and of their changes.
+func TestProfileTables(t *testing.T) {
+	before := testProfile(map[string]int64{"hash main": 60, "sort main": 30, "main": 10})
+	after := testProfile(map[string]int64{"hash main": 20, "sort main": 30, "fib fib main": 50})
+
+	text := tableLines(profileTopTable(before, 2).Text())
+	for _, want := range []string{"60ms 60.00% 60.00% 60ms 60.00% hash", "30ms 30.00% 90.00% 30ms 30.00% sort"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("\t%s Expected the top table to contain %q, got\n%s", failure, want, text)
+		}
+	}
+	if strings.Contains(text, "main") {
+		t.Errorf("\t%s Expected the top table to be limited to 2 functions, got\n%s", failure, text)
+	}
+	if text := tableLines(profileTopTable(after, 10).Text()); !strings.Contains(text, "50ms 50.00% 50.00% 50ms 50.00% fib") ||
+		!strings.Contains(text, "0s 0.00% 100.00% 100ms 100.00% main") {
+		t.Errorf("\t%s Expected recursive functions to count once in the cumulative time, got\n%s", failure, text)
+	}
+	if text := profileTopTable(&profile.Profile{}, 10).Text(); !strings.Contains(text, "no samples") {
+		t.Errorf("\t%s Expected an empty profile to say so, got\n%s", failure, text)
+	}
+
+	got := tableLines(profileDiffTable("old", "new", before, after, 10).Text())
+	want := strings.Join([]string{
+		"old self new self self delta old cum new cum cum delta function",
+		"0s 50ms +50ms 0s 50ms +50ms fib",
+		"60ms 20ms -40ms 60ms 20ms -40ms hash",
+		"10ms 0s -10ms 100ms 100ms 0s main",
+	}, "\n")
+	if got != want {
+		t.Errorf("\t%s profileDiffTable() =\n%s\nexpected\n%s", failure, got, want)
+	}
+}
+
+// TestProfMagic tests capturing a CPU profile with `%%prof`.
+func TestProfMagic(t *testing.T) {
+	ir := newInterp()
+	if _, err := evalCell(ir, nil, "%%prof spin\nx := 0\nfor i := 0; i < 1000; i++ {\n\tx += i\n}"); err != nil {
+		t.Fatalf("\t%s Expected %%%%prof to run the cell, got %v", failure, err)
+	}
+	if profiles["spin"] == nil {
+		t.Errorf("\t%s Expected %%%%prof to record the profile spin", failure)
+	}
+	if _, err := evalCell(ir, nil, "%%prof\n1"); err == nil {
+		t.Errorf("\t%s Expected %%%%prof without a name to fail", failure)
+	}
+}
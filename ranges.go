@@ -0,0 +1,299 @@
+package main
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	r "reflect"
+	"strconv"
+	"sync"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// rangeFuncName is the name of the function running the range statements over integers, functions and maps.
+	rangeFuncName = "__gophernotesRange"
+
+	// rangeValueName is the name of the variable holding the value assigned to an iteration variable of a range
+	// statement without `:=`.
+	rangeValueName = "__gophernotesRangeValue"
+)
+
+// classicPkgPath is the path of the package of the interpreter, whose unexported types break, continue and
+// return statements panic with.
+var classicPkgPath = r.TypeOf(classic.Env{}).PkgPath()
+
+// sessionRanges holds the range statements of the cells of the session of ir, run by rangeFuncName. Those of
+// functions are kept with them, the others only until the next node is fixed, once the node that has them ran.
+type sessionRanges struct {
+	mu        sync.Mutex
+	ir        *classic.Interp
+	stmts     map[int]*ast.RangeStmt
+	next      int
+	transient []int
+}
+
+var ranges = &sessionRanges{}
+
+// fixRanges rewrites the range expressions of node that may be integers, functions or maps into calls of the
+// function rangeFuncName, which runs the range statements over integers and functions like Go 1.23 does, and
+// those over maps without listing their keys first, and gives the other values back to the interpreter. Each
+// iteration of those it runs has variables of its own, like in Go 1.22. It returns the replacement of node.
+func fixRanges(ir *classic.Interp, node ast.Node) ast.Node {
+	ranges.reset(ir)
+	declared := declaredNames([]ast.Node{node})
+
+	var fix func(n ast.Node, inFunc bool)
+	fix = func(n ast.Node, inFunc bool) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			switch stmt := n.(type) {
+			case *ast.FuncDecl:
+				if !inFunc && stmt.Body != nil {
+					fix(stmt.Body, true)
+					return false
+				}
+			case *ast.FuncLit:
+				if !inFunc {
+					fix(stmt.Body, true)
+					return false
+				}
+			case *ast.RangeStmt:
+				if mayIterate(ir, stmt.X, declared) {
+					stmt.X = ranges.add(stmt, inFunc)
+				}
+			}
+			return true
+		})
+	}
+	fix(node, false)
+	return node
+}
+
+// mayIterate reports whether the range expression x may be an integer, a function or a map: those of the other
+// types known before running the node are left to the interpreter.
+func mayIterate(ir *classic.Interp, x ast.Expr, declared map[string]bool) bool {
+	switch x := unparen(x).(type) {
+	case *ast.BasicLit:
+		return x.Kind == token.INT
+	case *ast.CompositeLit:
+		_, isMap := x.Type.(*ast.MapType)
+		return isMap
+	case *ast.SliceExpr:
+		return false
+	case *ast.CallExpr:
+		if ident, ok := unparen(x.Fun).(*ast.Ident); ok && ident.Name == "make" && !declared[ident.Name] {
+			if len(x.Args) == 0 {
+				return false
+			}
+			_, isMap := x.Args[0].(*ast.MapType)
+			return isMap
+		}
+	case *ast.Ident:
+		if declared[x.Name] {
+			return true
+		}
+		if v := ir.Env.ValueOf(x.Name); v.IsValid() {
+			switch v.Kind() {
+			case r.Int, r.Int8, r.Int16, r.Int32, r.Int64, r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr,
+				r.Func, r.Map:
+				return true
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// add records stmt, kept if inFunc is set, and returns the call of rangeFuncName replacing its range expression.
+func (s *sessionRanges) add(stmt *ast.RangeStmt, inFunc bool) ast.Expr {
+	s.mu.Lock()
+	index := s.next
+	s.next++
+	s.stmts[index] = stmt
+	if !inFunc {
+		s.transient = append(s.transient, index)
+	}
+	s.mu.Unlock()
+
+	return &ast.CallExpr{
+		Fun: &ast.Ident{NamePos: stmt.X.Pos(), Name: rangeFuncName},
+		Args: []ast.Expr{
+			&ast.BasicLit{ValuePos: stmt.X.Pos(), Kind: token.INT, Value: strconv.Itoa(index)},
+			stmt.X,
+		},
+		Rparen: stmt.X.End(),
+	}
+}
+
+// reset forgets the range statements of the previous session when ir is a new interpreter, and defines the
+// function rangeFuncName in it. Otherwise it forgets those of the previous node outside of functions, which it
+// ran already.
+func (s *sessionRanges) reset(ir *classic.Interp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, index := range s.transient {
+		delete(s.stmts, index)
+	}
+	s.transient = nil
+	if s.ir == ir {
+		return
+	}
+	s.ir = ir
+	s.stmts = make(map[int]*ast.RangeStmt)
+
+	fn := builtinFunc(s.run)
+	ir.Env.DefineVar(rangeFuncName, fn.Type(), fn)
+}
+
+// run implements rangeFuncName: args are the index of the range statement and the value of its range
+// expression, evaluated by env. The statement is run when the value is an integer, a function or a map, and an
+// empty string is returned for the interpreter to iterate over instead. Any other value is returned as is.
+func (s *sessionRanges) run(env *classic.Env, args []r.Value) (r.Value, []r.Value) {
+	s.mu.Lock()
+	stmt := s.stmts[int(args[0].Int())]
+	s.mu.Unlock()
+
+	x := args[1]
+	if !x.IsValid() {
+		return x, nil
+	}
+	switch x.Kind() {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		checkRangeVars(env, stmt, 1)
+		for i := int64(0); i < x.Int(); i++ {
+			v := r.New(x.Type()).Elem()
+			v.SetInt(i)
+			if !iterate(env, stmt, v) {
+				break
+			}
+		}
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		checkRangeVars(env, stmt, 1)
+		for i := uint64(0); i < x.Uint(); i++ {
+			v := r.New(x.Type()).Elem()
+			v.SetUint(i)
+			if !iterate(env, stmt, v) {
+				break
+			}
+		}
+	case r.Func:
+		if !isIterator(x.Type()) {
+			return x, nil
+		}
+		rangeFunc(env, stmt, x)
+	case r.Map:
+		// The entries are visited as the map holds them, rather than through a list of its keys, so that ranging
+		// over a large map takes no memory, and entries deleted before being reached are skipped, like in Go.
+		for entries := x.MapRange(); entries.Next(); {
+			if !iterate(env, stmt, entries.Key(), entries.Value()) {
+				break
+			}
+		}
+	default:
+		return x, nil
+	}
+	return r.ValueOf(""), nil
+}
+
+// isIterator reports whether typ is the type of a function a range statement iterates over: one taking a yield
+// function with at most two parameters returning a bool, and returning nothing.
+func isIterator(typ r.Type) bool {
+	if typ.NumIn() != 1 || typ.NumOut() != 0 || typ.IsVariadic() {
+		return false
+	}
+	yield := typ.In(0)
+	return yield.Kind() == r.Func && yield.NumIn() <= 2 && !yield.IsVariadic() &&
+		yield.NumOut() == 1 && yield.Out(0).Kind() == r.Bool
+}
+
+// checkRangeVars fails at the position of stmt in env if stmt has more iteration variables than the n values of
+// each iteration.
+func checkRangeVars(env *classic.Env, stmt *ast.RangeStmt, n int) {
+	x := stmt.X.(*ast.CallExpr).Args[1]
+	switch {
+	case n == 0 && stmt.Key != nil:
+		env.Errorf("range over %v permits no iteration variables", x)
+	case n == 1 && stmt.Value != nil:
+		env.Errorf("range over %v permits only one iteration variable", x)
+	}
+}
+
+// rangeFunc runs stmt over the iterator fn: the body is run by the yield function fn calls. The return
+// statements of the body end the iteration, and return once fn returns.
+func rangeFunc(env *classic.Env, stmt *ast.RangeStmt, fn r.Value) {
+	yieldType := fn.Type().In(0)
+	checkRangeVars(env, stmt, yieldType.NumIn())
+
+	var done bool
+	var ret interface{}
+	yield := r.MakeFunc(yieldType, func(in []r.Value) []r.Value {
+		if done {
+			panic(errors.New("range function continued iteration after function for loop body returned false"))
+		}
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if !isFlowPanic(p, "eReturn") {
+						panic(p)
+					}
+					ret = p
+				}
+			}()
+			done = !iterate(env, stmt, in...)
+		}()
+		if ret != nil {
+			done = true
+		}
+		return []r.Value{r.ValueOf(!done)}
+	})
+	fn.Call([]r.Value{yield})
+	if ret != nil {
+		panic(ret)
+	}
+}
+
+// iterate runs the body of stmt once, with vals as values of its iteration variables, in an environment of its
+// own within env. It reports whether the iteration goes on, i.e. the body did not break.
+func iterate(env *classic.Env, stmt *ast.RangeStmt, vals ...r.Value) (cont bool) {
+	env = classic.NewEnv(env, "range {}")
+	for i, expr := range []ast.Expr{stmt.Key, stmt.Value} {
+		if expr == nil || i >= len(vals) {
+			break
+		}
+		if ident, ok := expr.(*ast.Ident); ok && stmt.Tok == token.DEFINE {
+			env.DefineVar(ident.Name, vals[i].Type(), vals[i])
+			continue
+		}
+		// The value is defined apart from the variables of the body.
+		assign := classic.NewEnv(env, "range =")
+		assign.DefineVar(rangeValueName, vals[i].Type(), vals[i])
+		assign.EvalNode(&ast.AssignStmt{
+			Lhs: []ast.Expr{expr},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{&ast.Ident{NamePos: expr.Pos(), Name: rangeValueName}},
+		})
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			switch {
+			case isFlowPanic(p, "eBreak"):
+				cont = false
+			case isFlowPanic(p, "eContinue"):
+				cont = true
+			default:
+				panic(p)
+			}
+		}
+	}()
+	env.EvalNode(stmt.Body)
+	return true
+}
+
+// isFlowPanic reports whether p is the panic of the interpreter for the break, continue or return statements,
+// whose type is name.
+func isFlowPanic(p interface{}, name string) bool {
+	t := r.TypeOf(p)
+	return t.PkgPath() == classicPkgPath && t.Name() == name
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestRanges tests the range statements over integers, functions and maps.
+func TestRanges(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{"n := 0\nfor i := range 5 {\n\tn += i\n}\nn", 10},
+		{"var u uint8\nfor u = range uint8(4) {\n}\nu", uint8(3)},
+		{"count := 0\nfor range 3 {\n\tcount++\n}\ncount", 3},
+		{`func seq(yield func(int) bool) {
+	for i := 0; ; i++ {
+		if !yield(i * i) {
+			return
+		}
+	}
+}
+sum := 0
+for x := range seq {
+	if x > 20 {
+		break
+	}
+	if x == 4 {
+		continue
+	}
+	sum += x
+}
+sum`, 26},
+		{`func pairs(yield func(string, int) bool) {
+	_ = yield("a", 1) && yield("b", 2)
+}
+s := ""
+for k, v := range pairs {
+	s += k
+	s += string(rune('0' + v))
+}
+s`, "a1b2"},
+		// A return statement of the body returns from the function of the range statement.
+		{`func first(seq func(func(int) bool)) int {
+	for x := range seq {
+		return x
+	}
+	return -1
+}
+first(seq)`, 0},
+		// Each iteration has its own variable.
+		{`var fs []func() int
+for i := range 3 {
+	fs = append(fs, func() int { return i })
+}
+fs[0]() + fs[1]()*10 + fs[2]()*100`, 210},
+		{`m := map[string]int{"a": 1, "b": 2, "c": 3}
+total := 0
+for k, v := range m {
+	if k == "b" {
+		continue
+	}
+	total += v
+}
+total`, 4},
+		// The iteration variables have the static types of the keys and elements.
+		{`import "fmt"
+values := map[int]interface{}{1: "one"}
+types := ""
+for k, v := range values {
+	types = fmt.Sprintf("%T %T", &k, &v)
+}
+types`, "*int *interface {}"},
+		// Entries deleted before being reached are not visited.
+		{`odd := make(map[int]bool)
+for i := range 10 {
+	odd[i] = i%2 == 1
+}
+visited := 0
+for i := range odd {
+	for j := range odd {
+		if j != i {
+			delete(odd, j)
+		}
+	}
+	visited++
+}
+visited`, 1},
+		{`var none map[string]int
+n := 0
+for range none {
+	n++
+}
+for k := range map[string]bool{"x": true} {
+	n += len(k)
+}
+n`, 1},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+
+	// Only an iterator yielding two values permits two iteration variables.
+	if _, err := doEval(ir, "for i, j := range 3 {\n}"); err == nil {
+		t.Errorf("\t%s Expected an error for two iteration variables over an integer", failure)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"log"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// reactive is an output displaying the value of an expression, kept up to date by the kernel.
+type reactive struct {
+	expr      string
+	displayID string
+
+	// reads lists the symbols referenced by expr.
+	reads []string
+
+	// shown is set once the output has been displayed.
+	shown bool
+}
+
+// Reactive implements notebook.Kernel.Reactive. The expression is only evaluated by refreshReactives once the
+// cell completes, since the interpreter is busy running the cell.
+func (h *kernelHooks) Reactive(expr string) error {
+	if _, err := h.currentReceipt(); err != nil {
+		return err
+	}
+
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return fmt.Errorf("notebook: Reactive: %v", err)
+	}
+	_, reads := deps.symbols([]ast.Node{node})
+
+	displayID, err := newUUID()
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reactives = append(h.reactives, &reactive{expr: expr, displayID: displayID, reads: reads})
+	return nil
+}
+
+// refreshReactives displays the reactive outputs created by the last cell and updates the outputs referencing
+// one of the symbols it defines.
+func (h *kernelHooks) refreshReactives(ir *classic.Interp, receipt *msgReceipt, defines []string) {
+	h.mu.Lock()
+	reactives := append([]*reactive(nil), h.reactives...)
+	h.mu.Unlock()
+
+	for _, rv := range reactives {
+		if rv.shown && !rv.dependsOn(defines) {
+			continue
+		}
+
+		var data bundledMIMEData
+		if vals, err := doEval(ir, rv.expr); err != nil {
+			data = newTextBundledMIMEData(fmt.Sprintf("%s: %v", rv.expr, err))
+		} else {
+			data = renderValues(vals)
+		}
+
+		publish := receipt.PublishDisplayData
+		if rv.shown {
+			publish = receipt.PublishUpdateDisplayData
+		}
+		if err := publish(data, nil, rv.displayID); err != nil {
+			log.Printf("Error publishing reactive output: %v\n", err)
+		}
+		rv.shown = true
+	}
+}
+
+// dependsOn reports whether the expression of rv references one of the given symbols.
+func (rv *reactive) dependsOn(symbols []string) bool {
+	for _, name := range symbols {
+		for _, read := range rv.reads {
+			if name == read {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// TestLimitRecursion tests that the functions checking the depth of the calls are those that may recurse.
+func TestLimitRecursion(t *testing.T) {
+	defer func() { recursionLimit = 10000 }()
+
+	ir := newInterp()
+	if _, err := doEval(ir, "import (\n\t\"fmt\"\n\t\"sort\"\n\t\"strings\"\n)"); err != nil {
+		t.Fatalf("\t%s Importing the packages: %v", failure, err)
+	}
+	cases := []struct {
+		code  string
+		limit int
+		want  bool
+	}{
+		{"func sq(x int) int { return x * x }", 10000, false},
+		{"func rep(s string) []byte { return []byte(strings.Repeat(s, len(s))) }", 10000, false},
+		{"func down(n int) int { return 1 + down(n-1) }", 10000, true},
+		{"func show(x int) { fmt.Println(x) }", 10000, true},
+		{"func order(x []int) { sort.Slice(x, func(i, j int) bool { return x[i] < x[j] }) }", 10000, true},
+		{"func write(b *strings.Builder) { b.WriteString(\"x\") }", 10000, true},
+		{"func shadow() int { len := func(s string) int { return 0 }; return len(\"x\") }", 10000, true},
+		{"func down(n int) int { return 1 + down(n-1) }", 0, false},
+	}
+	for _, c := range cases {
+		recursionLimit = c.limit
+		file, err := parser.ParseFile(token.NewFileSet(), "", "package main\n"+c.code, 0)
+		if err != nil {
+			t.Fatalf("\t%s Parsing %s: %v", failure, c.code, err)
+		}
+		decl := file.Decls[0].(*ast.FuncDecl)
+		limitRecursion(ir, []ast.Node{decl})
+
+		call, _ := decl.Body.List[0].(*ast.ExprStmt)
+		checked := call != nil && isCallTo(call.X, enterCallFuncName)
+		if checked != c.want {
+			t.Errorf("\t%s Expected the depth to be checked to be %v but got %v with a limit of %d for\n%s", failure, c.want, checked, c.limit, c.code)
+		}
+	}
+}
+
+// isCallTo reports whether expr calls the function with the given name.
+func isCallTo(expr ast.Expr, name string) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	fun, ok := call.Fun.(*ast.Ident)
+	return ok && fun.Name == name
+}
+
+// BenchmarkRecursionLimit measures the cost of checking the depth of the calls, comparing a recursive function
+// declared with the default limit to the same function declared without limit.
+func BenchmarkRecursionLimit(b *testing.B) {
+	defer func() { recursionLimit = 10000 }()
+
+	for _, limit := range []int{10000, 0} {
+		recursionLimit = limit
+		ir := newInterp()
+		vals, err := doEval(ir, "func down(n int) int {\n\tif n == 0 {\n\t\treturn 0\n\t}\n\treturn 1 + down(n-1)\n}\ndown")
+		if err != nil || len(vals) != 1 {
+			b.Fatalf("\t%s Declaring down: %v", failure, err)
+		}
+		down := vals[0].(func(int) int)
+		name := "limit"
+		if limit == 0 {
+			name = "nolimit"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				down(1000)
+			}
+		})
+	}
+}
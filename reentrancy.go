@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"sync"
+)
+
+// errReentrant is returned when code tries to run a cell while another one is running, e.g. from a goroutine
+// started by a previous cell or from a callback of the running cell.
+var errReentrant = errors.New("cannot execute code while another cell is running, run it from a new cell instead")
+
+// evalGuard rejects evaluations started while another one is running, since the interpreter state is not safe
+// for concurrent or nested evaluations.
+type evalGuard struct {
+	mu      sync.Mutex
+	running bool
+}
+
+// evaluation guards the evaluations of the interpreter of the kernel.
+var evaluation evalGuard
+
+// enter marks the start of an evaluation, failing with errReentrant if one is already running.
+func (g *evalGuard) enter() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running {
+		return errReentrant
+	}
+	g.running = true
+	return nil
+}
+
+// exit marks the end of the evaluation started by enter.
+func (g *evalGuard) exit() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running = false
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/gopherdata/gophernotes/display"
+
+// renderValues returns the bundle displaying the values produced by a cell or an interactive function.
+// A single value is shown with the representations of the first renderer of display.Render accepting it, along
+// with its text if the renderer gives none, and anything else as text, written by formatValue.
+func renderValues(vals []interface{}) bundledMIMEData {
+	if len(vals) == 1 {
+		if data, ok := display.Render(vals[0]); ok {
+			bundle := bundledMIMEData(data)
+			if _, ok := bundle[display.MIMETypeText]; !ok {
+				bundle[display.MIMETypeText] = formatValue(vals[0])
+			}
+			return bundle
+		}
+	}
+	return newTextBundledMIMEData(formatValues(vals))
+}
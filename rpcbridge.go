@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	r "reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+func init() {
+	lineMagics["rpc"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		if len(args) == 0 {
+			return errors.New("expected the import paths of the packages to run in a separate process")
+		}
+		for _, path := range args {
+			pkg, err := loadRPCPackage(ir, path)
+			if err != nil {
+				return fmt.Errorf("cannot import %q: %v", path, err)
+			}
+			imports.Packages[path] = pkg
+		}
+		return nil
+	}
+}
+
+// rpcRequest calls the function Func of the package served by an RPC server with the JSON encoded Args.
+type rpcRequest struct {
+	Func string
+	Args []json.RawMessage
+}
+
+// rpcResponse holds the JSON encoded results of an rpcRequest, or the error it panicked with. An error
+// result is encoded as its message, or null.
+type rpcResponse struct {
+	Results []json.RawMessage
+	Panic   string
+}
+
+// rpcBridge forwards the calls of the interpreter to the RPC server of a package, one at a time.
+type rpcBridge struct {
+	path string
+	mu   sync.Mutex
+	cmd  *exec.Cmd
+	enc  *json.Encoder
+	dec  *json.Decoder
+	err  error
+
+	// dir is the directory of the binary of the server, when it cannot be removed while the server runs, as on
+	// Windows.
+	dir      string
+	stopOnce sync.Once
+}
+
+// rpcServers holds the RPC servers started during the session, stopped on shutdown.
+var rpcServers struct {
+	sync.Mutex
+	bridges []*rpcBridge
+}
+
+var errorType = r.TypeOf((*error)(nil)).Elem()
+
+// loadRPCPackage compiles a server exposing the API of the package with the given import path, and returns
+// bindings calling it over the stdin and stdout of a separate process. Only the functions whose parameters
+// and results are basic types, arrays, slices and maps of them, or errors, are exported, along with the
+// constants of the package. This is slower than plugins but works on every platform, and a crash of the
+// package does not take the kernel down.
+func loadRPCPackage(ir *classic.Interp, path string) (imports.Package, error) {
+	tpkg, err := importer.For("source", nil).Import(path)
+	if err != nil {
+		return imports.Package{}, err
+	}
+
+	pkg := imports.Package{}
+	pkg.Init()
+	var funcs []*types.Func
+	scope := tpkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Func:
+			if obj.Exported() && rpcSignature(obj.Type().(*types.Signature)) != nil {
+				funcs = append(funcs, obj)
+			}
+		case *types.Const:
+			if obj.Exported() {
+				if v, ok := rpcConst(obj); ok {
+					pkg.Binds[name] = v
+				}
+			}
+		}
+	}
+	if len(funcs) == 0 {
+		return pkg, nil
+	}
+
+	b, err := startRPCServer(path, funcs)
+	if err != nil {
+		return imports.Package{}, err
+	}
+	for _, fn := range funcs {
+		name, typ := fn.Name(), rpcSignature(fn.Type().(*types.Signature))
+		pkg.Binds[name] = r.MakeFunc(typ, func(args []r.Value) []r.Value {
+			return b.call(name, typ, args)
+		})
+	}
+	return pkg, nil
+}
+
+// rpcSignature returns the type of a function with the given signature, or nil if its parameters or results
+// cannot be sent to the RPC server.
+func rpcSignature(sig *types.Signature) r.Type {
+	if sig.Recv() != nil {
+		return nil
+	}
+	var in, out []r.Type
+	for _, tuple := range []struct {
+		vars  *types.Tuple
+		types *[]r.Type
+	}{{sig.Params(), &in}, {sig.Results(), &out}} {
+		for i := 0; i < tuple.vars.Len(); i++ {
+			t := rpcType(tuple.vars.At(i).Type())
+			if t == nil {
+				return nil
+			}
+			*tuple.types = append(*tuple.types, t)
+		}
+	}
+	return r.FuncOf(in, out, sig.Variadic())
+}
+
+// rpcType returns the type of the interpreter matching t, or nil if t is not a basic type, an array, slice or
+// map of them, or error. Named types are not supported, as the interpreter would see their underlying type.
+func rpcType(t types.Type) r.Type {
+	switch t := t.(type) {
+	case *types.Basic:
+		switch t.Kind() {
+		case types.Bool:
+			return r.TypeOf(false)
+		case types.Int:
+			return r.TypeOf(int(0))
+		case types.Int8:
+			return r.TypeOf(int8(0))
+		case types.Int16:
+			return r.TypeOf(int16(0))
+		case types.Int32:
+			return r.TypeOf(int32(0))
+		case types.Int64:
+			return r.TypeOf(int64(0))
+		case types.Uint:
+			return r.TypeOf(uint(0))
+		case types.Uint8:
+			return r.TypeOf(uint8(0))
+		case types.Uint16:
+			return r.TypeOf(uint16(0))
+		case types.Uint32:
+			return r.TypeOf(uint32(0))
+		case types.Uint64:
+			return r.TypeOf(uint64(0))
+		case types.Float32:
+			return r.TypeOf(float32(0))
+		case types.Float64:
+			return r.TypeOf(float64(0))
+		case types.String:
+			return r.TypeOf("")
+		}
+	case *types.Named:
+		if t.Obj().Pkg() == nil && t.Obj().Name() == "error" {
+			return errorType
+		}
+	case *types.Slice:
+		if elem := rpcType(t.Elem()); elem != nil && elem != errorType {
+			return r.SliceOf(elem)
+		}
+	case *types.Array:
+		if elem := rpcType(t.Elem()); elem != nil && elem != errorType {
+			return r.ArrayOf(int(t.Len()), elem)
+		}
+	case *types.Map:
+		key, elem := rpcType(t.Key()), rpcType(t.Elem())
+		if key == nil || elem == nil || elem == errorType {
+			break
+		}
+		if k := key.Kind(); k == r.String || k >= r.Int && k <= r.Uint64 {
+			return r.MapOf(key, elem)
+		}
+	}
+	return nil
+}
+
+// rpcConst returns the value of a constant, converted to its default type if untyped.
+func rpcConst(c *types.Const) (r.Value, bool) {
+	t := rpcType(types.Default(c.Type()))
+	if t == nil {
+		return r.Value{}, false
+	}
+	v := c.Val()
+	switch t.Kind() {
+	case r.Bool:
+		return r.ValueOf(constant.BoolVal(v)).Convert(t), true
+	case r.String:
+		return r.ValueOf(constant.StringVal(v)).Convert(t), true
+	case r.Float32, r.Float64:
+		f, _ := constant.Float64Val(constant.ToFloat(v))
+		return r.ValueOf(f).Convert(t), true
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64:
+		u, ok := constant.Uint64Val(constant.ToInt(v))
+		return r.ValueOf(u).Convert(t), ok
+	default:
+		i, ok := constant.Int64Val(constant.ToInt(v))
+		return r.ValueOf(i).Convert(t), ok
+	}
+}
+
+// startRPCServer compiles and starts the RPC server of the given functions of a package.
+func startRPCServer(path string, funcs []*types.Func) (_ *rpcBridge, err error) {
+	dir, err := ioutil.TempDir("", "gophernotes-rpc")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, rpcServerSource(path, funcs), 0600); err != nil {
+		return nil, err
+	}
+	bin := filepath.Join(dir, "server")
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+
+	env, err := rpcBuildEnv(dir, path)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	compile := exec.Command("go", "build", "-o", bin, ".")
+	compile.Dir, compile.Env = dir, env
+	compile.Stdout, compile.Stderr = &out, &out
+	if err := compile.Run(); err != nil {
+		return nil, fmt.Errorf("building the RPC server: %v\n%s", err, out.Bytes())
+	}
+
+	b := &rpcBridge{path: path, cmd: exec.Command(bin)}
+	stdin, err := b.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := b.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	b.cmd.Stderr = stderrWriter{}
+	if err := b.cmd.Start(); err != nil {
+		return nil, err
+	}
+	b.enc, b.dec = json.NewEncoder(stdin), json.NewDecoder(stdout)
+
+	// The binary of a running program can be removed, except on Windows, where its directory is removed once the
+	// server stopped.
+	if os.RemoveAll(dir) != nil {
+		b.dir = dir
+	}
+	rpcServers.Lock()
+	rpcServers.bridges = append(rpcServers.bridges, b)
+	rpcServers.Unlock()
+	return b, nil
+}
+
+// rpcBuildEnv returns the environment building the RPC server of the package with the given import path in
+// dir. A package of the module cache is built in module mode, with a go.mod in dir requiring the version of its
+// module found in the cache, the others in GOPATH mode.
+func rpcBuildEnv(dir, path string) ([]string, error) {
+	env := append(os.Environ(), "GOPATH="+build.Default.GOPATH)
+	pkg, err := build.Import(path, "", build.FindOnly)
+	if err != nil {
+		return nil, err
+	}
+	module, version, ok := moduleVersion(build.Default.GOPATH, pkg.Dir)
+	if !ok {
+		return append(env, "GO111MODULE=off"), nil
+	}
+
+	gomod := fmt.Sprintf("module gophernotes-rpc\n\nrequire %s %s\n", module, version)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomod), 0600); err != nil {
+		return nil, err
+	}
+	// -mod=mod records the checksums of the modules in a go.sum of dir, instead of the vendor directory offline
+	// mode may select.
+	return append(env, "GO111MODULE=on", "GOFLAGS=-mod=mod"), nil
+}
+
+// stderrWriter writes to the current os.Stderr, which is redirected below the running cell.
+type stderrWriter struct{}
+
+func (stderrWriter) Write(p []byte) (int, error) {
+	return os.Stderr.Write(p)
+}
+
+// call calls the function name of the RPC server, which has type typ. It panics if the function panics or the
+// server is gone, like a call to the package would.
+func (b *rpcBridge) call(name string, typ r.Type, args []r.Value) []r.Value {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		panic(b.err)
+	}
+
+	req := rpcRequest{Func: name, Args: make([]json.RawMessage, len(args))}
+	for i, arg := range args {
+		data, err := json.Marshal(arg.Interface())
+		if err != nil {
+			panic(fmt.Errorf("%s.%s: cannot encode argument %d: %v", b.path, name, i+1, err))
+		}
+		req.Args[i] = data
+	}
+
+	var resp rpcResponse
+	if err := b.enc.Encode(req); err != nil {
+		b.fail(err)
+	}
+	if err := b.dec.Decode(&resp); err != nil {
+		b.fail(err)
+	}
+	if resp.Panic != "" {
+		panic(fmt.Errorf("%s.%s: %s", b.path, name, resp.Panic))
+	}
+
+	results := make([]r.Value, typ.NumOut())
+	for i := range results {
+		t := typ.Out(i)
+		if t == errorType {
+			var msg *string
+			json.Unmarshal(resp.Results[i], &msg)
+			results[i] = r.Zero(t)
+			if msg != nil {
+				results[i] = r.ValueOf(errors.New(*msg)).Convert(t)
+			}
+			continue
+		}
+		v := r.New(t)
+		if err := json.Unmarshal(resp.Results[i], v.Interface()); err != nil {
+			panic(fmt.Errorf("%s.%s: cannot decode result %d: %v", b.path, name, i+1, err))
+		}
+		results[i] = v.Elem()
+	}
+	return results
+}
+
+// fail records that the RPC server is gone, and panics.
+func (b *rpcBridge) fail(err error) {
+	if err == io.EOF {
+		err = errors.New("exited")
+	}
+	b.err = fmt.Errorf("the RPC server of %s %v", b.path, err)
+	b.stop()
+	panic(b.err)
+}
+
+// stop kills the RPC server, and removes the directory of its binary if still there.
+func (b *rpcBridge) stop() {
+	b.stopOnce.Do(func() {
+		b.cmd.Process.Kill()
+		b.cmd.Wait()
+		if b.dir != "" {
+			if err := os.RemoveAll(b.dir); err != nil {
+				log.Printf("Error removing the RPC server of %s: %v\n", b.path, err)
+			}
+		}
+	})
+}
+
+// stopRPCServers stops the RPC servers started during the session. It is called on shutdown.
+func stopRPCServers() {
+	rpcServers.Lock()
+	defer rpcServers.Unlock()
+
+	for _, b := range rpcServers.bridges {
+		b.stop()
+	}
+	rpcServers.bridges = nil
+}
+
+// rpcServerSource returns the source of a program serving the given functions of a package on its stdin and
+// stdout. The output of the package goes to stderr.
+func rpcServerSource(path string, funcs []*types.Func) []byte {
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Name() < funcs[j].Name() })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	pkg %q
+)
+
+type request struct {
+	Func string
+	Args []json.RawMessage
+}
+
+type response struct {
+	Results []interface{}
+	Panic   string
+}
+
+func errorString(err error) *string {
+	if err == nil {
+		return nil
+	}
+	s := err.Error()
+	return &s
+}
+
+func serve(req request) (resp response) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = response{Panic: fmt.Sprint(r)}
+		}
+	}()
+	args := req.Args
+	switch req.Func {
+`, path)
+
+	for _, fn := range funcs {
+		sig := fn.Type().(*types.Signature)
+		fmt.Fprintf(&buf, "\tcase %q:\n", fn.Name())
+		var params, results []string
+		for i := 0; i < sig.Params().Len(); i++ {
+			t := types.TypeString(sig.Params().At(i).Type(), nil)
+			fmt.Fprintf(&buf, "\t\tvar a%d %s\n\t\tif err := json.Unmarshal(args[%d], &a%d); err != nil {\n\t\t\tpanic(err)\n\t\t}\n", i, t, i, i)
+			params = append(params, fmt.Sprintf("a%d", i))
+		}
+		if sig.Variadic() {
+			params[len(params)-1] += "..."
+		}
+		var encoded []string
+		for i := 0; i < sig.Results().Len(); i++ {
+			results = append(results, fmt.Sprintf("r%d", i))
+			if rpcType(sig.Results().At(i).Type()) == errorType {
+				encoded = append(encoded, fmt.Sprintf("errorString(r%d)", i))
+			} else {
+				encoded = append(encoded, fmt.Sprintf("r%d", i))
+			}
+		}
+		call := fmt.Sprintf("pkg.%s(%s)", fn.Name(), strings.Join(params, ", "))
+		if len(results) == 0 {
+			fmt.Fprintf(&buf, "\t\t%s\n\t\treturn response{}\n", call)
+		} else {
+			fmt.Fprintf(&buf, "\t\t%s := %s\n\t\treturn response{Results: []interface{}{%s}}\n",
+				strings.Join(results, ", "), call, strings.Join(encoded, ", "))
+		}
+	}
+
+	buf.WriteString(`	}
+	return response{Panic: "unknown function " + req.Func}
+}
+
+func main() {
+	// Keep stdout for the responses.
+	dec, enc := json.NewDecoder(os.Stdin), json.NewEncoder(os.Stdout)
+	os.Stdout = os.Stderr
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		if err := enc.Encode(serve(req)); err != nil {
+			return
+		}
+	}
+}
+`)
+	return buf.Bytes()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	r "reflect"
+	"strings"
+	"testing"
+)
+
+// TestRPCPackage tests calling a package compiled into an RPC server.
+func TestRPCPackage(t *testing.T) {
+	defer setTestGOPATH(t, map[string]map[string]string{"example.com/calc": {"calc.go": `package calc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const Pi = 3.14
+
+type Point struct{ X, Y int }
+
+func Sum(xs ...int) int {
+	fmt.Println("summing", xs)
+	n := 0
+	for _, x := range xs {
+		n += x
+	}
+	return n
+}
+
+func Fields(s string) (map[string]int, error) {
+	if s == "" {
+		return nil, errors.New("empty")
+	}
+	counts := make(map[string]int)
+	for _, f := range strings.Fields(s) {
+		counts[f]++
+	}
+	return counts, nil
+}
+
+func Crash() { panic("boom") }
+
+func Origin() Point { return Point{} }
+`}})()
+
+	pkg, err := loadRPCPackage(newInterp(), "example.com/calc")
+	if err != nil {
+		t.Fatalf("\t%s loadRPCPackage: %s", failure, err)
+	}
+	if _, ok := pkg.Binds["Origin"]; ok {
+		t.Errorf("\t%s A function returning a struct was bound", failure)
+	}
+	if pi := pkg.Binds["Pi"]; !pi.IsValid() || pi.Interface() != 3.14 {
+		t.Errorf("\t%s Expected the constant Pi but got %v", failure, pi)
+	}
+
+	sum := pkg.Binds["Sum"].Call([]r.Value{r.ValueOf(1), r.ValueOf(2), r.ValueOf(3)})
+	if sum[0].Interface() != 6 {
+		t.Errorf("\t%s Expected Sum(1, 2, 3) = 6 but got %v", failure, sum[0])
+	}
+
+	fields := pkg.Binds["Fields"]
+	res := fields.Call([]r.Value{r.ValueOf("a b a")})
+	if want := map[string]int{"a": 2, "b": 1}; !r.DeepEqual(res[0].Interface(), want) || !res[1].IsNil() {
+		t.Errorf("\t%s Expected %v, <nil> but got %v, %v", failure, want, res[0], res[1])
+	}
+	res = fields.Call([]r.Value{r.ValueOf("")})
+	if err, _ := res[1].Interface().(error); err == nil || err.Error() != "empty" {
+		t.Errorf("\t%s Expected the error \"empty\" but got %v", failure, res[1])
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p == nil || !strings.Contains(p.(error).Error(), "boom") {
+				t.Errorf("\t%s Expected a panic with \"boom\" but got %v", failure, p)
+			}
+		}()
+		pkg.Binds["Crash"].Call(nil)
+	}()
+}
+
+// TestRPCModulePackage tests compiling the RPC server of a package of the module cache, which is built in module
+// mode against the version of its module found in the cache, and stopping it.
+func TestRPCModulePackage(t *testing.T) {
+	defer setTestGOPATH(t, nil)()
+	files := map[string]string{
+		"pkg/mod/example.com/calc@v1.2.0/go.mod":                    "module example.com/calc\n",
+		"pkg/mod/example.com/calc@v1.2.0/calc.go":                   "package calc\n\nfunc Double(x int) int { return 2 * x }\n",
+		"pkg/mod/cache/download/example.com/calc/@v/v1.2.0.mod":     "module example.com/calc\n",
+		"pkg/mod/cache/download/example.com/calc/@v/v1.2.0.ziphash": "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n",
+		"notebook/go.mod": "module notebook\n\nrequire example.com/calc v1.2.0\n",
+	}
+	for name, data := range files {
+		file := filepath.Join(build.Default.GOPATH, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The notebook is a module using the cache only.
+	for name, value := range map[string]string{
+		"GO111MODULE": "on", "GOFLAGS": "-mod=mod", "GOPROXY": "off", "GOSUMDB": "off", "GOMODCACHE": "", "GOWORK": "off",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(filepath.Join(build.Default.GOPATH, "notebook"))
+
+	pkg, err := loadRPCPackage(newInterp(), "example.com/calc")
+	if err != nil {
+		t.Fatalf("\t%s loadRPCPackage: %s", failure, err)
+	}
+	double := pkg.Binds["Double"]
+	if res := double.Call([]r.Value{r.ValueOf(21)}); res[0].Interface() != 42 {
+		t.Errorf("\t%s Expected Double(21) = 42 but got %v", failure, res[0])
+	}
+
+	stopRPCServers()
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Errorf("\t%s Expected a call to a stopped RPC server to panic", failure)
+			}
+		}()
+		double.Call([]r.Value{r.ValueOf(1)})
+	}()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	r "reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// paramsFlag collects the repeated `--param name=value` flags of the run command.
+type paramsFlag []string
+
+func (p *paramsFlag) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *paramsFlag) Set(value string) error {
+	if i := strings.IndexByte(value, '='); i <= 0 {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// runCommand implements `gophernotes run [--param name=value]... notebook.ipynb`, which executes the code
+// cells of a notebook without a front-end and prints their output.
+func runCommand(args []string) error {
+	var params paramsFlag
+
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.Var(&params, "param", "set the notebook parameter `name=value` (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gophernotes run [--param name=value]... notebook.ipynb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("run: need exactly one notebook")
+	}
+
+	nb, err := readNotebook(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return runNotebook(newInterp(), nb, params, os.Stdout)
+}
+
+// runNotebook executes the code cells of nb in order, writing the result of each cell to out. Like papermill,
+// the parameters are bound as Go variables right after the cell tagged "parameters", or before the first cell
+// when there is none. Cells are run according to the execution flags in their tags.
+func runNotebook(ir *classic.Interp, nb ipynbNotebook, params []string, out io.Writer) error {
+	hasParamsCell := false
+	for _, cell := range nb.Cells {
+		hasParamsCell = hasParamsCell || cell.CellType == "code" && cell.hasTag("parameters")
+	}
+
+	if !hasParamsCell {
+		if err := injectParams(ir, params); err != nil {
+			return err
+		}
+	}
+
+	for i, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+
+		flags, err := parseCellFlags(cell.Metadata)
+		if err != nil {
+			return fmt.Errorf("cell %d: %v", i+1, err)
+		}
+		if flags.skip {
+			continue
+		}
+
+		vals, err := runNotebookCell(ir, string(cell.Source), flags)
+		if err != nil {
+			if !flags.raisesException {
+				return executionError{errorName(err), fmt.Errorf("cell %d: %s: %v", i+1, errorName(err), err)}
+			}
+			fmt.Fprintf(out, "cell %d raised the expected error: %v\n", i+1, err)
+		} else if vals != nil {
+			fmt.Fprintln(out, renderValues(vals)["text/plain"])
+		}
+
+		if cell.hasTag("parameters") {
+			if err := injectParams(ir, params); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// runNotebookCell evaluates a cell of a notebook run without a front-end, honoring its timeout.
+func runNotebookCell(ir *classic.Interp, code string, flags cellFlags) ([]interface{}, error) {
+	execution := hooks.startCell(nil, flags.timeout)
+	defer hooks.endCell()
+
+	vals, err := evalCell(ir, nil, code)
+	if execution.stopReason() == stopTimedOut {
+		return nil, executionError{enameTimeout, fmt.Errorf("Timeout: cell did not complete within %v", flags.timeout)}
+	}
+	return vals, err
+}
+
+// injectParams binds each `name=value` parameter as a Go variable. A variable already declared, e.g. by the
+// "parameters" cell, keeps its type and value is converted to it. Otherwise the variable is declared with
+// the type of the literal value: int, float64, bool or string.
+func injectParams(ir *classic.Interp, params []string) error {
+	for _, param := range params {
+		i := strings.IndexByte(param, '=')
+		name, value := param[:i], param[i+1:]
+
+		if v := ir.ValueOf(name); v.IsValid() && v.CanSet() {
+			if err := setParam(v, value); err != nil {
+				return fmt.Errorf("parameter %s: %v", name, err)
+			}
+			continue
+		}
+
+		var v interface{} = value
+		if n, err := strconv.Atoi(value); err == nil {
+			v = n
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			v = f
+		} else if b, err := strconv.ParseBool(value); err == nil {
+			v = b
+		}
+		ir.Env.DefineVar(name, r.TypeOf(v), r.ValueOf(v))
+	}
+	return nil
+}
+
+// setParam parses value according to the type of the variable v and stores it.
+func setParam(v r.Value, value string) error {
+	switch v.Kind() {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64:
+		if v.Type() == r.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64:
+		n, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case r.Float32, r.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case r.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case r.String:
+		v.SetString(value)
+	default:
+		return fmt.Errorf("cannot set a variable of type %v from the command line", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestRunNotebook tests that running a notebook without a front-end binds the parameters after the cell
+// tagged "parameters" and honors the execution flags of the cells.
+func TestRunNotebook(t *testing.T) {
+	nb := ipynbNotebook{Cells: []ipynbCell{
+		{CellType: "code", Source: "n := 1\nscale := 1.5", Metadata: map[string]interface{}{
+			"tags": []interface{}{"parameters"},
+		}},
+		{CellType: "markdown", Source: "# Not code"},
+		{CellType: "code", Source: "float64(n) * scale"},
+		{CellType: "code", Source: `panic("skipped")`, Metadata: map[string]interface{}{
+			"tags": []interface{}{"skip"},
+		}},
+		{CellType: "code", Source: "label + \"!\""},
+	}}
+
+	var out bytes.Buffer
+	params := []string{"n=4", "scale=0.5", "label=done"}
+	if err := runNotebook(newInterp(), nb, params, &out); err != nil {
+		t.Fatalf("\t%s runNotebook: %s", failure, err)
+	}
+
+	if got, want := strings.TrimSpace(out.String()), "2\ndone!"; got != want {
+		t.Fatalf("\t%s Expected output %q but got %q", failure, want, got)
+	}
+	t.Logf("\t%s Ran the notebook with the given parameters.", success)
+}
+
+// TestRunNotebookTimeout tests that a cell running past its timeout fails, even when busy in a loop.
+func TestRunNotebookTimeout(t *testing.T) {
+	nb := ipynbNotebook{Cells: []ipynbCell{
+		{CellType: "code", Source: "n := 0\nfor {\n\tn++\n}", Metadata: map[string]interface{}{
+			"tags": []interface{}{"timeout=100ms"},
+		}},
+	}}
+
+	var out bytes.Buffer
+	err := runNotebook(newInterp(), nb, nil, &out)
+	if err == nil || errorName(err) != enameTimeout {
+		t.Fatalf("\t%s Expected the busy cell to time out but got %v", failure, err)
+	}
+	t.Logf("\t%s Stopped the busy cell at its timeout.", success)
+}
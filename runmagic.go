@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+func init() {
+	lineMagics["run"] = runMagic
+}
+
+// running holds the paths of the notebooks being run by `%run`, innermost last, to resolve the relative paths
+// of nested runs and to stop notebooks running themselves.
+var running []string
+
+// runMagic implements `%run [-export] notebook.ipynb`: it runs the code cells of another notebook into the
+// session, so that the variables, functions and types they declare can be used by the next cells. With
+// -export, only the cells tagged "export" are run. Cells tagged "skip" are not run. A relative path is relative
+// to the notebook running `%run`, i.e. to the working directory of the kernel for the cells of the session.
+func runMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	exportOnly := false
+	if len(args) == 2 && args[0] == "-export" {
+		exportOnly, args = true, args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected [-export] notebook.ipynb, got %q", args)
+	}
+
+	path := args[0]
+	if !filepath.IsAbs(path) && len(running) > 0 {
+		path = filepath.Join(filepath.Dir(running[len(running)-1]), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range running {
+		if p == abs {
+			return fmt.Errorf("%s is already running", path)
+		}
+	}
+
+	nb, err := readNotebook(path)
+	if err != nil {
+		return err
+	}
+
+	running = append(running, abs)
+	defer func() {
+		running = running[:len(running)-1]
+	}()
+
+	for i, cell := range nb.Cells {
+		if cell.CellType != "code" || exportOnly && !cell.hasTag("export") {
+			continue
+		}
+		flags, err := parseCellFlags(cell.Metadata)
+		if err != nil {
+			return fmt.Errorf("%s: cell %d: %v", path, i+1, err)
+		}
+		if flags.skip {
+			continue
+		}
+		if _, err := evalCell(ir, receipt, string(cell.Source)); err != nil && !flags.raisesException {
+			return fmt.Errorf("%s: cell %d: %v", path, i+1, err)
+		}
+	}
+	return nil
+}
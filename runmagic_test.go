@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunMagic tests running the cells of other notebooks into the session with `%run`.
+func TestRunMagic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophernotes-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, cells ...ipynbCell) {
+		data, err := json.Marshal(ipynbNotebook{Cells: cells})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	export := map[string]interface{}{"tags": []interface{}{"export"}}
+	write("helpers.ipynb",
+		ipynbCell{CellType: "code", Source: "func double(n int) int { return 2 * n }", Metadata: export},
+		ipynbCell{CellType: "markdown", Source: "# Scratch"},
+		ipynbCell{CellType: "code", Source: "scratch := double(2)"},
+		ipynbCell{CellType: "code", Source: "%run other.ipynb", Metadata: export},
+	)
+	write("other.ipynb", ipynbCell{CellType: "code", Source: "const base = 10"})
+	write("loop.ipynb", ipynbCell{CellType: "code", Source: "%run loop.ipynb"})
+	write("broken.ipynb", ipynbCell{CellType: "code", Source: "x := undefined"})
+
+	ir := newInterp()
+	cases := []struct {
+		code, want, err string
+	}{
+		{"%run -export " + filepath.Join(dir, "helpers.ipynb") + "\ndouble(base)", "20", ""},
+		{"scratch", "", "undefined"},
+		{"%run " + filepath.Join(dir, "helpers.ipynb") + "\nscratch", "4", ""},
+		{"%run " + filepath.Join(dir, "loop.ipynb"), "", "loop.ipynb is already running"},
+		{"%run " + filepath.Join(dir, "broken.ipynb"), "", "broken.ipynb: cell 1: "},
+		{"%run", "", "expected [-export] notebook.ipynb"},
+	}
+	for _, c := range cases {
+		vals, err := evalCell(ir, nil, c.code)
+		switch {
+		case c.err != "":
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("\t%s Expected %q to fail with %q but got %v", failure, c.code, c.err, err)
+			}
+		case err != nil:
+			t.Errorf("\t%s Expected %q to succeed but got %v", failure, c.code, err)
+		case len(vals) != 1 || renderValues(vals)["text/plain"] != c.want:
+			t.Errorf("\t%s Expected %q to evaluate to %s but got %v", failure, c.code, c.want, vals)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// helperPackages maps the short names the helper packages of gophernotes are imported by in cells to their
+// import path.
+var helperPackages = map[string]string{
+	"assert":              "github.com/gopherdata/gophernotes/assert",
+	"display":             "github.com/gopherdata/gophernotes/display",
+	"display/arrow":       "github.com/gopherdata/gophernotes/display/arrow",
+	"notebook":            "github.com/gopherdata/gophernotes/notebook",
+	"notebook/grpcclient": "github.com/gopherdata/gophernotes/notebook/grpcclient",
+	"notebook/kube":       "github.com/gopherdata/gophernotes/notebook/kube",
+	"notebook/stream":     "github.com/gopherdata/gophernotes/notebook/stream",
+	"notebook/tables":     "github.com/gopherdata/gophernotes/notebook/tables",
+}
+
+// scaffoldMust is the generic version of the builtin must of the sessions, written in the modules of the
+// notebooks using it.
+const scaffoldMust = `package main
+
+// must returns v, or panics with err if it is not nil, like the builtin must of gophernotes.
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+`
+
+// scaffoldCommand implements `gophernotes scaffold [-module path] [-o dir] notebook.ipynb`, which turns a
+// notebook into a Go module.
+func scaffoldCommand(args []string) error {
+	flags := flag.NewFlagSet("scaffold", flag.ExitOnError)
+	module := flags.String("module", "", "the module `path` of go.mod (default: the name of the output directory)")
+	dir := flags.String("o", "", "the output `directory` (default: the name of the notebook without extension)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gophernotes scaffold [-module path] [-o dir] notebook.ipynb")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("scaffold: need exactly one notebook")
+	}
+	nb, err := readNotebook(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = strings.TrimSuffix(filepath.Base(flags.Arg(0)), filepath.Ext(flags.Arg(0)))
+	}
+	if *module == "" {
+		*module = filepath.Base(*dir)
+	}
+
+	files := scaffoldModule(newInterp(), nb, *module, filepath.Base(flags.Arg(0)))
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := filepath.Join(*dir, name)
+		if _, err := os.Stat(file); err == nil {
+			return fmt.Errorf("scaffold: %s already exists", file)
+		}
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(*dir, name), files[name], 0644); err != nil {
+			return err
+		}
+		fmt.Println(filepath.Join(*dir, name))
+	}
+	fmt.Printf("Run `go mod tidy` in %s to add the requirements of the imported modules.\n", *dir)
+	return nil
+}
+
+// scaffoldSection is the code of the cells below a markdown header of a notebook, turned into a file.
+type scaffoldSection struct {
+	title, name string
+	decls       []string
+	stmts       []string
+
+	// used holds the names the code of the section selects from, which may be imported packages.
+	used map[string]bool
+}
+
+// scaffoldTest is a `%%test` cell turned into a test function.
+type scaffoldTest struct {
+	name  string
+	code  string
+	decls []string
+}
+
+// scaffoldModule returns the files, by name, of the Go module turning the code cells of nb into a program,
+// parsed by ir. The code cells are grouped by the markdown headers preceding them, each group in a file of its
+// own, where the declarations of the cells, including the variables defined with :=, are moved to the top level
+// and their statements to a function that main calls. The `%%test` cells become tests.
+func scaffoldModule(ir *classic.Interp, nb ipynbNotebook, module, source string) map[string][]byte {
+	var sections []*scaffoldSection
+	var tests []scaffoldTest
+	imports := make(map[string]string)
+	testUsed := make(map[string]bool)
+	section := &scaffoldSection{name: "setup", used: make(map[string]bool)}
+	usesMust := false
+
+	newSection := func(title string) {
+		if len(section.decls) > 0 || len(section.stmts) > 0 {
+			sections = append(sections, section)
+		}
+		section = &scaffoldSection{title: title, name: identifierOf(title, false), used: make(map[string]bool)}
+	}
+
+	for i, cell := range nb.Cells {
+		code := string(cell.Source)
+		switch cell.CellType {
+		case "markdown":
+			if title := markdownTitle(code); title != "" {
+				newSection(title)
+			}
+			continue
+		case "code":
+		default:
+			continue
+		}
+
+		isTest := false
+		if strings.HasPrefix(code, "%%") {
+			fields := strings.Fields(strings.SplitN(code, "\n", 2)[0])
+			if len(fields) == 0 || fields[0] != "%%test" || !strings.Contains(code, "\n") {
+				continue
+			}
+			isTest = true
+			name := strings.Join(fields[1:], " ")
+			if name == "" {
+				name = fmt.Sprintf("cell %d", i+1)
+			}
+			tests = append(tests, scaffoldTest{name: "Test" + identifierOf(name, true)})
+			code = "\n" + strings.SplitN(code, "\n", 2)[1]
+		}
+
+		nodes, ok := parseCellNodes(ir, code)
+		if !ok {
+			continue
+		}
+		code = blankMagics(code)
+		ast.Inspect(&ast.BlockStmt{List: nodeStmts(nodes)}, func(n ast.Node) bool {
+			if call, ok := n.(*ast.CallExpr); ok {
+				if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == mustName {
+					usesMust = true
+				}
+			}
+			return true
+		})
+
+		for j, node := range nodes {
+			start, end := ir.Env.Fileset.Position(node.Pos()).Offset, ir.Env.Fileset.Position(node.End()).Offset
+			if start < 0 || end > len(code) || start >= end {
+				continue
+			}
+			text := code[start:end]
+			used := section.used
+			if isTest {
+				used = testUsed
+			}
+			markUsedPackages(node, used)
+
+			switch node := node.(type) {
+			case *ast.GenDecl:
+				if node.Tok == token.IMPORT {
+					addImports(node, imports)
+					continue
+				}
+				if isTest {
+					break
+				}
+				section.decls = append(section.decls, text)
+				continue
+			case *ast.FuncDecl:
+				if isTest {
+					tests[len(tests)-1].decls = append(tests[len(tests)-1].decls, text)
+				} else {
+					section.decls = append(section.decls, text)
+				}
+				continue
+			case *ast.AssignStmt:
+				if node.Tok == token.DEFINE && !isTest {
+					section.decls = append(section.decls, "var "+strings.Replace(text, ":=", "=", 1))
+					continue
+				}
+			case *ast.CallExpr:
+			case ast.Expr:
+				// The value of the last expression of a cell is displayed by the notebook only.
+				if j == len(nodes)-1 && !isTest {
+					text = "fmt.Println(" + text + ")"
+					used["fmt"] = true
+					imports["fmt"] = "fmt"
+				} else {
+					text = "_ = " + text
+				}
+			}
+			if isTest {
+				tests[len(tests)-1].code += text + "\n"
+			} else {
+				section.stmts = append(section.stmts, text)
+			}
+		}
+	}
+	newSection("")
+
+	files := make(map[string][]byte)
+	files["go.mod"] = []byte(fmt.Sprintf("module %s\n\ngo 1.18\n", module))
+
+	var main bytes.Buffer
+	fmt.Fprintf(&main, "// Command %s was generated by gophernotes scaffold from %s.\npackage main\n\nfunc main() {\n", path.Base(module), source)
+	seen := make(map[string]int)
+	for _, s := range sections {
+		// Sections with the same title get files and functions of their own.
+		if seen[s.name]++; seen[s.name] > 1 {
+			s.name += strconv.Itoa(seen[s.name])
+		}
+		file := fileNameOf(s.name)
+		if file == "main" || strings.HasSuffix(file, "_test") {
+			file += "_cells"
+		}
+		files[file+".go"] = s.source(imports)
+		if len(s.stmts) > 0 {
+			fmt.Fprintf(&main, "\t%s()\n", s.name)
+		}
+	}
+	main.WriteString("}\n")
+	files["main.go"] = formatSource(main.Bytes())
+
+	if usesMust {
+		files["must.go"] = []byte(scaffoldMust)
+	}
+	if len(tests) > 0 {
+		var src bytes.Buffer
+		imports["testing"] = "testing"
+		testUsed["testing"] = true
+		src.WriteString("package main\n\n")
+		writeImports(&src, imports, testUsed)
+		for _, test := range tests {
+			for _, decl := range test.decls {
+				fmt.Fprintf(&src, "\n%s\n", decl)
+			}
+			fmt.Fprintf(&src, "\nfunc %s(t *testing.T) {\n%s}\n", test.name, test.code)
+		}
+		files["main_test.go"] = formatSource(src.Bytes())
+	}
+	return files
+}
+
+// source returns the Go file of the section, importing those of imports, the packages imported by the cells of
+// the notebook by name, that it uses.
+func (s *scaffoldSection) source(imports map[string]string) []byte {
+	var src bytes.Buffer
+	src.WriteString("package main\n\n")
+	writeImports(&src, imports, s.used)
+	for _, decl := range s.decls {
+		fmt.Fprintf(&src, "\n%s\n", decl)
+	}
+	if len(s.stmts) > 0 {
+		if s.title != "" {
+			fmt.Fprintf(&src, "\n// %s runs the cells of the section %q.\n", s.name, s.title)
+		} else {
+			fmt.Fprintf(&src, "\n// %s runs the cells before the first section.\n", s.name)
+		}
+		fmt.Fprintf(&src, "func %s() {\n%s\n}\n", s.name, strings.Join(s.stmts, "\n"))
+	}
+	return formatSource(src.Bytes())
+}
+
+// nodeStmts returns the statements of nodes, with the expressions and declarations as statements, for
+// inspection.
+func nodeStmts(nodes []ast.Node) []ast.Stmt {
+	var stmts []ast.Stmt
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case ast.Stmt:
+			stmts = append(stmts, node)
+		case ast.Expr:
+			stmts = append(stmts, &ast.ExprStmt{X: node})
+		case *ast.GenDecl:
+			stmts = append(stmts, &ast.DeclStmt{Decl: node})
+		case *ast.FuncDecl:
+			stmts = append(stmts, &ast.ExprStmt{X: &ast.FuncLit{Type: node.Type, Body: node.Body}})
+		}
+	}
+	return stmts
+}
+
+// addImports adds the packages imported by decl to imports, by the name they are imported as, with the full
+// import path of the helper packages of gophernotes.
+func addImports(decl *ast.GenDecl, imports map[string]string) {
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ImportSpec)
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		if full, ok := helperPackages[importPath]; ok {
+			importPath = full
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = importPath
+	}
+}
+
+// markUsedPackages records the names of node selected from, which may be imported packages.
+func markUsedPackages(node ast.Node, used map[string]bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+// writeImports writes the import declaration of the packages of imports whose name is used.
+func writeImports(src *bytes.Buffer, imports map[string]string, used map[string]bool) {
+	var names []string
+	for name := range imports {
+		if used[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	src.WriteString("import (\n")
+	for _, name := range names {
+		if path.Base(imports[name]) == name {
+			fmt.Fprintf(src, "\t%q\n", imports[name])
+		} else {
+			fmt.Fprintf(src, "\t%s %q\n", name, imports[name])
+		}
+	}
+	src.WriteString(")\n")
+}
+
+// formatSource returns src formatted by gofmt, or as is if it does not parse.
+func formatSource(src []byte) []byte {
+	if formatted, err := format.Source(src); err == nil {
+		return formatted
+	}
+	return src
+}
+
+// markdownTitle returns the text of the first header of a markdown cell, or "".
+func markdownTitle(markdown string) string {
+	for _, line := range strings.Split(markdown, "\n") {
+		if strings.HasPrefix(line, "#") {
+			return strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+	}
+	return ""
+}
+
+// identifierOf returns the Go identifier in camel case made of the letters and digits of title, exported if
+// exported is set, e.g. loadingTheData for "Loading the data".
+func identifierOf(title string, exported bool) string {
+	words := strings.FieldsFunc(title, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	var b strings.Builder
+	for i, word := range words {
+		runes := []rune(strings.ToLower(word))
+		if i > 0 || exported {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		b.WriteString(string(runes))
+	}
+	id := b.String()
+	switch {
+	case id == "":
+		id = "section"
+	case unicode.IsDigit([]rune(id)[0]):
+		id = "section" + id
+	case token.Lookup(id).IsKeyword() || id == "main" || id == "init":
+		id += "Cells"
+	}
+	if exported {
+		id = strings.ToUpper(id[:1]) + id[1:]
+	}
+	return id
+}
+
+// fileNameOf returns the name in snake case of the file of the section whose function is name.
+func fileNameOf(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		if unicode.IsUpper(c) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
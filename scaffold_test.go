@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestScaffold tests turning a notebook into a Go module, which builds and passes its tests.
+func TestScaffold(t *testing.T) {
+	nb := ipynbNotebook{Cells: []ipynbCell{
+		{CellType: "code", Source: "import (\n\t\"fmt\"\n\t\"strconv\"\n)\nbase := 10"},
+		{CellType: "markdown", Source: "Some text.\n## Parsing the input\nMore text."},
+		{CellType: "code", Source: "%vet on\nfunc parse(s string) int {\n\treturn must(strconv.Atoi(s)) * base\n}\nn := parse(\"4\")\nn"},
+		{CellType: "code", Source: "%%sql\nSELECT 1"},
+		{CellType: "markdown", Source: "# Printing"},
+		{CellType: "code", Source: "fmt.Println(n)\nn + 1"},
+		{CellType: "code", Source: "%%test parse numbers\nimport \"assert\"\nassert.Equal(20, parse(\"2\"))"},
+	}}
+
+	files := scaffoldModule(newInterp(), nb, "example.com/parsing", "parsing.ipynb")
+	for name, want := range map[string][]string{
+		"go.mod":      {"module example.com/parsing\n"},
+		"setup.go":    {"package main\n\nvar base = 10\n"},
+		"main.go":     {"// Command parsing was generated by gophernotes scaffold from parsing.ipynb.", "\tparsingTheInput()\n\tprinting()\n"},
+		"must.go":     {"func must[T any](v T, err error) T {"},
+		"printing.go": {"\"fmt\"", "// printing runs the cells of the section \"Printing\".", "fmt.Println(n + 1)"},
+		"parsing_the_input.go": {
+			"\"strconv\"", "func parse(s string) int {", "var n = parse(\"4\")", "func parsingTheInput() {\n\tfmt.Println(n)\n}",
+		},
+		"main_test.go": {"\"github.com/gopherdata/gophernotes/assert\"", "func TestParseNumbers(t *testing.T) {\n\tassert.Equal(20, parse(\"2\"))\n}"},
+	} {
+		src, ok := files[name]
+		if !ok {
+			t.Errorf("\t%s Expected a file %s among %v", failure, name, files)
+			continue
+		}
+		for _, w := range want {
+			if !strings.Contains(string(src), w) {
+				t.Errorf("\t%s Expected %s to contain %q:\n%s", failure, name, w, src)
+			}
+		}
+	}
+	// The module builds, once the test importing assert is left out.
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gophernotes-scaffold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range files {
+		if name != "main_test.go" {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), src, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if err != nil || string(out) != "40\n40\n41\n" {
+		t.Errorf("\t%s Expected the module to print 40, 40 and 41 but got %v:\n%s", failure, err, out)
+	}
+}
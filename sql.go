@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go/token"
+	"html"
+	"log"
+	r "reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// sqlMaxRows is the number of rows of a query result displayed by `%%sql`. Further rows are only counted.
+const sqlMaxRows = 100
+
+func init() {
+	lineMagics["sql_connect"] = sqlConnectMagic
+	cellMagics["sql"] = sqlMagic
+}
+
+// sqlConnection is a database connected with `%sql_connect`.
+type sqlConnection struct {
+	name, driver string
+	db           *sql.DB
+}
+
+// sqlConnections is the registry of the databases connected during the session.
+var sqlConnections = struct {
+	sync.Mutex
+
+	byName map[string]*sqlConnection
+
+	// last is the name of the most recent connection, used by `%%sql` cells naming none.
+	last string
+}{byName: make(map[string]*sqlConnection)}
+
+// sqlConnectMagic implements `%sql_connect name dsn driver`, which opens a database with the given driver,
+// checks that it can be reached and defines a *sql.DB variable with the given name. The DSN may contain spaces.
+// Without arguments, it shows the health of the databases already connected.
+func sqlConnectMagic(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+	if len(args) == 0 {
+		sqlConnections.Lock()
+		conns := make([]*sqlConnection, 0, len(sqlConnections.byName))
+		for _, conn := range sqlConnections.byName {
+			conns = append(conns, conn)
+		}
+		sqlConnections.Unlock()
+
+		if len(conns) == 0 {
+			return errors.New("no database connected, expected a name, a DSN and a driver")
+		}
+		sort.Slice(conns, func(i, j int) bool { return conns[i].name < conns[j].name })
+		return publishSQLHealth(receipt, conns)
+	}
+
+	if len(args) < 3 || !token.IsIdentifier(args[0]) {
+		return fmt.Errorf("expected a name, a DSN and a driver, got %q", strings.Join(args, " "))
+	}
+	name, dsn, driver := args[0], strings.Join(args[1:len(args)-1], " "), args[len(args)-1]
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	if err := db.PingContext(hooks.Context()); err != nil {
+		db.Close()
+		return fmt.Errorf("cannot reach the %s database: %v", driver, err)
+	}
+
+	conn := &sqlConnection{name: name, driver: driver, db: db}
+	sqlConnections.Lock()
+	if old := sqlConnections.byName[name]; old != nil {
+		old.db.Close()
+	}
+	sqlConnections.byName[name] = conn
+	sqlConnections.last = name
+	sqlConnections.Unlock()
+
+	ir.Env.DefineVar(name, r.TypeOf(db), r.ValueOf(db))
+	return publishSQLHealth(receipt, []*sqlConnection{conn})
+}
+
+// publishSQLHealth pings each connection and displays whether it is reachable, the round trip time and the
+// number of connections open in its pool.
+func publishSQLHealth(receipt *msgReceipt, conns []*sqlConnection) error {
+	if receipt == nil {
+		return nil
+	}
+
+	var text, htm bytes.Buffer
+	w := tabwriter.NewWriter(&text, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tDriver\tStatus\tOpen connections")
+	htm.WriteString("<table><thead><tr><th>Name</th><th>Driver</th><th>Status</th><th>Open connections</th></tr></thead><tbody>")
+	for _, conn := range conns {
+		start := time.Now()
+		status := "error: "
+		if err := conn.db.PingContext(hooks.Context()); err != nil {
+			status += err.Error()
+		} else {
+			status = fmt.Sprintf("ok (ping %v)", time.Since(start).Round(time.Microsecond))
+		}
+		open := conn.db.Stats().OpenConnections
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", conn.name, conn.driver, status, open)
+		fmt.Fprintf(&htm, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td></tr>",
+			html.EscapeString(conn.name), html.EscapeString(conn.driver), html.EscapeString(status), open)
+	}
+	w.Flush()
+	htm.WriteString("</tbody></table>")
+
+	return receipt.PublishDisplayData(bundledMIMEData{
+		"text/plain": text.String(),
+		"text/html":  htm.String(),
+	}, nil, "")
+}
+
+// sqlMagic implements `%%sql [name]`, which runs the body of the cell as a query on the database connected
+// under the given name, or on the most recently connected one, and displays the rows it returns as a table.
+func sqlMagic(ir *classic.Interp, receipt *msgReceipt, args []string, body string) ([]interface{}, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected the name of a connection, got %q", strings.Join(args, " "))
+	}
+
+	sqlConnections.Lock()
+	name := sqlConnections.last
+	if len(args) == 1 {
+		name = args[0]
+	}
+	conn := sqlConnections.byName[name]
+	sqlConnections.Unlock()
+
+	if conn == nil {
+		if name == "" {
+			return nil, errors.New("no database connected, use %sql_connect first")
+		}
+		return nil, fmt.Errorf("no database connected as %s", name)
+	}
+
+	rows, err := conn.db.QueryContext(hooks.Context(), strings.TrimSpace(body))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	dropped := 0
+	for rows.Next() {
+		if len(records) >= sqlMaxRows {
+			dropped++
+			continue
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		record := make([]string, len(values))
+		for i, v := range values {
+			switch v := v.(type) {
+			case nil:
+				record[i] = "NULL"
+			case []byte:
+				record[i] = string(v)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if receipt != nil {
+		err := receipt.PublishDisplayData(bundledMIMEData{
+			"text/plain": sqlResultText(columns, records, dropped),
+			"text/html":  sqlResultHTML(columns, records, dropped),
+		}, nil, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// sqlResultText formats the rows returned by a query as a text table.
+func sqlResultText(columns []string, records [][]string, dropped int) string {
+	if len(columns) == 0 {
+		return "Statement executed.\n"
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+	for _, record := range records {
+		fmt.Fprintln(w, strings.Join(record, "\t"))
+	}
+	w.Flush()
+	if dropped > 0 {
+		fmt.Fprintf(&buf, "... %d more rows not shown\n", dropped)
+	}
+	return buf.String()
+}
+
+// sqlResultHTML formats the rows returned by a query as an HTML table.
+func sqlResultHTML(columns []string, records [][]string, dropped int) string {
+	if len(columns) == 0 {
+		return "<p>Statement executed.</p>"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<table><thead><tr>")
+	for _, column := range columns {
+		fmt.Fprintf(&buf, "<th>%s</th>", html.EscapeString(column))
+	}
+	buf.WriteString("</tr></thead><tbody>")
+	for _, record := range records {
+		buf.WriteString("<tr>")
+		for _, value := range record {
+			fmt.Fprintf(&buf, "<td>%s</td>", html.EscapeString(value))
+		}
+		buf.WriteString("</tr>")
+	}
+	buf.WriteString("</tbody></table>")
+	if dropped > 0 {
+		fmt.Fprintf(&buf, "<p>... %d more rows not shown</p>", dropped)
+	}
+	return buf.String()
+}
+
+// closeSQLConnections closes the databases connected during the session. It is called on shutdown.
+func closeSQLConnections() {
+	sqlConnections.Lock()
+	defer sqlConnections.Unlock()
+
+	for name, conn := range sqlConnections.byName {
+		if err := conn.db.Close(); err != nil {
+			log.Printf("Error closing the %s database: %v\n", name, err)
+		}
+		delete(sqlConnections.byName, name)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profileStartup is set by the --profile-startup flag: the kernel then reports where its startup time goes.
+var profileStartup = flag.Bool("profile-startup", false, "report the time spent in each phase of the startup of the kernel")
+
+// startupBegin is the time the package is initialized, once the packages it depends on, like the bindings of
+// the standard library, are. GODEBUG=inittrace=1 reports the time spent initializing these.
+var startupBegin = time.Now()
+
+// startupPhase is a phase of the startup of the kernel and its duration.
+type startupPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// startupProfile records the phases of the startup of the kernel, each ending when the next one starts. The
+// methods of a nil profile do nothing, so that startup only measures itself with --profile-startup.
+type startupProfile struct {
+	mu     sync.Mutex
+	begin  time.Time
+	last   time.Time
+	phases []startupPhase
+}
+
+// newStartupProfile returns a profile whose first phase started at begin, or nil unless enabled is set.
+func newStartupProfile(enabled bool, begin time.Time) *startupProfile {
+	if !enabled {
+		return nil
+	}
+	return &startupProfile{begin: begin, last: begin}
+}
+
+// mark ends the current phase, named name, and starts the next one.
+func (p *startupProfile) mark(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.phases = append(p.phases, startupPhase{name, now.Sub(p.last)})
+	p.last = now
+}
+
+// measure records the duration of a phase running concurrently with the others, like building the interpreter.
+func (p *startupProfile) measure(name string, begin time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phases = append(p.phases, startupPhase{name, time.Since(begin)})
+}
+
+// report writes the phases recorded so far and the time elapsed since the profile began, under title.
+func (p *startupProfile) report(w io.Writer, title string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	fmt.Fprintf(&b, "startup: %s after %v\n", title, time.Since(p.begin).Round(time.Microsecond))
+	for _, phase := range p.phases {
+		fmt.Fprintf(&b, "  %10v  %s\n", phase.duration.Round(time.Microsecond), phase.name)
+	}
+	io.WriteString(w, b.String())
+}
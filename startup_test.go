@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStartupProfile tests reporting the phases of the startup of the kernel.
+func TestStartupProfile(t *testing.T) {
+	var off *startupProfile
+	off.mark("ignored")
+	off.report(&bytes.Buffer{}, "ignored")
+	if p := newStartupProfile(false, time.Now()); p != nil {
+		t.Errorf("\t%s Expected no profile without --profile-startup", failure)
+	}
+
+	p := newStartupProfile(true, time.Now().Add(-time.Millisecond))
+	p.mark("package initialization")
+	p.measure("interpreter (in the background)", time.Now())
+	p.mark("sockets")
+
+	var out bytes.Buffer
+	p.report(&out, "kernel reachable")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "startup: kernel reachable after ") ||
+		!strings.HasSuffix(lines[1], "  package initialization") || !strings.HasSuffix(lines[3], "  sockets") {
+		t.Errorf("\t%s Unexpected report:\n%s", failure, out.String())
+	}
+}
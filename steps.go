@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	r "reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stepTimeout is how long a step may run before the scheduler lets the next goroutine run: the goroutines
+// blocked elsewhere than in the channel operations of the interpreted code, e.g. in time.Sleep or
+// sync.WaitGroup.Wait, do not come back to the scheduler.
+const stepTimeout = 100 * time.Millisecond
+
+// stepScheduler runs the goroutines of the interpreted code one at a time when `%chans step` is set, handing
+// over to the next goroutine, in the order they started, at each of their channel operations. The interleavings
+// of the goroutines of a cell are then the same from one run to the next, e.g. to teach concurrency. It relies
+// on the hooks inserted by instrumentChanOps: a goroutine waits for its turn before and after each operation.
+type stepScheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	on   bool
+
+	// goroutines are the goroutines stepped, in the order they started, and byID indexes them by goroutine id.
+	goroutines []*stepper
+	byID       map[int64]*stepper
+
+	// next is the index in goroutines of the first one considered for the next step, running counts the
+	// goroutines of the current step that did not come back yet, and step numbers the steps.
+	next    int
+	running int
+	step    int64
+}
+
+// stepper is a goroutine run by the scheduler.
+type stepper struct {
+	id  int64
+	ctx context.Context
+
+	// waits holds the channel operations the goroutine waits to start, nil when it waits to run its other code.
+	waits *chanWaits
+
+	// parked is set while the goroutine waits for its turn, and turn once it is given. step is the step it
+	// was given.
+	parked bool
+	turn   bool
+	step   int64
+}
+
+var steps = newStepScheduler()
+
+func newStepScheduler() *stepScheduler {
+	s := &stepScheduler{byID: make(map[int64]*stepper)}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// start turns stepping on, for the goroutines started from then on.
+func (s *stepScheduler) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.on = true
+}
+
+// stop turns stepping off, letting all the goroutines stepped run freely.
+func (s *stepScheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.on = false
+	s.goroutines, s.byID = nil, make(map[int64]*stepper)
+	s.next, s.running = 0, 0
+	s.cond.Broadcast()
+}
+
+// spawn adds a goroutine to step, running code of the cell of execution unless it is nil, which then calls
+// enter. It returns nil when stepping is off.
+func (s *stepScheduler) spawn(execution *cellExecution) *stepper {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.on {
+		return nil
+	}
+	g := &stepper{parked: true}
+	s.goroutines = append(s.goroutines, g)
+	if execution != nil {
+		g.ctx = execution.ctx
+		context.AfterFunc(g.ctx, func() {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		})
+	}
+	if s.running == 0 {
+		s.schedule()
+	}
+	return g
+}
+
+// enter makes g the calling goroutine, and waits for its first turn.
+func (s *stepScheduler) enter(g *stepper) {
+	if g == nil {
+		return
+	}
+	id := goroutineID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g.id = id
+	s.byID[id] = g
+	s.await(g)
+}
+
+// exit removes g, whose goroutine ends, from the goroutines stepped.
+func (s *stepScheduler) exit(g *stepper) {
+	if g == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(g)
+}
+
+// wait, rewait and done are the hooks of the channel operations inserted by instrumentChanOps: they record the
+// operations with chanTracker and, when stepping, the calling goroutine hands over to the next one before and
+// after each of them.
+func (s *stepScheduler) wait(ops ...interface{}) *chanWaits {
+	w := chans.wait(ops...)
+	if w != nil {
+		s.yield(w.goroutine, w)
+	}
+	return w
+}
+
+func (s *stepScheduler) rewait(w *chanWaits) {
+	chans.rewait(w)
+	if w != nil {
+		s.yield(w.goroutine, w)
+	}
+}
+
+func (s *stepScheduler) done(w *chanWaits) {
+	chans.done(w)
+	if w != nil {
+		s.yield(w.goroutine, nil)
+	}
+}
+
+// yield ends the turn of the goroutine of the given id, if stepped, and waits for the next one, when the
+// operations of w can proceed unless it is nil.
+func (s *stepScheduler) yield(id int64, w *chanWaits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.byID[id]
+	if !s.on || g == nil {
+		return
+	}
+	g.waits = w
+	g.parked = true
+	if g.turn {
+		g.turn = false
+		if g.step == s.step {
+			s.running--
+		}
+	}
+	if s.running == 0 {
+		s.schedule()
+	}
+	s.await(g)
+}
+
+// await waits for the turn of g, with s.mu held. A goroutine whose cell is interrupted or times out stops
+// being stepped.
+func (s *stepScheduler) await(g *stepper) {
+	for s.on && !g.turn && (g.ctx == nil || g.ctx.Err() == nil) {
+		s.cond.Wait()
+	}
+	if s.on && !g.turn {
+		s.remove(g)
+	}
+}
+
+// remove removes g from the goroutines stepped, with s.mu held, and starts the next step if g ran the last one.
+func (s *stepScheduler) remove(g *stepper) {
+	for i, other := range s.goroutines {
+		if other != g {
+			continue
+		}
+		s.goroutines = append(s.goroutines[:i], s.goroutines[i+1:]...)
+		if i < s.next {
+			s.next--
+		}
+		delete(s.byID, g.id)
+		if g.turn && g.step == s.step {
+			s.running--
+		}
+		g.turn, g.parked = false, false
+		if s.running == 0 {
+			s.schedule()
+		}
+		return
+	}
+}
+
+// schedule starts the next step, with s.mu held: it gives the turn to the first goroutine, from next on, that
+// waits to run code or whose channel operation can proceed, along with the goroutine it exchanges a value with
+// on an unbuffered channel. When no operation can proceed, e.g. on closed channels, the first goroutine waiting
+// gets the turn.
+func (s *stepScheduler) schedule() {
+	if !s.on || len(s.goroutines) == 0 {
+		return
+	}
+	n := len(s.goroutines)
+	first, partner := -1, (*stepper)(nil)
+	for i := 0; i < n; i++ {
+		j := (s.next + i) % n
+		g := s.goroutines[j]
+		if !g.parked {
+			continue
+		}
+		if ready, p := s.ready(j); ready {
+			first, partner = j, p
+			break
+		}
+		if first < 0 {
+			first = j
+		}
+	}
+	if first < 0 {
+		return
+	}
+
+	s.step++
+	s.running = 0
+	for _, g := range []*stepper{s.goroutines[first], partner} {
+		if g != nil {
+			g.parked, g.turn, g.step = false, true, s.step
+			s.running++
+		}
+	}
+	s.next = (first + 1) % n
+	s.cond.Broadcast()
+
+	step := s.step
+	time.AfterFunc(stepTimeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.step == step && s.running > 0 {
+			s.running = 0
+			s.schedule()
+		}
+	})
+}
+
+// ready reports whether the goroutine of index i can run without blocking in its channel operations, and
+// returns the goroutine it exchanges a value with, if any.
+func (s *stepScheduler) ready(i int) (bool, *stepper) {
+	g := s.goroutines[i]
+	if g.waits == nil {
+		return true, nil
+	}
+	for _, op := range g.waits.ops {
+		if !op.ch.IsValid() || op.ch.IsNil() {
+			continue
+		}
+		send := strings.HasSuffix(op.op, "send")
+		if send && op.ch.Len() < op.ch.Cap() || !send && op.ch.Len() > 0 {
+			return true, nil
+		}
+		n := len(s.goroutines)
+		for k := 1; k < n; k++ {
+			other := s.goroutines[(i+k)%n]
+			if other.parked && other.waits != nil && waitsOn(other.waits, op.ch, !send) {
+				return true, other
+			}
+		}
+	}
+	return false, nil
+}
+
+// waitsOn reports whether w has an operation on ch, a send if send is set, a receive otherwise.
+func waitsOn(w *chanWaits, ch r.Value, send bool) bool {
+	for _, op := range w.ops {
+		if op.ch.IsValid() && !op.ch.IsNil() && op.ch.Pointer() == ch.Pointer() && strings.HasSuffix(op.op, "send") == send {
+			return true
+		}
+	}
+	return false
+}
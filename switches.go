@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	r "reflect"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+// stmtContext tells where a statement is, for the checks of fallthrough.
+type stmtContext uint
+
+const (
+	// fallthroughOk is set for the last statement of the clauses of expression switches but the last one.
+	fallthroughOk stmtContext = 1 << iota
+	// finalSwitchCase is set for the statements of the last clause of an expression switch.
+	finalSwitchCase
+	// inTypeSwitch is set for the statements of the clauses of a type switch.
+	inTypeSwitch
+)
+
+// switchChecker looks for the errors of the switch statements of a cell that the interpreter does not report.
+type switchChecker struct {
+	ir       *classic.Interp
+	folder   constantFolder
+	declared map[string]bool
+	err      error
+}
+
+// checkSwitches returns the first error gc would report for the switch statements of nodes, and that the
+// interpreter does not: fallthrough statements out of place, in the last clause of a switch or in a type switch,
+// and duplicate constants or types among the cases. The errors mirror those of gc.
+func checkSwitches(ir *classic.Interp, nodes []ast.Node) error {
+	c := switchChecker{ir: ir, declared: declaredNames(nodes)}
+	c.folder = constantFolder{
+		consts:     &sessionConsts{ir: ir, values: make(map[string]constant.Value)},
+		shadowed:   shadowedConsts(nodes),
+		cellConsts: make(map[string]bool),
+	}
+	if untypedConsts.ir == ir {
+		for name, val := range untypedConsts.values {
+			c.folder.consts.values[name] = val
+		}
+	}
+
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *ast.GenDecl:
+			if node.Tok == token.CONST {
+				c.constDecl(node)
+			}
+			c.funcLits(node)
+		case *ast.FuncDecl:
+			if node.Body != nil {
+				c.stmts(node.Body.List, 0)
+			}
+		case ast.Stmt:
+			c.stmt(node, 0)
+		default:
+			c.funcLits(node)
+		}
+		if c.err != nil {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// constDecl records the values of the untyped constants declared by decl without iota, so that the cases of
+// the cell can use them.
+func (c *switchChecker) constDecl(decl *ast.GenDecl) {
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		if spec.Type != nil || len(spec.Values) != len(spec.Names) {
+			continue
+		}
+		for i, name := range spec.Names {
+			if val, typ := c.folder.value(spec.Values[i]); val != nil && typ == "" && !usesIota(spec.Values[i]) {
+				c.folder.consts.values[name.Name] = val
+				c.folder.cellConsts[name.Name] = true
+			}
+		}
+	}
+}
+
+// errorf records the error at pos, unless there is one already.
+func (c *switchChecker) errorf(pos token.Pos, format string, args ...interface{}) {
+	if c.err == nil {
+		c.err = fmt.Errorf("%s: %s", c.ir.Env.Fileset.Position(pos), fmt.Sprintf(format, args...))
+	}
+}
+
+// stmts checks the statements of a block, the last of which may be a fallthrough if ctxt allows it.
+func (c *switchChecker) stmts(list []ast.Stmt, ctxt stmtContext) {
+	ok := ctxt&fallthroughOk != 0
+	inner := ctxt &^ fallthroughOk
+
+	// The empty statements at the end of a block do not count.
+	for len(list) > 0 {
+		if _, empty := list[len(list)-1].(*ast.EmptyStmt); !empty {
+			break
+		}
+		list = list[:len(list)-1]
+	}
+	for i, stmt := range list {
+		ctxt := inner
+		if ok && i+1 == len(list) {
+			ctxt |= fallthroughOk
+		}
+		c.stmt(stmt, ctxt)
+	}
+}
+
+// stmt checks stmt, in the context ctxt.
+func (c *switchChecker) stmt(stmt ast.Stmt, ctxt stmtContext) {
+	inner := ctxt &^ (fallthroughOk | finalSwitchCase | inTypeSwitch)
+	switch stmt := stmt.(type) {
+	case nil:
+	case *ast.BranchStmt:
+		if stmt.Tok == token.FALLTHROUGH && ctxt&fallthroughOk == 0 {
+			switch {
+			case ctxt&finalSwitchCase != 0:
+				c.errorf(stmt.Pos(), "cannot fallthrough final case in switch")
+			case ctxt&inTypeSwitch != 0:
+				c.errorf(stmt.Pos(), "cannot fallthrough in type switch")
+			default:
+				c.errorf(stmt.Pos(), "fallthrough statement out of place")
+			}
+		}
+	case *ast.LabeledStmt:
+		c.stmt(stmt.Stmt, ctxt)
+	case *ast.BlockStmt:
+		c.stmts(stmt.List, inner)
+	case *ast.IfStmt:
+		c.stmt(stmt.Init, inner)
+		c.funcLits(stmt.Cond)
+		c.stmts(stmt.Body.List, inner)
+		c.stmt(stmt.Else, inner)
+	case *ast.ForStmt:
+		c.stmt(stmt.Init, inner)
+		c.funcLits(stmt.Cond)
+		c.stmt(stmt.Post, inner)
+		c.stmts(stmt.Body.List, inner)
+	case *ast.RangeStmt:
+		c.funcLits(stmt.X)
+		c.stmts(stmt.Body.List, inner)
+	case *ast.SelectStmt:
+		for _, clause := range stmt.Body.List {
+			clause := clause.(*ast.CommClause)
+			c.stmt(clause.Comm, inner)
+			c.stmts(clause.Body, inner)
+		}
+	case *ast.SwitchStmt:
+		c.stmt(stmt.Init, inner)
+		c.funcLits(stmt.Tag)
+		c.duplicateValues(stmt)
+		for i, clause := range stmt.Body.List {
+			clause := clause.(*ast.CaseClause)
+			for _, expr := range clause.List {
+				c.funcLits(expr)
+			}
+			ctxt := inner
+			if i+1 < len(stmt.Body.List) {
+				ctxt |= fallthroughOk
+			} else {
+				ctxt |= finalSwitchCase
+			}
+			c.stmts(clause.Body, ctxt)
+		}
+	case *ast.TypeSwitchStmt:
+		c.stmt(stmt.Init, inner)
+		c.stmt(stmt.Assign, inner)
+		c.duplicateTypes(stmt)
+		for _, clause := range stmt.Body.List {
+			c.stmts(clause.(*ast.CaseClause).Body, inner|inTypeSwitch)
+		}
+	default:
+		c.funcLits(stmt)
+	}
+}
+
+// funcLits checks the bodies of the function literals of node, whose statements are in no switch.
+func (c *switchChecker) funcLits(node ast.Node) {
+	if node == nil || r.ValueOf(node).IsNil() {
+		return
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok {
+			c.stmts(lit.Body.List, 0)
+			return false
+		}
+		return true
+	})
+}
+
+// caseValue is a constant of the cases of an expression switch.
+type caseValue struct {
+	expr ast.Expr
+	val  constant.Value
+	typ  string
+}
+
+// duplicateValues reports the first constant of the cases of stmt equal to a previous one.
+func (c *switchChecker) duplicateValues(stmt *ast.SwitchStmt) {
+	if stmt.Tag == nil {
+		// The cases are booleans, which gc does not check.
+		return
+	}
+	tag := c.tagType(stmt)
+	seen := make(map[string]caseValue)
+	for _, clause := range stmt.Body.List {
+		for _, expr := range clause.(*ast.CaseClause).List {
+			v, ok := c.caseValue(expr, tag)
+			if !ok {
+				continue
+			}
+			key := v.typ + " " + v.val.ExactString()
+			if prev, dup := seen[key]; dup {
+				operand := types.ExprString(expr) + " (constant"
+				if s := v.val.String(); s != types.ExprString(expr) {
+					operand += " " + s
+				}
+				operand += " of type " + v.typ + ")"
+				c.errorf(expr.Pos(), "duplicate case %s in expression switch\n\t%s: previous case", operand, c.ir.Env.Fileset.Position(prev.expr.Pos()))
+				return
+			}
+			seen[key] = v
+		}
+	}
+}
+
+// tagType returns the type of the tag of stmt if it is known before running the cell, or nil.
+func (c *switchChecker) tagType(stmt *ast.SwitchStmt) r.Type {
+	if _, ok := c.constValue(stmt.Tag); ok {
+		return nil
+	}
+	switch tag := unparen(stmt.Tag).(type) {
+	case *ast.Ident:
+		if !c.declared[tag.Name] {
+			if v := c.ir.Env.ValueOf(tag.Name); v.IsValid() {
+				return v.Type()
+			}
+		}
+	case *ast.CallExpr:
+		if typ := funcType(c.ir, tag.Fun, c.declared); typ != nil && typ.NumOut() == 1 {
+			return typ.Out(0)
+		}
+	}
+	return nil
+}
+
+// caseValue returns the constant value of expr converted to the type tag of the switch, or to its default type
+// if tag is nil or an interface, and reports whether it is constant.
+func (c *switchChecker) caseValue(expr ast.Expr, tag r.Type) (caseValue, bool) {
+	val, ok := c.constValue(expr)
+	if !ok {
+		return caseValue{}, false
+	}
+	var typ string
+	var kind r.Kind
+	if tag == nil || tag.Kind() == r.Interface {
+		switch val.Kind() {
+		case constant.Int:
+			typ, kind = "int", r.Int
+			if lit, isLit := unparen(expr).(*ast.BasicLit); isLit && lit.Kind == token.CHAR {
+				typ = "rune"
+			}
+		case constant.Float:
+			typ, kind = "float64", r.Float64
+		case constant.String:
+			typ, kind = "string", r.String
+		default:
+			return caseValue{}, false
+		}
+	} else {
+		typ, kind = typeDescription(tag), tag.Kind()
+	}
+
+	switch kind {
+	case r.Int, r.Int8, r.Int16, r.Int32, r.Int64, r.Uint, r.Uint8, r.Uint16, r.Uint32, r.Uint64, r.Uintptr:
+		val = constant.ToInt(val)
+		if val.Kind() != constant.Int {
+			return caseValue{}, false
+		}
+	case r.Float32, r.Float64:
+		val = constant.ToFloat(val)
+		if val.Kind() == constant.Unknown {
+			return caseValue{}, false
+		}
+		f, _ := constant.Float64Val(val)
+		if kind == r.Float32 {
+			f32, _ := constant.Float32Val(val)
+			f = float64(f32)
+		}
+		val = constant.MakeFloat64(f)
+	case r.String:
+		if val.Kind() != constant.String {
+			return caseValue{}, false
+		}
+	default:
+		return caseValue{}, false
+	}
+	return caseValue{expr, val, typ}, true
+}
+
+// constValue returns the value of expr if it is an untyped constant or a character.
+func (c *switchChecker) constValue(expr ast.Expr) (constant.Value, bool) {
+	if lit, ok := unparen(expr).(*ast.BasicLit); ok && lit.Kind == token.CHAR {
+		if val := constant.MakeFromLiteral(lit.Value, lit.Kind, 0); val.Kind() != constant.Unknown {
+			return val, true
+		}
+		return nil, false
+	}
+	val, typ := c.folder.value(expr)
+	return val, val != nil && typ == ""
+}
+
+// typeDescription describes typ like gc does in its errors about constants: the name of the predeclared types,
+// and the underlying kind along with the name for the others, as in "int type Color".
+func typeDescription(typ r.Type) string {
+	if typ.PkgPath() == "" && typ.Name() != "" {
+		return typ.Name()
+	}
+	if typ.Name() != "" {
+		return typ.Kind().String() + " type " + typ.Name()
+	}
+	return typ.String()
+}
+
+// duplicateTypes reports the first type of the cases of stmt that a previous case lists, nil included.
+func (c *switchChecker) duplicateTypes(stmt *ast.TypeSwitchStmt) {
+	seen := make(map[string]ast.Expr)
+	for _, clause := range stmt.Body.List {
+		for _, expr := range clause.(*ast.CaseClause).List {
+			name := types.ExprString(expr)
+			if prev, dup := seen[name]; dup {
+				c.errorf(expr.Pos(), "duplicate case %s in type switch\n\t%s: previous case", name, c.ir.Env.Fileset.Position(prev.Pos()))
+				return
+			}
+			seen[name] = expr
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestSwitchErrors tests that the misplaced fallthrough statements and the duplicate cases of switches are
+// reported like gc does.
+func TestSwitchErrors(t *testing.T) {
+	cases := []struct {
+		code string
+		want string
+	}{
+		{"switch 1 {\ncase 1:\n\tfallthrough\n}", "repl.go:3:2: cannot fallthrough final case in switch"},
+		{"for i := 0; i < 1; i++ {\n\tswitch i {\n\tcase 0:\n\t\tif true {\n\t\t\tfallthrough\n\t\t}\n\tcase 1:\n\t}\n}",
+			"repl.go:5:4: fallthrough statement out of place"},
+		{"func f() {\n\tfallthrough\n}", "repl.go:2:2: fallthrough statement out of place"},
+		{"var e interface{}\nswitch e.(type) {\ncase int:\n\tfallthrough\ncase string:\n}", "repl.go:4:2: cannot fallthrough in type switch"},
+		{"switch x := 1; x {\ncase 1, 2:\ncase 3, 1:\n}",
+			"repl.go:3:9: duplicate case 1 (constant of type int) in expression switch\n\trepl.go:2:6: previous case"},
+		{"const K = 2\nswitch 2 {\ncase K:\ncase 1, 1 + 1:\n}",
+			"repl.go:4:9: duplicate case 1 + 1 (constant 2 of type int) in expression switch\n\trepl.go:3:6: previous case"},
+		{"switch \"a\" {\ncase \"a\":\ncase \"b\", \"a\":\n}",
+			"repl.go:3:11: duplicate case \"a\" (constant of type string) in expression switch\n\trepl.go:2:6: previous case"},
+		{"var e interface{}\nswitch e.(type) {\ncase int, string:\ncase []int, int:\n}",
+			"repl.go:4:13: duplicate case int in type switch\n\trepl.go:3:6: previous case"},
+	}
+	for _, c := range cases {
+		ir := newInterp()
+		if _, err := doEval(ir, c.code); err == nil || err.Error() != c.want {
+			t.Errorf("\t%s Expected %q but got %v for\n%s", failure, c.want, err, c.code)
+		}
+	}
+
+	// Booleans are not checked, and a fallthrough ending a clause before the last one is fine.
+	ir := newInterp()
+	if _, err := doEval(ir, "switch {\ncase true:\n\tfallthrough\ncase true:\n}"); err != nil {
+		t.Errorf("\t%s Expected no error but got %v", failure, err)
+	}
+}
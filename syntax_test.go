@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// syntaxKnownFailures lists the programs of testdata/syntax the interpreter does not run like gc, with the
+// reason. A program of the list that starts passing is reported, so that the list tracks the missing features.
+var syntaxKnownFailures = map[string]string{
+	"defers.go":   "the variable declared from recover() has the type of the panic value instead of interface{}",
+	"generics.go": "the interpreter has no type parameters",
+	"goto.go":     "the interpreter has no goto",
+	"results.go":  "the interpreter has no named result parameters",
+}
+
+// TestSyntaxConformance runs the programs of testdata/syntax with `go run` and in a new interpreter, and
+// compares their output.
+func TestSyntaxConformance(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("needs the go command")
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "syntax", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		want, err := exec.Command("go", "run", file).CombinedOutput()
+		if err != nil {
+			t.Errorf("\t%s go run %s: %v\n%s", failure, name, err, want)
+			continue
+		}
+		got, err := interpretProgram(file)
+
+		reason, known := syntaxKnownFailures[name]
+		switch {
+		case known && err == nil && got == string(want):
+			t.Errorf("\t%s %s now runs like gc: remove it from syntaxKnownFailures", failure, name)
+		case known:
+			t.Logf("%s: known failure: %s", name, reason)
+		case err != nil:
+			t.Errorf("\t%s %s: %v", failure, name, err)
+		case got != string(want):
+			t.Errorf("\t%s %s: expected the output of gc\n%s\nbut got\n%s", failure, name, want, got)
+		}
+	}
+}
+
+// interpretProgram runs the main function of the program of file in a new interpreter, and returns what it
+// writes to the standard output.
+func interpretProgram(file string) (string, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	// The package clause has no meaning for the cells.
+	code := strings.Replace(string(src), "package main", "", 1)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.String()
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+
+	ir := newInterp()
+	_, err = doEval(ir, code)
+	if err == nil {
+		_, err = doEval(ir, "main()")
+	}
+	os.Stdout = stdout
+	w.Close()
+	return <-output, err
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// eliminateTailCalls rewrites the functions declared by nodes that call themselves in tail position, as in
+// `return f(n-1, acc*n)`, into loops assigning the arguments of the call to the parameters. Deep recursions
+// then neither grow the stack nor reach recursionLimit, and run faster as the interpreter does not create an
+// environment per call.
+func eliminateTailCalls(nodes []ast.Node) {
+	for _, node := range nodes {
+		if decl, ok := node.(*ast.FuncDecl); ok && tailCallsEliminable(decl) {
+			eliminateFuncTailCalls(decl)
+		}
+	}
+}
+
+// tailCallsEliminable reports whether the self tail calls of decl can be replaced by a loop: it is a function
+// with named parameters that are not redeclared, no named results, and its body neither defers calls, creates
+// closures nor takes the address of a parameter, which could see the parameters change.
+func tailCallsEliminable(decl *ast.FuncDecl) bool {
+	if decl.Recv != nil || decl.Body == nil {
+		return false
+	}
+	params := make(map[string]bool)
+	types := make(map[string]ast.Expr)
+	for _, field := range decl.Type.Params.List {
+		if len(field.Names) == 0 {
+			return false
+		}
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return false
+		}
+		for _, name := range field.Names {
+			params[name.Name] = true
+			types[name.Name] = field.Type
+		}
+	}
+	if results := decl.Type.Results; results != nil {
+		for _, field := range results.List {
+			if len(field.Names) > 0 {
+				return false
+			}
+		}
+	}
+
+	ok, calls := true, 0
+	redeclared := func(idents ...ast.Expr) {
+		for _, ident := range idents {
+			if ident, isIdent := ident.(*ast.Ident); isIdent && params[ident.Name] {
+				ok = false
+			}
+		}
+	}
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit, *ast.DeferStmt, *ast.GoStmt:
+			ok = false
+		case *ast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				redeclared(n.Lhs...)
+			}
+		case *ast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				redeclared(n.Key, n.Value)
+			}
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				redeclared(name)
+			}
+		case *ast.UnaryExpr:
+			if _, isParam := paramOperand(n.X, params); isParam && n.Op == token.AND {
+				ok = false
+			}
+		case *ast.SliceExpr:
+			if name, isParam := paramOperand(n.X, params); isParam && isArrayType(types[name]) {
+				ok = false
+			}
+		case *ast.CallExpr:
+			// A method with a pointer receiver takes the address of its operand.
+			if sel, isSel := n.Fun.(*ast.SelectorExpr); isSel {
+				if name, isParam := paramOperand(sel.X, params); isParam && mayHavePointerMethods(types[name]) {
+					ok = false
+				}
+			}
+		case *ast.ReturnStmt:
+			if selfCall(decl, n.Results) != nil {
+				calls++
+			}
+		}
+		return ok
+	})
+	return ok && (calls > 0 || decl.Type.Results == nil)
+}
+
+// paramOperand returns the parameter whose variable, or a field or array element of it, expr designates, if
+// any.
+func paramOperand(expr ast.Expr, params map[string]bool) (string, bool) {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e.Name, params[e.Name]
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		default:
+			return "", false
+		}
+	}
+}
+
+// isArrayType reports whether typ is an array type, whose slices share the variable.
+func isArrayType(typ ast.Expr) bool {
+	array, ok := typ.(*ast.ArrayType)
+	return ok && array.Len != nil
+}
+
+// mayHavePointerMethods reports whether the variables of type typ may have methods with pointer receivers: those
+// of named types, except the predeclared ones, and of structs and arrays, whose fields and elements may.
+func mayHavePointerMethods(typ ast.Expr) bool {
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		return !predeclaredTypes[typ.Name]
+	case *ast.ParenExpr:
+		return mayHavePointerMethods(typ.X)
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return false
+	case *ast.ArrayType:
+		return typ.Len != nil
+	}
+	return true
+}
+
+// predeclaredTypes are the names of the predeclared types, which have no methods.
+var predeclaredTypes = map[string]bool{
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true, "float32": true,
+	"float64": true, "int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+	"string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+// selfCall returns the call of decl making up exprs, if any, with as many arguments as decl has parameters.
+func selfCall(decl *ast.FuncDecl, exprs []ast.Expr) *ast.CallExpr {
+	if len(exprs) != 1 {
+		return nil
+	}
+	call, ok := exprs[0].(*ast.CallExpr)
+	if !ok || call.Ellipsis.IsValid() || len(call.Args) != decl.Type.Params.NumFields() {
+		return nil
+	}
+	if fun, ok := call.Fun.(*ast.Ident); !ok || fun.Name != decl.Name.Name {
+		return nil
+	}
+	return call
+}
+
+// eliminateFuncTailCalls wraps the body of decl in a loop and replaces its self tail calls with assignments of
+// the parameters followed by the next iteration. The calls within loops are left alone, as the interpreter does
+// not support continuing an outer loop by its label.
+func eliminateFuncTailCalls(decl *ast.FuncDecl) {
+	var params []ast.Expr
+	for _, field := range decl.Type.Params.List {
+		for _, name := range field.Names {
+			params = append(params, ast.NewIdent(name.Name))
+		}
+	}
+	jump := func(call *ast.CallExpr) ast.Stmt {
+		var stmts []ast.Stmt
+		if len(params) > 0 {
+			stmts = append(stmts, &ast.AssignStmt{Lhs: params, Tok: token.ASSIGN, Rhs: call.Args})
+		}
+		stmts = append(stmts, &ast.BranchStmt{Tok: token.CONTINUE})
+		return &ast.BlockStmt{List: stmts}
+	}
+
+	replaced := 0
+	var rewrite func(stmts []ast.Stmt, tail bool)
+	rewrite = func(stmts []ast.Stmt, tail bool) {
+		for i, stmt := range stmts {
+			last := tail && i == len(stmts)-1
+			switch stmt := stmt.(type) {
+			case *ast.ReturnStmt:
+				if call := selfCall(decl, stmt.Results); call != nil {
+					stmts[i] = jump(call)
+					replaced++
+				}
+			case *ast.ExprStmt:
+				// Without results, a call ending the function is a tail call too.
+				if call := selfCall(decl, []ast.Expr{stmt.X}); call != nil && last && decl.Type.Results == nil {
+					stmts[i] = jump(call)
+					replaced++
+				}
+			case *ast.BlockStmt:
+				rewrite(stmt.List, last)
+			case *ast.IfStmt:
+				rewrite(stmt.Body.List, last)
+				if stmt.Else != nil {
+					rewrite([]ast.Stmt{stmt.Else}, last)
+				}
+			case *ast.SwitchStmt:
+				rewriteClauses(stmt.Body, last, rewrite)
+			case *ast.TypeSwitchStmt:
+				rewriteClauses(stmt.Body, last, rewrite)
+			case *ast.SelectStmt:
+				rewriteClauses(stmt.Body, last, rewrite)
+			case *ast.LabeledStmt:
+				rewrite([]ast.Stmt{stmt.Stmt}, last)
+			}
+		}
+	}
+	rewrite(decl.Body.List, true)
+	if replaced == 0 {
+		return
+	}
+
+	body := decl.Body.List
+	if decl.Type.Results == nil {
+		body = append(body, &ast.ReturnStmt{})
+	}
+	decl.Body.List = []ast.Stmt{&ast.ForStmt{Body: &ast.BlockStmt{List: body}}}
+}
+
+// rewriteClauses calls rewrite on the statements of each clause of a switch or select statement.
+func rewriteClauses(body *ast.BlockStmt, tail bool, rewrite func([]ast.Stmt, bool)) {
+	for _, clause := range body.List {
+		switch clause := clause.(type) {
+		case *ast.CaseClause:
+			rewrite(clause.Body, tail)
+		case *ast.CommClause:
+			rewrite(clause.Body, tail)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestEliminateTailCalls tests running self tail recursive functions deeper than the recursion limit.
+func TestEliminateTailCalls(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{`func sum(n, acc int) int {
+	if n == 0 {
+		return acc
+	}
+	return sum(n-1, acc+n)
+}
+sum(100000, 0)`, 5000050000},
+		{`func gcd(a, b int) int {
+	switch {
+	case b == 0:
+		return a
+	default:
+		return gcd(b, a%b)
+	}
+}
+gcd(1071, 462)`, 21},
+		{`count := 0
+func countdown(n int) {
+	if n > 0 {
+		count++
+		countdown(n - 1)
+	}
+}
+countdown(50000)
+count`, 50000},
+		// A parameter redeclared in the body keeps the function recursive.
+		{`func halve(n int) int {
+	if n <= 1 {
+		return n
+	}
+	n := n / 2
+	return halve(n)
+}
+halve(1000)`, 1},
+		// The pointers to a parameter point to the variable of each call, like in gc.
+		{`var ps []*int
+func tp(n int) int {
+	ps = append(ps, &n)
+	if n == 0 {
+		return 0
+	}
+	return tp(n - 1)
+}
+tp(2)
+*ps[0]*100 + *ps[1]*10 + *ps[2]`, 210},
+		// So do the receivers of the methods with pointer receivers.
+		{`type counter struct{ N int }
+var cs []*counter
+func (c *counter) inc() {
+	c.N++
+	cs = append(cs, c)
+}
+func track(c counter, depth int) int {
+	c.inc()
+	if depth == 0 {
+		return c.N
+	}
+	return track(counter{c.N * 10}, depth-1)
+}
+track(counter{0}, 1)
+cs[0].N*100 + cs[1].N`, 111},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, c.code)
+		if err != nil || len(vals) != 1 || vals[0] != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+}
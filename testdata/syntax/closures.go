@@ -0,0 +1,28 @@
+// Function literals are closures: they may refer to the variables of the surrounding function.
+package main
+
+import "fmt"
+
+func counter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+func main() {
+	next := counter()
+	next()
+	next()
+	fmt.Println(next())
+
+	var fs []func() int
+	for i := 0; i < 3; i++ {
+		fs = append(fs, func() int { return i })
+	}
+	for _, f := range fs {
+		fmt.Print(f(), " ")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,32 @@
+// The constant declarations of the specification.
+package main
+
+import "fmt"
+
+type Weekday int
+
+const (
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+)
+
+const (
+	_  = iota
+	KB = 1 << (10 * iota)
+	MB
+)
+
+const (
+	a, b = iota, iota * 10
+	c, d
+)
+
+const Huge = 1 << 100
+
+func main() {
+	fmt.Println(Sunday, Monday, Tuesday)
+	fmt.Println(KB, MB)
+	fmt.Println(a, b, c, d)
+	fmt.Println(Huge >> 98)
+}
@@ -0,0 +1,23 @@
+// Deferred calls run in reverse order when the function returns, and recover stops a panic.
+package main
+
+import "fmt"
+
+var msg string
+
+func safe() {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprint("recovered ", r)
+		}
+	}()
+	panic("boom")
+}
+
+func main() {
+	for i := 0; i < 3; i++ {
+		defer fmt.Print(i, " ")
+	}
+	safe()
+	fmt.Println(msg)
+}
@@ -0,0 +1,21 @@
+// Labeled break and continue statements leave the statements they name.
+package main
+
+import "fmt"
+
+func main() {
+	n := 0
+Outer:
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			switch {
+			case j > i:
+				continue Outer
+			case i == 4:
+				break Outer
+			}
+			n++
+		}
+	}
+	fmt.Println(n)
+}
@@ -0,0 +1,33 @@
+// The range clauses of the specification, including those over integers and functions.
+package main
+
+import "fmt"
+
+func squares(yield func(int, int) bool) {
+	for i := 0; ; i++ {
+		if !yield(i, i*i) {
+			return
+		}
+	}
+}
+
+func main() {
+	sum := 0
+	for i := range 5 {
+		sum += i
+	}
+	fmt.Println(sum)
+
+	for i, sq := range squares {
+		if sq > 10 {
+			break
+		}
+		fmt.Print(i, ":", sq, " ")
+	}
+	fmt.Println()
+
+	for i, r := range "héllo" {
+		fmt.Print(i, string(r), " ")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,14 @@
+// Named result parameters are variables, returned by a bare return statement.
+package main
+
+import "fmt"
+
+func divmod(a, b int) (q, r int) {
+	q = a / b
+	r = a % b
+	return
+}
+
+func main() {
+	fmt.Println(divmod(7, 2))
+}
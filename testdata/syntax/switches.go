@@ -0,0 +1,33 @@
+// The expression and type switches of the specification.
+package main
+
+import "fmt"
+
+func kind(x interface{}) string {
+	switch v := x.(type) {
+	case nil:
+		return "nil"
+	case int, float64:
+		return fmt.Sprintf("number %v", v)
+	case string:
+		return "string " + v
+	default:
+		return "other"
+	}
+}
+
+func main() {
+	for i := 0; i < 4; i++ {
+		switch {
+		case i == 0:
+			fmt.Print("zero ")
+			fallthrough
+		case i == 1:
+			fmt.Print("small ")
+		case i == 2, i == 3:
+			fmt.Print("big ")
+		}
+	}
+	fmt.Println()
+	fmt.Println(kind(nil), kind(1), kind(2.5), kind("s"), kind(true))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+func init() {
+	cellMagics["test"] = testMagic
+}
+
+// testMagic implements `%%test [name]`: it runs the body of the cell as a test, which fails when the body fails,
+// e.g. on a failed assertion of package assert, and prints its outcome and duration on the output of the cell.
+func testMagic(ir *classic.Interp, receipt *msgReceipt, args []string, body string) ([]interface{}, error) {
+	name := strings.Join(args, " ")
+	if name == "" {
+		name = fmt.Sprintf("In [%d]", ExecCounter)
+	}
+
+	start := time.Now()
+	vals, err := evalCell(ir, receipt, body)
+	elapsed := time.Since(start).Seconds()
+	if err != nil {
+		fmt.Fprintf(os.Stdout, "test %s failed after %.2fs\n", name, elapsed)
+		return nil, err
+	}
+	fmt.Fprintf(os.Stdout, "test %s passed in %.2fs\n", name, elapsed)
+	return vals, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestTestMagic tests running cells as tests with `%%test`, which fail on failed assertions.
+func TestTestMagic(t *testing.T) {
+	ir := newInterp()
+	cases := []struct {
+		code, ename, message, summary string
+	}{
+		{"%%test sums\nimport \"assert\"\nassert.Equal(6, 1+2+3)\nassert.Panics(func() { panic(\"no\") })", "", "",
+			"test sums passed in "},
+		{"%%test\nassert.Equal([]string{\"a\", \"b\"}, []string{\"a\", \"c\"}, \"letters\")", enameAssertion,
+			"values are not equal: letters\n--- expected\n+++ actual\n- []string{\"a\", \"b\"}\n+ []string{\"a\", \"c\"}",
+			"test In [0] failed after "},
+		{"%%test\nvar x []int\nassert.True(len(x) > 0, \"x is empty\")", enameAssertion, "value is false: x is empty",
+			"test In [0] failed after "},
+	}
+	for _, c := range cases {
+		var err error
+		stdout := captureStdout(t, func() { _, err = evalCell(ir, nil, c.code) })
+		switch {
+		case c.ename == "" && err != nil:
+			t.Errorf("\t%s Expected %q to pass but got %v", failure, c.code, err)
+		case c.ename != "" && (err == nil || errorName(err) != c.ename || !strings.Contains(err.Error(), c.message)):
+			t.Errorf("\t%s Expected %q to fail with the %s %q but got %v", failure, c.code, c.ename, c.message, err)
+		}
+		if !strings.HasPrefix(stdout, c.summary) || !strings.HasSuffix(stdout, "s\n") {
+			t.Errorf("\t%s Expected %q to print %q and its duration but got %q", failure, c.code, c.summary, stdout)
+		}
+	}
+}
+
+// captureStdout returns what run writes to the standard output.
+func captureStdout(t *testing.T, run func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("\t%s Creating a pipe: %v", failure, err)
+	}
+	output := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.String()
+	}()
+	stdout := os.Stdout
+	os.Stdout = w
+	run()
+	os.Stdout = stdout
+	w.Close()
+	return <-output
+}
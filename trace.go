@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"html"
+	"log"
+	r "reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cosmos72/gomacro/base"
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// traceFuncName is the name of the function called by the statements inserted into traced cells.
+	traceFuncName = "__gophernotesTrace"
+
+	// traceMaxSteps is the number of steps kept in the trace of a cell. Further steps are only counted.
+	traceMaxSteps = 1000
+
+	// traceMaxValue is the length beyond which the values in a trace are truncated.
+	traceMaxValue = 60
+)
+
+// traceOn is toggled by `%trace_on` and `%trace_off`. When set, each statement executed by a cell is logged
+// along with the values it assigns, and the trace is displayed below the cell.
+var traceOn bool
+
+func init() {
+	lineMagics["trace_on"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		traceOn = true
+		return nil
+	}
+	lineMagics["trace_off"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) error {
+		traceOn = false
+		return nil
+	}
+}
+
+// executionTrace collects the steps executed by a traced cell.
+type executionTrace struct {
+	mu      sync.Mutex
+	steps   []string
+	dropped int
+}
+
+var (
+	// activeTraceMu guards activeTrace, since goroutines started by a cell may run traced statements.
+	activeTraceMu sync.Mutex
+
+	// activeTrace is the trace of the cell being executed, nil when tracing is off. Functions instrumented
+	// by a traced cell do not log anything when called from a cell that is not traced.
+	activeTrace *executionTrace
+)
+
+// startTrace instruments nodes so that their statements log themselves, and starts the trace of the cell.
+func startTrace(ir *classic.Interp, nodes []ast.Node) *executionTrace {
+	ir.Env.DefineVar(traceFuncName, r.TypeOf(traceStep), r.ValueOf(traceStep))
+
+	instrumentBlocks(nodes, func(stmts []ast.Stmt) []ast.Stmt {
+		return instrumentStmts(stmts, func(pos token.Pos) int {
+			return ir.Env.Fileset.Position(pos).Line
+		})
+	})
+
+	tr := &executionTrace{}
+	activeTraceMu.Lock()
+	activeTrace = tr
+	activeTraceMu.Unlock()
+	return tr
+}
+
+// instrumentBlocks replaces the statements of each block nested in nodes with the result of instrument.
+func instrumentBlocks(nodes []ast.Node, instrument func([]ast.Stmt) []ast.Stmt) {
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BlockStmt:
+				n.List = instrument(n.List)
+			case *ast.CaseClause:
+				n.Body = instrument(n.Body)
+			case *ast.CommClause:
+				n.Body = instrument(n.Body)
+			}
+			return true
+		})
+	}
+}
+
+// instrumentStmts inserts a call to the trace function after each statement of a block, passing the line
+// of the statement and the variables it assigns. The call goes before statements leaving the block. Statements
+// inserted by other instrumentations, which have no position, are left alone.
+func instrumentStmts(stmts []ast.Stmt, line func(token.Pos) int) []ast.Stmt {
+	instrumented := make([]ast.Stmt, 0, 2*len(stmts))
+	for _, stmt := range stmts {
+		if !stmt.Pos().IsValid() {
+			instrumented = append(instrumented, stmt)
+			continue
+		}
+
+		names := tracedNames(stmt)
+
+		args := []ast.Expr{
+			&ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(line(stmt.Pos()))},
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(strings.Join(names, ","))},
+		}
+		for _, name := range names {
+			args = append(args, ast.NewIdent(name))
+		}
+		call := &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent(traceFuncName), Args: args}}
+
+		switch stmt.(type) {
+		case *ast.ReturnStmt, *ast.BranchStmt:
+			instrumented = append(instrumented, call, stmt)
+		default:
+			instrumented = append(instrumented, stmt, call)
+		}
+	}
+	return instrumented
+}
+
+// tracedNames returns the names of the variables whose values are logged after stmt runs.
+func tracedNames(stmt ast.Node) []string {
+	var names []string
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStmt, *ast.BranchStmt:
+		return nil
+	case *ast.IncDecStmt:
+		if ident, ok := stmt.X.(*ast.Ident); ok {
+			names = []string{ident.Name}
+		}
+	default:
+		names = assignedNames(stmt)
+	}
+
+	traced := names[:0]
+	for _, name := range names {
+		if name != "_" {
+			traced = append(traced, name)
+		}
+	}
+	return traced
+}
+
+// traceStep is the trace function called by instrumented statements. names is the comma separated list of
+// the variables holding values.
+func traceStep(line int, names string, values ...interface{}) {
+	activeTraceMu.Lock()
+	tr := activeTrace
+	activeTraceMu.Unlock()
+
+	if tr != nil {
+		var split []string
+		if names != "" {
+			split = strings.Split(names, ",")
+		}
+		tr.add(line, split, values)
+	}
+}
+
+// traceNode logs the execution of a top-level node of the cell, reading the variables it assigns from ir.
+func (tr *executionTrace) traceNode(ir *classic.Interp, node ast.Node) {
+	names := tracedNames(node)
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = base.ValueInterface(ir.ValueOf(name))
+	}
+	tr.add(ir.Env.Fileset.Position(node.Pos()).Line, names, values)
+}
+
+// add logs a step of the trace, truncating the values. Steps beyond traceMaxSteps are dropped.
+func (tr *executionTrace) add(line int, names []string, values []interface{}) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if len(tr.steps) >= traceMaxSteps {
+		tr.dropped++
+		return
+	}
+
+	step := fmt.Sprintf("line %d", line)
+	for i, name := range names {
+		sep := ", "
+		if i == 0 {
+			sep = ": "
+		}
+		value := fmt.Sprint(values[i])
+		if len(value) > traceMaxValue {
+			value = value[:traceMaxValue] + "…"
+		}
+		step += sep + name + " = " + value
+	}
+	tr.steps = append(tr.steps, step)
+}
+
+// finish stops the trace and displays it below the cell, in a scrollable view for rich front-ends.
+func (tr *executionTrace) finish() {
+	activeTraceMu.Lock()
+	activeTrace = nil
+	activeTraceMu.Unlock()
+
+	receipt, err := hooks.currentReceipt()
+	if err != nil {
+		return
+	}
+
+	tr.mu.Lock()
+	var buf bytes.Buffer
+	for _, step := range tr.steps {
+		buf.WriteString(step)
+		buf.WriteByte('\n')
+	}
+	if tr.dropped > 0 {
+		fmt.Fprintf(&buf, "... %d more steps not shown\n", tr.dropped)
+	}
+	tr.mu.Unlock()
+
+	text := buf.String()
+	err = receipt.PublishDisplayData(bundledMIMEData{
+		"text/plain": text,
+		"text/html":  `<pre style="max-height: 20em; overflow: auto">` + html.EscapeString(text) + "</pre>",
+	}, nil, "")
+	if err != nil {
+		log.Printf("Error publishing execution trace: %v\n", err)
+	}
+}
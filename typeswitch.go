@@ -0,0 +1,91 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// switchValueVarName is the name of the variable holding the value of the guard of a type switch.
+const switchValueVarName = "__gophernotesSwitchValue"
+
+// fixTypeSwitches rewrites the type switches of nodes binding a variable, as in `switch v := x.(type)`, so
+// that in the clauses listing several types, in the default clause and in the `case nil` clause the variable
+// has the type of x, as the specification requires, instead of the dynamic type of its value or
+// interface{}. The value of x is assigned to a variable before the switch, and v is declared again from it at
+// the start of these clauses.
+func fixTypeSwitches(nodes []ast.Node) {
+	for i, node := range nodes {
+		if stmt, ok := node.(ast.Stmt); ok {
+			if block := fixTypeSwitch(stmt); block != nil {
+				nodes[i] = block
+			}
+		}
+	}
+	instrumentBlocks(nodes, func(stmts []ast.Stmt) []ast.Stmt {
+		for i, stmt := range stmts {
+			if block := fixTypeSwitch(stmt); block != nil {
+				stmts[i] = block
+			}
+		}
+		return stmts
+	})
+}
+
+// fixTypeSwitch returns the block replacing stmt if it is a type switch to fix, or nil.
+func fixTypeSwitch(stmt ast.Stmt) ast.Stmt {
+	inner := stmt
+	if labeled, ok := stmt.(*ast.LabeledStmt); ok {
+		inner = labeled.Stmt
+	}
+	ts, ok := inner.(*ast.TypeSwitchStmt)
+	if !ok {
+		return nil
+	}
+	assign, ok := ts.Assign.(*ast.AssignStmt)
+	if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+		return nil
+	}
+	ident, ok := assign.Lhs[0].(*ast.Ident)
+	guard, isAssert := assign.Rhs[0].(*ast.TypeAssertExpr)
+	if !ok || ident.Name == "_" || !isAssert {
+		return nil
+	}
+	if x, ok := guard.X.(*ast.Ident); ok && x.Name == switchValueVarName {
+		// Already fixed.
+		return nil
+	}
+
+	var clauses []*ast.CaseClause
+	for _, clause := range ts.Body.List {
+		clause := clause.(*ast.CaseClause)
+		if len(clause.List) != 1 {
+			clauses = append(clauses, clause)
+		} else if typ, ok := clause.List[0].(*ast.Ident); ok && typ.Name == "nil" {
+			clauses = append(clauses, clause)
+		}
+	}
+	if len(clauses) == 0 {
+		return nil
+	}
+
+	// The block has the position of the switch, so that it is traced and covered like it.
+	block := &ast.BlockStmt{Lbrace: stmt.Pos(), Rbrace: stmt.End() - 1}
+	if ts.Init != nil {
+		block.List = append(block.List, ts.Init)
+		ts.Init = nil
+	}
+	block.List = append(block.List, &ast.AssignStmt{
+		Lhs: []ast.Expr{ast.NewIdent(switchValueVarName)},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{guard.X},
+	}, stmt)
+	guard.X = &ast.Ident{NamePos: guard.X.Pos(), Name: switchValueVarName}
+	for _, clause := range clauses {
+		clause.Body = append([]ast.Stmt{&ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent(ident.Name)},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{ast.NewIdent(switchValueVarName)},
+		}}, clause.Body...)
+	}
+	return block
+}
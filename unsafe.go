@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	r "reflect"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"github.com/cosmos72/gomacro/classic"
+	"github.com/cosmos72/gomacro/imports"
+)
+
+const (
+	// The names of the functions implementing the builtins of the package unsafe and the conversions involving
+	// unsafe.Pointer, which the interpreter cannot do with reflect.Value.Convert.
+	unsafePointerFuncName  = "__gophernotesUnsafePointer"
+	unsafeUintptrFuncName  = "__gophernotesUnsafeUintptr"
+	unsafeConvertFuncName  = "__gophernotesUnsafeConvert"
+	unsafeSizeofFuncName   = "__gophernotesUnsafeSizeof"
+	unsafeAlignofFuncName  = "__gophernotesUnsafeAlignof"
+	unsafeOffsetofFuncName = "__gophernotesUnsafeOffsetof"
+
+	// unsafeValueVarName is the name of the variable holding the operand of unsafe.Sizeof and unsafe.Alignof,
+	// so that its static type can be found from a pointer to it.
+	unsafeValueVarName = "__gophernotesUnsafeValue"
+)
+
+// unsafeOn is set by `%unsafe on`: the cells can then convert pointers to and from unsafe.Pointer and uintptr,
+// and use unsafe.Sizeof, unsafe.Alignof, unsafe.Offsetof and unsafe.Add.
+var unsafeOn bool
+
+var unsafePointerType = r.TypeOf(unsafe.Pointer(nil))
+
+// unsafeBinds holds the functions of the package unsafe that are plain functions, which its imports see when
+// unsafe is on.
+var unsafeBinds = map[string]r.Value{
+	"Add": r.ValueOf(func(p unsafe.Pointer, n int) unsafe.Pointer { return unsafe.Add(p, n) }),
+}
+
+func init() {
+	// The imports of unsafe share the map of its functions, so that they see the changes of `%unsafe`.
+	pkg := imports.Packages["unsafe"]
+	if pkg.Binds == nil {
+		pkg.Binds = make(map[string]r.Value)
+	}
+	imports.Packages["unsafe"] = pkg
+
+	lineMagics["unsafe"] = func(ir *classic.Interp, receipt *msgReceipt, args []string) (err error) {
+		if unsafeOn, err = parseSwitch(args); err != nil {
+			return err
+		}
+		for name, f := range unsafeBinds {
+			if unsafeOn {
+				pkg.Binds[name] = f
+			} else {
+				delete(pkg.Binds, name)
+			}
+		}
+		return nil
+	}
+}
+
+// unsafePointer converts x, a pointer, an unsafe.Pointer or a uintptr, to an unsafe.Pointer.
+func unsafePointer(x interface{}) unsafe.Pointer {
+	v := r.ValueOf(x)
+	switch {
+	case !v.IsValid():
+		return nil
+	case v.Type() == unsafePointerType:
+		return x.(unsafe.Pointer)
+	case v.Kind() == r.Ptr:
+		return unsafe.Pointer(v.Pointer())
+	case v.Kind() == r.Uintptr || v.Kind() == r.Uint || v.Kind() == r.Uint64:
+		// The interpreter may compute the arithmetic on uintptr with uint64. Like in compiled Go, the address
+		// must be that of a live value.
+		p := uintptr(v.Uint())
+		return *(*unsafe.Pointer)(unsafe.Pointer(&p))
+	}
+	panic(fmt.Errorf("cannot convert %v (type %T) to unsafe.Pointer", x, x))
+}
+
+// unsafeUintptr converts x, an unsafe.Pointer or a number, to a uintptr.
+func unsafeUintptr(x interface{}) uintptr {
+	if p, ok := x.(unsafe.Pointer); ok {
+		return uintptr(p)
+	}
+	return r.ValueOf(x).Convert(r.TypeOf(uintptr(0))).Interface().(uintptr)
+}
+
+// unsafeConvert converts x to the type of the pointer typ, reinterpreting the memory x points to if it is an
+// unsafe.Pointer.
+func unsafeConvert(x interface{}, typ interface{}) interface{} {
+	t := r.TypeOf(typ)
+	if p, ok := x.(unsafe.Pointer); ok {
+		if p == nil {
+			return r.Zero(t).Interface()
+		}
+		return r.NewAt(t.Elem(), p).Interface()
+	}
+	return r.ValueOf(x).Convert(t).Interface()
+}
+
+// unsafeSizeof returns the size of the value ptr points to.
+func unsafeSizeof(ptr interface{}) uintptr {
+	return r.TypeOf(ptr).Elem().Size()
+}
+
+// unsafeAlignof returns the alignment of the value ptr points to.
+func unsafeAlignof(ptr interface{}) uintptr {
+	return uintptr(r.TypeOf(ptr).Elem().Align())
+}
+
+// unsafeOffsetof returns the offset of the field of the struct x, or of the struct x points to.
+func unsafeOffsetof(x interface{}, field string) uintptr {
+	t := r.TypeOf(x)
+	if t != nil && t.Kind() == r.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != r.Struct {
+		panic(fmt.Errorf("invalid argument: %v is not a selector of a struct field", field))
+	}
+	f, ok := t.FieldByName(field)
+	if !ok {
+		// The interpreter exports the fields of the struct types it creates.
+		c, size := utf8.DecodeRuneInString(field)
+		f, ok = t.FieldByName(string(unicode.ToUpper(c)) + field[size:])
+	}
+	if !ok {
+		panic(fmt.Errorf("%v has no field %s", t, field))
+	}
+	// The offset of a promoted field is the sum of those along the path to it.
+	var offset uintptr
+	for i := range f.Index {
+		offset += t.FieldByIndex(f.Index[:i+1]).Offset
+	}
+	return offset
+}
+
+// rewriteUnsafe rewrites the uses of the package unsafe by nodes when `%unsafe on` is set: unsafe.Sizeof,
+// unsafe.Alignof and unsafe.Offsetof, and the conversions to and from unsafe.Pointer and uintptr, become calls
+// to functions doing them with reflect. The package must be imported under its own name.
+func rewriteUnsafe(ir *classic.Interp, nodes []ast.Node) {
+	if !unsafeOn {
+		return
+	}
+	declared := declaredNames(nodes)
+	isUnsafe := importsUnsafe(nodes)
+	if ref := packageRef(ir.Env.ValueOf("unsafe")); ref != nil {
+		isUnsafe = isUnsafe || ref.Path == "unsafe"
+	}
+	if !isUnsafe || declared["unsafe"] {
+		return
+	}
+
+	for name, f := range map[string]interface{}{
+		unsafePointerFuncName:  unsafePointer,
+		unsafeUintptrFuncName:  unsafeUintptr,
+		unsafeConvertFuncName:  unsafeConvert,
+		unsafeSizeofFuncName:   unsafeSizeof,
+		unsafeAlignofFuncName:  unsafeAlignof,
+		unsafeOffsetofFuncName: unsafeOffsetof,
+	} {
+		ir.Env.DefineVar(name, r.TypeOf(f), r.ValueOf(f))
+	}
+
+	rewrite := func(expr ast.Expr) ast.Expr {
+		call, ok := expr.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+			return expr
+		}
+		arg := call.Args[0]
+		helper := func(name string, args ...ast.Expr) ast.Expr {
+			return &ast.CallExpr{Fun: &ast.Ident{NamePos: call.Pos(), Name: name}, Args: args, Rparen: call.Rparen}
+		}
+
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			if pkg, ok := fun.X.(*ast.Ident); !ok || pkg.Name != "unsafe" {
+				return expr
+			}
+			switch fun.Sel.Name {
+			case "Pointer":
+				return helper(unsafePointerFuncName, arg)
+			case "Sizeof", "Alignof":
+				// The operand is assigned to a variable, whose address keeps its static type, e.g. that of an
+				// interface rather than that of the dynamic value.
+				name := unsafeSizeofFuncName
+				if fun.Sel.Name == "Alignof" {
+					name = unsafeAlignofFuncName
+				}
+				return helper(name, &ast.CallExpr{Fun: &ast.FuncLit{
+					Type: &ast.FuncType{
+						Params:  &ast.FieldList{},
+						Results: &ast.FieldList{List: []*ast.Field{{Type: &ast.InterfaceType{Methods: &ast.FieldList{}}}}},
+					},
+					Body: &ast.BlockStmt{List: []ast.Stmt{
+						&ast.AssignStmt{Lhs: []ast.Expr{ast.NewIdent(unsafeValueVarName)}, Tok: token.DEFINE, Rhs: []ast.Expr{arg}},
+						&ast.ReturnStmt{Results: []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ast.NewIdent(unsafeValueVarName)}}},
+					}},
+				}})
+			case "Offsetof":
+				for paren, ok := arg.(*ast.ParenExpr); ok; paren, ok = arg.(*ast.ParenExpr) {
+					arg = paren.X
+				}
+				if sel, ok := arg.(*ast.SelectorExpr); ok {
+					field := &ast.BasicLit{ValuePos: sel.Sel.Pos(), Kind: token.STRING, Value: strconv.Quote(sel.Sel.Name)}
+					return helper(unsafeOffsetofFuncName, sel.X, field)
+				}
+			}
+		case *ast.Ident:
+			// Constants are converted as usual.
+			if _, isLit := arg.(*ast.BasicLit); fun.Name == "uintptr" && !isLit && !declared["uintptr"] {
+				return helper(unsafeUintptrFuncName, arg)
+			}
+		case *ast.ParenExpr:
+			star, ok := fun.X.(*ast.StarExpr)
+			if nilIdent, isNil := arg.(*ast.Ident); !ok || isNil && nilIdent.Name == "nil" {
+				return expr
+			}
+			// The pointer type is given as a nil pointer, and the result asserted to it.
+			typ := &ast.CallExpr{Fun: &ast.ParenExpr{X: star}, Args: []ast.Expr{ast.NewIdent("nil")}}
+			return &ast.TypeAssertExpr{X: helper(unsafeConvertFuncName, arg, typ), Type: star}
+		}
+		return expr
+	}
+	for i, node := range nodes {
+		if expr, ok := node.(ast.Expr); ok {
+			nodes[i] = rewriteExprs(expr, rewrite).(ast.Expr)
+		} else {
+			rewriteExprs(node, rewrite)
+		}
+	}
+}
+
+// rewriteExprs replaces each expression below node, and node itself if it is an expression, with the result
+// of f, from the innermost ones out. It returns the replacement of node.
+func rewriteExprs(node ast.Node, f func(ast.Expr) ast.Expr) ast.Node {
+	v := r.ValueOf(node)
+	if v.Kind() != r.Ptr || v.IsNil() || v.Elem().Kind() != r.Struct {
+		return node
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Type() == exprType:
+			if !field.IsNil() {
+				field.Set(r.ValueOf(rewriteExprs(field.Interface().(ast.Node), f)))
+			}
+		case field.Type() == exprsType:
+			for j := 0; j < field.Len(); j++ {
+				field.Index(j).Set(r.ValueOf(rewriteExprs(field.Index(j).Interface().(ast.Node), f)))
+			}
+		case field.Type().Implements(nodeType):
+			if !field.IsNil() {
+				rewriteExprs(field.Interface().(ast.Node), f)
+			}
+		case field.Kind() == r.Slice && field.Type().Elem().Implements(nodeType):
+			for j := 0; j < field.Len(); j++ {
+				if elem := field.Index(j); !elem.IsNil() {
+					rewriteExprs(elem.Interface().(ast.Node), f)
+				}
+			}
+		}
+	}
+	if expr, ok := node.(ast.Expr); ok {
+		return f(expr)
+	}
+	return node
+}
+
+// rewriteStmts replaces each statement of the blocks and clauses below node, and node itself if it is a
+// statement, with the result of f. It returns the replacement of node.
+func rewriteStmts(node ast.Node, f func(ast.Stmt) ast.Stmt) ast.Node {
+	ast.Inspect(node, func(n ast.Node) bool {
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			list = n.Body
+		case *ast.LabeledStmt:
+			n.Stmt = f(n.Stmt)
+		}
+		for i, stmt := range list {
+			list[i] = f(stmt)
+		}
+		return true
+	})
+	if stmt, ok := node.(ast.Stmt); ok {
+		return f(stmt)
+	}
+	return node
+}
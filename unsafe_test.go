@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestUnsafe tests the package unsafe with `%unsafe on`, and that it stays off by default.
+func TestUnsafe(t *testing.T) {
+	ir := newInterp()
+	if _, err := doEval(ir, "import \"unsafe\"\nx := 7\nunsafe.Pointer(&x)"); err == nil {
+		t.Errorf("\t%s Expected converting to unsafe.Pointer to fail while unsafe is off", failure)
+	}
+
+	if err := lineMagics["unsafe"](ir, nil, []string{"on"}); err != nil {
+		t.Fatal(err)
+	}
+	defer lineMagics["unsafe"](ir, nil, []string{"off"})
+	cases := []struct {
+		code string
+		want interface{}
+	}{
+		{`type S struct {
+	a int8
+	b int64
+	c bool
+}
+var s S
+[]uintptr{unsafe.Sizeof(s), unsafe.Alignof(s), unsafe.Offsetof(s.b), unsafe.Offsetof(s.c)}`, "[24 8 8 16]"},
+		// The size of an interface, not of its dynamic value.
+		{`var e interface{} = int8(1)
+unsafe.Sizeof(e)`, "16"},
+		{`f := 1.5
+*(*uint64)(unsafe.Pointer(&f))`, "4609434218613702656"},
+		{`arr := [3]int32{1, 2, 3}
+p := unsafe.Add(unsafe.Pointer(&arr[0]), 8)
+*(*int32)(p)`, "3"},
+		{`u := uintptr(unsafe.Pointer(&arr[0])) + unsafe.Sizeof(arr[0])
+*(*int32)(unsafe.Pointer(u))`, "2"},
+		{`var nilPtr unsafe.Pointer
+(*int)(nilPtr) == nil`, "true"},
+	}
+	for _, c := range cases {
+		vals, err := doEval(ir, "import (\"fmt\"; \"unsafe\")\n"+c.code)
+		if err != nil || len(vals) != 1 || fmt.Sprint(vals[0]) != c.want {
+			t.Errorf("\t%s Expected %v but got %v, %v for\n%s", failure, c.want, vals, err, c.code)
+		}
+	}
+}
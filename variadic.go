@@ -0,0 +1,225 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	r "reflect"
+	"strconv"
+
+	"github.com/cosmos72/gomacro/classic"
+)
+
+const (
+	// valuesFuncName is the name of the builtin Values of the interpreter, which gives its argument the type of its
+	// dynamic value, kept under a name the cells do not shadow.
+	valuesFuncName = "__gophernotesValues"
+
+	// appendSliceFuncName is the name of the function appending a slice, or the bytes of a string, to a slice.
+	appendSliceFuncName = "__gophernotesAppendSlice"
+
+	// variadicFuncPrefix prefixes the names of the functions turning a variadic function into one taking a fixed
+	// number of arguments.
+	variadicFuncPrefix = "__gophernotesVariadic"
+)
+
+// variadicKey identifies a function of variadicFuncs: the one taking n arguments for a function of type typ.
+type variadicKey struct {
+	typ r.Type
+	n   int
+}
+
+// sessionVariadics holds the names of the functions defined for the variadic calls of the session of ir.
+type sessionVariadics struct {
+	ir    *classic.Interp
+	names map[variadicKey]string
+}
+
+var variadicFuncs = &sessionVariadics{}
+
+// appendSlice returns the result of append(s, x...), where x is a slice of the type of the elements of s, or a
+// string when they are bytes.
+func appendSlice(s, x interface{}) interface{} {
+	vs, vx := r.ValueOf(s), r.ValueOf(x)
+	if !vx.IsValid() {
+		return s
+	}
+	if vx.Kind() == r.String {
+		vx = r.ValueOf([]byte(vx.String()))
+	}
+	return r.AppendSlice(vs, vx.Convert(r.SliceOf(vs.Type().Elem()))).Interface()
+}
+
+// fixVariadicCalls rewrites the calls of node to variadic functions that the interpreter gets wrong: append with
+// `...` is given the elements of the slice, or the bytes of the string, and the calls passing nil or untyped
+// constants as variadic arguments, or no variadic argument at all, are made through a function with a fixed
+// number of parameters, so that the interpreter converts the arguments to the type of the variadic parameter and
+// passes a nil slice when there are none. Only the functions and methods of the session and of imported packages
+// are known: those local to functions are left to the interpreter. It returns the replacement of node.
+func fixVariadicCalls(ir *classic.Interp, node ast.Node) ast.Node {
+	if variadicFuncs.ir != ir {
+		variadicFuncs.ir = ir
+		variadicFuncs.names = make(map[variadicKey]string)
+		ir.Env.DefineVar(appendSliceFuncName, r.TypeOf(appendSlice), r.ValueOf(appendSlice))
+	}
+	if !ir.Env.ValueOf(valuesFuncName).IsValid() {
+		return node
+	}
+	declared := declaredNames([]ast.Node{node})
+
+	return rewriteExprs(node, func(expr ast.Expr) ast.Expr {
+		call, ok := expr.(*ast.CallExpr)
+		if !ok {
+			return expr
+		}
+		if call.Ellipsis.IsValid() {
+			ident, ok := call.Fun.(*ast.Ident)
+			if !ok || ident.Name != "append" || declared["append"] || len(call.Args) != 2 {
+				return expr
+			}
+			return &ast.CallExpr{
+				Fun: &ast.Ident{NamePos: call.Pos(), Name: valuesFuncName},
+				Args: []ast.Expr{&ast.CallExpr{
+					Fun:    &ast.Ident{NamePos: call.Pos(), Name: appendSliceFuncName},
+					Args:   call.Args,
+					Rparen: call.Rparen,
+				}},
+				Rparen: call.Rparen,
+			}
+		}
+
+		typ := funcType(ir, call.Fun, declared)
+		if typ == nil || !typ.IsVariadic() || !needsFixedArity(call, typ) {
+			return expr
+		}
+		key := variadicKey{typ, len(call.Args)}
+		name, ok := variadicFuncs.names[key]
+		if !ok {
+			fn := fixedArity(typ, len(call.Args))
+			name = variadicFuncPrefix + strconv.Itoa(len(variadicFuncs.names))
+			ir.Env.DefineVar(name, fn.Type(), fn)
+			variadicFuncs.names[key] = name
+		}
+		call.Fun = &ast.CallExpr{Fun: &ast.Ident{NamePos: call.Pos(), Name: name}, Args: []ast.Expr{call.Fun}}
+		return call
+	})
+}
+
+// funcType returns the type of the function fun refers to, a function or variable of the session, a function
+// of an imported package, or a method of a variable of the session, or nil if it is not known before running
+// node.
+func funcType(ir *classic.Interp, fun ast.Expr, declared map[string]bool) r.Type {
+	var v r.Value
+	switch fun := unparen(fun).(type) {
+	case *ast.Ident:
+		if declared[fun.Name] {
+			return nil
+		}
+		v = ir.Env.ValueOf(fun.Name)
+	case *ast.SelectorExpr:
+		x, ok := fun.X.(*ast.Ident)
+		if !ok || declared[x.Name] {
+			return nil
+		}
+		xv := ir.Env.ValueOf(x.Name)
+		if !xv.IsValid() {
+			return nil
+		}
+		if ref := packageRef(xv); ref != nil {
+			v = ref.Binds[fun.Sel.Name]
+		} else if xv.Type() != nil && sessionType(ir, x, declared) == nil {
+			return methodType(ir, xv.Type(), fun.Sel.Name)
+		}
+	}
+	if !v.IsValid() || v.Kind() != r.Func {
+		return nil
+	}
+	return v.Type()
+}
+
+// needsFixedArity reports whether the call of a function of type typ passes no variadic argument, or passes nil
+// or untyped constants as variadic arguments.
+func needsFixedArity(call *ast.CallExpr, typ r.Type) bool {
+	fixed := typ.NumIn() - 1
+	if len(call.Args) == 1 {
+		// The arguments may be the results of a call.
+		if _, ok := unparen(call.Args[0]).(*ast.CallExpr); ok {
+			return false
+		}
+	}
+	if len(call.Args) <= fixed {
+		return len(call.Args) == fixed
+	}
+	for _, arg := range call.Args[fixed:] {
+		if unary, ok := arg.(*ast.UnaryExpr); ok && (unary.Op == token.SUB || unary.Op == token.ADD) {
+			arg = unary.X
+		}
+		switch arg := unparen(arg).(type) {
+		case *ast.BasicLit:
+			return true
+		case *ast.Ident:
+			if arg.Name == "nil" || arg.Name == "true" || arg.Name == "false" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fixedArity returns a function turning a variadic function of type typ into one taking n arguments, with the
+// type of the variadic parameter for those beyond the fixed ones.
+func fixedArity(typ r.Type, n int) r.Value {
+	fixed := typ.NumIn() - 1
+	elem := typ.In(fixed).Elem()
+	var in, out []r.Type
+	for i := 0; i < n; i++ {
+		if i < fixed {
+			in = append(in, typ.In(i))
+		} else {
+			in = append(in, elem)
+		}
+	}
+	for i := 0; i < typ.NumOut(); i++ {
+		out = append(out, typ.Out(i))
+	}
+	fixedType := r.FuncOf(in, out, false)
+	return r.MakeFunc(r.FuncOf([]r.Type{typ}, []r.Type{fixedType}, false), func(args []r.Value) []r.Value {
+		fn := args[0]
+		return []r.Value{r.MakeFunc(fixedType, func(args []r.Value) []r.Value {
+			// Like in compiled Go, no variadic argument gives a nil slice.
+			rest := r.Zero(typ.In(fixed))
+			if n > fixed {
+				rest = r.MakeSlice(typ.In(fixed), 0, n-fixed)
+				rest = r.Append(rest, args[fixed:]...)
+			}
+			return fn.CallSlice(append(args[:fixed:fixed], rest))
+		})}
+	})
+}
+
+// fixVariadicMethods fixes the variadic methods declared by the cells, which the interpreter calls with the
+// slice of the variadic arguments as a single variadic argument: they are replaced with functions taking that
+// slice as last parameter.
+func fixVariadicMethods(ir *classic.Interp) {
+	for _, methods := range ir.Env.AllMethods {
+		for name, method := range methods {
+			// The function of a method is in an unexported field.
+			field := unexportedField(r.ValueOf(&method).Elem(), "val", r.TypeOf(r.Value{}))
+			orig := field.Interface().(r.Value)
+			typ := orig.Type()
+			if !typ.IsVariadic() {
+				continue
+			}
+			var in, out []r.Type
+			for i := 0; i < typ.NumIn(); i++ {
+				in = append(in, typ.In(i))
+			}
+			for i := 0; i < typ.NumOut(); i++ {
+				out = append(out, typ.Out(i))
+			}
+			field.Set(r.ValueOf(r.MakeFunc(r.FuncOf(in, out, false), func(args []r.Value) []r.Value {
+				return orig.CallSlice(args)
+			})))
+			methods[name] = method
+		}
+	}
+}